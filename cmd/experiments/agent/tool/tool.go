@@ -102,7 +102,7 @@ var ToolCallCmd = &cobra.Command{
 			Settings: stepSettings,
 			Tools: []go_openai.Tool{{
 				Type: "function",
-				Function: go_openai.FunctionDefinition{
+				Function: &go_openai.FunctionDefinition{
 					Name:        "getWeather",
 					Description: "Get the weather",
 					Parameters:  getWeatherJsonSchema,
@@ -110,7 +110,7 @@ var ToolCallCmd = &cobra.Command{
 			},
 				{
 					Type: "function",
-					Function: go_openai.FunctionDefinition{
+					Function: &go_openai.FunctionDefinition{
 						Name:        "getWeatherOnDay",
 						Description: "Get the weather on a specific day",
 						Parameters:  getWeatherOnDayJsonSchema,
@@ -15,6 +15,7 @@ type WeatherRequest struct {
 	Temperature bool `json:"temperature"`
 }
 
+// getWeather returns the current weather in a city.
 func getWeather(request WeatherRequest) WeatherData {
 	return WeatherData{
 		City:        request.City,
@@ -29,6 +30,7 @@ type WeatherOnDayRequest struct {
 	Date string `json:"date"`
 }
 
+// getWeatherOnDay returns the weather in a city on a given date.
 func getWeatherOnDay(request WeatherOnDayRequest) WeatherData {
 	return WeatherData{
 		City:        request.City,
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestToolDescriptions(t *testing.T) {
+	reflector := tools.NewReflector()
+	err := reflector.AddGoComments("github.com/go-go-golems/geppetto/cmd/experiments/tool-ui", ".")
+	require.NoError(t, err)
+
+	// the binary sees the functions as main.<name>, the test binary under their import path
+	doc, ok := reflector.Functions["main.getWeather"]
+	require.True(t, ok)
+	assert.Equal(t, "getWeather returns the current weather in a city.", doc.Description)
+
+	tool, err := tools.NewFunctionTool(reflector, "getWeather", getWeather)
+	require.NoError(t, err)
+	assert.Equal(t, "getWeather returns the current weather in a city.", tool.GetDescription())
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(tool.GetParameters(), &schema))
+	assert.Contains(t, schema["properties"], "city")
+}
@@ -12,13 +12,13 @@ import (
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/openai"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
 	"github.com/go-go-golems/geppetto/pkg/ui"
 	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	glazed_settings "github.com/go-go-golems/glazed/pkg/settings"
-	"github.com/invopop/jsonschema"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -29,7 +29,7 @@ type ToolUiCommand struct {
 	*glazed_cmds.CommandDescription
 	stepSettings *settings.StepSettings
 	manager      conversation.Manager
-	reflector    *jsonschema.Reflector
+	reflector    *tools.Reflector
 	chatToolStep *openai.ChatToolStep
 	eventRouter  *events.EventRouter
 }
@@ -168,9 +168,7 @@ func (t *ToolUiCommand) Init(parsedLayers *layers.ParsedLayers) error {
 		return err
 	}
 
-	t.reflector = &jsonschema.Reflector{
-		DoNotReference: true,
-	}
+	t.reflector = tools.NewReflector()
 	err = t.reflector.AddGoComments("github.com/go-go-golems/geppetto", "./cmd/experiments/tool-ui")
 	if err != nil {
 		log.Warn().Err(err).Msg("Could not add go comments")
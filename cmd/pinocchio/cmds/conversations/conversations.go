@@ -0,0 +1,66 @@
+package conversations
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/spf13/cobra"
+)
+
+func newConversationsDirFlag() *parameters.ParameterDefinition {
+	return parameters.NewParameterDefinition(
+		"conversations-dir",
+		parameters.ParameterTypeString,
+		parameters.WithHelp("Directory where conversations are stored (default: ~/.local/share/pinocchio/conversations)"),
+	)
+}
+
+// RegisterCommands adds the conversations command group.
+func RegisterCommands(rootCmd *cobra.Command) error {
+	conversationsCmd := &cobra.Command{
+		Use:   "conversations",
+		Short: "Commands related to stored conversations",
+	}
+
+	listCmdInstance, err := NewListCommand()
+	if err != nil {
+		return err
+	}
+	listCommand, err := cli.BuildCobraCommandFromGlazeCommand(listCmdInstance)
+	if err != nil {
+		return err
+	}
+	conversationsCmd.AddCommand(listCommand)
+
+	showCmdInstance, err := NewShowCommand()
+	if err != nil {
+		return err
+	}
+	showCommand, err := cli.BuildCobraCommandFromGlazeCommand(showCmdInstance)
+	if err != nil {
+		return err
+	}
+	conversationsCmd.AddCommand(showCommand)
+
+	removeCmdInstance, err := NewRemoveCommand()
+	if err != nil {
+		return err
+	}
+	removeCommand, err := cli.BuildCobraCommandFromBareCommand(removeCmdInstance)
+	if err != nil {
+		return err
+	}
+	conversationsCmd.AddCommand(removeCommand)
+
+	exportCmdInstance, err := NewExportCommand()
+	if err != nil {
+		return err
+	}
+	exportCommand, err := cli.BuildCobraCommandFromWriterCommand(exportCmdInstance)
+	if err != nil {
+		return err
+	}
+	conversationsCmd.AddCommand(exportCommand)
+
+	rootCmd.AddCommand(conversationsCmd)
+	return nil
+}
@@ -0,0 +1,110 @@
+package conversations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+type ExportCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.WriterCommand = (*ExportCommand)(nil)
+
+func NewExportCommand() (*ExportCommand, error) {
+	return &ExportCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"export",
+			glazed_cmds.WithShort("Export a stored conversation"),
+			glazed_cmds.WithLong("Export the messages of a stored conversation, from the first message to the last one. "+
+				"The json format can be passed back to --message-file."),
+			glazed_cmds.WithFlags(
+				newConversationsDirFlag(),
+				parameters.NewParameterDefinition(
+					"format",
+					parameters.ParameterTypeChoice,
+					parameters.WithHelp("Export format"),
+					parameters.WithChoices("json", "markdown"),
+					parameters.WithDefault("json"),
+				),
+			),
+			glazed_cmds.WithArguments(
+				parameters.NewParameterDefinition(
+					"id",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("ID, or unique ID prefix, of the conversation"),
+					parameters.WithRequired(true),
+				),
+			),
+		),
+	}, nil
+}
+
+type ExportSettings struct {
+	ConversationsDir string `glazed.parameter:"conversations-dir"`
+	Format           string `glazed.parameter:"format"`
+	ID               string `glazed.parameter:"id"`
+}
+
+func (c *ExportCommand) RunIntoWriter(
+	ctx context.Context,
+	parsedLayers *layers.ParsedLayers,
+	w io.Writer,
+) error {
+	s := &ExportSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	store, err := conversations.NewStore(s.ConversationsDir)
+	if err != nil {
+		return err
+	}
+	conversation_, err := store.Load(s.ID)
+	if err != nil {
+		return err
+	}
+	thread := conversation_.Thread()
+
+	switch s.Format {
+	case "json":
+		messages := make([]*conversation.Message, len(thread))
+		for i, msg := range thread {
+			messages[i] = conversation.NewChatMessage(msg.Role, msg.Text,
+				conversation.WithID(msg.ID),
+				conversation.WithParentID(msg.ParentID),
+				conversation.WithTime(msg.Time),
+				conversation.WithMetadata(msg.Metadata),
+			)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(messages)
+
+	case "markdown":
+		_, err = fmt.Fprintf(w, "# %s\n", conversation_.Name)
+		if err != nil {
+			return err
+		}
+		for _, msg := range thread {
+			_, err = fmt.Fprintf(w, "\n## %s\n\n%s\n", msg.Role, strings.TrimRight(msg.Text, "\n"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return errors.Errorf("unknown format %s", s.Format)
+	}
+}
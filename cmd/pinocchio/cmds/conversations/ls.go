@@ -0,0 +1,93 @@
+package conversations
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"strings"
+)
+
+type ListCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.GlazeCommand = (*ListCommand)(nil)
+
+func NewListCommand() (*ListCommand, error) {
+	glazedLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, err
+	}
+	return &ListCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"ls",
+			glazed_cmds.WithShort("List stored conversations"),
+			glazed_cmds.WithFlags(newConversationsDirFlag()),
+			glazed_cmds.WithLayersList(glazedLayer),
+		),
+	}, nil
+}
+
+type ListSettings struct {
+	ConversationsDir string `glazed.parameter:"conversations-dir"`
+}
+
+func (c *ListCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedLayers *layers.ParsedLayers,
+	gp middlewares.Processor,
+) error {
+	s := &ListSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	store, err := conversations.NewStore(s.ConversationsDir)
+	if err != nil {
+		return err
+	}
+	conversations_, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	for _, conversation_ := range conversations_ {
+		lastMessage := ""
+		thread := conversation_.Thread()
+		if len(thread) > 0 {
+			lastMessage = summarize(thread[len(thread)-1].Text, 60)
+		}
+		row := types.NewRow(
+			types.MRP("id", conversation_.ID),
+			types.MRP("name", conversation_.Name),
+			types.MRP("created_at", conversation_.CreatedAt),
+			types.MRP("updated_at", conversation_.UpdatedAt),
+			types.MRP("messages", len(thread)),
+			types.MRP("nodes", len(conversation_.Messages)),
+			types.MRP("last_message", lastMessage),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// summarize returns the first line of s, shortened to length runes.
+func summarize(s string, length int) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + " …"
+	}
+	runes := []rune(s)
+	if len(runes) > length {
+		return string(runes[:length]) + "…"
+	}
+	return s
+}
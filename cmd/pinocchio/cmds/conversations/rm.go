@@ -0,0 +1,70 @@
+package conversations
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+)
+
+type RemoveCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.BareCommand = (*RemoveCommand)(nil)
+
+func NewRemoveCommand() (*RemoveCommand, error) {
+	return &RemoveCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"rm",
+			glazed_cmds.WithShort("Delete stored conversations"),
+			glazed_cmds.WithFlags(newConversationsDirFlag()),
+			glazed_cmds.WithArguments(
+				parameters.NewParameterDefinition(
+					"ids",
+					parameters.ParameterTypeStringList,
+					parameters.WithHelp("IDs, or unique ID prefixes, of the conversations to delete"),
+					parameters.WithRequired(true),
+				),
+			),
+		),
+	}, nil
+}
+
+type RemoveSettings struct {
+	ConversationsDir string   `glazed.parameter:"conversations-dir"`
+	IDs              []string `glazed.parameter:"ids"`
+}
+
+func (c *RemoveCommand) Run(ctx context.Context, parsedLayers *layers.ParsedLayers) error {
+	s := &RemoveSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	store, err := conversations.NewStore(s.ConversationsDir)
+	if err != nil {
+		return err
+	}
+
+	// resolve all the IDs first, so that nothing is deleted if one of them is wrong
+	ids := make([]string, len(s.IDs))
+	for i, id := range s.IDs {
+		ids[i], err = store.Resolve(id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		err = store.Delete(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted conversation %s\n", id)
+	}
+
+	return nil
+}
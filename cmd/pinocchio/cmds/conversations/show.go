@@ -0,0 +1,103 @@
+package conversations
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/google/uuid"
+)
+
+type ShowCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.GlazeCommand = (*ShowCommand)(nil)
+
+func NewShowCommand() (*ShowCommand, error) {
+	glazedLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, err
+	}
+	return &ShowCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"show",
+			glazed_cmds.WithShort("Show the messages of a stored conversation"),
+			glazed_cmds.WithLong("Show the messages of a stored conversation, from the first message "+
+				"to the last one. --all shows all the messages of the conversation tree, including other branches."),
+			glazed_cmds.WithFlags(
+				newConversationsDirFlag(),
+				parameters.NewParameterDefinition(
+					"all",
+					parameters.ParameterTypeBool,
+					parameters.WithHelp("Show all the messages of the conversation tree"),
+					parameters.WithDefault(false),
+				),
+			),
+			glazed_cmds.WithArguments(
+				parameters.NewParameterDefinition(
+					"id",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("ID, or unique ID prefix, of the conversation"),
+					parameters.WithRequired(true),
+				),
+			),
+			glazed_cmds.WithLayersList(glazedLayer),
+		),
+	}, nil
+}
+
+type ShowSettings struct {
+	ConversationsDir string `glazed.parameter:"conversations-dir"`
+	All              bool   `glazed.parameter:"all"`
+	ID               string `glazed.parameter:"id"`
+}
+
+func (c *ShowCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedLayers *layers.ParsedLayers,
+	gp middlewares.Processor,
+) error {
+	s := &ShowSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	store, err := conversations.NewStore(s.ConversationsDir)
+	if err != nil {
+		return err
+	}
+	conversation_, err := store.Load(s.ID)
+	if err != nil {
+		return err
+	}
+
+	messages := conversation_.Thread()
+	if s.All {
+		messages = conversation_.Messages
+	}
+
+	for _, msg := range messages {
+		parentID := ""
+		if uuid.UUID(msg.ParentID) != uuid.Nil {
+			parentID = uuid.UUID(msg.ParentID).String()
+		}
+		row := types.NewRow(
+			types.MRP("id", uuid.UUID(msg.ID).String()),
+			types.MRP("parent_id", parentID),
+			types.MRP("time", msg.Time),
+			types.MRP("role", string(msg.Role)),
+			types.MRP("text", msg.Text),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package mcp
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cli"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/spf13/cobra"
+)
+
+// RegisterCommands adds the mcp command group. The given commands are the ones served by mcp serve.
+func RegisterCommands(rootCmd *cobra.Command, commands []glazed_cmds.Command) error {
+	mcpCmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Model Context Protocol commands",
+	}
+
+	serveCmdInstance, err := NewServeCommand(commands)
+	if err != nil {
+		return err
+	}
+	serveCommand, err := cli.BuildCobraCommandFromBareCommand(serveCmdInstance)
+	if err != nil {
+		return err
+	}
+	mcpCmd.AddCommand(serveCommand)
+
+	rootCmd.AddCommand(mcpCmd)
+	return nil
+}
@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/mcp"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/rs/zerolog/log"
+	"os"
+)
+
+type ServeCommand struct {
+	*glazed_cmds.CommandDescription
+	commands []glazed_cmds.Command
+}
+
+var _ glazed_cmds.BareCommand = (*ServeCommand)(nil)
+
+func NewServeCommand(commands []glazed_cmds.Command) (*ServeCommand, error) {
+	return &ServeCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"serve",
+			glazed_cmds.WithShort("Serve the pinocchio commands as MCP tools and prompts over stdio"),
+			glazed_cmds.WithLong(`Run a Model Context Protocol server on stdin and stdout.
+
+Every loaded pinocchio command is offered as a tool, taking the flags and arguments
+of the command, and running it when called. Commands are also offered as prompts,
+which render the messages of the command without running it.
+
+The --profile and --profile-file flags select the profile used to run the commands.`),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"no-tools",
+					parameters.ParameterTypeBool,
+					parameters.WithHelp("Don't offer the commands as tools"),
+					parameters.WithDefault(false),
+				),
+				parameters.NewParameterDefinition(
+					"no-prompts",
+					parameters.ParameterTypeBool,
+					parameters.WithHelp("Don't offer the commands as prompts"),
+					parameters.WithDefault(false),
+				),
+				parameters.NewParameterDefinition(
+					"commands",
+					parameters.ParameterTypeStringList,
+					parameters.WithHelp("Only serve the commands with these tool names (parents and name joined with _)"),
+				),
+			),
+		),
+		commands: commands,
+	}, nil
+}
+
+type ServeSettings struct {
+	NoTools   bool     `glazed.parameter:"no-tools"`
+	NoPrompts bool     `glazed.parameter:"no-prompts"`
+	Commands  []string `glazed.parameter:"commands"`
+}
+
+func (c *ServeCommand) Run(ctx context.Context, parsedLayers *layers.ParsedLayers) error {
+	s := &ServeSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	commandSettings := &cli.GlazedCommandSettings{}
+	if glazedCommandLayer, ok := parsedLayers.Get(cli.GlazedCommandSlug); ok {
+		err = glazedCommandLayer.InitializeStruct(commandSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	selected := map[string]bool{}
+	for _, name := range s.Commands {
+		selected[name] = true
+	}
+
+	tools_ := []tools.Tool{}
+	prompts := []*mcp.ServerPrompt{}
+	for _, command := range c.commands {
+		geppettoCommand, ok := command.(*cmds.GeppettoCommand)
+		if !ok {
+			continue
+		}
+		name := cmds.GetCommandToolName(geppettoCommand)
+		if len(selected) > 0 && !selected[name] {
+			continue
+		}
+
+		if !s.NoTools {
+			tools_ = append(tools_, cmds.NewGeppettoCommandTool(
+				geppettoCommand,
+				cmds.WithCommandToolProfile(commandSettings.ProfileFile, commandSettings.Profile),
+			))
+		}
+		if !s.NoPrompts {
+			prompts = append(prompts, cmds.NewGeppettoCommandPrompt(
+				geppettoCommand,
+				commandSettings.ProfileFile, commandSettings.Profile,
+			))
+		}
+	}
+
+	log.Info().Int("tools", len(tools_)).Int("prompts", len(prompts)).Msg("Serving MCP")
+
+	server := mcp.NewServer(
+		mcp.WithServerInfo("pinocchio", "0.1.0"),
+		mcp.WithTools(tools_...),
+		mcp.WithPrompts(prompts...),
+	)
+
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/metrics"
+	"github.com/go-go-golems/geppetto/pkg/proxy"
+	"github.com/go-go-golems/geppetto/pkg/steps/checkpoint"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"net/http"
+	"time"
+)
+
+type ProxyCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.BareCommand = (*ProxyCommand)(nil)
+
+func NewProxyCommand() (*ProxyCommand, error) {
+	return &ProxyCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"proxy",
+			glazed_cmds.WithShort("Serve an OpenAI-compatible API answering with the pinocchio profiles"),
+			glazed_cmds.WithLong(`Run an HTTP server implementing the OpenAI /v1/chat/completions and /v1/models endpoints,
+so that tools built on the OpenAI SDKs can use any provider configured in the pinocchio profiles.
+
+Every profile of the profile file is offered as a model named after the profile, unless a
+--models file maps model names to profiles and engines. See "pinocchio help proxy".
+
+The server has no authentication, only expose it to trusted clients.`),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"addr",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Address to listen on"),
+					parameters.WithDefault("localhost:8080"),
+				),
+				parameters.NewParameterDefinition(
+					"models",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("YAML file mapping the model names to profiles, engines and prices"),
+				),
+				parameters.NewParameterDefinition(
+					"cache-dir",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Directory where completions are cached, to answer identical requests without calling the provider"),
+				),
+				parameters.NewParameterDefinition(
+					"metrics",
+					parameters.ParameterTypeBool,
+					parameters.WithHelp("Serve the Prometheus metrics of the requests on /metrics"),
+					parameters.WithDefault(false),
+				),
+			),
+		),
+	}, nil
+}
+
+type ProxySettings struct {
+	Addr     string `glazed.parameter:"addr"`
+	Models   string `glazed.parameter:"models"`
+	CacheDir string `glazed.parameter:"cache-dir"`
+	Metrics  bool   `glazed.parameter:"metrics"`
+}
+
+func (c *ProxyCommand) Run(ctx context.Context, parsedLayers *layers.ParsedLayers) error {
+	s := &ProxySettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	commandSettings := &cli.GlazedCommandSettings{}
+	if glazedCommandLayer, ok := parsedLayers.Get(cli.GlazedCommandSlug); ok {
+		err = glazedCommandLayer.InitializeStruct(commandSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	var models []*proxy.Model
+	if s.Models != "" {
+		models, err = proxy.LoadModels(s.Models)
+	} else {
+		models, err = proxy.ModelsFromProfiles(commandSettings.ProfileFile)
+	}
+	if err != nil {
+		return err
+	}
+	if len(models) == 0 {
+		return errors.New("no models to serve, add profiles to the profile file or pass a --models file")
+	}
+
+	options := []proxy.ServerOption{
+		proxy.WithProfileFile(commandSettings.ProfileFile),
+	}
+	if s.CacheDir != "" {
+		store, err := checkpoint.NewFileStore(s.CacheDir)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = store.Close()
+		}()
+		options = append(options, proxy.WithCache(store))
+	}
+	if s.Metrics {
+		collector, err := metrics.NewCollector()
+		if err != nil {
+			return err
+		}
+		options = append(options, proxy.WithMetrics(collector))
+	}
+
+	server, err := proxy.NewServer(models, options...)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Addr:              s.Addr,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Info().Str("addr", s.Addr).Int("models", len(models)).Msg("Serving OpenAI-compatible API")
+	err = httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func RegisterCommands(rootCmd *cobra.Command) error {
+	proxyCmdInstance, err := NewProxyCommand()
+	if err != nil {
+		return err
+	}
+	proxyCommand, err := cli.BuildCobraCommandFromBareCommand(proxyCmdInstance)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(proxyCommand)
+	return nil
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/go-go-golems/geppetto/pkg/rpc"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+type RPCCommand struct {
+	*glazed_cmds.CommandDescription
+	commands []glazed_cmds.Command
+}
+
+var _ glazed_cmds.BareCommand = (*RPCCommand)(nil)
+
+func NewRPCCommand(commands []glazed_cmds.Command) (*RPCCommand, error) {
+	return &RPCCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"rpc",
+			glazed_cmds.WithShort("Run the pinocchio commands and chats for a JSON-RPC 2.0 client over stdio"),
+			glazed_cmds.WithLong(`Answer JSON-RPC 2.0 requests read from stdin, one message per line, on stdout.
+
+The client can list the loaded commands with their parameter layers, run them, and start,
+continue and cancel chats. The events of the completions are sent as notifications while
+they stream. See "pinocchio help rpc" for the methods.
+
+The --profile and --profile-file flags select the profile used when a request doesn't select one.`),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"conversations-dir",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Directory where chats are stored (default: ~/.local/share/pinocchio/conversations)"),
+				),
+				parameters.NewParameterDefinition(
+					"no-store",
+					parameters.ParameterTypeBool,
+					parameters.WithHelp("Don't store the chats"),
+					parameters.WithDefault(false),
+				),
+			),
+		),
+		commands: commands,
+	}, nil
+}
+
+type RPCSettings struct {
+	ConversationsDir string `glazed.parameter:"conversations-dir"`
+	NoStore          bool   `glazed.parameter:"no-store"`
+}
+
+func (c *RPCCommand) Run(ctx context.Context, parsedLayers *layers.ParsedLayers) error {
+	s := &RPCSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	commandSettings := &cli.GlazedCommandSettings{}
+	if glazedCommandLayer, ok := parsedLayers.Get(cli.GlazedCommandSlug); ok {
+		err = glazedCommandLayer.InitializeStruct(commandSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	geppettoCommands := []*cmds.GeppettoCommand{}
+	for _, command := range c.commands {
+		if geppettoCommand, ok := command.(*cmds.GeppettoCommand); ok {
+			geppettoCommands = append(geppettoCommands, geppettoCommand)
+		}
+	}
+
+	options := []rpc.ServerOption{
+		rpc.WithProfile(commandSettings.ProfileFile, commandSettings.Profile),
+	}
+	if !s.NoStore {
+		store, err := conversations.NewStore(s.ConversationsDir)
+		if err != nil {
+			return err
+		}
+		options = append(options, rpc.WithConversationStore(store))
+	}
+
+	log.Info().Int("commands", len(geppettoCommands)).Msg("Serving JSON-RPC")
+
+	server := rpc.NewServer(geppettoCommands, options...)
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// RegisterCommands adds the rpc command. The given commands are the ones the client can run.
+func RegisterCommands(rootCmd *cobra.Command, commands []glazed_cmds.Command) error {
+	rpcCmdInstance, err := NewRPCCommand(commands)
+	if err != nil {
+		return err
+	}
+	rpcCommand, err := cli.BuildCobraCommandFromBareCommand(rpcCmdInstance)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(rpcCommand)
+	return nil
+}
@@ -0,0 +1,88 @@
+package runs
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"strings"
+)
+
+type ListCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.GlazeCommand = (*ListCommand)(nil)
+
+func NewListCommand() (*ListCommand, error) {
+	glazedLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, err
+	}
+	return &ListCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"ls",
+			glazed_cmds.WithShort("List recorded runs"),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"runs-dir",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Directory of the recorded runs (default: ~/.local/share/pinocchio/runs)"),
+				),
+			),
+			glazed_cmds.WithLayersList(glazedLayer),
+		),
+	}, nil
+}
+
+type ListSettings struct {
+	RunsDir string `glazed.parameter:"runs-dir"`
+}
+
+func (c *ListCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedLayers *layers.ParsedLayers,
+	gp middlewares.Processor,
+) error {
+	s := &ListSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	runsDir := s.RunsDir
+	if runsDir == "" {
+		runsDir, err = cmds.DefaultRunsDir()
+		if err != nil {
+			return err
+		}
+	}
+
+	runs, err := cmds.ListRuns(runsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		row := types.NewRow(
+			types.MRP("id", run.ID),
+			types.MRP("name", run.Name),
+			types.MRP("started_at", run.StartedAt),
+			types.MRP("duration", run.EndedAt.Sub(run.StartedAt).String()),
+			types.MRP("engine", run.Engine),
+			types.MRP("steps", strings.Join(run.StepTypes, ",")),
+			types.MRP("events", run.Events),
+			types.MRP("errors", run.Errors),
+			types.MRP("path", run.Path),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package runs
+
+import (
+	"context"
+	"fmt"
+	"github.com/ThreeDotsLabs/watermill/message"
+	tea "github.com/charmbracelet/bubbletea"
+	bobatea_chat "github.com/go-go-golems/bobatea/pkg/chat"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/ui"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+)
+
+type ReplayCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.WriterCommand = (*ReplayCommand)(nil)
+
+func NewReplayCommand() (*ReplayCommand, error) {
+	return &ReplayCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"replay",
+			cmds.WithShort("Replay a recorded run"),
+			cmds.WithLong("Replay the events of a run recorded with the event log, "+
+				"as they were originally rendered."),
+			cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"speed",
+					parameters.ParameterTypeFloat,
+					parameters.WithHelp("Replay speed, relative to the original run. 0 replays without delay"),
+					parameters.WithDefault(1.0),
+				),
+				parameters.NewParameterDefinition(
+					"tui",
+					parameters.ParameterTypeBool,
+					parameters.WithHelp("Replay the run in the chat UI"),
+					parameters.WithDefault(false),
+				),
+			),
+			cmds.WithArguments(
+				parameters.NewParameterDefinition(
+					"file",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Event log of the run"),
+					parameters.WithRequired(true),
+				),
+			),
+		),
+	}, nil
+}
+
+type ReplaySettings struct {
+	Speed float64 `glazed.parameter:"speed"`
+	TUI   bool    `glazed.parameter:"tui"`
+	File  string  `glazed.parameter:"file"`
+}
+
+func (c *ReplayCommand) RunIntoWriter(
+	ctx context.Context,
+	parsedLayers *layers.ParsedLayers,
+	w io.Writer,
+) error {
+	s := &ReplaySettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	entries, err := events.ReadEventLog(s.File)
+	if err != nil {
+		return err
+	}
+
+	if s.TUI {
+		return replayInTUI(ctx, entries, s.Speed)
+	}
+
+	printer := chat.StepPrinterFunc("", w)
+	return events.Replay(ctx, entries, s.Speed, func(topic string, msg *message.Message) error {
+		err := printer(msg)
+		var eventError *chat.EventError
+		if errors.As(err, &eventError) {
+			// errors are part of the recorded run, keep on replaying
+			_, err = fmt.Fprintf(w, "\nError: %s\n", eventError.Error())
+		}
+		return err
+	})
+}
+
+// replayBackend is a read-only backend, the conversation is driven by the recorded events.
+type replayBackend struct{}
+
+var _ bobatea_chat.Backend = (*replayBackend)(nil)
+
+func (r *replayBackend) Start(ctx context.Context, msgs []*conversation.Message) (tea.Cmd, error) {
+	return nil, errors.New("cannot continue a replayed run")
+}
+
+func (r *replayBackend) Interrupt() {}
+
+func (r *replayBackend) Kill() {}
+
+func (r *replayBackend) IsFinished() bool {
+	return true
+}
+
+func replayInTUI(ctx context.Context, entries []*events.LogEntry, speed float64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	options := []tea.ProgramOption{
+		tea.WithMouseCellMotion(),
+	}
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		options = append(options, tea.WithOutput(os.Stderr))
+	} else {
+		options = append(options, tea.WithAltScreen())
+	}
+
+	model := bobatea_chat.InitialModel(
+		conversation.NewManager(),
+		&replayBackend{},
+		bobatea_chat.WithTitle("PINOCCHIO REPLAY:"),
+	)
+	p := tea.NewProgram(model, options...)
+
+	forward := ui.StepChatForwardFunc(p)
+	go func() {
+		err := events.Replay(ctx, entries, speed, func(topic string, msg *message.Message) error {
+			return forward(msg)
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Error().Err(err).Msg("could not replay run")
+		}
+	}()
+
+	_, err := p.Run()
+	return err
+}
@@ -0,0 +1,118 @@
+package runs
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RemoveCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.BareCommand = (*RemoveCommand)(nil)
+
+func NewRemoveCommand() (*RemoveCommand, error) {
+	return &RemoveCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"rm",
+			glazed_cmds.WithShort("Delete recorded runs and their checkpoints"),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"runs-dir",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Directory of the recorded runs (default: ~/.local/share/pinocchio/runs)"),
+				),
+				parameters.NewParameterDefinition(
+					"older-than",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Delete the runs started longer ago than this, for example 30d or 12h"),
+				),
+			),
+			glazed_cmds.WithArguments(
+				parameters.NewParameterDefinition(
+					"ids",
+					parameters.ParameterTypeStringList,
+					parameters.WithHelp("IDs of the runs to delete, as listed by runs ls"),
+				),
+			),
+		),
+	}, nil
+}
+
+type RemoveSettings struct {
+	RunsDir   string   `glazed.parameter:"runs-dir"`
+	OlderThan string   `glazed.parameter:"older-than"`
+	IDs       []string `glazed.parameter:"ids"`
+}
+
+func (c *RemoveCommand) Run(ctx context.Context, parsedLayers *layers.ParsedLayers) error {
+	s := &RemoveSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+	if len(s.IDs) == 0 && s.OlderThan == "" {
+		return errors.New("no run IDs or --older-than given")
+	}
+
+	runsDir := s.RunsDir
+	if runsDir == "" {
+		runsDir, err = cmds.DefaultRunsDir()
+		if err != nil {
+			return err
+		}
+	}
+
+	ids := s.IDs
+	if s.OlderThan != "" {
+		age, err := parseAge(s.OlderThan)
+		if err != nil {
+			return err
+		}
+		runs, err := cmds.ListRuns(runsDir)
+		if err != nil {
+			return err
+		}
+		before := time.Now().Add(-age)
+		for _, run := range runs {
+			if run.StartedAt.Before(before) && !slices.Contains(ids, run.ID) {
+				ids = append(ids, run.ID)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		err = cmds.RemoveRun(runsDir, id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted run %s\n", id)
+	}
+
+	return nil
+}
+
+// parseAge parses a duration, which can also be given in days, like 30d.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errors.Errorf("invalid age %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	ret, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid age %s", s)
+	}
+	return ret, nil
+}
@@ -0,0 +1,57 @@
+package runs
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/spf13/cobra"
+)
+
+// RegisterCommands adds the replay and trace commands and the runs command group.
+func RegisterCommands(rootCmd *cobra.Command) error {
+	replayCmdInstance, err := NewReplayCommand()
+	if err != nil {
+		return err
+	}
+	replayCommand, err := cli.BuildCobraCommandFromWriterCommand(replayCmdInstance)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(replayCommand)
+
+	traceCmdInstance, err := NewTraceCommand()
+	if err != nil {
+		return err
+	}
+	traceCommand, err := cli.BuildCobraCommandFromGlazeCommand(traceCmdInstance)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(traceCommand)
+
+	runsCmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Commands related to recorded runs",
+	}
+
+	listCmdInstance, err := NewListCommand()
+	if err != nil {
+		return err
+	}
+	listCommand, err := cli.BuildCobraCommandFromGlazeCommand(listCmdInstance)
+	if err != nil {
+		return err
+	}
+	runsCmd.AddCommand(listCommand)
+
+	removeCmdInstance, err := NewRemoveCommand()
+	if err != nil {
+		return err
+	}
+	removeCommand, err := cli.BuildCobraCommandFromBareCommand(removeCmdInstance)
+	if err != nil {
+		return err
+	}
+	runsCmd.AddCommand(removeCommand)
+
+	rootCmd.AddCommand(runsCmd)
+	return nil
+}
@@ -0,0 +1,110 @@
+package runs
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/google/uuid"
+	"os"
+	"strings"
+)
+
+type TraceCommand struct {
+	*glazed_cmds.CommandDescription
+}
+
+var _ glazed_cmds.GlazeCommand = (*TraceCommand)(nil)
+
+func NewTraceCommand() (*TraceCommand, error) {
+	glazedLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, err
+	}
+	return &TraceCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"trace",
+			glazed_cmds.WithShort("Show the tree of steps of a recorded run"),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"tree",
+					parameters.ParameterTypeBool,
+					parameters.WithHelp("Print the steps as an indented tree instead of rows"),
+					parameters.WithDefault(false),
+				),
+			),
+			glazed_cmds.WithArguments(
+				parameters.NewParameterDefinition(
+					"file",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Event log of the run"),
+					parameters.WithRequired(true),
+				),
+			),
+			glazed_cmds.WithLayersList(glazedLayer),
+		),
+	}, nil
+}
+
+type TraceSettings struct {
+	Tree bool   `glazed.parameter:"tree"`
+	File string `glazed.parameter:"file"`
+}
+
+func (c *TraceCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedLayers *layers.ParsedLayers,
+	gp middlewares.Processor,
+) error {
+	s := &TraceSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	entries, err := events.ReadEventLog(s.File)
+	if err != nil {
+		return err
+	}
+	roots := cmds.BuildStepTree(entries)
+
+	if s.Tree {
+		return cmds.PrintStepTree(os.Stdout, roots)
+	}
+
+	for _, root := range roots {
+		err = root.Walk(0, func(node *cmds.StepNode, depth int) error {
+			parentStepID := ""
+			if node.ParentStepID != uuid.Nil {
+				parentStepID = node.ParentStepID.String()
+			}
+			inputTokens, outputTokens := 0, 0
+			if node.Usage != nil {
+				inputTokens, outputTokens = node.Usage.InputTokens, node.Usage.OutputTokens
+			}
+			row := types.NewRow(
+				types.MRP("step", strings.Repeat("  ", depth)+node.Name()),
+				types.MRP("step_id", node.StepID.String()),
+				types.MRP("parent_step_id", parentStepID),
+				types.MRP("depth", depth),
+				types.MRP("started_at", node.StartedAt),
+				types.MRP("duration", node.Duration().String()),
+				types.MRP("input_tokens", inputTokens),
+				types.MRP("output_tokens", outputTokens),
+				types.MRP("events", node.Events),
+				types.MRP("errors", strings.Join(node.Errors, "; ")),
+			)
+			return gp.AddRow(ctx, row)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
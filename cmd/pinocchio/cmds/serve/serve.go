@@ -0,0 +1,113 @@
+package serve
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/server"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"net/http"
+	"time"
+)
+
+type ServeCommand struct {
+	*glazed_cmds.CommandDescription
+	commands []glazed_cmds.Command
+}
+
+var _ glazed_cmds.BareCommand = (*ServeCommand)(nil)
+
+func NewServeCommand(commands []glazed_cmds.Command) (*ServeCommand, error) {
+	return &ServeCommand{
+		CommandDescription: glazed_cmds.NewCommandDescription(
+			"serve",
+			glazed_cmds.WithShort("Serve the pinocchio commands over HTTP"),
+			glazed_cmds.WithLong(`Run an HTTP server exposing every loaded pinocchio command.
+
+GET /commands lists the commands with the JSON schemas of their parameter layers.
+POST /commands/<path> runs a command, for example POST /commands/code/go, and returns
+its output, or streams its chat events as Server-Sent Events. See "pinocchio help serve".
+
+The --profile and --profile-file flags select the profile used when a request doesn't select one.
+The server has no authentication, only expose it to trusted clients.`),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition(
+					"addr",
+					parameters.ParameterTypeString,
+					parameters.WithHelp("Address to listen on"),
+					parameters.WithDefault("localhost:8080"),
+				),
+			),
+		),
+		commands: commands,
+	}, nil
+}
+
+type ServeSettings struct {
+	Addr string `glazed.parameter:"addr"`
+}
+
+func (c *ServeCommand) Run(ctx context.Context, parsedLayers *layers.ParsedLayers) error {
+	s := &ServeSettings{}
+	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	commandSettings := &cli.GlazedCommandSettings{}
+	if glazedCommandLayer, ok := parsedLayers.Get(cli.GlazedCommandSlug); ok {
+		err = glazedCommandLayer.InitializeStruct(commandSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	geppettoCommands := []*cmds.GeppettoCommand{}
+	for _, command := range c.commands {
+		if geppettoCommand, ok := command.(*cmds.GeppettoCommand); ok {
+			geppettoCommands = append(geppettoCommands, geppettoCommand)
+		}
+	}
+
+	server_ := server.NewServer(geppettoCommands,
+		server.WithProfile(commandSettings.ProfileFile, commandSettings.Profile),
+	)
+	httpServer := &http.Server{
+		Addr:              s.Addr,
+		Handler:           server_.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Info().Str("addr", s.Addr).Int("commands", len(geppettoCommands)).Msg("Serving commands over HTTP")
+	err = httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// RegisterCommands adds the serve command. The given commands are the ones served.
+func RegisterCommands(rootCmd *cobra.Command, commands []glazed_cmds.Command) error {
+	serveCmdInstance, err := NewServeCommand(commands)
+	if err != nil {
+		return err
+	}
+	serveCommand, err := cli.BuildCobraCommandFromBareCommand(serveCmdInstance)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(serveCommand)
+	return nil
+}
@@ -2,11 +2,17 @@ package tokens
 
 import (
 	"context"
-	"fmt"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	geppetto_tokens "github.com/go-go-golems/geppetto/pkg/tokens"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
-	"io"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
 )
 
 type CountCommand struct {
@@ -14,46 +20,65 @@ type CountCommand struct {
 }
 
 func NewCountCommand() (*CountCommand, error) {
+	glazedLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, err
+	}
 	return &CountCommand{
 		CommandDescription: cmds.NewCommandDescription(
 			"count",
-			cmds.WithShort("Count data entries using a specific model and codec"),
+			cmds.WithShort("Count the tokens of a text or a conversation, per message"),
+			cmds.WithLong(`Count the tokens of a text or a conversation, as sent to the model.
+
+The input is a text, or a conversation rendered with --print-prompt, whose "[role]: " lines start
+the messages. Conversations can also be loaded from JSON or YAML message files. Each message is
+counted with the overhead of its role, and the total adds the tokens priming the reply.
+
+The OpenAI models are counted with their codec. The other models are estimated with cl100k_base,
+scaled for their family, which is shown in the tokenizer column.`),
 			cmds.WithFlags(
 				parameters.NewParameterDefinition(
 					"model",
 					parameters.ParameterTypeString,
-					parameters.WithHelp("Model used for encoding"),
+					parameters.WithHelp("Model whose tokenizer and message overhead are used"),
 					parameters.WithDefault("gpt-4"),
 				),
 				parameters.NewParameterDefinition(
 					"codec",
 					parameters.ParameterTypeString,
-					parameters.WithHelp("Codec used for encoding"),
+					parameters.WithHelp("Codec used instead of the tokenizer of the model"),
+				),
+				parameters.NewParameterDefinition(
+					"message-file",
+					parameters.ParameterTypeStringList,
+					parameters.WithHelp("JSON or YAML files of messages, counted before the input"),
 				),
 			),
 			cmds.WithArguments(
 				parameters.NewParameterDefinition(
 					"input",
 					parameters.ParameterTypeStringFromFiles,
-					parameters.WithHelp("Input file"),
+					parameters.WithHelp("Input files, plain text or --print-prompt renders"),
 				),
 			),
+			cmds.WithLayersList(glazedLayer),
 		),
 	}, nil
 }
 
 type CountSettings struct {
-	Model string `glazed.parameter:"model"`
-	Codec string `glazed.parameter:"codec"`
-	Input string `glazed.parameter:"input"`
+	Model        string   `glazed.parameter:"model"`
+	Codec        string   `glazed.parameter:"codec"`
+	MessageFiles []string `glazed.parameter:"message-file"`
+	Input        string   `glazed.parameter:"input"`
 }
 
-var _ cmds.WriterCommand = (*CountCommand)(nil)
+var _ cmds.GlazeCommand = (*CountCommand)(nil)
 
-func (cc *CountCommand) RunIntoWriter(
+func (cc *CountCommand) RunIntoGlazeProcessor(
 	ctx context.Context,
 	parsedLayers *layers.ParsedLayers,
-	w io.Writer,
+	gp middlewares.Processor,
 ) error {
 	s := &CountSettings{}
 	err := parsedLayers.InitializeStruct(layers.DefaultSlug, s)
@@ -61,38 +86,93 @@ func (cc *CountCommand) RunIntoWriter(
 		return err
 	}
 
-	codecStr := s.Codec
-	if s.Codec == "" {
-		codecStr, err = getDefaultEncoding(s.Model)
+	counter, err := geppetto_tokens.NewCounter(s.Model)
+	if err != nil {
+		return err
+	}
+	if s.Codec != "" {
+		counter.Tokenizer, err = geppetto_tokens.ForEncoding(s.Codec)
 		if err != nil {
-			return fmt.Errorf("error getting default encoding: %v", err)
+			return err
 		}
 	}
 
-	// Get codec based on model and codec string.
-	codec := getCodec(s.Model, codecStr)
+	messages := conversation.Conversation{}
+	for _, file := range s.MessageFiles {
+		messages_, err := conversation.LoadFromFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "could not load messages from %s", file)
+		}
+		messages = append(messages, messages_...)
+	}
+	if strings.TrimSpace(s.Input) != "" {
+		messages = append(messages, parsePrompt(s.Input)...)
+	}
+	if len(messages) == 0 {
+		return errors.New("no input or message file given")
+	}
 
-	ids, _, err := codec.Encode(s.Input)
-	if err != nil {
-		return fmt.Errorf("error encoding input: %v", err)
+	total := 0
+	for i, msg := range messages {
+		count := counter.CountMessage(msg)
+		total += count
+		role := ""
+		if content, ok := msg.Content.(*conversation.ChatMessageContent); ok {
+			role = string(content.Role)
+		}
+		row := types.NewRow(
+			types.MRP("message", i),
+			types.MRP("role", role),
+			types.MRP("tokens", count),
+			types.MRP("cumulative", total),
+			types.MRP("model", s.Model),
+			types.MRP("tokenizer", counter.Tokenizer.Name()),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
 	}
 
-	count := len(ids)
+	total += counter.TokensPerReply
+	row := types.NewRow(
+		types.MRP("message", "total"),
+		types.MRP("role", ""),
+		types.MRP("tokens", total),
+		types.MRP("cumulative", total),
+		types.MRP("model", s.Model),
+		types.MRP("tokenizer", counter.Tokenizer.Name()),
+	)
+	return gp.AddRow(ctx, row)
+}
 
-	// Write the result to the provided writer.
-	// print model and encoding
-	_, err = w.Write([]byte(fmt.Sprintf("Model: %s\n", s.Model)))
-	if err != nil {
-		return fmt.Errorf("error writing to output: %v", err)
+var promptRoleRegexp = regexp.MustCompile(`^\[(system|user|assistant)\]: `)
+
+// parsePrompt parses a conversation rendered with --print-prompt, whose messages start with
+// "[role]: " lines. Texts without such lines are a single user message.
+func parsePrompt(prompt string) conversation.Conversation {
+	if !promptRoleRegexp.MatchString(prompt) {
+		return conversation.Conversation{conversation.NewChatMessage(conversation.RoleUser, prompt)}
 	}
-	_, err = w.Write([]byte(fmt.Sprintf("Codec: %s\n", codecStr)))
-	if err != nil {
-		return fmt.Errorf("error writing to output: %v", err)
+
+	ret := conversation.Conversation{}
+	role := ""
+	lines := []string{}
+	flush := func() {
+		if role != "" {
+			// the render ends each message with a newline
+			text := strings.TrimSuffix(strings.Join(lines, "\n"), "\n")
+			ret = append(ret, conversation.NewChatMessage(conversation.Role(role), text))
+		}
 	}
-	_, err = w.Write([]byte(fmt.Sprintf("Total tokens: %d\n", count)))
-	if err != nil {
-		return fmt.Errorf("error writing to output: %v", err)
+	for _, line := range strings.Split(prompt, "\n") {
+		if m := promptRoleRegexp.FindStringSubmatch(line); m != nil {
+			flush()
+			role = m[1]
+			lines = []string{strings.TrimPrefix(line, m[0])}
+			continue
+		}
+		lines = append(lines, line)
 	}
-
-	return nil
+	flush()
+	return ret
 }
@@ -71,7 +71,10 @@ func (d *DecodeCommand) RunIntoWriter(
 	}
 
 	// Get codec based on model and codec string.
-	codec := getCodec(s.Model, codecStr)
+	codec, err := getCodec(s.Model, codecStr)
+	if err != nil {
+		return err
+	}
 
 	// Decode input
 	var ids []uint
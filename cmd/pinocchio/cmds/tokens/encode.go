@@ -73,7 +73,10 @@ func (cmd *EncodeCommand) RunIntoWriter(
 	}
 
 	// Use tokenizer to encode
-	codec := getCodec(s.Model, codecStr)
+	codec, err := getCodec(s.Model, codecStr)
+	if err != nil {
+		return err
+	}
 	ids, _, err := codec.Encode(s.Input)
 	if err != nil {
 		return fmt.Errorf("error encoding: %v", err)
@@ -2,31 +2,33 @@ package tokens
 
 import (
 	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/tiktoken-go/tokenizer"
-	"log"
 )
 
-func getCodec(model, encoding string) tokenizer.Codec {
+// getCodec returns the codec of model, or the codec of encoding for the models without their own codec.
+func getCodec(model, encoding string) (tokenizer.Codec, error) {
 	if model != "" {
 		c, err := tokenizer.ForModel(tokenizer.Model(model))
-		if err != nil {
-			log.Fatalf("error creating tokenizer: %v", err)
+		if err == nil {
+			return c, nil
 		}
-		return c
-	} else {
-		c, err := tokenizer.Get(tokenizer.Encoding(encoding))
-		if err != nil {
-			log.Fatalf("error creating tokenizer: %v", err)
+		if encoding == "" {
+			return nil, errors.Wrapf(err, "unknown model %s", model)
 		}
-		return c
 	}
+	c, err := tokenizer.Get(tokenizer.Encoding(encoding))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unknown codec %s", encoding)
+	}
+	return c, nil
 }
 
 func RegisterTokenCommands(tokensCmd *cobra.Command) {
 	countCmdInstance, err := NewCountCommand()
 	cobra.CheckErr(err)
-	countCommand, err := cli.BuildCobraCommandFromWriterCommand(countCmdInstance)
+	countCommand, err := cli.BuildCobraCommandFromGlazeCommand(countCmdInstance)
 	cobra.CheckErr(err)
 	tokensCmd.AddCommand(countCommand)
 
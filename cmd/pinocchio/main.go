@@ -8,8 +8,14 @@ import (
 	"github.com/go-go-golems/clay/pkg/repositories"
 	"github.com/go-go-golems/clay/pkg/sql"
 	pinocchio_cmds "github.com/go-go-golems/geppetto/cmd/pinocchio/cmds"
+	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/conversations"
 	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/kagi"
+	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/mcp"
 	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/openai"
+	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/proxy"
+	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/rpc"
+	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/runs"
+	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/serve"
 	"github.com/go-go-golems/geppetto/cmd/pinocchio/cmds/tokens"
 	"github.com/go-go-golems/geppetto/pkg/cmds"
 	"github.com/go-go-golems/geppetto/pkg/doc"
@@ -198,5 +204,35 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 	kagiCmd := kagi.RegisterKagiCommands()
 	rootCmd.AddCommand(kagiCmd)
 
+	err = mcp.RegisterCommands(rootCmd, allCommands)
+	if err != nil {
+		return err
+	}
+
+	err = rpc.RegisterCommands(rootCmd, allCommands)
+	if err != nil {
+		return err
+	}
+
+	err = serve.RegisterCommands(rootCmd, allCommands)
+	if err != nil {
+		return err
+	}
+
+	err = proxy.RegisterCommands(rootCmd)
+	if err != nil {
+		return err
+	}
+
+	err = runs.RegisterCommands(rootCmd)
+	if err != nil {
+		return err
+	}
+
+	err = conversations.RegisterCommands(rootCmd)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -4,14 +4,23 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"github.com/ThreeDotsLabs/watermill/message"
 	tea "github.com/charmbracelet/bubbletea"
 	bobatea_chat "github.com/go-go-golems/bobatea/pkg/chat"
 	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
 	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/mcp"
+	"github.com/go-go-golems/geppetto/pkg/metrics"
 	"github.com/go-go-golems/geppetto/pkg/steps"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/contextwindow"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/openai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/react"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/go-go-golems/geppetto/pkg/steps/checkpoint"
 	"github.com/go-go-golems/geppetto/pkg/ui"
 	glazedcmds "github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
@@ -23,6 +32,7 @@ import (
 	"github.com/tcnksm/go-input"
 	"golang.org/x/sync/errgroup"
 	"io"
+	"net/http"
 	"os"
 	"strings"
 )
@@ -35,9 +45,11 @@ type GeppettoCommandDescription struct {
 	Arguments []*parameters.ParameterDefinition `yaml:"arguments,omitempty"`
 	Layers    []layers.ParameterLayer           `yaml:"layers,omitempty"`
 
-	Prompt       string                  `yaml:"prompt,omitempty"`
-	Messages     []*conversation.Message `yaml:"messages,omitempty"`
-	SystemPrompt string                  `yaml:"system-prompt,omitempty"`
+	Prompt       string                   `yaml:"prompt,omitempty"`
+	Messages     []*conversation.Message  `yaml:"messages,omitempty"`
+	SystemPrompt string                   `yaml:"system-prompt,omitempty"`
+	Tools        []*ToolDescription       `yaml:"tools,omitempty"`
+	McpServers   []*mcp.ServerDescription `yaml:"mcp-servers,omitempty"`
 }
 
 const GeppettoHelpersSlug = "geppetto-helpers"
@@ -72,31 +84,116 @@ func NewHelpersParameterLayer() (layers.ParameterLayer, error) {
 				parameters.WithHelp("Continue in chat mode"),
 				parameters.WithDefault(false),
 			),
+			parameters.NewParameterDefinition(
+				"repl",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Continue in a line-oriented chat on stdin and stdout, which doesn't need a terminal"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"repl-delimiter",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Line ending each message in the REPL, for multi-line messages (default: every line is a message)"),
+			),
 			parameters.NewParameterDefinition(
 				"interactive",
 				parameters.ParameterTypeBool,
 				parameters.WithHelp("Always enter interactive mode, even with non-tty stdout"),
 				parameters.WithDefault(false),
 			),
+			parameters.NewParameterDefinition(
+				"non-interactive",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Never ask to continue in chat mode"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"no-record",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Don't record the events of the run in the runs directory"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"runs-dir",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Directory where runs are recorded (default: ~/.local/share/pinocchio/runs)"),
+			),
+			parameters.NewParameterDefinition(
+				"events-addr",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Address on which to stream the events of the run as SSE (/events) and WebSocket (/ws), for example localhost:8080"),
+			),
+			parameters.NewParameterDefinition(
+				"metrics-addr",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Address on which to expose Prometheus metrics of the LLM calls (/metrics), for example localhost:9090"),
+			),
+			parameters.NewParameterDefinition(
+				"redact-events",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Redact base URLs and user IDs from the recorded and streamed events, and mask API keys, email addresses and card numbers"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"drop-events",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Types of events to drop before they are recorded or streamed (for example partial)"),
+			),
+			parameters.NewParameterDefinition(
+				"resume",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("ID of a recorded run to resume, reusing its completions for unchanged prompts"),
+			),
+			parameters.NewParameterDefinition(
+				"continue",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("ID, or unique ID prefix, of a stored conversation to continue"),
+			),
+			parameters.NewParameterDefinition(
+				"continue-last",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Continue the most recently updated stored conversation"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"conversations-dir",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Directory where conversations are stored (default: ~/.local/share/pinocchio/conversations)"),
+			),
 		),
 	)
 }
 
 type HelpersSettings struct {
-	PrintPrompt       bool   `glazed.parameter:"print-prompt"`
-	System            string `glazed.parameter:"system"`
-	AppendMessageFile string `glazed.parameter:"append-message-file"`
-	MessageFile       string `glazed.parameter:"message-file"`
-	Chat              bool   `glazed.parameter:"chat"`
-	Interactive       bool   `glazed.parameter:"interactive"`
+	PrintPrompt       bool     `glazed.parameter:"print-prompt"`
+	System            string   `glazed.parameter:"system"`
+	AppendMessageFile string   `glazed.parameter:"append-message-file"`
+	MessageFile       string   `glazed.parameter:"message-file"`
+	Chat              bool     `glazed.parameter:"chat"`
+	REPL              bool     `glazed.parameter:"repl"`
+	REPLDelimiter     string   `glazed.parameter:"repl-delimiter"`
+	Interactive       bool     `glazed.parameter:"interactive"`
+	NonInteractive    bool     `glazed.parameter:"non-interactive"`
+	NoRecord          bool     `glazed.parameter:"no-record"`
+	RunsDir           string   `glazed.parameter:"runs-dir"`
+	Resume            string   `glazed.parameter:"resume"`
+	EventsAddr        string   `glazed.parameter:"events-addr"`
+	MetricsAddr       string   `glazed.parameter:"metrics-addr"`
+	RedactEvents      bool     `glazed.parameter:"redact-events"`
+	DropEvents        []string `glazed.parameter:"drop-events"`
+	Continue          string   `glazed.parameter:"continue"`
+	ContinueLast      bool     `glazed.parameter:"continue-last"`
+	ConversationsDir  string   `glazed.parameter:"conversations-dir"`
 }
 
 type GeppettoCommand struct {
 	*glazedcmds.CommandDescription `yaml:",inline"`
-	StepSettings                   *settings.StepSettings  `yaml:"stepSettings,omitempty"`
-	Prompt                         string                  `yaml:"prompt,omitempty"`
-	Messages                       []*conversation.Message `yaml:"messages,omitempty"`
-	SystemPrompt                   string                  `yaml:"system-prompt,omitempty"`
+	StepSettings                   *settings.StepSettings   `yaml:"stepSettings,omitempty"`
+	Prompt                         string                   `yaml:"prompt,omitempty"`
+	Messages                       []*conversation.Message  `yaml:"messages,omitempty"`
+	SystemPrompt                   string                   `yaml:"system-prompt,omitempty"`
+	Tools                          []*ToolDescription       `yaml:"tools,omitempty"`
+	McpServers                     []*mcp.ServerDescription `yaml:"mcp-servers,omitempty"`
 }
 
 var _ glazedcmds.WriterCommand = &GeppettoCommand{}
@@ -121,6 +218,18 @@ func WithSystemPrompt(systemPrompt string) GeppettoCommandOption {
 	}
 }
 
+func WithTools(tools []*ToolDescription) GeppettoCommandOption {
+	return func(g *GeppettoCommand) {
+		g.Tools = tools
+	}
+}
+
+func WithMcpServers(servers []*mcp.ServerDescription) GeppettoCommandOption {
+	return func(g *GeppettoCommand) {
+		g.McpServers = servers
+	}
+}
+
 func NewGeppettoCommand(
 	description *glazedcmds.CommandDescription,
 	settings *settings.StepSettings,
@@ -145,10 +254,17 @@ func NewGeppettoCommand(
 	return ret, nil
 }
 
+// InitializeContextManager renders the system prompt, the messages and the prompt of the command
+// into contextManager. When contextManager already holds a conversation that is being continued,
+// only the prompt is appended.
 func (g *GeppettoCommand) InitializeContextManager(
 	contextManager conversation.Manager,
 	ps map[string]interface{},
 ) error {
+	if len(contextManager.GetConversation()) > 0 {
+		return g.appendPrompt(contextManager, ps)
+	}
+
 	if g.SystemPrompt != "" {
 		systemPromptTemplate, err := templating.CreateTemplate("system-prompt").Parse(g.SystemPrompt)
 		if err != nil {
@@ -188,6 +304,10 @@ func (g *GeppettoCommand) InitializeContextManager(
 		}
 	}
 
+	return g.appendPrompt(contextManager, ps)
+}
+
+func (g *GeppettoCommand) appendPrompt(contextManager conversation.Manager, ps map[string]interface{}) error {
 	// render the prompt
 	if g.Prompt != "" {
 		// TODO(manuel, 2023-02-04) All this could be handle by some prompt renderer kind of thing
@@ -219,6 +339,7 @@ func (g *GeppettoCommand) Run(
 	contextManager conversation.Manager,
 	helpersSettings *HelpersSettings,
 	ps map[string]interface{},
+	w io.Writer,
 ) (steps.StepResult[string], error) {
 	err := g.InitializeContextManager(contextManager, ps)
 	if err != nil {
@@ -227,8 +348,9 @@ func (g *GeppettoCommand) Run(
 
 	conversation_ := contextManager.GetConversation()
 	if helpersSettings.PrintPrompt {
-		fmt.Println(conversation_.GetSinglePrompt())
-		return nil, nil
+		// the prompt is the output of the command, which isn't stdout when served over rpc or mcp
+		_, err = fmt.Fprintln(w, conversation_.GetSinglePrompt())
+		return nil, err
 	}
 
 	messagesM := steps.Resolve(conversation_)
@@ -246,6 +368,10 @@ func (g *GeppettoCommand) RunIntoWriter(
 	if g.Prompt != "" && len(g.Messages) != 0 {
 		return errors.Errorf("Prompt and messages are mutually exclusive")
 	}
+	// the command can be run several times in the same process, for example when served,
+	// so the overrides of the system prompt and messages below are applied to a copy
+	g_ := *g
+	g = &g_
 
 	s := &HelpersSettings{}
 	err := parsedLayers.InitializeStruct(GeppettoHelpersSlug, s)
@@ -266,7 +392,43 @@ func (g *GeppettoCommand) RunIntoWriter(
 		Settings: stepSettings,
 	}
 
-	router, err := events.NewEventRouter()
+	var eventLog *events.EventLog
+	if !s.NoRecord {
+		eventLog, err = NewRunEventLog(s.RunsDir, g.Name)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := eventLog.Close()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to close event log")
+			}
+		}()
+	}
+
+	middlewares := []events.Middleware{}
+	if len(s.DropEvents) > 0 {
+		middlewares = append(middlewares, events.DropEventTypes(s.DropEvents...))
+	}
+	if s.RedactEvents {
+		middlewares = append(middlewares, events.DefaultRedactionMiddlewares()...)
+	}
+
+	// handlers are queued so that recording, streaming and metrics don't slow down the steps
+	routerOptions := []events.EventRouterOption{
+		events.WithExportMiddlewares(middlewares...),
+		events.WithDefaultDeliveryPolicy(events.DeliveryBuffered, 1024),
+	}
+	var collector *metrics.Collector
+	if s.MetricsAddr != "" {
+		collector, err = metrics.NewCollector()
+		if err != nil {
+			return err
+		}
+		routerOptions = append(routerOptions, events.WithDeliveryObserver(collector))
+	}
+
+	router, err := events.NewEventRouter(routerOptions...)
 	if err != nil {
 		return err
 	}
@@ -278,15 +440,171 @@ func (g *GeppettoCommand) RunIntoWriter(
 		}
 	}()
 
-	router.AddHandler("chat", "chat", chat.StepPrinterFunc("", w))
+	// the printer is queued so that the steps don't wait for the terminal. The router is flushed
+	// once a step is done, and closing it drains the queue before RunIntoWriter returns.
+	router.AddHandler("chat", "chat", chat.StepPrinterFunc("", w),
+		events.WithDeliveryPolicy(events.DeliveryBuffered))
+	for _, handler := range getEventHandlers(ctx) {
+		router.AddHandler(handler.name, "chat", handler.f,
+			events.WithDeliveryPolicy(events.DeliverySync), events.AsExport())
+	}
+	if eventLog != nil {
+		eventLog.AddToRouter(router, "chat", "ui")
+	}
+	if s.EventsAddr != "" {
+		bridge := events.NewBridge()
+		bridge.AddToRouter(router, "chat", "ui")
+		server := &http.Server{
+			Addr:    s.EventsAddr,
+			Handler: bridge.Handler(),
+		}
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Failed to serve events")
+			}
+		}()
+		defer func() {
+			_ = server.Close()
+		}()
+	}
+	if collector != nil {
+		collector.AddToRouter(router, "chat", "ui")
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", collector.Handler())
+		server := &http.Server{
+			Addr:    s.MetricsAddr,
+			Handler: mux,
+		}
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Failed to serve metrics")
+			}
+		}()
+		defer func() {
+			_ = server.Close()
+		}()
+	}
+
+	conversationStore, err := conversations.NewStore(s.ConversationsDir)
+	if err != nil {
+		return err
+	}
+	// the branching manager keeps the conversation sent to the model in sync with the chat UI,
+	// which can regenerate answers and edit messages as new branches
+	contextManager := conversations.NewBranchingManager(conversation.NewManager())
+	conversationName := g.Name
+	if s.Continue != "" || s.ContinueLast {
+		var stored *conversations.Conversation
+		if s.ContinueLast {
+			stored, err = conversationStore.Latest()
+		} else {
+			stored, err = conversationStore.Load(s.Continue)
+		}
+		if err != nil {
+			return err
+		}
+		manager, err := stored.ToManager()
+		if err != nil {
+			return err
+		}
+		contextManager = conversations.NewBranchingManager(manager)
+		conversationName = stored.Name
+	}
+	storeConversation := func() (*conversations.Conversation, error) {
+		c := conversations.NewConversation(contextManager.ManagerImpl, conversationName)
+		if len(c.Messages) == 0 {
+			return c, nil
+		}
+		err := conversationStore.Save(c)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().Str("conversation", c.ID).Msg("Saved conversation")
+		return c, nil
+	}
+	saveConversation := func() {
+		_, err := storeConversation()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to save conversation")
+		}
+	}
+
+	mcpServers, err := g.getMcpServers(parsedLayers)
+	if err != nil {
+		return err
+	}
+	var mcpTools []tools.Tool
+	if len(mcpServers) > 0 {
+		clientSet, err := mcp.StartClientSet(ctx, mcpServers)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := clientSet.Close()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to close MCP servers")
+			}
+		}()
 
-	contextManager := conversation.NewManager()
+		mcpTools, err = clientSet.Tools(ctx)
+		if err != nil {
+			return err
+		}
+	}
 
 	var chatStep chat.Step
-	chatStep, err = stepFactory.NewStep(chat.WithPublishedTopic(router.Publisher, "chat"))
+	var chatTools []tools.Tool
+	if len(g.Tools) > 0 || len(mcpTools) > 0 {
+		chatTools, err = g.getTools(mcpTools)
+		if err != nil {
+			return err
+		}
+		chatStep, err = g.newChatToolStep(stepSettings, stepFactory, chatTools)
+		if err != nil {
+			return err
+		}
+		err = chatStep.AddPublishedTopic(router.Publisher, "chat")
+	} else {
+		chatStep, err = stepFactory.NewStep(chat.WithPublishedTopic(router.Publisher, "chat"))
+	}
 	if err != nil {
 		return err
 	}
+	chatStep, err = newContextWindowStep(parsedLayers, chatStep, stepSettings, chatTools)
+	if err != nil {
+		return err
+	}
+
+	// when resuming without recording, the checkpoints of the resumed run are updated in place
+	runID := s.Resume
+	if eventLog != nil {
+		runID = RunID(eventLog.Path())
+	}
+	resumedFromCheckpoint := false
+	if runID != "" {
+		ctx = steps.WithRunID(ctx, runID)
+
+		checkpointsDir, err := DefaultCheckpointsDir(s.RunsDir)
+		if err != nil {
+			return err
+		}
+		store, err := checkpoint.NewFileStore(checkpointsDir)
+		if err != nil {
+			return err
+		}
+		chatStep = checkpoint.NewStep[conversation.Conversation, string](
+			chatStep, store, runID, g.Name,
+			checkpoint.WithResumeFrom(s.Resume),
+			checkpoint.WithHashFunc(func(input interface{}) (string, error) {
+				return HashConversation(input.(conversation.Conversation), stepSettings)
+			}),
+			checkpoint.WithOnResume(func(c *checkpoint.Checkpoint) {
+				resumedFromCheckpoint = true
+			}),
+		)
+	}
 
 	// load and render the system prompt
 	if s.System != "" {
@@ -317,18 +635,22 @@ func (g *GeppettoCommand) RunIntoWriter(
 	eg.Go(func() error {
 		defer cancel()
 
-		m, err := g.Run(ctx, chatStep, contextManager, s, parsedLayers.GetDataMap())
+		m, err := g.Run(ctx, chatStep, contextManager, s, parsedLayers.GetDataMap(), w)
 		if err != nil {
 			return err
 		}
 		if m == nil {
 			return nil
 		}
+		// the conversation is saved again after the chat continuation, or if the step fails
+		defer saveConversation()
 
 		isStream := stepSettings.Chat.Stream
 		log.Debug().Bool("isStream", isStream).Msg("")
 
 		res := m.Return()
+		// the printer has written the streamed answer before anything else is written to w
+		router.Flush()
 		for _, msg := range res {
 			s, err := msg.Value()
 			if err != nil {
@@ -337,7 +659,8 @@ func (g *GeppettoCommand) RunIntoWriter(
 			} else {
 				contextManager.AppendMessages(conversation.NewChatMessage(conversation.RoleAssistant, s))
 
-				if !isStream {
+				// resumed completions don't stream any events
+				if !isStream || resumedFromCheckpoint {
 					_, err := w.Write([]byte(s))
 					if err != nil {
 						return err
@@ -351,9 +674,12 @@ func (g *GeppettoCommand) RunIntoWriter(
 		isOutputTerminal := isatty.IsTerminal(os.Stdout.Fd())
 		interactive := s.Interactive
 		continueInChat := s.Chat
-		askChat := (isOutputTerminal || interactive) && !continueInChat
+		askChat := (isOutputTerminal || interactive) && !continueInChat && !s.NonInteractive && !s.REPL
+
+		saveConversation()
 
 		lengthBeforeChat := len(contextManager.GetConversation())
+		conversationBeforeChat := contextManager.ConversationID
 
 		if askChat {
 			if !endedInNewline {
@@ -366,29 +692,81 @@ func (g *GeppettoCommand) RunIntoWriter(
 			}
 		}
 
-		if continueInChat {
-			stepFactory.Settings.Chat.Stream = true
-			chatStep, err = stepFactory.NewStep(chat.WithPublishedTopic(router.Publisher, "ui"))
-			if err != nil {
-				return err
-			}
+		if !continueInChat && !s.REPL {
+			return nil
+		}
 
-			err = chat_(ctx, chatStep, router, contextManager)
-			if err != nil {
-				return err
-			}
+		// the chat UI renders the events of the ui topic, while the REPL streams the answers
+		// through the printer of the chat topic
+		topic := "ui"
+		if s.REPL {
+			topic = "chat"
+		}
+		stepFactory.Settings.Chat.Stream = true
+		newStep := g.newChatStepFunc(parsedLayers, router.Publisher, topic, chatTools)
+		chatStep, err = newStep(stepFactory.Settings)
+		if err != nil {
+			return err
+		}
 
-			fmt.Printf("\n---\n")
-			for idx, msg := range contextManager.GetConversation() {
-				if idx < lengthBeforeChat {
-					continue
+		commands := &chatCommands{
+			stepFactory: stepFactory,
+			newStep:     newStep,
+			manager:     contextManager,
+			store:       conversationStore,
+			save:        storeConversation,
+			load: func(stored *conversations.Conversation) error {
+				manager, err := stored.ToManager()
+				if err != nil {
+					return err
+				}
+				contextManager.Reset(manager)
+				conversationName = stored.Name
+				return nil
+			},
+		}
+		slashCommands := ui.NewSlashCommands(commands.SlashCommands()...)
+
+		if s.REPL {
+			if !endedInNewline {
+				_, err = w.Write([]byte("\n"))
+				if err != nil {
+					return err
 				}
-				view := msg.Content.View()
-				fmt.Printf("\n%s\n", view)
 			}
-			if err != nil {
-				return err
+			repl := ui.NewREPL(chatStep, contextManager,
+				ui.WithREPLOutput(w, os.Stderr),
+				ui.WithREPLDelimiter(s.REPLDelimiter),
+				ui.WithREPLSlashCommands(slashCommands),
+				ui.WithREPLOnTurn(func() {
+					router.Flush()
+					saveConversation()
+				}),
+			)
+			commands.setStep = repl.SetStep
+			return repl.Run(ctx)
+		}
+
+		stepBackend := ui.NewStepBackend(chatStep)
+		commands.setStep = stepBackend.SetStep
+		backend := ui.NewSlashCommandBackend(stepBackend, contextManager, slashCommands)
+
+		err = chat_(ctx, backend, router, contextManager)
+		if err != nil {
+			return err
+		}
+
+		// the conversation was replaced by /clear or /load
+		if contextManager.ConversationID != conversationBeforeChat {
+			lengthBeforeChat = 0
+		}
+		fmt.Printf("\n---\n")
+		for idx, msg := range contextManager.GetConversation() {
+			if idx < lengthBeforeChat {
+				continue
 			}
+			view := msg.Content.View()
+			fmt.Printf("\n%s\n", view)
 		}
 
 		return nil
@@ -400,6 +778,199 @@ func (g *GeppettoCommand) RunIntoWriter(
 	return eg.Wait()
 }
 
+// HashConversation hashes the messages of the conversation and the step settings, so that a resumed
+// run only reuses a completion if both the prompt and the model configuration are unchanged.
+func HashConversation(conversation_ conversation.Conversation, stepSettings *settings.StepSettings) (string, error) {
+	messages := []map[string]string{}
+	for _, msg := range conversation_ {
+		m := map[string]string{
+			"content": msg.Content.String(),
+		}
+		if content, ok := msg.Content.(*conversation.ChatMessageContent); ok {
+			m["role"] = string(content.Role)
+		}
+		messages = append(messages, m)
+	}
+
+	settings_ := stepSettings.GetMetadata()
+	// streaming doesn't change the completion
+	delete(settings_, "ai-stream")
+
+	return checkpoint.HashJSON(map[string]interface{}{
+		"messages": messages,
+		"settings": settings_,
+	})
+}
+
+// getMcpServers returns the MCP servers declared in the command file, followed by the ones
+// configured through the mcp layer (flags, profiles and config file).
+func (g *GeppettoCommand) getMcpServers(parsedLayers *layers.ParsedLayers) ([]*mcp.ServerDescription, error) {
+	ret := append([]*mcp.ServerDescription{}, g.McpServers...)
+
+	if _, ok := parsedLayers.Get(mcp.McpSlug); !ok {
+		return ret, nil
+	}
+	mcpSettings := &mcp.Settings{}
+	err := parsedLayers.InitializeStruct(mcp.McpSlug, mcpSettings)
+	if err != nil {
+		return nil, err
+	}
+	servers, err := mcpSettings.GetServerDescriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ret, servers...), nil
+}
+
+// newContextWindowStep wraps step to keep the conversation within the context window of the model,
+// as configured through the context-window layer. The definitions of the tools offered by step
+// take up part of the context window.
+func newContextWindowStep(
+	parsedLayers *layers.ParsedLayers,
+	step chat.Step,
+	stepSettings *settings.StepSettings,
+	tools_ []tools.Tool,
+) (chat.Step, error) {
+	if _, ok := parsedLayers.Get(contextwindow.ContextWindowSlug); !ok {
+		return step, nil
+	}
+	contextSettings := &contextwindow.Settings{}
+	err := parsedLayers.InitializeStruct(contextwindow.ContextWindowSlug, contextSettings)
+	if err != nil {
+		return nil, err
+	}
+	if contextSettings.Strategy == contextwindow.StrategyNone {
+		return step, nil
+	}
+
+	options := []contextwindow.Option{contextwindow.WithTools(tools_)}
+	if contextSettings.Strategy == contextwindow.StrategySummarize {
+		summarySettings := stepSettings.Clone()
+		if contextSettings.SummaryEngine != "" {
+			summarySettings.Chat.Engine = &contextSettings.SummaryEngine
+		}
+		summarySettings.Chat.Stream = false
+		factory := &ai.StandardStepFactory{Settings: summarySettings}
+		summarizer, err := factory.NewStep()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, contextwindow.WithSummarizer(summarizer))
+	}
+
+	return contextwindow.NewStep(step, stepSettings, contextSettings, options...), nil
+}
+
+// withContextWindow wraps the steps created by newStep, which offer tools_, with newContextWindowStep.
+func withContextWindow(
+	parsedLayers *layers.ParsedLayers,
+	tools_ []tools.Tool,
+	newStep func(stepSettings *settings.StepSettings) (chat.Step, error),
+) func(stepSettings *settings.StepSettings) (chat.Step, error) {
+	return func(stepSettings *settings.StepSettings) (chat.Step, error) {
+		step, err := newStep(stepSettings)
+		if err != nil {
+			return nil, err
+		}
+		return newContextWindowStep(parsedLayers, step, stepSettings, tools_)
+	}
+}
+
+// newChatStepFunc returns the function creating the steps of the chat continuation, initially and on
+// /model or /temperature. Like the first completion, they offer chatTools and are kept within the
+// context window, and publish their events to topic.
+func (g *GeppettoCommand) newChatStepFunc(
+	parsedLayers *layers.ParsedLayers,
+	publisher message.Publisher,
+	topic string,
+	chatTools []tools.Tool,
+) func(stepSettings *settings.StepSettings) (chat.Step, error) {
+	return withContextWindow(parsedLayers, chatTools, func(stepSettings *settings.StepSettings) (chat.Step, error) {
+		factory := &ai.StandardStepFactory{Settings: stepSettings}
+		if len(chatTools) == 0 {
+			return factory.NewStep(chat.WithPublishedTopic(publisher, topic))
+		}
+		step, err := g.newChatToolStep(stepSettings, factory, chatTools)
+		if err != nil {
+			return nil, err
+		}
+		err = step.AddPublishedTopic(publisher, topic)
+		if err != nil {
+			return nil, err
+		}
+		return step, nil
+	})
+}
+
+// getTools returns the tools declared in the command, followed by the given additional tools.
+func (g *GeppettoCommand) getTools(additionalTools []tools.Tool) ([]tools.Tool, error) {
+	ret := []tools.Tool{}
+	names := map[string]bool{}
+	for _, toolDescription := range g.Tools {
+		tool, err := toolDescription.ToTool()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, tool)
+		names[tool.GetName()] = true
+	}
+	for _, tool := range additionalTools {
+		if names[tool.GetName()] {
+			return nil, errors.Errorf("tool %s is declared more than once", tool.GetName())
+		}
+		ret = append(ret, tool)
+		names[tool.GetName()] = true
+	}
+	return ret, nil
+}
+
+// newChatToolStep creates the step that offers the given tools to the model and executes
+// the resulting tool calls.
+//
+// With the react tool format, the tools are described in the prompt of a chat step created by stepFactory,
+// which works with models that don't support function calling.
+func (g *GeppettoCommand) newChatToolStep(
+	stepSettings *settings.StepSettings,
+	stepFactory *ai.StandardStepFactory,
+	tools_ []tools.Tool,
+) (chat.Step, error) {
+	toolFunctions := map[string]interface{}{}
+	for _, tool := range tools_ {
+		toolFunctions[tool.GetName()] = tool
+	}
+
+	toolFormat := settings.ToolFormatNative
+	if stepSettings.Chat.ToolFormat != nil {
+		toolFormat = *stepSettings.Chat.ToolFormat
+	}
+	switch toolFormat {
+	case settings.ToolFormatReAct:
+		step, err := stepFactory.NewStep()
+		if err != nil {
+			return nil, err
+		}
+		return react.NewStep(step, react.WithToolFunctions(toolFunctions))
+	case settings.ToolFormatNative:
+	}
+
+	if stepSettings.Chat.ApiType == nil {
+		apiType := settings.ApiTypeOpenAI
+		stepSettings.Chat.ApiType = &apiType
+	}
+	switch *stepSettings.Chat.ApiType {
+	case settings.ApiTypeOpenAI, settings.ApiTypeAnyScale, settings.ApiTypeFireworks:
+	case settings.ApiTypeClaude,
+		settings.ApiTypeOllama,
+		settings.ApiTypeMistral,
+		settings.ApiTypePerplexity,
+		settings.ApiTypeCohere:
+		return nil, errors.Errorf("native tools are not supported for api type %s, use --ai-tool-format react", *stepSettings.Chat.ApiType)
+	}
+
+	return openai.NewChatToolStep(stepSettings, openai.WithToolFunctions(toolFunctions))
+}
+
 func (g *GeppettoCommand) askForChatContinuation(continueInChat bool) (bool, error) {
 	tty_, err := bobatea_chat.OpenTTY()
 	if err != nil {
@@ -449,9 +1020,9 @@ func (g *GeppettoCommand) askForChatContinuation(continueInChat bool) (bool, err
 
 func chat_(
 	ctx context.Context,
-	step chat.Step,
+	backend bobatea_chat.Backend,
 	router *events.EventRouter,
-	contextManager conversation.Manager,
+	contextManager *conversations.BranchingManager,
 ) error {
 	// switch on streaming for chatting
 	// TODO(manuel, 2023-12-09) Probably need to create a new follow on step for enabling streaming
@@ -467,9 +1038,7 @@ func chat_(
 		options = append(options, tea.WithAltScreen())
 	}
 
-	backend := ui.NewStepBackend(step)
-
-	model := bobatea_chat.InitialModel(
+	model := ui.NewBranchingModel(
 		contextManager,
 		backend,
 		bobatea_chat.WithTitle("PINOCCHIO AT YOUR SERVICE:"),
@@ -480,7 +1049,9 @@ func chat_(
 		options...,
 	)
 
-	router.AddHandler("ui", "ui", ui.StepChatForwardFunc(p))
+	// the UI only renders the latest completion, so partial completions are merged while it is busy
+	router.AddHandler("ui", "ui", ui.StepChatForwardFunc(p),
+		events.WithDeliveryPolicy(events.DeliveryCoalescePartials))
 	err := router.RunHandlers(ctx)
 	if err != nil {
 		return err
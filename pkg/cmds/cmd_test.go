@@ -0,0 +1,138 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/contextwindow"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/openai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/react"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/middlewares"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// recordingStep answers with a fixed text, recording the conversation it was started with.
+type recordingStep struct {
+	input conversation.Conversation
+}
+
+func (r *recordingStep) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
+	r.input = input
+	return steps.Resolve("ok"), nil
+}
+
+func (r *recordingStep) AddPublishedTopic(publisher message.Publisher, topic string) error {
+	return nil
+}
+
+type recordingPublisher struct {
+	messages []*message.Message
+}
+
+func (r *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	r.messages = append(r.messages, messages...)
+	return nil
+}
+
+func (r *recordingPublisher) Close() error {
+	return nil
+}
+
+func TestChatContinuationContextWindow(t *testing.T) {
+	contextWindowLayer, err := contextwindow.NewParameterLayer()
+	require.NoError(t, err)
+	parsedLayers := layers.NewParsedLayers()
+	err = middlewares.ExecuteMiddlewares(
+		layers.NewParameterLayers(layers.WithLayers(contextWindowLayer)),
+		parsedLayers,
+		middlewares.UpdateFromMap(map[string]map[string]interface{}{
+			contextwindow.ContextWindowSlug: {
+				"context-strategy": "drop-oldest",
+				"context-limit":    300,
+			},
+		}),
+		middlewares.SetFromDefaults(),
+	)
+	require.NoError(t, err)
+
+	step := &recordingStep{}
+	newStep := withContextWindow(parsedLayers, nil, func(stepSettings *settings.StepSettings) (chat.Step, error) {
+		return step, nil
+	})
+
+	// the steps created by /model are wrapped as well
+	engine := "gpt-4"
+	stepSettings := settings.NewStepSettings()
+	stepSettings.Chat.Engine = &engine
+	chatStep, err := newStep(stepSettings)
+	require.NoError(t, err)
+
+	long := strings.Repeat("word ", 100)
+	_, err = chatStep.Start(context.Background(), conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleUser, "first "+long),
+		conversation.NewChatMessage(conversation.RoleAssistant, "first answer "+long),
+		conversation.NewChatMessage(conversation.RoleUser, "second "+long),
+		conversation.NewChatMessage(conversation.RoleAssistant, "second answer "+long),
+		conversation.NewChatMessage(conversation.RoleUser, "last question"),
+	})
+	require.NoError(t, err)
+	// the first turn was dropped
+	require.Len(t, step.input, 3)
+	assert.Equal(t, "second "+long, step.input[0].Content.String())
+	assert.Equal(t, "last question", step.input[2].Content.String())
+}
+
+func TestChatContinuationTools(t *testing.T) {
+	getWeather := &tools.ToolFunc{Name: "get_weather", Description: "Get the weather"}
+	g := &GeppettoCommand{}
+	newStep := g.newChatStepFunc(layers.NewParsedLayers(), &recordingPublisher{}, "chat", []tools.Tool{getWeather})
+
+	// the steps created after the first completion, and by /model, still offer the tools
+	engine := "gpt-4"
+	stepSettings := settings.NewStepSettings()
+	stepSettings.Chat.Engine = &engine
+	step, err := newStep(stepSettings)
+	require.NoError(t, err)
+	assert.IsType(t, &openai.ChatToolStep{}, step)
+
+	toolFormat := settings.ToolFormatReAct
+	stepSettings.Chat.ToolFormat = &toolFormat
+	step, err = newStep(stepSettings)
+	require.NoError(t, err)
+	assert.IsType(t, &react.Step{}, step)
+}
+
+func TestPrintPromptWritesToWriter(t *testing.T) {
+	// no pinocchio profiles
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	stepSettings := settings.NewStepSettings()
+	geppettoLayers, err := CreateGeppettoLayers(stepSettings)
+	require.NoError(t, err)
+	command, err := NewGeppettoCommand(
+		glazed_cmds.NewCommandDescription("hello", glazed_cmds.WithLayersList(geppettoLayers...)),
+		stepSettings,
+		WithPrompt("Say hello"),
+	)
+	require.NoError(t, err)
+
+	parsedLayers, err := ParseGeppettoRequestParameters(command.Description(), map[string]map[string]interface{}{
+		GeppettoHelpersSlug: {"print-prompt": true, "no-record": true},
+	}, "", "")
+	require.NoError(t, err)
+
+	// served commands write their output, including the prompt, to the writer instead of stdout
+	w := &bytes.Buffer{}
+	require.NoError(t, command.RunIntoWriter(context.Background(), parsedLayers, w))
+	assert.Equal(t, "Say hello\n", w.String())
+}
@@ -2,6 +2,8 @@ package cmds
 
 import (
 	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/mcp"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/contextwindow"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings/claude"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings/openai"
@@ -10,7 +12,9 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/middlewares"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 	"os"
 )
 
@@ -48,45 +52,103 @@ func GetCobraCommandGeppettoMiddlewares(
 			middlewares.LoadParametersFromFile(commandSettings.LoadParametersFromFile))
 	}
 
-	xdgConfigPath, err := os.UserConfigDir()
+	profileMiddlewares, err := GetGeppettoProfileMiddlewares(commandSettings.ProfileFile, commandSettings.Profile)
 	if err != nil {
 		return nil, err
 	}
+	middlewares_ = append(middlewares_, profileMiddlewares...)
+
+	return middlewares_, nil
+}
 
+// GetGeppettoProfileMiddlewares returns the middlewares that load the parameters from the pinocchio profiles,
+// the viper configuration and finally the defaults.
+//
+// An empty profileFile or profile selects the default profiles.yaml and the "default" profile.
+func GetGeppettoProfileMiddlewares(profileFile string, profile string) ([]middlewares.Middleware, error) {
 	// TODO(manuel, 2024-03-20) I wonder if we should just use a custom layer for the profiles, as we want to load
 	// the profile from the environment as well. So the sequence would be defaults -> viper -> command line
-	defaultProfileFile := fmt.Sprintf("%s/pinocchio/profiles.yaml", xdgConfigPath)
-	if commandSettings.ProfileFile == "" {
-		commandSettings.ProfileFile = defaultProfileFile
+	defaultProfileFile, err := DefaultProfileFile()
+	if err != nil {
+		return nil, err
+	}
+	if profileFile == "" {
+		profileFile = defaultProfileFile
 	}
-	if commandSettings.Profile == "" {
-		commandSettings.Profile = "default"
+	if profile == "" {
+		profile = "default"
 	}
-	middlewares_ = append(middlewares_,
+
+	return []middlewares.Middleware{
 		middlewares.GatherFlagsFromProfiles(
 			defaultProfileFile,
-			commandSettings.ProfileFile,
-			commandSettings.Profile,
+			profileFile,
+			profile,
 			parameters.WithParseStepSource("profiles"),
 			parameters.WithParseStepMetadata(map[string]interface{}{
-				"profileFile": commandSettings.ProfileFile,
-				"profile":     commandSettings.Profile,
+				"profileFile": profileFile,
+				"profile":     profile,
 			}),
 		),
-	)
-
-	middlewares_ = append(middlewares_,
 		middlewares.WrapWithWhitelistedLayers(
 			[]string{
 				settings.AiChatSlug,
 				settings.AiClientSlug,
 				openai.OpenAiChatSlug,
 				claude.ClaudeChatSlug,
+				mcp.McpSlug,
+				contextwindow.ContextWindowSlug,
 			},
 			middlewares.GatherFlagsFromViper(parameters.WithParseStepSource("viper")),
 		),
 		middlewares.SetFromDefaults(parameters.WithParseStepSource("defaults")),
-	)
+	}, nil
+}
 
-	return middlewares_, nil
+// DefaultProfileFile returns the path of the pinocchio profiles.yaml in the user configuration directory.
+func DefaultProfileFile() (string, error) {
+	xdgConfigPath, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/pinocchio/profiles.yaml", xdgConfigPath), nil
+}
+
+// ListProfiles returns the names of the profiles of profileFile, or of the default profile file if empty,
+// in the order of the file. A missing profile file has no profiles.
+func ListProfiles(profileFile string) ([]string, error) {
+	if profileFile == "" {
+		var err error
+		profileFile, err = DefaultProfileFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := os.ReadFile(profileFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	// a yaml.Node keeps the order of the profiles
+	node := &yaml.Node{}
+	err = yaml.Unmarshal(b, node)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse profile file %s", profileFile)
+	}
+	ret := []string{}
+	if len(node.Content) == 0 {
+		return ret, nil
+	}
+	root := node.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.Errorf("profile file %s is not a map of profiles", profileFile)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		ret = append(ret, root.Content[i].Value)
+	}
+	return ret, nil
 }
@@ -1,6 +1,8 @@
 package cmds
 
 import (
+	"github.com/go-go-golems/geppetto/pkg/mcp"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/contextwindow"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings/claude"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings/ollama"
@@ -14,6 +16,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"io"
 	"io/fs"
+	"path"
 	"strings"
 )
 
@@ -76,12 +79,27 @@ func (g *GeppettoCommandLoader) loadGeppettoCommandFromReader(
 		return nil, errors.Errorf("Prompt and messages are mutually exclusive")
 	}
 
+	for _, tool := range scd.Tools {
+		err = tool.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, server := range scd.McpServers {
+		if server.Command == "" {
+			return nil, errors.Errorf("MCP server %s has no command", server.Name)
+		}
+	}
+
 	sq, err := NewGeppettoCommand(
 		description,
 		stepSettings,
 		WithPrompt(scd.Prompt),
 		WithMessages(scd.Messages),
 		WithSystemPrompt(scd.SystemPrompt),
+		WithTools(scd.Tools),
+		WithMcpServers(scd.McpServers),
 	)
 	if err != nil {
 		return nil, err
@@ -132,6 +150,16 @@ func CreateGeppettoLayers(stepSettings *settings.StepSettings) ([]layers.Paramet
 	// TODO(manuel, 2024-01-17) Disable not fully function ollama layer for now
 	_ = ollamaParameterLayer
 
+	mcpParameterLayer, err := mcp.NewParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+
+	contextWindowParameterLayer, err := contextwindow.NewParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+
 	helpersLayer, err := NewHelpersParameterLayer()
 	if err != nil {
 		return nil, err
@@ -142,6 +170,8 @@ func CreateGeppettoLayers(stepSettings *settings.StepSettings) ([]layers.Paramet
 		chatParameterLayer, clientParameterLayer,
 		claudeParameterLayer,
 		openaiParameterLayer,
+		mcpParameterLayer,
+		contextWindowParameterLayer,
 		//ollamaParameterLayer,
 	}, nil
 }
@@ -158,9 +188,22 @@ func (scl *GeppettoCommandLoader) LoadCommands(
 	defer func(r fs.File) {
 		_ = r.Close()
 	}(r)
-	return loaders.LoadCommandOrAliasFromReader(
+	cmds_, err := loaders.LoadCommandOrAliasFromReader(
 		r,
 		scl.loadGeppettoCommandFromReader,
 		options,
 		aliasOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, command := range cmds_ {
+		if geppettoCommand, ok := command.(*GeppettoCommand); ok {
+			for _, tool := range geppettoCommand.Tools {
+				tool.setCommandDir(f, path.Dir(entryName))
+			}
+		}
+	}
+
+	return cmds_, nil
 }
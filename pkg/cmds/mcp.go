@@ -0,0 +1,173 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/go-go-golems/geppetto/pkg/mcp"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"regexp"
+	"strings"
+)
+
+// GeppettoCommandTool exposes a geppetto command as a tool. The tool arguments are the flags
+// and arguments of the command, and calling the tool runs the command and returns its output.
+type GeppettoCommandTool struct {
+	command     *GeppettoCommand
+	name        string
+	profileFile string
+	profile     string
+}
+
+var _ tools.Tool = (*GeppettoCommandTool)(nil)
+
+type GeppettoCommandToolOption func(*GeppettoCommandTool)
+
+func WithCommandToolName(name string) GeppettoCommandToolOption {
+	return func(t *GeppettoCommandTool) {
+		t.name = name
+	}
+}
+
+// WithCommandToolProfile selects the pinocchio profile used to run the command.
+func WithCommandToolProfile(profileFile string, profile string) GeppettoCommandToolOption {
+	return func(t *GeppettoCommandTool) {
+		t.profileFile = profileFile
+		t.profile = profile
+	}
+}
+
+func NewGeppettoCommandTool(command *GeppettoCommand, options ...GeppettoCommandToolOption) *GeppettoCommandTool {
+	ret := &GeppettoCommandTool{
+		command: command,
+		name:    GetCommandToolName(command),
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+var invalidToolNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// GetCommandToolName returns the name of the command prefixed by its parents, joined with _,
+// as model providers only accept letters, digits, _ and - in tool names.
+func GetCommandToolName(command *GeppettoCommand) string {
+	name := strings.Join(append(append([]string{}, command.Parents...), command.Name), "_")
+	return invalidToolNameCharacters.ReplaceAllString(name, "_")
+}
+
+func (t *GeppettoCommandTool) GetName() string {
+	return t.name
+}
+
+func (t *GeppettoCommandTool) GetDescription() string {
+	if t.command.Long != "" {
+		return t.command.Short + "\n\n" + t.command.Long
+	}
+	return t.command.Short
+}
+
+func (t *GeppettoCommandTool) GetParameters() json.RawMessage {
+	b, err := json.Marshal(helpers.ParameterDefinitionsToJsonSchema(getCommandParameterDefinitions(t.command)))
+	if err != nil {
+		log.Warn().Err(err).Str("command", t.command.Name).Msg("could not marshal command schema")
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return b
+}
+
+func (t *GeppettoCommandTool) Call(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+	var b bytes.Buffer
+	err := RunGeppettoCommandWithValues(ctx, t.command, arguments, &b, t.profileFile, t.profile)
+	if err != nil {
+		return nil, err
+	}
+	return b.String(), nil
+}
+
+func getCommandParameterDefinitions(command *GeppettoCommand) []*parameters.ParameterDefinition {
+	return append(command.GetDefaultFlags().ToList(), command.GetDefaultArguments().ToList()...)
+}
+
+// NewGeppettoCommandPrompt exposes a geppetto command as an MCP prompt. The prompt arguments are the
+// flags and arguments of the command, and the prompt messages are the rendered messages of the command,
+// without running it.
+//
+// MCP prompts only have user and assistant messages, so the system prompt is sent as the first user message.
+func NewGeppettoCommandPrompt(command *GeppettoCommand, profileFile string, profile string) *mcp.ServerPrompt {
+	pds := getCommandParameterDefinitions(command)
+
+	prompt := mcp.Prompt{
+		Name:        GetCommandToolName(command),
+		Description: command.Short,
+		Arguments:   []mcp.PromptArgument{},
+	}
+	for _, pd := range pds {
+		prompt.Arguments = append(prompt.Arguments, mcp.PromptArgument{
+			Name:        pd.Name,
+			Description: pd.Help,
+			Required:    pd.Required,
+		})
+	}
+
+	return &mcp.ServerPrompt{
+		Prompt: prompt,
+		Render: func(ctx context.Context, arguments map[string]string) (*mcp.GetPromptResult, error) {
+			values := map[string]interface{}{}
+			for _, pd := range pds {
+				v, ok := arguments[pd.Name]
+				if !ok {
+					continue
+				}
+				parsed, err := pd.ParseParameter([]string{v})
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid value for argument %s", pd.Name)
+				}
+				values[pd.Name] = parsed.Value
+			}
+
+			parsedLayers, err := ParseGeppettoParametersFromMap(
+				command.Description(),
+				map[string]map[string]interface{}{layers.DefaultSlug: values},
+				profileFile, profile,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			contextManager := conversation.NewManager()
+			err = command.InitializeContextManager(contextManager, parsedLayers.GetDataMap())
+			if err != nil {
+				return nil, err
+			}
+
+			ret := &mcp.GetPromptResult{
+				Description: command.Short,
+				Messages:    []mcp.PromptMessage{},
+			}
+			for _, message := range contextManager.GetConversation() {
+				content, ok := message.Content.(*conversation.ChatMessageContent)
+				if !ok {
+					continue
+				}
+				role := "user"
+				if content.Role == conversation.RoleAssistant {
+					role = "assistant"
+				}
+				ret.Messages = append(ret.Messages, mcp.PromptMessage{
+					Role:    role,
+					Content: mcp.NewTextContent(content.Text),
+				})
+			}
+
+			return ret, nil
+		},
+	}
+}
@@ -0,0 +1,175 @@
+package cmds
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/geppetto/pkg/mcp"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/middlewares"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// ParseGeppettoParametersFromMap parses the parameters of a command from a map of layer slug -> parameter values,
+// instead of from the command line. The parameters not provided in values are loaded from the
+// given pinocchio profile, the viper configuration and the defaults, just like with the cobra middlewares.
+func ParseGeppettoParametersFromMap(
+	description *cmds.CommandDescription,
+	values map[string]map[string]interface{},
+	profileFile string,
+	profile string,
+) (*layers.ParsedLayers, error) {
+	middlewares_ := []middlewares.Middleware{
+		middlewares.UpdateFromMap(values, parameters.WithParseStepSource("map")),
+	}
+
+	profileMiddlewares, err := GetGeppettoProfileMiddlewares(profileFile, profile)
+	if err != nil {
+		return nil, err
+	}
+	middlewares_ = append(middlewares_, profileMiddlewares...)
+
+	parsedLayers := layers.NewParsedLayers()
+	err = middlewares.ExecuteMiddlewares(description.Layers, parsedLayers, middlewares_...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsedLayers, nil
+}
+
+// blockedRequestLayers can't be set by clients, as they access the files and processes of the server.
+// Only the system prompt of the helpers layer can be set.
+var blockedRequestLayers = map[string]bool{
+	GeppettoHelpersSlug: true,
+	mcp.McpSlug:         true,
+}
+
+// IsBlockedRequestParameter returns true for the parameters that clients running a command,
+// for example over JSON-RPC or HTTP, can't set.
+func IsBlockedRequestParameter(slug string, name string) bool {
+	if blockedRequestLayers[slug] {
+		return !(slug == GeppettoHelpersSlug && name == "system")
+	}
+	// the API keys of the server would be sent to a base URL chosen by the client
+	return strings.HasSuffix(name, "-api-key") || strings.HasSuffix(name, "-base-url")
+}
+
+// CheckRequestParameters returns an error if values set a parameter that clients can't set,
+// see IsBlockedRequestParameter.
+func CheckRequestParameters(values map[string]map[string]interface{}) error {
+	for slug, layerValues := range values {
+		for name := range layerValues {
+			if IsBlockedRequestParameter(slug, name) {
+				return errors.Errorf("parameter %s of layer %s can't be set by clients", name, slug)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseGeppettoRequestParameters parses the parameters sent by a client to run a command, for example
+// over JSON-RPC or HTTP, by layer slug and parameter name. Unlike ParseGeppettoParametersFromMap,
+// unknown parameters and missing required arguments are errors, and the command never waits for
+// the terminal to continue in chat mode.
+func ParseGeppettoRequestParameters(
+	description *cmds.CommandDescription,
+	values map[string]map[string]interface{},
+	profileFile string,
+	profile string,
+) (*layers.ParsedLayers, error) {
+	values_ := map[string]map[string]interface{}{}
+	for slug, layerValues := range values {
+		layer, ok := description.Layers.Get(slug)
+		if !ok {
+			return nil, errors.Errorf("unknown parameter layer %s", slug)
+		}
+		pds := layer.GetParameterDefinitions()
+		values_[slug] = map[string]interface{}{}
+		for name, value := range layerValues {
+			if _, ok := pds.Get(name); !ok {
+				return nil, errors.Errorf("unknown parameter %s in layer %s", name, slug)
+			}
+			values_[slug][name] = value
+		}
+	}
+
+	// required parameters have no default, and are not read from the profiles
+	err := description.Layers.ForEachE(func(slug string, layer layers.ParameterLayer) error {
+		return layer.GetParameterDefinitions().ForEachE(func(pd *parameters.ParameterDefinition) error {
+			if _, ok := values_[slug][pd.Name]; pd.Required && !ok {
+				return errors.Errorf("missing required parameter %s", pd.Name)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := description.Layers.Get(GeppettoHelpersSlug); ok {
+		if values_[GeppettoHelpersSlug] == nil {
+			values_[GeppettoHelpersSlug] = map[string]interface{}{}
+		}
+		values_[GeppettoHelpersSlug]["non-interactive"] = true
+		values_[GeppettoHelpersSlug]["chat"] = false
+		values_[GeppettoHelpersSlug]["repl"] = false
+	}
+
+	return ParseGeppettoParametersFromMap(description, values_, profileFile, profile)
+}
+
+// RunGeppettoCommandWithValues runs a geppetto command with the given flag and argument values,
+// and writes the result into w. The command never asks to continue in chat mode.
+// The remaining parameters are loaded from the given profile (see ParseGeppettoParametersFromMap).
+//
+// This is used to run commands programmatically, for example as the implementation of a tool.
+func RunGeppettoCommandWithValues(
+	ctx context.Context,
+	command *GeppettoCommand,
+	values map[string]interface{},
+	w io.Writer,
+	profileFile string,
+	profile string,
+) error {
+	parsedLayers, err := ParseGeppettoParametersFromMap(
+		command.Description(),
+		map[string]map[string]interface{}{
+			layers.DefaultSlug: values,
+			GeppettoHelpersSlug: {
+				"non-interactive": true,
+			},
+		},
+		profileFile, profile,
+	)
+	if err != nil {
+		return err
+	}
+
+	return command.RunIntoWriter(ctx, parsedLayers, w)
+}
+
+type eventHandler struct {
+	name string
+	f    func(msg *message.Message) error
+}
+
+type eventHandlersContextKey struct{}
+
+// WithEventHandler returns a context in which RunIntoWriter also passes the events published
+// by the steps of the command to f, for example to stream them to a client.
+// Events are delivered to f synchronously, so f has seen all the events once RunIntoWriter returns.
+// As f exports the events, they are transformed by --drop-events and --redact-events.
+func WithEventHandler(ctx context.Context, name string, f func(msg *message.Message) error) context.Context {
+	handlers := append(getEventHandlers(ctx), eventHandler{name: name, f: f})
+	return context.WithValue(ctx, eventHandlersContextKey{}, handlers)
+}
+
+func getEventHandlers(ctx context.Context) []eventHandler {
+	handlers, _ := ctx.Value(eventHandlersContextKey{}).([]eventHandler)
+	// copied, so that contexts derived from the same parent don't share handlers
+	return append([]eventHandler{}, handlers...)
+}
@@ -0,0 +1,194 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const runTimestampFormat = "2006-01-02T15-04-05"
+
+var runFileRegexp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2})-(.*)-([0-9a-f]{8})\.jsonl$`)
+
+// DefaultRunsDir returns the directory where runs are recorded,
+// $XDG_DATA_HOME/pinocchio/runs, by default ~/.local/share/pinocchio/runs.
+func DefaultRunsDir() (string, error) {
+	dataDir, err := helpers.GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "runs"), nil
+}
+
+// NewRunEventLog creates the event log recording a run of the command name in runsDir,
+// or in the default runs directory if runsDir is empty.
+func NewRunEventLog(runsDir string, name string) (*events.EventLog, error) {
+	if runsDir == "" {
+		var err error
+		runsDir, err = DefaultRunsDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fileName := fmt.Sprintf("%s-%s-%s.jsonl",
+		time.Now().Format(runTimestampFormat),
+		sanitizeRunName(name),
+		uuid.New().String()[:8],
+	)
+	return events.NewEventLog(filepath.Join(runsDir, fileName))
+}
+
+func sanitizeRunName(name string) string {
+	if name == "" {
+		return "run"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// RunID returns the ID of the run recorded in the event log at path, which is the name of the file.
+func RunID(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".jsonl")
+}
+
+// DefaultCheckpointsDir returns the directory where the checkpoints of runs are stored, in runsDir
+// or in the default runs directory if runsDir is empty.
+func DefaultCheckpointsDir(runsDir string) (string, error) {
+	if runsDir == "" {
+		var err error
+		runsDir, err = DefaultRunsDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(runsDir, "checkpoints"), nil
+}
+
+// RunInfo summarizes a recorded run.
+type RunInfo struct {
+	ID        string
+	Path      string
+	Name      string
+	StartedAt time.Time
+	EndedAt   time.Time
+	Events    int
+	Errors    int
+	StepTypes []string
+	Engine    string
+}
+
+// GetRunInfo reads the event log of a run and summarizes it.
+func GetRunInfo(path string) (*RunInfo, error) {
+	entries, err := events.ReadEventLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &RunInfo{
+		ID:     RunID(path),
+		Path:   path,
+		Name:   RunID(path),
+		Events: len(entries),
+	}
+	if m := runFileRegexp.FindStringSubmatch(filepath.Base(path)); m != nil {
+		ret.Name = m[2]
+		if t, err := time.ParseInLocation(runTimestampFormat, m[1], time.Local); err == nil {
+			ret.StartedAt = t
+		}
+	}
+
+	stepIDs := map[uuid.UUID]bool{}
+	for i, entry := range entries {
+		if i == 0 {
+			ret.StartedAt = entry.Timestamp
+		}
+		ret.EndedAt = entry.Timestamp
+
+		var e struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(entry.Event, &e); err == nil && e.Type == "error" {
+			ret.Errors++
+		}
+
+		if entry.Step == nil || stepIDs[entry.Step.StepID] {
+			continue
+		}
+		stepIDs[entry.Step.StepID] = true
+		ret.StepTypes = append(ret.StepTypes, entry.Step.Type)
+		if ret.Engine == "" {
+			ret.Engine = getStepEngine(entry.Step)
+		}
+	}
+
+	return ret, nil
+}
+
+func getStepEngine(step *steps.StepMetadata) string {
+	settings_, ok := step.Metadata[steps.MetadataSettingsSlug].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	engine, _ := settings_["ai-engine"].(string)
+	return engine
+}
+
+// ListRuns returns the recorded runs in runsDir, most recent first.
+// Event logs that can't be read, for example because they were truncated, are skipped.
+func ListRuns(runsDir string) ([]*RunInfo, error) {
+	files, err := filepath.Glob(filepath.Join(runsDir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*RunInfo{}
+	for _, file := range files {
+		info, err := GetRunInfo(file)
+		if err != nil {
+			log.Warn().Err(err).Str("path", file).Msg("skipping unreadable run")
+			continue
+		}
+		ret = append(ret, info)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].StartedAt.After(ret[j].StartedAt)
+	})
+
+	return ret, nil
+}
+
+// RemoveRun deletes the event log of the run id in runsDir, and its checkpoints.
+func RemoveRun(runsDir string, id string) error {
+	if id == "" || filepath.Base(id) != id {
+		return errors.Errorf("invalid run ID %s", id)
+	}
+	err := os.Remove(filepath.Join(runsDir, id+".jsonl"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("run %s not found", id)
+		}
+		return err
+	}
+
+	checkpointsDir, err := DefaultCheckpointsDir(runsDir)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(checkpointsDir, id))
+}
@@ -0,0 +1,49 @@
+package cmds
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultRunsDir(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	runsDir, err := DefaultRunsDir()
+	require.NoError(t, err)
+	assert.Equal(t, "/data/pinocchio/runs", runsDir)
+}
+
+func TestListAndRemoveRuns(t *testing.T) {
+	runsDir := t.TempDir()
+	write := func(name string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(runsDir, name), []byte(content), 0644))
+	}
+	write("2024-01-01T10-00-00-chat-1a2b3c4d.jsonl",
+		`{"sequence_number":0,"timestamp":"2024-01-01T10:00:00Z","topic":"chat","event":{"type":"start"}}`+"\n")
+	write("2024-01-02T10-00-00-chat-5e6f7a8b.jsonl",
+		`{"sequence_number":0,"timestamp":"2024-01-02T10:00:00Z","topic":"chat","event":{"type":"start"}}`+"\n")
+	// a run killed while writing its log
+	write("2024-01-03T10-00-00-chat-9c0d1e2f.jsonl",
+		`{"sequence_number":0,"timestamp":"2024-01-03T10:00:00Z","topic":"chat","event":{"type":"start"}}`+"\n"+`{"sequence`)
+
+	runs, err := ListRuns(runsDir)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, "2024-01-02T10-00-00-chat-5e6f7a8b", runs[0].ID)
+	assert.Equal(t, "2024-01-01T10-00-00-chat-1a2b3c4d", runs[1].ID)
+
+	checkpointsDir := filepath.Join(runsDir, "checkpoints", runs[1].ID)
+	require.NoError(t, os.MkdirAll(checkpointsDir, 0755))
+	require.NoError(t, RemoveRun(runsDir, runs[1].ID))
+	_, err = os.Stat(checkpointsDir)
+	assert.True(t, os.IsNotExist(err))
+
+	runs, err = ListRuns(runsDir)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+
+	assert.Error(t, RemoveRun(runsDir, "2024-01-01T10-00-00-chat-1a2b3c4d"))
+	assert.Error(t, RemoveRun(runsDir, "../2024-01-02T10-00-00-chat-5e6f7a8b"))
+}
@@ -0,0 +1,322 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/claude"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/openai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/tokens"
+	"github.com/go-go-golems/geppetto/pkg/ui"
+	"github.com/pkg/errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// chatCommands are the slash commands available when continuing a command in chat.
+type chatCommands struct {
+	stepFactory *ai.StandardStepFactory
+	// newStep creates the chat step for the given settings, publishing its events where the chat displays them
+	newStep func(stepSettings *settings.StepSettings) (chat.Step, error)
+	// setStep replaces the step of the chat
+	setStep func(step chat.Step) error
+	manager *conversations.BranchingManager
+	store   *conversations.Store
+	// save stores the current conversation, and load replaces it with a stored conversation
+	save func() (*conversations.Conversation, error)
+	load func(stored *conversations.Conversation) error
+}
+
+func (c *chatCommands) SlashCommands() []*ui.SlashCommand {
+	return []*ui.SlashCommand{
+		{Name: "model", Args: "[engine]", Short: "show or change the model", Run: c.model},
+		{Name: "temperature", Args: "[value]", Short: "show or change the temperature", Run: c.temperature},
+		{Name: "system", Args: "<prompt>", Short: "replace the system prompt", Run: c.system},
+		{Name: "save", Args: "[file]", Short: "save the conversation to the store, or to a file", Run: c.saveConversation},
+		{Name: "load", Args: "<file|id>", Short: "load a conversation file, or a stored conversation", Run: c.loadConversation},
+		{Name: "tokens", Short: "show the size of the current conversation", Run: c.tokens},
+		{Name: "clear", Short: "start a new conversation with the same system prompt", Run: c.clear},
+		{Name: "run", Args: "<command> [args...]", Short: "add the output of a pinocchio command as a message", Run: c.run},
+	}
+}
+
+// updateStep rebuilds the chat step with modified settings, which are only kept if the step can be created.
+func (c *chatCommands) updateStep(update func(stepSettings *settings.StepSettings) error) error {
+	stepSettings := c.stepFactory.Settings.Clone()
+	err := update(stepSettings)
+	if err != nil {
+		return err
+	}
+	step, err := c.newStep(stepSettings)
+	if err != nil {
+		return err
+	}
+	err = c.setStep(step)
+	if err != nil {
+		return err
+	}
+	c.stepFactory.Settings = stepSettings
+	return nil
+}
+
+func (c *chatCommands) engine() string {
+	if c.stepFactory.Settings.Chat.Engine == nil {
+		return ""
+	}
+	return *c.stepFactory.Settings.Chat.Engine
+}
+
+func (c *chatCommands) model(ctx context.Context, args string) (tea.Cmd, error) {
+	if args == "" {
+		return ui.Outputf("model: %s", c.engine()), nil
+	}
+
+	err := c.updateStep(func(stepSettings *settings.StepSettings) error {
+		stepSettings.Chat.Engine = &args
+		switch {
+		case openai.IsOpenAiEngine(args), claude.IsClaudeEngine(args):
+			// let the step factory pick the API of the new engine
+			stepSettings.Chat.ApiType = nil
+		case stepSettings.Chat.ApiType == nil:
+			return errors.Errorf("unknown engine %s, set --ai-api-type to use it", args)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ui.Outputf("model: %s", args), nil
+}
+
+func (c *chatCommands) temperature(ctx context.Context, args string) (tea.Cmd, error) {
+	if args == "" {
+		if c.stepFactory.Settings.Chat.Temperature == nil {
+			return ui.Output("temperature: default"), nil
+		}
+		return ui.Outputf("temperature: %g", *c.stepFactory.Settings.Chat.Temperature), nil
+	}
+
+	temperature, err := strconv.ParseFloat(args, 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid temperature %s", args)
+	}
+	err = c.updateStep(func(stepSettings *settings.StepSettings) error {
+		stepSettings.Chat.Temperature = &temperature
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ui.Outputf("temperature: %g", temperature), nil
+}
+
+func (c *chatCommands) system(ctx context.Context, args string) (tea.Cmd, error) {
+	if args == "" {
+		return nil, errors.New("missing system prompt")
+	}
+	c.manager.SetSystemPrompt(args)
+	return ui.Output("system prompt replaced"), nil
+}
+
+func (c *chatCommands) saveConversation(ctx context.Context, args string) (tea.Cmd, error) {
+	stored, err := c.save()
+	if err != nil {
+		return nil, err
+	}
+	if args == "" {
+		return ui.Outputf("saved conversation %s", stored.ID), nil
+	}
+
+	err = conversations.WriteFile(args, stored)
+	if err != nil {
+		return nil, err
+	}
+	return ui.Outputf("saved conversation %s to %s", stored.ID, args), nil
+}
+
+func (c *chatCommands) loadConversation(ctx context.Context, args string) (tea.Cmd, error) {
+	if args == "" {
+		return nil, errors.New("missing file or conversation ID")
+	}
+
+	var stored *conversations.Conversation
+	var err error
+	if _, statErr := os.Stat(args); statErr == nil {
+		stored, err = conversations.ReadFile(args)
+	} else {
+		stored, err = c.store.Load(args)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the current conversation before replacing it
+	_, err = c.save()
+	if err != nil {
+		return nil, err
+	}
+	err = c.load(stored)
+	if err != nil {
+		return nil, err
+	}
+	return ui.Outputf("loaded conversation %s (%d messages)", stored.ID, len(stored.Messages)), nil
+}
+
+func (c *chatCommands) clear(ctx context.Context, args string) (tea.Cmd, error) {
+	_, err := c.save()
+	if err != nil {
+		return nil, err
+	}
+
+	manager := conversation.NewManager()
+	thread := c.manager.GetConversation()
+	if len(thread) > 0 {
+		if content, ok := thread[0].Content.(*conversation.ChatMessageContent); ok && content.Role == conversation.RoleSystem {
+			manager.AppendMessages(conversation.NewChatMessage(conversation.RoleSystem, content.Text))
+		}
+	}
+	c.manager.Reset(manager)
+
+	return ui.Output("started a new conversation"), nil
+}
+
+func (c *chatCommands) tokens(ctx context.Context, args string) (tea.Cmd, error) {
+	engine := c.engine()
+	counter, err := tokens.NewCounter(engine)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := c.manager.GetConversation()
+	count := counter.CountConversation(thread)
+
+	return ui.Outputf("%d tokens in %d messages (%s, %s)", count, len(thread), engine, counter.Tokenizer.Name()), nil
+}
+
+// runHelperFlags are passed to the commands run by /run, which have no terminal to ask to continue
+// in chat, and whose runs are part of the chat rather than separate recorded runs.
+var runHelperFlags = []string{"--non-interactive", "--no-record"}
+
+// run runs pinocchio with the given arguments, and adds its output as a user message.
+func (c *chatCommands) run(ctx context.Context, args string) (tea.Cmd, error) {
+	argv, err := splitArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("missing command")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() tea.Msg {
+		stdout, stderr, err := runCommand(ctx, executable, withRunHelperFlags(argv))
+		// commands that aren't prompts, like conversations export, don't have the helper flags
+		if err != nil && isUnknownHelperFlagError(stderr) {
+			stdout, stderr, err = runCommand(ctx, executable, argv)
+		}
+		if err != nil {
+			return ui.SlashCommandOutputMsg{Err: errors.Wrapf(err, "/run %s: %s", argv[0], lastLine(stderr))}
+		}
+
+		text := strings.TrimSpace(stdout)
+		if text == "" {
+			return ui.SlashCommandOutputMsg{Text: fmt.Sprintf("%s had no output", argv[0])}
+		}
+		return ui.InjectMessagesMsg{
+			Messages: []*conversation.Message{conversation.NewChatMessage(conversation.RoleUser, text)},
+		}
+	}, nil
+}
+
+func runCommand(ctx context.Context, executable string, argv []string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, executable, argv...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// withRunHelperFlags adds the helper flags to argv, before the "--" ending the flags if there is one.
+func withRunHelperFlags(argv []string) []string {
+	ret := []string{}
+	for i, arg := range argv {
+		if arg == "--" {
+			ret = append(ret, runHelperFlags...)
+			return append(ret, argv[i:]...)
+		}
+		ret = append(ret, arg)
+	}
+	return append(ret, runHelperFlags...)
+}
+
+func isUnknownHelperFlagError(stderr string) bool {
+	for _, flag := range runHelperFlags {
+		if strings.Contains(stderr, "unknown flag: "+flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
+
+// splitArgs splits a command line into arguments, the way a shell would for quoted
+// and escaped arguments, without any expansion.
+func splitArgs(s string) ([]string, error) {
+	ret := []string{}
+	current := strings.Builder{}
+	inArg := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '\'':
+			current.WriteRune(r)
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				ret = append(ret, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		ret = append(ret, current.String())
+	}
+	return ret, nil
+}
@@ -0,0 +1,28 @@
+package cmds
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`code go  "explain this" --flag='a b' escaped\ space "quoted \"word\""`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"code", "go", "explain this", "--flag=a b", "escaped space", `quoted "word"`}, args)
+
+	_, err = splitArgs(`unterminated "quote`)
+	assert.Error(t, err)
+}
+
+func TestWithRunHelperFlags(t *testing.T) {
+	assert.Equal(t,
+		[]string{"code", "go", "--non-interactive", "--no-record"},
+		withRunHelperFlags([]string{"code", "go"}))
+	assert.Equal(t,
+		[]string{"code", "go", "--non-interactive", "--no-record", "--", "--not-a-flag"},
+		withRunHelperFlags([]string{"code", "go", "--", "--not-a-flag"}))
+
+	assert.True(t, isUnknownHelperFlagError("Error: unknown flag: --non-interactive\n"))
+	assert.False(t, isUnknownHelperFlagError("Error: unknown flag: --format\n"))
+}
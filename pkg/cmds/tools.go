@@ -0,0 +1,475 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	glazedcmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/alias"
+	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/helpers/templating"
+	"github.com/pkg/errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ToolDescription declares a tool that the model can call, in the tools: section of a command YAML file.
+//
+// The arguments of the tool are described either by a JSON schema (parameters)
+// or by a list of glazed parameter definitions (flags).
+// Exactly one of Shell, Exec, Command and HTTP provides the implementation.
+type ToolDescription struct {
+	Name        string                            `yaml:"name"`
+	Description string                            `yaml:"description,omitempty"`
+	Parameters  map[string]interface{}            `yaml:"parameters,omitempty"`
+	Flags       []*parameters.ParameterDefinition `yaml:"flags,omitempty"`
+
+	// Shell is a command template, rendered with the tool arguments and run with sh -c.
+	// The arguments are also passed as TOOL_ARG_<NAME> environment variables. As they are chosen
+	// by the model, they have to be quoted with shellquote when they are put into the template.
+	Shell string `yaml:"shell,omitempty"`
+	// Exec is a command line, whose elements are templates rendered with the tool arguments,
+	// run without shell.
+	Exec []string `yaml:"exec,omitempty"`
+	// Command is the path to another geppetto command YAML file, run with the tool arguments as flags.
+	// Relative paths are resolved against the directory of the YAML file declaring the tool.
+	Command string `yaml:"command,omitempty"`
+	// HTTP is an HTTP endpoint called with the tool arguments.
+	HTTP *HTTPToolDescription `yaml:"http,omitempty"`
+
+	// commandFS and commandDir locate the YAML file declaring the tool, see setCommandDir.
+	commandFS  fs.FS
+	commandDir string
+}
+
+// HTTPToolDescription describes an HTTP endpoint backing a tool.
+// The URL and headers are templates rendered with the tool arguments.
+// GET requests pass the arguments as query parameters, all other methods as JSON body.
+type HTTPToolDescription struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+func (t *ToolDescription) Validate() error {
+	if t.Name == "" {
+		return errors.New("tool is missing a name")
+	}
+
+	implementations := 0
+	if t.Shell != "" {
+		implementations++
+	}
+	if len(t.Exec) > 0 {
+		implementations++
+	}
+	if t.Command != "" {
+		implementations++
+	}
+	if t.HTTP != nil {
+		implementations++
+	}
+	if implementations != 1 {
+		return errors.Errorf("tool %s needs exactly one of shell, exec, command or http", t.Name)
+	}
+
+	if t.Shell != "" {
+		err := checkShellTemplate(t.Shell)
+		if err != nil {
+			return errors.Wrapf(err, "tool %s", t.Name)
+		}
+	}
+
+	if len(t.Parameters) > 0 && len(t.Flags) > 0 {
+		return errors.Errorf("tool %s: parameters and flags are mutually exclusive", t.Name)
+	}
+
+	if t.HTTP != nil && t.HTTP.URL == "" {
+		return errors.Errorf("tool %s is missing an http url", t.Name)
+	}
+
+	return nil
+}
+
+// ToTool creates the tool described by the description.
+// Command tools load their command file at this point.
+func (t *ToolDescription) ToTool() (tools.Tool, error) {
+	err := t.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &tools.ToolFunc{
+		Name:        t.Name,
+		Description: t.Description,
+	}
+
+	flags := t.Flags
+
+	switch {
+	case t.Shell != "":
+		ret.Function = t.runShell
+	case len(t.Exec) > 0:
+		ret.Function = t.runExec
+	case t.HTTP != nil:
+		ret.Function = t.callHTTP
+	case t.Command != "":
+		command, err := t.loadCommand()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load command for tool %s", t.Name)
+		}
+		commandTool := NewGeppettoCommandTool(command)
+		if ret.Description == "" {
+			ret.Description = commandTool.GetDescription()
+		}
+		if len(t.Parameters) == 0 && len(flags) == 0 {
+			ret.Parameters = commandTool.GetParameters()
+		}
+		ret.Function = commandTool.Call
+	}
+
+	switch {
+	case len(t.Parameters) > 0:
+		ret.Parameters, err = json.Marshal(t.Parameters)
+		if err != nil {
+			return nil, err
+		}
+	case len(flags) > 0:
+		ret.Parameters, err = json.Marshal(helpers.ParameterDefinitionsToJsonSchema(flags))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// shellQuote quotes v as a single shell word.
+func shellQuote(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+var toolTemplateFuncs = template.FuncMap{
+	"shellquote": shellQuote,
+}
+
+func renderToolTemplate(name string, s string, arguments map[string]interface{}) (string, error) {
+	tmpl, err := templating.CreateTemplate(name).Funcs(toolTemplateFuncs).Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, arguments)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// checkShellTemplate checks that all the values of the arguments output by a shell template
+// are quoted with shellquote, so that the model can't inject shell code.
+func checkShellTemplate(s string) error {
+	tmpl, err := templating.CreateTemplate("shell").Funcs(toolTemplateFuncs).Parse(s)
+	if err != nil {
+		return err
+	}
+	if tmpl.Tree == nil {
+		return nil
+	}
+	return checkShellNode(tmpl.Tree.Root)
+}
+
+func checkShellNode(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkShellNode(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		// actions that don't use the arguments, like {{ env "HOME" }}, are left as is
+		if !usesArguments(n.Pipe) {
+			return nil
+		}
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if len(n.Pipe.Decl) > 0 {
+			return nil
+		}
+		if identifier, ok := last.Args[0].(*parse.IdentifierNode); !ok || identifier.Ident != "shellquote" {
+			return errors.Errorf("shell template action %s has to be quoted with shellquote", n.String())
+		}
+	case *parse.IfNode:
+		return checkShellBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return checkShellBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkShellBranch(&n.BranchNode)
+	}
+	return nil
+}
+
+func checkShellBranch(n *parse.BranchNode) error {
+	if err := checkShellNode(n.List); err != nil {
+		return err
+	}
+	if n.ElseList != nil {
+		return checkShellNode(n.ElseList)
+	}
+	return nil
+}
+
+func usesArguments(pipe *parse.PipeNode) bool {
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode, *parse.VariableNode, *parse.DotNode, *parse.ChainNode:
+				return true
+			case *parse.PipeNode:
+				if usesArguments(a) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// getParameterNames returns the names of the declared parameters of the tool.
+func (t *ToolDescription) getParameterNames() map[string]bool {
+	ret := map[string]bool{}
+	for _, flag := range t.Flags {
+		ret[flag.Name] = true
+	}
+	switch properties := t.Parameters["properties"].(type) {
+	case map[string]interface{}:
+		for name := range properties {
+			ret[name] = true
+		}
+	case map[interface{}]interface{}:
+		for name := range properties {
+			ret[fmt.Sprint(name)] = true
+		}
+	}
+	return ret
+}
+
+// checkArguments rejects the arguments that aren't declared parameters of the tool.
+func (t *ToolDescription) checkArguments(arguments map[string]interface{}) error {
+	names := t.getParameterNames()
+	for k := range arguments {
+		if !names[k] {
+			return errors.Errorf("tool %s has no parameter %s", t.Name, k)
+		}
+	}
+	return nil
+}
+
+// ToolArgumentEnvPrefix prefixes the names of the environment variables holding the tool arguments.
+const ToolArgumentEnvPrefix = "TOOL_ARG_"
+
+var nonEnvCharacterRegexp = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// argumentsEnvironment passes the arguments as environment variables named TOOL_ARG_<NAME>,
+// strings as is and other values as JSON. The prefix keeps the model from setting variables like PATH.
+func argumentsEnvironment(arguments map[string]interface{}) []string {
+	ret := os.Environ()
+	for k, v := range arguments {
+		s, ok := v.(string)
+		if !ok {
+			b, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			s = string(b)
+		}
+		name := ToolArgumentEnvPrefix + strings.ToUpper(nonEnvCharacterRegexp.ReplaceAllString(k, "_"))
+		ret = append(ret, name+"="+s)
+	}
+	return ret
+}
+
+func (t *ToolDescription) runShell(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+	err := t.checkArguments(arguments)
+	if err != nil {
+		return nil, err
+	}
+	command, err := renderToolTemplate("shell", t.Shell, arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.run(exec.CommandContext(ctx, "sh", "-c", command), arguments)
+}
+
+func (t *ToolDescription) runExec(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+	err := t.checkArguments(arguments)
+	if err != nil {
+		return nil, err
+	}
+	argv := []string{}
+	for _, arg := range t.Exec {
+		arg_, err := renderToolTemplate("exec", arg, arguments)
+		if err != nil {
+			return nil, err
+		}
+		argv = append(argv, arg_)
+	}
+
+	return t.run(exec.CommandContext(ctx, argv[0], argv[1:]...), arguments)
+}
+
+func (t *ToolDescription) run(cmd *exec.Cmd, arguments map[string]interface{}) (interface{}, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Env = argumentsEnvironment(arguments)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, errors.Wrapf(err, "tool %s failed: %s", t.Name, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+func (t *ToolDescription) callHTTP(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+	url_, err := renderToolTemplate("url", t.HTTP.URL, arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(t.HTTP.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if method == http.MethodGet {
+		u, err := url.Parse(url_)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		for k, v := range arguments {
+			q.Set(k, fmt.Sprintf("%v", v))
+		}
+		u.RawQuery = q.Encode()
+		url_ = u.String()
+	} else {
+		b, err := json.Marshal(arguments)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url_, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range t.HTTP.Headers {
+		v_, err := renderToolTemplate("header", v, arguments)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v_)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Errorf("tool %s: HTTP %d: %s", t.Name, resp.StatusCode, string(respBody))
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(respBody, &v); err == nil {
+		return v, nil
+	}
+
+	return string(respBody), nil
+}
+
+// setCommandDir records the directory of the YAML file declaring the tool, in which relative
+// command paths are resolved.
+func (t *ToolDescription) setCommandDir(f fs.FS, dir string) {
+	t.commandFS = f
+	t.commandDir = dir
+}
+
+func (t *ToolDescription) loadCommand() (*GeppettoCommand, error) {
+	fileName := os.ExpandEnv(t.Command)
+	if filepath.IsAbs(fileName) || t.commandFS == nil {
+		return loadGeppettoCommandFromFile(fileName)
+	}
+
+	fileName = path.Join(t.commandDir, filepath.ToSlash(fileName))
+	if !fs.ValidPath(fileName) {
+		return nil, errors.Errorf("command %s is outside of the directory of the tool", t.Command)
+	}
+	return loadGeppettoCommandFromFS(t.commandFS, fileName)
+}
+
+func loadGeppettoCommandFromFile(fileName string) (*GeppettoCommand, error) {
+	fs_, filePath, err := loaders.FileNameToFsFilePath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return loadGeppettoCommandFromFS(fs_, filePath)
+}
+
+func loadGeppettoCommandFromFS(f fs.FS, fileName string) (*GeppettoCommand, error) {
+	cmds_, err := (&GeppettoCommandLoader{}).LoadCommands(
+		f, fileName,
+		[]glazedcmds.CommandDescriptionOption{}, []alias.Option{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmds_) != 1 {
+		return nil, errors.Errorf("expected exactly one command in %s, got %d", fileName, len(cmds_))
+	}
+
+	command, ok := cmds_[0].(*GeppettoCommand)
+	if !ok {
+		return nil, errors.Errorf("%s is not a geppetto command", fileName)
+	}
+
+	return command, nil
+}
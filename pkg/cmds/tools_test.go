@@ -0,0 +1,142 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const weatherToolsYAML = `
+- name: get_weather
+  description: Get the weather
+  flags:
+    - name: city
+      type: string
+      help: The city
+      required: true
+    - name: unit
+      type: choice
+      choices: [celsius, fahrenheit]
+  shell: "echo weather in {{ .city | shellquote }} $TOOL_ARG_UNIT"
+- name: broken
+  shell: "echo foo"
+  http:
+    url: http://localhost
+`
+
+func TestToolDescriptionFromYAML(t *testing.T) {
+	var tools []*ToolDescription
+	err := yaml.Unmarshal([]byte(weatherToolsYAML), &tools)
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+
+	assert.Error(t, tools[1].Validate())
+
+	tool, err := tools[0].ToTool()
+	require.NoError(t, err)
+	assert.Equal(t, "get_weather", tool.GetName())
+	assert.Equal(t, "Get the weather", tool.GetDescription())
+
+	var schema map[string]interface{}
+	err = json.Unmarshal(tool.GetParameters(), &schema)
+	require.NoError(t, err)
+	assert.Equal(t, "object", schema["type"])
+	assert.Equal(t, []interface{}{"city"}, schema["required"])
+	properties := schema["properties"].(map[string]interface{})
+	assert.Equal(t, "string", properties["city"].(map[string]interface{})["type"])
+	assert.Equal(t,
+		[]interface{}{"celsius", "fahrenheit"},
+		properties["unit"].(map[string]interface{})["enum"])
+
+	res, err := tool.Call(context.Background(), map[string]interface{}{"city": "Paris", "unit": "celsius"})
+	require.NoError(t, err)
+	assert.Equal(t, "weather in Paris celsius\n", res)
+
+	// arguments are quoted and can't run shell code
+	res, err = tool.Call(context.Background(), map[string]interface{}{"city": "x'; echo pwned; '", "unit": "$(echo pwned)"})
+	require.NoError(t, err)
+	assert.Equal(t, "weather in x'; echo pwned; ' $(echo pwned)\n", res)
+
+	// undeclared arguments, which could set variables like PATH, are rejected
+	_, err = tool.Call(context.Background(), map[string]interface{}{"city": "Paris", "PATH": "/tmp"})
+	assert.Error(t, err)
+}
+
+func TestToolDescriptionShellQuoting(t *testing.T) {
+	for _, shell := range []string{
+		"echo {{ .city }}",
+		"echo {{ if .city }}{{ .city }}{{ end }}",
+		"echo {{ printf \"%s\" .city }}",
+	} {
+		assert.Error(t, (&ToolDescription{Name: "echo", Shell: shell}).Validate(), shell)
+	}
+	for _, shell := range []string{
+		"echo {{ .city | shellquote }}",
+		"echo {{ if .city }}{{ shellquote .city }}{{ end }}",
+		"echo {{ env \"HOME\" }} \"$TOOL_ARG_CITY\"",
+	} {
+		assert.NoError(t, (&ToolDescription{Name: "echo", Shell: shell}).Validate(), shell)
+	}
+}
+
+func TestToolDescriptionExec(t *testing.T) {
+	tool, err := (&ToolDescription{
+		Name:       "echo",
+		Exec:       []string{"sh", "-c", "echo weather in \"$1\" $TOOL_ARG_DAYS_AHEAD", "sh", "{{ .city }}"},
+		Parameters: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{}, "days-ahead": map[string]interface{}{}}},
+	}).ToTool()
+	require.NoError(t, err)
+
+	res, err := tool.Call(context.Background(), map[string]interface{}{"city": "Paris; echo pwned", "days-ahead": 2})
+	require.NoError(t, err)
+	assert.Equal(t, "weather in Paris; echo pwned 2\n", res)
+
+	_, err = tool.Call(context.Background(), map[string]interface{}{"city": "Paris", "LD_PRELOAD": "/tmp/x.so"})
+	assert.Error(t, err)
+}
+
+func TestToolDescriptionCommandPath(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tools"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tools", "summarize.yaml"), []byte(`name: summarize
+short: Summarize a text
+prompt: "Summarize {{ .text }}"
+flags:
+  - name: text
+    type: string
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.yaml"), []byte(`name: main
+short: Main
+prompt: "hello"
+tools:
+  - name: summarize
+    command: tools/summarize.yaml
+`), 0644))
+
+	// the command path is resolved against the directory of main.yaml, not the working directory
+	command, err := loadGeppettoCommandFromFile(filepath.Join(dir, "main.yaml"))
+	require.NoError(t, err)
+	require.Len(t, command.Tools, 1)
+	tool, err := command.Tools[0].ToTool()
+	require.NoError(t, err)
+	assert.Equal(t, "Summarize a text", tool.GetDescription())
+}
+
+func TestToolDescriptionShellError(t *testing.T) {
+	tool, err := (&ToolDescription{
+		Name:  "fail",
+		Shell: "echo oops >&2; exit 1",
+		Flags: []*parameters.ParameterDefinition{},
+	}).ToTool()
+	require.NoError(t, err)
+
+	_, err = tool.Call(context.Background(), map[string]interface{}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oops")
+}
@@ -0,0 +1,173 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/google/uuid"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StepNode is a step of a recorded run, along with the steps it started.
+type StepNode struct {
+	StepID       uuid.UUID
+	ParentStepID uuid.UUID
+	Type         string
+	StartedAt    time.Time
+	EndedAt      time.Time
+	Events       int
+	Errors       []string
+	Usage        *steps.Usage
+	Children     []*StepNode
+	// Synthetic is true for steps that didn't publish any event, like composite steps,
+	// which are only known as the parent of other steps.
+	Synthetic bool
+}
+
+func (n *StepNode) Duration() time.Duration {
+	return n.EndedAt.Sub(n.StartedAt)
+}
+
+// Name returns the type of the step, or a shortened step ID for synthetic steps.
+func (n *StepNode) Name() string {
+	if n.Type != "" {
+		return n.Type
+	}
+	return "step " + n.StepID.String()[:8]
+}
+
+// Walk calls f on the node and its descendants, depth-first.
+func (n *StepNode) Walk(depth int, f func(node *StepNode, depth int) error) error {
+	err := f(n, depth)
+	if err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		err = child.Walk(depth+1, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildStepTree reconstructs the tree of steps of a recorded run from the parent step IDs
+// of their events, and returns the top-level steps ordered by start time.
+func BuildStepTree(entries []*events.LogEntry) []*StepNode {
+	nodes := map[uuid.UUID]*StepNode{}
+	order := []*StepNode{}
+
+	getNode := func(stepID uuid.UUID) *StepNode {
+		node, ok := nodes[stepID]
+		if !ok {
+			node = &StepNode{StepID: stepID, Synthetic: true}
+			nodes[stepID] = node
+			order = append(order, node)
+		}
+		return node
+	}
+
+	for _, entry := range entries {
+		if entry.Step == nil {
+			continue
+		}
+		node := getNode(entry.Step.StepID)
+		if node.Synthetic {
+			node.Synthetic = false
+			node.ParentStepID = entry.Step.ParentStepID
+			node.Type = entry.Step.Type
+			node.StartedAt = entry.Timestamp
+		}
+		node.EndedAt = entry.Timestamp
+		node.Events++
+
+		var e struct {
+			Type  string `json:"type"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(entry.Event, &e); err == nil && e.Type == "error" {
+			message := "unknown error"
+			if e.Error != nil {
+				message = e.Error.Message
+			}
+			node.Errors = append(node.Errors, message)
+		}
+
+		if usage, ok := entry.Step.Metadata[steps.MetadataUsageSlug].(map[string]interface{}); ok {
+			inputTokens, _ := usage["input_tokens"].(float64)
+			outputTokens, _ := usage["output_tokens"].(float64)
+			node.Usage = &steps.Usage{
+				InputTokens:  int(inputTokens),
+				OutputTokens: int(outputTokens),
+			}
+		}
+	}
+
+	roots := []*StepNode{}
+	// synthetic parents are appended to order while linking, and are linked in turn
+	for i := 0; i < len(order); i++ {
+		node := order[i]
+		if node.ParentStepID == uuid.Nil {
+			roots = append(roots, node)
+			continue
+		}
+		parent := getNode(node.ParentStepID)
+		parent.Children = append(parent.Children, node)
+	}
+
+	for _, root := range roots {
+		finishNode(root)
+	}
+	sortNodes(roots)
+
+	return roots
+}
+
+// finishNode computes the times of synthetic nodes from their children, and sorts the children by start time.
+func finishNode(node *StepNode) {
+	for _, child := range node.Children {
+		finishNode(child)
+		if node.Synthetic {
+			if node.StartedAt.IsZero() || child.StartedAt.Before(node.StartedAt) {
+				node.StartedAt = child.StartedAt
+			}
+			if child.EndedAt.After(node.EndedAt) {
+				node.EndedAt = child.EndedAt
+			}
+		}
+	}
+	sortNodes(node.Children)
+}
+
+func sortNodes(nodes []*StepNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].StartedAt.Before(nodes[j].StartedAt)
+	})
+}
+
+// PrintStepTree writes the step tree as an indented tree, with the duration, usage and errors of each step.
+func PrintStepTree(w io.Writer, roots []*StepNode) error {
+	for _, root := range roots {
+		err := root.Walk(0, func(node *StepNode, depth int) error {
+			line := strings.Repeat("  ", depth) + node.Name() + " " + node.Duration().Round(time.Millisecond).String()
+			if node.Usage != nil {
+				line += fmt.Sprintf(" tokens=%d/%d", node.Usage.InputTokens, node.Usage.OutputTokens)
+			}
+			for _, e := range node.Errors {
+				line += " error=" + fmt.Sprintf("%q", e)
+			}
+			_, err := fmt.Fprintln(w, line)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
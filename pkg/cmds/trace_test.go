@@ -0,0 +1,47 @@
+package cmds
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildStepTree(t *testing.T) {
+	ctx := steps.WithRunID(context.Background(), "run-1")
+	// the composite step doesn't publish events, and only shows up as a parent
+	composite := steps.NewStepMetadata(ctx, "chat-tool-step", "", "", nil)
+	ctx = steps.WithParentStep(ctx, composite)
+	completion := steps.NewStepMetadata(ctx, "openai-tool-completion", "", "", nil)
+	execution := steps.NewStepMetadata(ctx, "execute-tool-step", "", "", nil)
+	assert.Equal(t, composite.StepID, execution.ParentStepID)
+	assert.Equal(t, "run-1", execution.RunID)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*events.LogEntry{
+		{Timestamp: start, Step: completion, Event: []byte(`{"type":"start"}`)},
+		{Timestamp: start.Add(time.Second), Step: completion, Event: []byte(`{"type":"final"}`)},
+		{Timestamp: start.Add(2 * time.Second), Step: execution, Event: []byte(`{"type":"start"}`)},
+		{Timestamp: start.Add(3 * time.Second), Step: execution, Event: []byte(`{"type":"error","error":{"message":"tool failed"}}`)},
+	}
+
+	roots := BuildStepTree(entries)
+	require.Len(t, roots, 1)
+	root := roots[0]
+	assert.True(t, root.Synthetic)
+	assert.Equal(t, composite.StepID, root.StepID)
+	assert.Equal(t, 3*time.Second, root.Duration())
+	require.Len(t, root.Children, 2)
+	assert.Equal(t, "openai-tool-completion", root.Children[0].Type)
+	assert.Equal(t, []string{"tool failed"}, root.Children[1].Errors)
+
+	out := &strings.Builder{}
+	require.NoError(t, PrintStepTree(out, roots))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "  openai-tool-completion 1s"))
+}
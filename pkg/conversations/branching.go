@@ -0,0 +1,203 @@
+package conversations
+
+import (
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+// BranchingManager is a conversation manager whose current conversation is the thread leading
+// to the last message of the tree, rather than the leftmost thread. Moving the last message
+// allows regenerating answers and editing messages as sibling branches, and switching between
+// branches, while the conversation that is shown is always the one sent to the model.
+type BranchingManager struct {
+	*conversation.ManagerImpl
+
+	// leaves remembers the last message visited under each message that starts a branch,
+	// so that switching back to a branch restores where it was left.
+	leaves map[conversation.NodeID]conversation.NodeID
+}
+
+var _ conversation.Manager = (*BranchingManager)(nil)
+
+func NewBranchingManager(manager *conversation.ManagerImpl) *BranchingManager {
+	return &BranchingManager{
+		ManagerImpl: manager,
+		leaves:      map[conversation.NodeID]conversation.NodeID{},
+	}
+}
+
+// GetConversation returns the thread from the root of the tree to the last message.
+func (b *BranchingManager) GetConversation() conversation.Conversation {
+	return b.Tree.GetConversationThread(b.Tree.LastID)
+}
+
+// Fork makes id the last message, so that the next appended messages start a new branch
+// from it, next to its current children. Forking from conversation.NullNode starts a new root.
+func (b *BranchingManager) Fork(id conversation.NodeID) {
+	b.rememberLeaf()
+	b.Tree.LastID = id
+}
+
+// Remove removes the message id, which can't have children. If it was the last message,
+// its parent becomes the last message.
+func (b *BranchingManager) Remove(id conversation.NodeID) error {
+	msg, ok := b.Tree.Nodes[id]
+	if !ok {
+		return errors.Errorf("message %s not found", uuidString(id))
+	}
+	if len(msg.Children) > 0 {
+		return errors.Errorf("message %s has children", uuidString(id))
+	}
+
+	if parent, ok := b.Tree.Nodes[msg.ParentID]; ok {
+		children := []*conversation.Message{}
+		for _, child := range parent.Children {
+			if child.ID != id {
+				children = append(children, child)
+			}
+		}
+		parent.Children = children
+	}
+	delete(b.Tree.Nodes, id)
+
+	if b.Tree.RootID == id {
+		b.Tree.RootID = conversation.NullNode
+		if roots := b.roots(); len(roots) > 0 {
+			b.Tree.RootID = roots[0].ID
+		}
+	}
+	if b.Tree.LastID == id {
+		b.Tree.LastID = msg.ParentID
+		if _, ok := b.Tree.Nodes[msg.ParentID]; !ok {
+			b.Tree.LastID = b.Tree.RootID
+		}
+	}
+	return nil
+}
+
+// Reset replaces the conversation tree with the one of manager, for example to load another conversation.
+func (b *BranchingManager) Reset(manager *conversation.ManagerImpl) {
+	b.ManagerImpl = manager
+	b.leaves = map[conversation.NodeID]conversation.NodeID{}
+}
+
+// SetSystemPrompt replaces the text of the system message starting the current conversation,
+// or adds a system message before all the messages if there is none.
+func (b *BranchingManager) SetSystemPrompt(text string) {
+	thread := b.GetConversation()
+	if len(thread) > 0 {
+		if content, ok := thread[0].Content.(*conversation.ChatMessageContent); ok && content.Role == conversation.RoleSystem {
+			content.Text = text
+			thread[0].LastUpdate = time.Now()
+			return
+		}
+	}
+
+	msg := conversation.NewChatMessage(conversation.RoleSystem, text)
+	for _, root := range b.roots() {
+		root.ParentID = msg.ID
+		msg.Children = append(msg.Children, root)
+	}
+	b.Tree.Nodes[msg.ID] = msg
+	b.Tree.RootID = msg.ID
+	if b.Tree.LastID == conversation.NullNode {
+		b.Tree.LastID = msg.ID
+	}
+}
+
+// Siblings returns the messages sharing the parent of the message id, including itself,
+// in the order they were added.
+func (b *BranchingManager) Siblings(id conversation.NodeID) []*conversation.Message {
+	msg, ok := b.Tree.Nodes[id]
+	if !ok {
+		return nil
+	}
+	if parent, ok := b.Tree.Nodes[msg.ParentID]; ok {
+		return parent.Children
+	}
+	return b.roots()
+}
+
+// roots returns the messages without a parent, in the order they were added.
+func (b *BranchingManager) roots() []*conversation.Message {
+	ret := []*conversation.Message{}
+	for _, node := range b.Tree.Nodes {
+		if _, ok := b.Tree.Nodes[node.ParentID]; !ok {
+			ret = append(ret, node)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return ret
+}
+
+func uuidString(id conversation.NodeID) string {
+	return uuid.UUID(id).String()
+}
+
+// Branch describes the deepest fork of the current conversation, where branches can be switched.
+type Branch struct {
+	// Message is the message of the current conversation that has siblings.
+	Message *conversation.Message
+	// Index is the position of Message among its siblings, starting at 0.
+	Index int
+	Count int
+}
+
+// CurrentBranch returns the deepest message of the current conversation that has siblings,
+// or false if the conversation has no branches.
+func (b *BranchingManager) CurrentBranch() (Branch, bool) {
+	thread := b.GetConversation()
+	for i := len(thread) - 1; i >= 0; i-- {
+		siblings := b.Siblings(thread[i].ID)
+		if len(siblings) < 2 {
+			continue
+		}
+		for idx, sibling := range siblings {
+			if sibling.ID == thread[i].ID {
+				return Branch{Message: thread[i], Index: idx, Count: len(siblings)}, true
+			}
+		}
+	}
+	return Branch{}, false
+}
+
+// SwitchBranch switches the deepest fork of the current conversation to the sibling branch
+// offset positions away, wrapping around, and continues to the last message visited in that branch.
+func (b *BranchingManager) SwitchBranch(offset int) bool {
+	branch, ok := b.CurrentBranch()
+	if !ok {
+		return false
+	}
+	siblings := b.Siblings(branch.Message.ID)
+	idx := ((branch.Index+offset)%branch.Count + branch.Count) % branch.Count
+
+	b.rememberLeaf()
+	b.Tree.LastID = b.leafOf(siblings[idx])
+	return true
+}
+
+// rememberLeaf records the current last message as the leaf of each branch it belongs to.
+func (b *BranchingManager) rememberLeaf() {
+	for _, msg := range b.GetConversation() {
+		b.leaves[msg.ID] = b.Tree.LastID
+	}
+}
+
+// leafOf returns the remembered leaf of the branch starting at msg,
+// or follows the most recent children down to a leaf.
+func (b *BranchingManager) leafOf(msg *conversation.Message) conversation.NodeID {
+	if leaf, ok := b.leaves[msg.ID]; ok {
+		if _, ok := b.Tree.Nodes[leaf]; ok {
+			return leaf
+		}
+	}
+	for len(msg.Children) > 0 {
+		msg = msg.Children[len(msg.Children)-1]
+	}
+	return msg.ID
+}
@@ -0,0 +1,59 @@
+package conversations
+
+import (
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBranchingManager(t *testing.T) {
+	m := NewBranchingManager(conversation.NewManager())
+	question := conversation.NewChatMessage(conversation.RoleUser, "question")
+	first := conversation.NewChatMessage(conversation.RoleAssistant, "first")
+	m.AppendMessages(question, first)
+	m.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "follow-up"))
+
+	_, ok := m.CurrentBranch()
+	assert.False(t, ok)
+
+	// regenerate the first answer
+	m.Fork(question.ID)
+	assert.Equal(t, []string{"question"}, chatTexts(m.GetConversation()))
+	m.AppendMessages(conversation.NewChatMessage(conversation.RoleAssistant, "second"))
+	assert.Equal(t, []string{"question", "second"}, chatTexts(m.GetConversation()))
+
+	branch, ok := m.CurrentBranch()
+	require.True(t, ok)
+	assert.Equal(t, 1, branch.Index)
+	assert.Equal(t, 2, branch.Count)
+
+	// switching back restores the follow-up of the first answer
+	require.True(t, m.SwitchBranch(-1))
+	assert.Equal(t, []string{"question", "first", "follow-up"}, chatTexts(m.GetConversation()))
+	require.True(t, m.SwitchBranch(1))
+	assert.Equal(t, []string{"question", "second"}, chatTexts(m.GetConversation()))
+
+	// editing the question starts a new root branch
+	m.Fork(question.ParentID)
+	m.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "edited"))
+	assert.Equal(t, []string{"edited"}, chatTexts(m.GetConversation()))
+	branch, ok = m.CurrentBranch()
+	require.True(t, ok)
+	assert.Equal(t, 2, branch.Count)
+}
+
+func TestBranchingManagerSystemPrompt(t *testing.T) {
+	m := NewBranchingManager(conversation.NewManager())
+	m.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "question"))
+	command := conversation.NewChatMessage(conversation.RoleUser, "/system be brief")
+	m.AppendMessages(command)
+
+	require.NoError(t, m.Remove(command.ID))
+	assert.Equal(t, []string{"question"}, chatTexts(m.GetConversation()))
+
+	m.SetSystemPrompt("be brief")
+	assert.Equal(t, []string{"be brief", "question"}, chatTexts(m.GetConversation()))
+	m.SetSystemPrompt("be verbose")
+	assert.Equal(t, []string{"be verbose", "question"}, chatTexts(m.GetConversation()))
+}
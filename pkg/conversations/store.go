@@ -0,0 +1,357 @@
+// Package conversations persists conversation trees, so that conversations can be listed
+// and continued across runs.
+package conversations
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is a stored message of a conversation tree.
+type Message struct {
+	ID         conversation.NodeID    `json:"id"`
+	ParentID   conversation.NodeID    `json:"parent_id"`
+	Time       time.Time              `json:"time"`
+	LastUpdate time.Time              `json:"last_update"`
+	Role       conversation.Role      `json:"role"`
+	Text       string                 `json:"text"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Conversation is a stored conversation tree.
+type Conversation struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// LastID is the last message of the conversation, where it gets continued.
+	LastID conversation.NodeID `json:"last_id"`
+	// Messages are ordered so that parents come before their children.
+	Messages []*Message `json:"messages"`
+}
+
+// NewConversation converts the tree of manager into a stored conversation.
+// Only chat messages are stored.
+func NewConversation(manager *conversation.ManagerImpl, name string) *Conversation {
+	tree := manager.Tree
+	ret := &Conversation{
+		ID:     manager.ConversationID.String(),
+		Name:   name,
+		LastID: tree.LastID,
+	}
+
+	visited := map[conversation.NodeID]bool{}
+	var visit func(msg *conversation.Message)
+	visit = func(msg *conversation.Message) {
+		if visited[msg.ID] {
+			return
+		}
+		visited[msg.ID] = true
+		if content, ok := msg.Content.(*conversation.ChatMessageContent); ok {
+			ret.Messages = append(ret.Messages, &Message{
+				ID:         msg.ID,
+				ParentID:   msg.ParentID,
+				Time:       msg.Time,
+				LastUpdate: msg.LastUpdate,
+				Role:       content.Role,
+				Text:       content.Text,
+				Metadata:   msg.Metadata,
+			})
+		}
+		for _, child := range msg.Children {
+			visit(child)
+		}
+	}
+
+	if root, ok := tree.Nodes[tree.RootID]; ok {
+		visit(root)
+	}
+	// messages that are not reachable from the root, for example after prepending a thread
+	rest := []*conversation.Message{}
+	for _, msg := range tree.Nodes {
+		if !visited[msg.ID] {
+			rest = append(rest, msg)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		return rest[i].Time.Before(rest[j].Time)
+	})
+	for _, msg := range rest {
+		visit(msg)
+	}
+
+	for _, msg := range ret.Messages {
+		if ret.CreatedAt.IsZero() || msg.Time.Before(ret.CreatedAt) {
+			ret.CreatedAt = msg.Time
+		}
+	}
+
+	return ret
+}
+
+// ToManager rebuilds the conversation tree into a manager, which continues after the last message.
+func (c *Conversation) ToManager() (*conversation.ManagerImpl, error) {
+	id, err := uuid.Parse(c.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid conversation ID %s", c.ID)
+	}
+	manager := conversation.NewManager(conversation.WithManagerConversationID(id))
+
+	// the manager follows the first child of each message, so the thread leading to
+	// the last message is inserted before the other branches
+	onThread := map[conversation.NodeID]bool{}
+	for _, msg := range c.Thread() {
+		onThread[msg.ID] = true
+	}
+	ids := map[conversation.NodeID]bool{}
+	for _, msg := range c.Messages {
+		ids[msg.ID] = true
+	}
+	children := map[conversation.NodeID][]*Message{}
+	roots := []*Message{}
+	for _, msg := range c.Messages {
+		if ids[msg.ParentID] {
+			children[msg.ParentID] = append(children[msg.ParentID], msg)
+		} else {
+			roots = append(roots, msg)
+		}
+	}
+
+	var insert func(msgs []*Message)
+	insert = func(msgs []*Message) {
+		sort.SliceStable(msgs, func(i, j int) bool {
+			return onThread[msgs[i].ID] && !onThread[msgs[j].ID]
+		})
+		for _, msg := range msgs {
+			manager.Tree.InsertMessages(conversation.NewChatMessage(msg.Role, msg.Text,
+				conversation.WithID(msg.ID),
+				conversation.WithParentID(msg.ParentID),
+				conversation.WithTime(msg.Time),
+				conversation.WithMetadata(msg.Metadata),
+			))
+			insert(children[msg.ID])
+		}
+	}
+	insert(roots)
+	if _, ok := manager.Tree.Nodes[c.LastID]; ok {
+		manager.Tree.LastID = c.LastID
+	}
+
+	return manager, nil
+}
+
+// Thread returns the messages from the root of the conversation to its last message.
+func (c *Conversation) Thread() []*Message {
+	byID := map[conversation.NodeID]*Message{}
+	for _, msg := range c.Messages {
+		byID[msg.ID] = msg
+	}
+
+	ret := []*Message{}
+	for id := c.LastID; id != conversation.NullNode; {
+		msg, ok := byID[id]
+		if !ok {
+			break
+		}
+		ret = append([]*Message{msg}, ret...)
+		id = msg.ParentID
+	}
+	return ret
+}
+
+// DefaultDir returns the directory where conversations are stored,
+// $XDG_DATA_HOME/pinocchio/conversations, by default ~/.local/share/pinocchio/conversations.
+func DefaultDir() (string, error) {
+	dataDir, err := helpers.GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "conversations"), nil
+}
+
+// Store stores conversations as JSON files, one per conversation.
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store in dir, or in the default directory if dir is empty.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		var err error
+		dir, err = DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// idPrefixRegexp matches conversation IDs, which are UUIDs, and their prefixes.
+var idPrefixRegexp = regexp.MustCompile(`^[0-9a-fA-F][0-9a-fA-F-]{0,35}$`)
+
+// Save writes the conversation, replacing its previous version.
+func (s *Store) Save(c *Conversation) error {
+	// the ID is the name of the file, it can't point outside of the store
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return errors.Wrapf(err, "invalid conversation ID %s", c.ID)
+	}
+
+	c.UpdatedAt = time.Now()
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = c.UpdatedAt
+	}
+
+	return WriteFile(s.path(c.ID), c)
+}
+
+// WriteFile writes the conversation as JSON to path, replacing any previous file.
+func WriteFile(path string, c *Conversation) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that a conversation is never left half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadFile reads a conversation written by WriteFile.
+func ReadFile(path string) (*Conversation, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Conversation{}
+	err = json.Unmarshal(b, ret)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read conversation %s", path)
+	}
+	return ret, nil
+}
+
+// Resolve returns the ID of the stored conversation starting with prefix.
+func (s *Store) Resolve(prefix string) (string, error) {
+	if prefix == "" {
+		return "", errors.New("empty conversation ID")
+	}
+	if !idPrefixRegexp.MatchString(prefix) {
+		return "", errors.Errorf("invalid conversation ID %s", prefix)
+	}
+	if _, err := os.Stat(s.path(prefix)); err == nil {
+		return prefix, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return "", err
+	}
+	matches := []string{}
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		if strings.HasPrefix(id, prefix) && !strings.HasPrefix(id, ".") {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", errors.Errorf("conversation %s not found", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", errors.Errorf("conversation ID %s is ambiguous: %s", prefix, strings.Join(matches, ", "))
+	}
+}
+
+// Load reads the conversation with the given ID, or unique ID prefix.
+func (s *Store) Load(id string) (*Conversation, error) {
+	id, err := s.Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFile(s.path(id))
+}
+
+// List returns the stored conversations, most recently updated first.
+// Files that can't be read are skipped with a warning.
+func (s *Store) List() ([]*Conversation, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Conversation{}
+	for _, file := range files {
+		if strings.HasPrefix(filepath.Base(file), ".") {
+			continue
+		}
+		c, err := ReadFile(file)
+		if err != nil {
+			log.Warn().Err(err).Str("path", file).Msg("skipping unreadable conversation")
+			continue
+		}
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].UpdatedAt.After(ret[j].UpdatedAt)
+	})
+
+	return ret, nil
+}
+
+// Latest returns the most recently updated conversation.
+func (s *Store) Latest() (*Conversation, error) {
+	conversations, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, errors.New("no stored conversation")
+	}
+	return conversations[0], nil
+}
+
+// Delete removes the conversation with the given ID, or unique ID prefix.
+func (s *Store) Delete(id string) error {
+	id, err := s.Resolve(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(s.path(id))
+	if err != nil {
+		return errors.Wrapf(err, "could not delete conversation %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package conversations
+
+import (
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	manager := conversation.NewManager()
+	system := conversation.NewChatMessage(conversation.RoleSystem, "be brief")
+	question := conversation.NewChatMessage(conversation.RoleUser, "hello?")
+	manager.AppendMessages(system, question)
+	// a branch that was regenerated
+	manager.AttachMessages(question.ID, conversation.NewChatMessage(conversation.RoleAssistant, "hi"))
+	manager.AttachMessages(question.ID, conversation.NewChatMessage(conversation.RoleAssistant, "hello!"))
+
+	require.NoError(t, store.Save(NewConversation(manager, "chat")))
+
+	stored, err := store.Load(manager.ConversationID.String()[:8])
+	require.NoError(t, err)
+	assert.Equal(t, "chat", stored.Name)
+	assert.Len(t, stored.Messages, 4)
+	thread := stored.Thread()
+	require.Len(t, thread, 3)
+	assert.Equal(t, "hello!", thread[2].Text)
+
+	restored, err := stored.ToManager()
+	require.NoError(t, err)
+	assert.Equal(t, manager.ConversationID, restored.ConversationID)
+	assert.Len(t, restored.Tree.FindChildren(question.ID), 2)
+	assert.Equal(t, []string{"be brief", "hello?", "hello!"}, chatTexts(restored.GetConversation()))
+
+	// continuing appends to the last message
+	restored.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "more"))
+	continued := NewConversation(restored, stored.Name)
+	assert.Equal(t, []string{"be brief", "hello?", "hello!", "more"}, texts(continued.Thread()))
+
+	latest, err := store.Latest()
+	require.NoError(t, err)
+	assert.Equal(t, stored.ID, latest.ID)
+
+	require.NoError(t, store.Delete(stored.ID))
+	_, err = store.Load(stored.ID)
+	assert.Error(t, err)
+}
+
+func texts(messages []*Message) []string {
+	ret := []string{}
+	for _, msg := range messages {
+		ret = append(ret, msg.Text)
+	}
+	return ret
+}
+
+func chatTexts(messages conversation.Conversation) []string {
+	ret := []string{}
+	for _, msg := range messages {
+		ret = append(ret, msg.Content.String())
+	}
+	return ret
+}
+
+func TestStoreInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+
+	manager := conversation.NewManager()
+	manager.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "hello?"))
+	require.NoError(t, store.Save(NewConversation(manager, "chat")))
+
+	// a corrupt conversation doesn't prevent listing the others
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0644))
+	conversations, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, conversations, 1)
+	assert.Equal(t, manager.ConversationID.String(), conversations[0].ID)
+
+	// IDs are UUIDs, and can't point outside of the store
+	for _, id := range []string{"../conversations/x", "/etc/passwd", "corrupt", "."} {
+		_, err = store.Load(id)
+		assert.ErrorContains(t, err, "invalid conversation ID", id)
+		assert.ErrorContains(t, store.Delete(id), "invalid conversation ID", id)
+	}
+	err = store.Save(&Conversation{ID: "../outside"})
+	assert.ErrorContains(t, err, "invalid conversation ID")
+	_, err = os.Stat(filepath.Join(dir, "..", "outside.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,366 @@
+package events
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const nullID = "00000000-0000-0000-0000-000000000000"
+
+// BridgeEvent is an event forwarded by the bridge to its clients.
+type BridgeEvent struct {
+	SequenceNumber uint64 `json:"sequence_number"`
+	Topic          string `json:"topic"`
+	Type           string `json:"type"`
+	StepID         string `json:"step_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Event is the payload of the message, as published.
+	Event json.RawMessage `json:"event"`
+}
+
+// BridgeFilter selects the events sent to a client. Empty fields match all events.
+type BridgeFilter struct {
+	Topic          string
+	StepID         string
+	ConversationID string
+}
+
+// NewBridgeFilterFromRequest reads the filter from the topic, step_id and conversation_id query parameters.
+func NewBridgeFilterFromRequest(r *http.Request) BridgeFilter {
+	q := r.URL.Query()
+	return BridgeFilter{
+		Topic:          q.Get("topic"),
+		StepID:         q.Get("step_id"),
+		ConversationID: q.Get("conversation_id"),
+	}
+}
+
+func (f BridgeFilter) Matches(e *BridgeEvent) bool {
+	return (f.Topic == "" || f.Topic == e.Topic) &&
+		(f.StepID == "" || f.StepID == e.StepID) &&
+		(f.ConversationID == "" || f.ConversationID == e.ConversationID)
+}
+
+type bridgeClient struct {
+	filter BridgeFilter
+	c      chan *BridgeEvent
+	// done is closed when the client is dropped because it doesn't keep up
+	done chan struct{}
+}
+
+// Bridge forwards the events of an EventRouter to HTTP clients, either as Server-Sent Events
+// or over a WebSocket. Clients joining late first receive the last events, kept in a replay buffer.
+//
+// Slow clients are disconnected instead of blocking the router.
+type Bridge struct {
+	replayBufferSize    int
+	clientBufferSize    int
+	trackedMessagesSize int
+	upgrader            websocket.Upgrader
+
+	mutex   sync.Mutex
+	buffer  []*BridgeEvent
+	clients map[*bridgeClient]struct{}
+	// conversations maps message IDs to the ID of their conversation, to attribute events
+	// of steps that don't know their conversation, like tool executions, to the conversation
+	// of their parent message. Only the last trackedMessagesSize messages are kept, the least
+	// recently used first in conversationsLRU.
+	conversations    map[string]*list.Element
+	conversationsLRU *list.List
+}
+
+type trackedMessage struct {
+	id             string
+	conversationID string
+}
+
+type BridgeOption func(*Bridge)
+
+// WithReplayBufferSize sets the number of events replayed to clients when they connect.
+func WithReplayBufferSize(size int) BridgeOption {
+	return func(b *Bridge) {
+		b.replayBufferSize = size
+	}
+}
+
+// WithClientBufferSize sets the number of events that can be queued for a client before it gets disconnected.
+func WithClientBufferSize(size int) BridgeOption {
+	return func(b *Bridge) {
+		b.clientBufferSize = size
+	}
+}
+
+// WithTrackedMessagesSize sets the number of messages whose conversation is remembered, to attribute
+// the events of their child messages to their conversation.
+func WithTrackedMessagesSize(size int) BridgeOption {
+	return func(b *Bridge) {
+		b.trackedMessagesSize = size
+	}
+}
+
+// WithCheckOrigin sets the function validating the origin of WebSocket connections.
+// By default, only same origin connections are accepted.
+func WithCheckOrigin(checkOrigin func(r *http.Request) bool) BridgeOption {
+	return func(b *Bridge) {
+		b.upgrader.CheckOrigin = checkOrigin
+	}
+}
+
+func NewBridge(options ...BridgeOption) *Bridge {
+	ret := &Bridge{
+		replayBufferSize:    100,
+		clientBufferSize:    256,
+		trackedMessagesSize: 1024,
+		clients:             map[*bridgeClient]struct{}{},
+		conversations:       map[string]*list.Element{},
+		conversationsLRU:    list.New(),
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+// AddToRouter forwards the messages of the given topics of the router.
+func (b *Bridge) AddToRouter(router *EventRouter, topics ...string) {
+	for _, topic := range topics {
+		topic_ := topic
+		router.AddHandler("bridge-"+topic_, topic_, func(msg *message.Message) error {
+			return b.Handle(topic_, msg)
+		}, AsExport())
+	}
+}
+
+// Handle forwards the message published on topic to the connected clients.
+func (b *Bridge) Handle(topic string, msg *message.Message) error {
+	defer msg.Ack()
+
+	var payload struct {
+		Type string `json:"type"`
+		Meta struct {
+			ID             string `json:"message_id"`
+			ParentID       string `json:"parent_id"`
+			ConversationID string `json:"conversation_id"`
+		} `json:"meta"`
+		Step *struct {
+			StepID string `json:"step_id"`
+		} `json:"step"`
+	}
+	err := json.Unmarshal(msg.Payload, &payload)
+	if err != nil {
+		return err
+	}
+
+	e := &BridgeEvent{
+		Topic:          topic,
+		Type:           payload.Type,
+		ConversationID: payload.Meta.ConversationID,
+		Event:          json.RawMessage(msg.Payload),
+	}
+	if v := msg.Metadata.Get(MetadataSequenceNumber); v != "" {
+		e.SequenceNumber, _ = strconv.ParseUint(v, 10, 64)
+	}
+	if payload.Step != nil {
+		e.StepID = payload.Step.StepID
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if e.ConversationID == "" || e.ConversationID == nullID {
+		e.ConversationID = b.getConversation(payload.Meta.ParentID)
+	}
+	if e.ConversationID != "" && payload.Meta.ID != "" {
+		b.trackConversation(payload.Meta.ID, e.ConversationID)
+	}
+
+	b.buffer = append(b.buffer, e)
+	if len(b.buffer) > b.replayBufferSize {
+		b.buffer = b.buffer[len(b.buffer)-b.replayBufferSize:]
+	}
+
+	for client := range b.clients {
+		if !client.filter.Matches(e) {
+			continue
+		}
+		select {
+		case client.c <- e:
+		default:
+			log.Warn().Msg("dropping slow event bridge client")
+			b.removeClient(client)
+		}
+	}
+
+	return nil
+}
+
+// getConversation returns the conversation of the message id, if it is tracked.
+// It needs to be called with the mutex held.
+func (b *Bridge) getConversation(id string) string {
+	element, ok := b.conversations[id]
+	if !ok {
+		return ""
+	}
+	b.conversationsLRU.MoveToBack(element)
+	return element.Value.(*trackedMessage).conversationID
+}
+
+// trackConversation remembers the conversation of the message id, and forgets the least recently
+// used message once more than trackedMessagesSize messages are tracked.
+// It needs to be called with the mutex held.
+func (b *Bridge) trackConversation(id string, conversationID string) {
+	if element, ok := b.conversations[id]; ok {
+		element.Value.(*trackedMessage).conversationID = conversationID
+		b.conversationsLRU.MoveToBack(element)
+		return
+	}
+	b.conversations[id] = b.conversationsLRU.PushBack(&trackedMessage{id: id, conversationID: conversationID})
+	for b.conversationsLRU.Len() > b.trackedMessagesSize {
+		oldest := b.conversationsLRU.Front()
+		b.conversationsLRU.Remove(oldest)
+		delete(b.conversations, oldest.Value.(*trackedMessage).id)
+	}
+}
+
+// subscribe registers a client and returns it along with the buffered events matching its filter.
+func (b *Bridge) subscribe(filter BridgeFilter) (*bridgeClient, []*BridgeEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	client := &bridgeClient{
+		filter: filter,
+		c:      make(chan *BridgeEvent, b.clientBufferSize),
+		done:   make(chan struct{}),
+	}
+	b.clients[client] = struct{}{}
+
+	replay := []*BridgeEvent{}
+	for _, e := range b.buffer {
+		if filter.Matches(e) {
+			replay = append(replay, e)
+		}
+	}
+
+	return client, replay
+}
+
+func (b *Bridge) unsubscribe(client *bridgeClient) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.removeClient(client)
+}
+
+// removeClient needs to be called with the mutex held.
+func (b *Bridge) removeClient(client *bridgeClient) {
+	if _, ok := b.clients[client]; ok {
+		delete(b.clients, client)
+		close(client.done)
+	}
+}
+
+// run sends the replayed and live events of the client to send, until the request is done.
+func (b *Bridge) run(ctx context.Context, filter BridgeFilter, send func(e *BridgeEvent) error) error {
+	client, replay := b.subscribe(filter)
+	defer b.unsubscribe(client)
+
+	for _, e := range replay {
+		if err := send(e); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.done:
+			return fmt.Errorf("client too slow")
+		case e := <-client.c:
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ServeSSE streams the events as Server-Sent Events, filtered by the query parameters of the request.
+func (b *Bridge) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err := b.run(r.Context(), NewBridgeFilterFromRequest(r), func(e *BridgeEvent) error {
+		b_, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.SequenceNumber, e.Type, b_)
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		log.Debug().Err(err).Msg("SSE client disconnected")
+	}
+}
+
+// ServeWebSocket sends the events as JSON text messages over a WebSocket,
+// filtered by the query parameters of the request.
+func (b *Bridge) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := b.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not upgrade websocket connection")
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the connection is read-only, but reading is needed to handle close and ping messages
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = b.run(ctx, NewBridgeFilterFromRequest(r), func(e *BridgeEvent) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(e)
+	})
+	if err != nil {
+		log.Debug().Err(err).Msg("websocket client disconnected")
+	}
+}
+
+// Handler serves the events as Server-Sent Events on /events, and over a WebSocket on /ws.
+func (b *Bridge) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", b.ServeSSE)
+	mux.HandleFunc("/ws", b.ServeWebSocket)
+	return mux
+}
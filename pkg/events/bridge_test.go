@@ -0,0 +1,141 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBridgeSSEReplaysConversation(t *testing.T) {
+	bridge := NewBridge(WithReplayBufferSize(10))
+	payloads := []string{
+		`{"type":"start","meta":{"message_id":"m1","parent_id":"p","conversation_id":"c1"},"step":{"step_id":"s1"}}`,
+		`{"type":"start","meta":{"message_id":"m2","parent_id":"p","conversation_id":"c2"},"step":{"step_id":"s2"}}`,
+		// tool results don't know their conversation, and get it from their parent message
+		`{"type":"tool-result","meta":{"message_id":"m3","parent_id":"m1"},"step":{"step_id":"s3"}}`,
+	}
+	for _, p := range payloads {
+		require.NoError(t, bridge.Handle("chat", message.NewMessage("id", message.Payload(p))))
+	}
+
+	server := httptest.NewServer(bridge.Handler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events?conversation_id=c1", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	events := []*BridgeEvent{}
+	for len(events) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		e := &BridgeEvent{}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, "s1", events[0].StepID)
+	assert.Equal(t, "tool-result", events[1].Type)
+	assert.Equal(t, "c1", events[1].ConversationID)
+}
+
+func TestBridgeWebSocket(t *testing.T) {
+	bridge := NewBridge()
+	require.NoError(t, bridge.Handle("chat", message.NewMessage("id", message.Payload(
+		`{"type":"start","meta":{"message_id":"m1","conversation_id":"c1"},"step":{"step_id":"s1"}}`,
+	))))
+
+	server := httptest.NewServer(bridge.Handler())
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?step_id=s1", nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// the replayed event
+	e := &BridgeEvent{}
+	require.NoError(t, conn.ReadJSON(e))
+	assert.Equal(t, "start", e.Type)
+	assert.Equal(t, "c1", e.ConversationID)
+
+	// the live events, filtered by step
+	require.NoError(t, bridge.Handle("chat", message.NewMessage("id", message.Payload(
+		`{"type":"partial","meta":{"message_id":"m2"},"step":{"step_id":"s2"}}`,
+	))))
+	require.NoError(t, bridge.Handle("chat", message.NewMessage("id", message.Payload(
+		`{"type":"final","meta":{"message_id":"m1","conversation_id":"c1"},"step":{"step_id":"s1"}}`,
+	))))
+	e = &BridgeEvent{}
+	require.NoError(t, conn.ReadJSON(e))
+	assert.Equal(t, "final", e.Type)
+	assert.Equal(t, "s1", e.StepID)
+}
+
+func TestBridgeDropsSlowClients(t *testing.T) {
+	bridge := NewBridge(WithClientBufferSize(1))
+	handle := func(type_ string) {
+		payload := `{"type":"` + type_ + `","meta":{"message_id":"m1"}}`
+		require.NoError(t, bridge.Handle("chat", message.NewMessage("id", message.Payload(payload))))
+	}
+
+	// the client is stuck sending the replayed event
+	handle("start")
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	errs := make(chan error)
+	go func() {
+		first := true
+		errs <- bridge.run(context.Background(), BridgeFilter{}, func(e *BridgeEvent) error {
+			if first {
+				first = false
+				close(started)
+				<-unblock
+			}
+			return nil
+		})
+	}()
+	<-started
+
+	// the first event fills the buffer of the client, the second one drops the client
+	// instead of blocking the router
+	handle("partial")
+	handle("final")
+	bridge.mutex.Lock()
+	assert.Empty(t, bridge.clients)
+	bridge.mutex.Unlock()
+
+	close(unblock)
+	assert.EqualError(t, <-errs, "client too slow")
+}
+
+func TestBridgeTrackedMessages(t *testing.T) {
+	bridge := NewBridge(WithTrackedMessagesSize(2))
+	for _, id := range []string{"m1", "m2", "m3"} {
+		payload := `{"type":"start","meta":{"message_id":"` + id + `","conversation_id":"c1"}}`
+		require.NoError(t, bridge.Handle("chat", message.NewMessage("id", message.Payload(payload))))
+	}
+
+	assert.Len(t, bridge.conversations, 2)
+	assert.Equal(t, "", bridge.getConversation("m1"))
+	assert.Equal(t, "c1", bridge.getConversation("m3"))
+}
@@ -0,0 +1,261 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// DeliveryPolicy decides how messages are delivered to a handler of the EventRouter.
+type DeliveryPolicy string
+
+const (
+	// DeliverySync calls the handler before the message is acknowledged, so that publishing waits
+	// until the handler is done. Handlers see the messages in strict lockstep with the publisher.
+	DeliverySync DeliveryPolicy = "sync"
+	// DeliveryBuffered queues the messages for the handler, and only makes publishing wait
+	// once the queue is full. No message is lost.
+	DeliveryBuffered DeliveryPolicy = "buffered"
+	// DeliveryDropOldest queues the messages for the handler, and drops the oldest queued message
+	// when the queue is full.
+	DeliveryDropOldest DeliveryPolicy = "drop-oldest"
+	// DeliveryCoalescePartials queues the messages for the handler, and merges consecutive
+	// partial completions of the same step while the handler is busy, which suits renderers
+	// that only display the latest completion. Publishing waits once the queue is full.
+	DeliveryCoalescePartials DeliveryPolicy = "coalesce-partials"
+)
+
+// Reasons passed to DeliveryObserver.ObserveDrop.
+const (
+	DropReasonQueueFull = "queue-full"
+	DropReasonCoalesced = "coalesced"
+	DropReasonClosed    = "closed"
+)
+
+// DeliveryObserver is notified about the messages delivered through handler queues,
+// for example to export metrics about slow handlers.
+type DeliveryObserver interface {
+	// ObserveDelivery is called when a queued message is handed to its handler,
+	// with the time it spent in the queue.
+	ObserveDelivery(handler string, topic string, delay time.Duration)
+	// ObserveDrop is called when a queued message is dropped, or merged into another message.
+	ObserveDrop(handler string, topic string, reason string)
+}
+
+type HandlerOption func(*handlerSettings)
+
+type handlerSettings struct {
+	policy    DeliveryPolicy
+	queueSize int
+	export    bool
+}
+
+// WithDeliveryPolicy sets the delivery policy of the handler, overriding the default policy of the router.
+func WithDeliveryPolicy(policy DeliveryPolicy) HandlerOption {
+	return func(s *handlerSettings) {
+		s.policy = policy
+	}
+}
+
+// AsExport marks the handler as exporting the events out of the process, for example to a file or
+// a client, so that it receives the events transformed by the router's WithExportMiddlewares.
+func AsExport() HandlerOption {
+	return func(s *handlerSettings) {
+		s.export = true
+	}
+}
+
+// WithQueueSize sets the maximum number of messages queued for the handler, for queued delivery policies.
+func WithQueueSize(size int) HandlerOption {
+	return func(s *handlerSettings) {
+		s.queueSize = size
+	}
+}
+
+type queuedMessage struct {
+	msg        *message.Message
+	enqueuedAt time.Time
+}
+
+// deliveryQueue delivers the messages of a topic to a handler from its own goroutine,
+// so that the publisher doesn't wait for the handler.
+type deliveryQueue struct {
+	name     string
+	topic    string
+	settings handlerSettings
+	f        func(msg *message.Message) error
+	observer DeliveryObserver
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	items  []*queuedMessage
+	closed bool
+	// busy is set while the handler handles a message
+	busy bool
+}
+
+func newDeliveryQueue(
+	name string,
+	topic string,
+	settings handlerSettings,
+	f func(msg *message.Message) error,
+	observer DeliveryObserver,
+) *deliveryQueue {
+	ret := &deliveryQueue{
+		name:     name,
+		topic:    topic,
+		settings: settings,
+		f:        f,
+		observer: observer,
+	}
+	ret.cond = sync.NewCond(&ret.mutex)
+	return ret
+}
+
+// push queues msg according to the delivery policy. It is used as the router handler,
+// and returns as soon as the message is queued, which acknowledges it.
+func (q *deliveryQueue) push(msg *message.Message) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		q.observeDrop(DropReasonClosed)
+		return nil
+	}
+
+	item := &queuedMessage{msg: msg.Copy(), enqueuedAt: time.Now()}
+
+	if q.settings.policy == DeliveryCoalescePartials && len(q.items) > 0 {
+		last := q.items[len(q.items)-1]
+		if merged, ok := coalescePartials(last.msg, item.msg); ok {
+			// the merged message keeps its place in the queue
+			last.msg = merged
+			q.observeDrop(DropReasonCoalesced)
+			return nil
+		}
+	}
+
+	for len(q.items) >= q.settings.queueSize && !q.closed {
+		if q.settings.policy == DeliveryDropOldest {
+			q.items = q.items[1:]
+			q.observeDrop(DropReasonQueueFull)
+			break
+		}
+		q.cond.Wait()
+	}
+	if q.closed {
+		q.observeDrop(DropReasonClosed)
+		return nil
+	}
+
+	q.items = append(q.items, item)
+	q.cond.Broadcast()
+	return nil
+}
+
+// run hands the queued messages to the handler until the queue is closed and drained.
+func (q *deliveryQueue) run() {
+	for {
+		q.mutex.Lock()
+		for len(q.items) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.items) == 0 {
+			q.mutex.Unlock()
+			return
+		}
+		item := q.items[0]
+		q.items = q.items[1:]
+		q.busy = true
+		q.cond.Broadcast()
+		q.mutex.Unlock()
+
+		if q.observer != nil {
+			q.observer.ObserveDelivery(q.name, q.topic, time.Since(item.enqueuedAt))
+		}
+		err := q.f(item.msg)
+		if err != nil {
+			log.Warn().Err(err).Str("handler", q.name).Msg("failed to handle queued event")
+		}
+
+		q.mutex.Lock()
+		q.busy = false
+		q.cond.Broadcast()
+		q.mutex.Unlock()
+	}
+}
+
+// flush waits until the handler has handled all the queued messages.
+func (q *deliveryQueue) flush() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for len(q.items) > 0 || q.busy {
+		q.cond.Wait()
+	}
+}
+
+// close stops accepting messages. The messages already queued are still delivered.
+func (q *deliveryQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *deliveryQueue) observeDrop(reason string) {
+	if q.observer != nil {
+		q.observer.ObserveDrop(q.name, q.topic, reason)
+	}
+}
+
+// coalescePartials merges two partial completion events of the same step into one,
+// concatenating their deltas and keeping the latest completion.
+func coalescePartials(previous *message.Message, next *message.Message) (*message.Message, bool) {
+	p, ok := decodePartial(previous.Payload)
+	if !ok {
+		return nil, false
+	}
+	n, ok := decodePartial(next.Payload)
+	if !ok || !sameStep(p, n) {
+		return nil, false
+	}
+
+	previousDelta, _ := p["delta"].(string)
+	nextDelta, _ := n["delta"].(string)
+	n["delta"] = previousDelta + nextDelta
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		return nil, false
+	}
+	ret := next.Copy()
+	ret.Payload = b
+	return ret, true
+}
+
+func decodePartial(payload []byte) (map[string]interface{}, bool) {
+	var e map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&e); err != nil {
+		return nil, false
+	}
+	if t, _ := e["type"].(string); t != "partial" {
+		return nil, false
+	}
+	return e, true
+}
+
+func sameStep(a, b map[string]interface{}) bool {
+	stepA, _ := a["step"].(map[string]interface{})
+	stepB, _ := b["step"].(map[string]interface{})
+	if stepA == nil || stepB == nil {
+		return false
+	}
+	idA, _ := stepA["step_id"].(string)
+	idB, _ := stepB["step_id"].(string)
+	return idA != "" && idA == idB
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingObserver struct {
+	mutex sync.Mutex
+	drops map[string]int
+}
+
+func (o *countingObserver) ObserveDelivery(handler string, topic string, delay time.Duration) {}
+
+func (o *countingObserver) ObserveDrop(handler string, topic string, reason string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.drops[reason]++
+}
+
+// runBlockedQueue pushes the payloads while the handler is blocked on its first message,
+// and returns the payloads the handler received once unblocked.
+func runBlockedQueue(t *testing.T, policy DeliveryPolicy, queueSize int, observer DeliveryObserver, payloads ...string) []string {
+	received := []string{}
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	q := newDeliveryQueue("test", "ui", handlerSettings{policy: policy, queueSize: queueSize},
+		func(msg *message.Message) error {
+			if len(received) == 0 {
+				close(started)
+				<-unblock
+			}
+			received = append(received, string(msg.Payload))
+			return nil
+		}, observer)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.run()
+	}()
+
+	require.NoError(t, q.push(message.NewMessage("0", []byte(payloads[0]))))
+	<-started
+	for i, p := range payloads[1:] {
+		require.NoError(t, q.push(message.NewMessage(string(rune('1'+i)), []byte(p))))
+	}
+	close(unblock)
+	q.close()
+	<-done
+
+	return received
+}
+
+func TestDeliveryCoalescePartials(t *testing.T) {
+	observer := &countingObserver{drops: map[string]int{}}
+	received := runBlockedQueue(t, DeliveryCoalescePartials, 10, observer,
+		`{"type":"start","step":{"step_id":"a"}}`,
+		`{"type":"partial","delta":"he","completion":"he","step":{"step_id":"a"}}`,
+		`{"type":"partial","delta":"ll","completion":"hell","step":{"step_id":"a"}}`,
+		`{"type":"partial","delta":"o","completion":"hello","step":{"step_id":"a"}}`,
+		`{"type":"final","text":"hello","step":{"step_id":"a"}}`,
+	)
+
+	require.Len(t, received, 3)
+	assert.JSONEq(t, `{"type":"partial","delta":"hello","completion":"hello","step":{"step_id":"a"}}`, received[1])
+	assert.Equal(t, 2, observer.drops[DropReasonCoalesced])
+}
+
+func TestDeliveryDropOldest(t *testing.T) {
+	observer := &countingObserver{drops: map[string]int{}}
+	received := runBlockedQueue(t, DeliveryDropOldest, 2, observer, `0`, `1`, `2`, `3`, `4`)
+
+	assert.Equal(t, []string{`0`, `3`, `4`}, received)
+	assert.Equal(t, 2, observer.drops[DropReasonQueueFull])
+}
+
+func TestDeliveryFlush(t *testing.T) {
+	received := []string{}
+	q := newDeliveryQueue("test", "ui", handlerSettings{policy: DeliveryBuffered, queueSize: 10},
+		func(msg *message.Message) error {
+			time.Sleep(10 * time.Millisecond)
+			received = append(received, string(msg.Payload))
+			return nil
+		}, nil)
+	go q.run()
+	defer q.close()
+
+	require.NoError(t, q.push(message.NewMessage("0", []byte(`0`))))
+	require.NoError(t, q.push(message.NewMessage("1", []byte(`1`))))
+	q.flush()
+	assert.Equal(t, []string{`0`, `1`}, received)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	"github.com/rs/zerolog/log"
+	"sync"
 )
 
 // things to build / group
@@ -21,6 +22,14 @@ type EventRouter struct {
 	Subscriber message.Subscriber
 	router     *message.Router
 	verbose    bool
+	// exportMiddlewares transform the messages delivered to the export handlers.
+	exportMiddlewares []Middleware
+
+	deliveryPolicy DeliveryPolicy
+	queueSize      int
+	observer       DeliveryObserver
+	queues         []*deliveryQueue
+	queuesWg       sync.WaitGroup
 }
 
 type EventRouterOption func(*EventRouter)
@@ -49,9 +58,36 @@ func WithVerbose(verbose bool) EventRouterOption {
 	}
 }
 
+// WithExportMiddlewares applies the middlewares to the messages delivered to the handlers added
+// with AsExport, like the event log and the events bridge. The other handlers, like the printer of
+// the output, receive the messages as published.
+func WithExportMiddlewares(middlewares ...Middleware) EventRouterOption {
+	return func(r *EventRouter) {
+		r.exportMiddlewares = append(r.exportMiddlewares, middlewares...)
+	}
+}
+
+// WithDefaultDeliveryPolicy sets the delivery policy of handlers that don't set their own,
+// DeliverySync by default, and the size of their queue.
+func WithDefaultDeliveryPolicy(policy DeliveryPolicy, queueSize int) EventRouterOption {
+	return func(r *EventRouter) {
+		r.deliveryPolicy = policy
+		r.queueSize = queueSize
+	}
+}
+
+// WithDeliveryObserver notifies observer about the messages delivered through handler queues.
+func WithDeliveryObserver(observer DeliveryObserver) EventRouterOption {
+	return func(r *EventRouter) {
+		r.observer = observer
+	}
+}
+
 func NewEventRouter(options ...EventRouterOption) (*EventRouter, error) {
 	ret := &EventRouter{
-		logger: watermill.NopLogger{},
+		logger:         watermill.NopLogger{},
+		deliveryPolicy: DeliverySync,
+		queueSize:      1024,
 	}
 
 	for _, o := range options {
@@ -74,6 +110,7 @@ func NewEventRouter(options ...EventRouterOption) (*EventRouter, error) {
 	return ret, nil
 }
 
+// Close closes the publisher, and waits for the handlers to process the messages left in their queues.
 func (e *EventRouter) Close() error {
 	err := e.Publisher.Close()
 	if err != nil {
@@ -81,11 +118,76 @@ func (e *EventRouter) Close() error {
 		// not returning just yet
 	}
 
+	for _, q := range e.queues {
+		q.close()
+	}
+	e.queuesWg.Wait()
+
 	return nil
 }
 
-func (e *EventRouter) AddHandler(name string, topic string, f func(msg *message.Message) error) {
-	e.router.AddNoPublisherHandler(name, topic, e.Subscriber, f)
+// Flush waits until the queued handlers have handled the messages published so far, for example
+// so that a printer has written all the output of a step before the next output is written.
+func (e *EventRouter) Flush() {
+	for _, q := range e.queues {
+		q.flush()
+	}
+}
+
+// AddHandler calls f with the messages published on topic.
+//
+// With the default DeliverySync policy, publishing waits for f to return. Other policies queue
+// the messages and call f from a separate goroutine, so that a slow handler doesn't slow down
+// the steps publishing events.
+func (e *EventRouter) AddHandler(name string, topic string, f func(msg *message.Message) error, options ...HandlerOption) {
+	settings := handlerSettings{
+		policy:    e.deliveryPolicy,
+		queueSize: e.queueSize,
+	}
+	for _, option := range options {
+		option(&settings)
+	}
+	if settings.export && len(e.exportMiddlewares) > 0 {
+		f = applyMiddlewares(topic, f, e.exportMiddlewares)
+	}
+
+	if settings.policy == DeliverySync {
+		e.router.AddNoPublisherHandler(name, topic, e.Subscriber, f)
+		return
+	}
+
+	if settings.queueSize <= 0 {
+		settings.queueSize = 1
+	}
+	q := newDeliveryQueue(name, topic, settings, f, e.observer)
+	e.queues = append(e.queues, q)
+	e.queuesWg.Add(1)
+	go func() {
+		defer e.queuesWg.Done()
+		q.run()
+	}()
+
+	e.router.AddNoPublisherHandler(name, topic, e.Subscriber, q.push)
+}
+
+// applyMiddlewares passes the messages transformed by the middlewares to f, and skips the dropped ones.
+func applyMiddlewares(topic string, f func(msg *message.Message) error, middlewares []Middleware) func(msg *message.Message) error {
+	return func(msg *message.Message) error {
+		payload, err := ApplyMiddlewares(topic, msg.Payload, middlewares...)
+		if err != nil {
+			return err
+		}
+		if payload == nil {
+			msg.Ack()
+			return nil
+		}
+		// the message is shared with the other handlers, so it is copied rather than modified
+		msg_ := msg.Copy()
+		msg_.Payload = payload
+		err = f(msg_)
+		msg.Ack()
+		return err
+	}
 }
 
 func (e *EventRouter) DumpRawEvents(msg *message.Message) error {
@@ -114,6 +216,11 @@ func (e *EventRouter) Run(ctx context.Context) error {
 	return e.router.Run(ctx)
 }
 
+// Running is closed once the router is running, from which on the published events reach the handlers.
+func (e *EventRouter) Running() chan struct{} {
+	return e.router.Running()
+}
+
 func (e *EventRouter) RunHandlers(ctx context.Context) error {
 	return e.router.RunHandlers(ctx)
 }
@@ -0,0 +1,172 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LogEntry is a line of an event log.
+type LogEntry struct {
+	SequenceNumber uint64              `json:"sequence_number"`
+	Timestamp      time.Time           `json:"timestamp"`
+	Topic          string              `json:"topic"`
+	Step           *steps.StepMetadata `json:"step,omitempty"`
+	// Event is the payload of the message, as published.
+	Event json.RawMessage `json:"event"`
+}
+
+// EventLog appends all the messages it handles to a JSONL file, so that runs can be inspected
+// and replayed later on.
+type EventLog struct {
+	path  string
+	f     *os.File
+	mutex sync.Mutex
+}
+
+// NewEventLog creates the event log file at path, creating its directory if needed.
+// If the file already exists, new entries are appended.
+func NewEventLog(path string) (*EventLog, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLog{
+		path: path,
+		f:    f,
+	}, nil
+}
+
+func (l *EventLog) Path() string {
+	return l.path
+}
+
+// AddToRouter logs the messages of the given topics of the router.
+func (l *EventLog) AddToRouter(router *EventRouter, topics ...string) {
+	for _, topic := range topics {
+		topic_ := topic
+		router.AddHandler("event-log-"+topic_, topic_, func(msg *message.Message) error {
+			return l.Handle(topic_, msg)
+		}, AsExport())
+	}
+}
+
+// Handle appends the message published on topic to the log.
+func (l *EventLog) Handle(topic string, msg *message.Message) error {
+	defer msg.Ack()
+
+	entry := &LogEntry{
+		Timestamp: time.Now(),
+		Topic:     topic,
+		Event:     json.RawMessage(msg.Payload),
+	}
+	if v := msg.Metadata.Get(MetadataSequenceNumber); v != "" {
+		entry.SequenceNumber, _ = strconv.ParseUint(v, 10, 64)
+	}
+	if v := msg.Metadata.Get(MetadataTimestamp); v != "" {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			entry.Timestamp = t
+		}
+	}
+
+	var payload struct {
+		Step *steps.StepMetadata `json:"step"`
+	}
+	if err := json.Unmarshal(msg.Payload, &payload); err == nil {
+		entry.Step = payload.Step
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, err = l.f.Write(append(b, '\n'))
+	return err
+}
+
+func (l *EventLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.f.Close()
+}
+
+// ReadEventLog reads all the entries of an event log file.
+func ReadEventLog(path string) ([]*LogEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	ret := []*LogEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &LogEntry{}
+		err = json.Unmarshal(scanner.Bytes(), entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse line %d of %s", line, path)
+		}
+		ret = append(ret, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Replay calls handler with the message of each entry, in order. The delays between the
+// original messages are divided by speed, speed <= 0 replays the entries without delay.
+func Replay(
+	ctx context.Context,
+	entries []*LogEntry,
+	speed float64,
+	handler func(topic string, msg *message.Message) error,
+) error {
+	var previous time.Time
+	for _, entry := range entries {
+		if speed > 0 && !previous.IsZero() && entry.Timestamp.After(previous) {
+			delay := time.Duration(float64(entry.Timestamp.Sub(previous)) / speed)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		previous = entry.Timestamp
+
+		msg := message.NewMessage(watermill.NewUUID(), message.Payload(entry.Event))
+		msg.Metadata.Set(MetadataSequenceNumber, strconv.FormatUint(entry.SequenceNumber, 10))
+		msg.Metadata.Set(MetadataTimestamp, entry.Timestamp.Format(time.RFC3339Nano))
+		err := handler(entry.Topic, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventLogRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs", "run.jsonl")
+	l, err := NewEventLog(path)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	payloads := []string{
+		`{"type":"start","step":{"type":"openai-chat"}}`,
+		`{"type":"partial","delta":"hello"}`,
+		`{"type":"final","text":"hello"}`,
+	}
+	for i, p := range payloads {
+		msg := message.NewMessage("id", message.Payload(p))
+		msg.Metadata.Set(MetadataSequenceNumber, []string{"0", "1", "2"}[i])
+		msg.Metadata.Set(MetadataTimestamp, start.Add(time.Duration(i)*time.Millisecond).Format(time.RFC3339Nano))
+		require.NoError(t, l.Handle("chat", msg))
+	}
+	require.NoError(t, l.Close())
+
+	entries, err := ReadEventLog(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, uint64(2), entries[2].SequenceNumber)
+	assert.Equal(t, "chat", entries[0].Topic)
+	require.NotNil(t, entries[0].Step)
+	assert.Equal(t, "openai-chat", entries[0].Step.Type)
+	assert.True(t, entries[1].Timestamp.Equal(start.Add(time.Millisecond)))
+
+	replayed := []string{}
+	err = Replay(context.Background(), entries, 0, func(topic string, msg *message.Message) error {
+		replayed = append(replayed, string(msg.Payload))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, payloads, replayed)
+}
@@ -0,0 +1,205 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// Middleware transforms an event published on topic before it reaches any publisher.
+// The event is the JSON payload of the message, decoded into a map.
+//
+// A middleware can modify the event in place and return it, or return nil to drop the event.
+type Middleware func(topic string, event map[string]interface{}) (map[string]interface{}, error)
+
+// Redacted replaces the values removed by the redaction middlewares.
+const Redacted = "[REDACTED]"
+
+var (
+	// APIKeyPattern matches the common formats of API keys and bearer tokens.
+	APIKeyPattern = regexp.MustCompile(`\b(sk-(ant-)?[A-Za-z0-9_-]{16,}|gh[pousr]_[A-Za-z0-9]{20,}|xox[abprs]-[A-Za-z0-9-]{10,}|AKIA[0-9A-Z]{16})\b|(?i:bearer\s+[A-Za-z0-9._~+/=-]{16,})`)
+	// EmailPattern matches email addresses.
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// CardNumberPattern matches card numbers of 13 to 19 digits, optionally grouped with spaces or dashes.
+	CardNumberPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+)
+
+// DefaultMaskPatterns are the patterns masked by default when redacting events.
+var DefaultMaskPatterns = []*regexp.Regexp{APIKeyPattern, EmailPattern, CardNumberPattern}
+
+// DefaultRedactedFields are the fields of the settings metadata that can identify
+// the user or their infrastructure.
+var DefaultRedactedFields = []string{
+	"step.metadata.settings.ai-base-url",
+	"step.metadata.settings.organization",
+	"step.metadata.settings.claude-user-id",
+}
+
+// DefaultRedactionMiddlewares redacts the identifying settings fields of the step metadata,
+// and masks API keys, email addresses and card numbers in all the string values of events.
+func DefaultRedactionMiddlewares() []Middleware {
+	return []Middleware{
+		RedactFields(DefaultRedactedFields...),
+		MaskPatterns(DefaultMaskPatterns...),
+	}
+}
+
+// RedactFields replaces the value of the fields at the given dot-separated paths, if present.
+func RedactFields(paths ...string) Middleware {
+	paths_ := make([][]string, len(paths))
+	for i, path := range paths {
+		paths_[i] = strings.Split(path, ".")
+	}
+
+	return func(topic string, event map[string]interface{}) (map[string]interface{}, error) {
+		for _, path := range paths_ {
+			m := event
+			for _, key := range path[:len(path)-1] {
+				var ok bool
+				m, ok = m[key].(map[string]interface{})
+				if !ok {
+					break
+				}
+			}
+			if m == nil {
+				continue
+			}
+			if _, ok := m[path[len(path)-1]]; ok {
+				m[path[len(path)-1]] = Redacted
+			}
+		}
+		return event, nil
+	}
+}
+
+// MaskPatterns replaces the matches of the patterns in all the string values of the event, except UUIDs.
+func MaskPatterns(patterns ...*regexp.Regexp) Middleware {
+	var mask func(v interface{}) interface{}
+	mask = func(v interface{}) interface{} {
+		switch v_ := v.(type) {
+		case string:
+			// IDs are kept, as they could otherwise look like card numbers
+			if _, err := uuid.Parse(v_); err == nil {
+				return v_
+			}
+			for _, pattern := range patterns {
+				v_ = pattern.ReplaceAllString(v_, Redacted)
+			}
+			return v_
+		case map[string]interface{}:
+			for k, w := range v_ {
+				v_[k] = mask(w)
+			}
+			return v_
+		case []interface{}:
+			for i, w := range v_ {
+				v_[i] = mask(w)
+			}
+			return v_
+		default:
+			return v
+		}
+	}
+
+	return func(topic string, event map[string]interface{}) (map[string]interface{}, error) {
+		return mask(event).(map[string]interface{}), nil
+	}
+}
+
+// DropEventTypes drops the events of the given types, for example "partial".
+func DropEventTypes(types ...string) Middleware {
+	dropped := map[string]bool{}
+	for _, t := range types {
+		dropped[t] = true
+	}
+
+	return func(topic string, event map[string]interface{}) (map[string]interface{}, error) {
+		if t, ok := event["type"].(string); ok && dropped[t] {
+			return nil, nil
+		}
+		return event, nil
+	}
+}
+
+// AddFields sets the given top-level fields on every event, for example to tag events with a run ID.
+func AddFields(fields map[string]interface{}) Middleware {
+	return func(topic string, event map[string]interface{}) (map[string]interface{}, error) {
+		for k, v := range fields {
+			event[k] = v
+		}
+		return event, nil
+	}
+}
+
+// ApplyMiddlewares runs the JSON payload of an event published on topic through the middlewares.
+// It returns nil if the event was dropped, and the payload unchanged if there are no middlewares.
+func ApplyMiddlewares(topic string, payload []byte, middlewares ...Middleware) ([]byte, error) {
+	if len(middlewares) == 0 {
+		return payload, nil
+	}
+
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	// keep numbers, like token counts, as they were published
+	decoder.UseNumber()
+	err := decoder.Decode(&event)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode event")
+	}
+
+	for _, middleware := range middlewares {
+		event, err = middleware(topic, event)
+		if err != nil {
+			return nil, err
+		}
+		if event == nil {
+			return nil, nil
+		}
+	}
+
+	return json.Marshal(event)
+}
+
+// MiddlewarePublisher applies middlewares to the messages before forwarding them to a publisher.
+type MiddlewarePublisher struct {
+	publisher   message.Publisher
+	middlewares []Middleware
+}
+
+var _ message.Publisher = (*MiddlewarePublisher)(nil)
+
+func NewMiddlewarePublisher(publisher message.Publisher, middlewares ...Middleware) *MiddlewarePublisher {
+	return &MiddlewarePublisher{
+		publisher:   publisher,
+		middlewares: middlewares,
+	}
+}
+
+func (m *MiddlewarePublisher) Publish(topic string, messages ...*message.Message) error {
+	forwarded := make([]*message.Message, 0, len(messages))
+	for _, msg := range messages {
+		payload, err := ApplyMiddlewares(topic, msg.Payload, m.middlewares...)
+		if err != nil {
+			return err
+		}
+		if payload == nil {
+			continue
+		}
+		// the same message can be published to several topics, so it is copied rather than modified
+		msg_ := msg.Copy()
+		msg_.Payload = payload
+		forwarded = append(forwarded, msg_)
+	}
+	if len(forwarded) == 0 {
+		return nil
+	}
+	return m.publisher.Publish(topic, forwarded...)
+}
+
+func (m *MiddlewarePublisher) Close() error {
+	return m.publisher.Close()
+}
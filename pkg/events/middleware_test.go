@@ -0,0 +1,62 @@
+package events
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type recordingPublisher struct {
+	messages map[string][]*message.Message
+}
+
+func (r *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	r.messages[topic] = append(r.messages[topic], messages...)
+	return nil
+}
+
+func (r *recordingPublisher) Close() error {
+	return nil
+}
+
+func TestApplyRedactionMiddlewares(t *testing.T) {
+	payload := `{
+		"type": "final",
+		"text": "mail jane@example.com the key sk-abcdefghijklmnopqrstuvwx, card 4111 1111 1111 1111",
+		"meta": {"message_id": "00000000-0000-0000-0000-000000000000"},
+		"step": {"metadata": {
+			"settings": {"ai-base-url": "https://llm.internal", "ai-engine": "gpt-4", "ai-max-response-tokens": 12345678901234}
+		}}
+	}`
+
+	b, err := ApplyMiddlewares("chat", []byte(payload), DefaultRedactionMiddlewares()...)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "final",
+		"text": "mail [REDACTED] the key [REDACTED], card [REDACTED]",
+		"meta": {"message_id": "00000000-0000-0000-0000-000000000000"},
+		"step": {"metadata": {
+			"settings": {"ai-base-url": "[REDACTED]", "ai-engine": "gpt-4", "ai-max-response-tokens": 12345678901234}
+		}}
+	}`, string(b))
+}
+
+func TestPublisherManagerMiddlewares(t *testing.T) {
+	p := &recordingPublisher{messages: map[string][]*message.Message{}}
+	m := NewPublisherManager()
+	m.SubscribePublisher("chat", p)
+	m.AddMiddleware(
+		DropEventTypes("partial"),
+		AddFields(map[string]interface{}{"run_id": "run-1"}),
+	)
+
+	require.NoError(t, m.Publish(map[string]interface{}{"type": "partial"}))
+	require.NoError(t, m.Publish(map[string]interface{}{"type": "final"}))
+
+	require.Len(t, p.messages["chat"], 1)
+	msg := p.messages["chat"][0]
+	assert.JSONEq(t, `{"type": "final", "run_id": "run-1"}`, string(msg.Payload))
+	// dropped events still use up a sequence number
+	assert.Equal(t, "1", msg.Metadata.Get(MetadataSequenceNumber))
+}
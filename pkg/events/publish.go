@@ -7,6 +7,7 @@ import (
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/rs/zerolog/log"
 	"sync"
+	"time"
 )
 
 // NOTE(manuel, 2024-03-24) This might be worth moving / integrating into the event router
@@ -19,8 +20,12 @@ import (
 //
 // The Manager also keeps a sequence number for each outgoing message,
 // in the order they are handled by Publish.
+//
+// Middlewares added with AddMiddleware transform or drop the payloads before they
+// reach any publisher.
 type PublisherManager struct {
 	Publishers     map[string][]message.Publisher
+	middlewares    []Middleware
 	sequenceNumber uint64
 	mutex          sync.Mutex
 }
@@ -37,27 +42,69 @@ func (s *PublisherManager) SubscribePublisher(topic string, sub message.Publishe
 	s.Publishers[topic] = append(s.Publishers[topic], sub)
 }
 
+// AddMiddleware adds middlewares, applied in order to the payload of every published message.
+func (s *PublisherManager) AddMiddleware(middlewares ...Middleware) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// Metadata keys set by Publish on every message.
+const (
+	MetadataSequenceNumber = "sequence_number"
+	MetadataTimestamp      = "timestamp"
+)
+
+// VersionedPayload is implemented by payloads that carry the version of their schema,
+// which gets set by Publish before serializing them.
+type VersionedPayload interface {
+	SetSchemaVersion()
+}
+
 // Publish distributes a message to all Publishers across all topics.
 // Serializing the payload to JSON is done by Publish itself.
 //
 // Returns an error for any processing or distribution issues.
 func (s *PublisherManager) Publish(payload interface{}) error {
-	// lock for the sequence number hash
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	if v, ok := payload.(VersionedPayload); ok {
+		v.SetSchemaVersion()
+	}
 
 	b, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
+	// the lock is only held to number the message and snapshot the publishers, so that
+	// a slow publisher doesn't block the other steps publishing through this manager
+	s.mutex.Lock()
 	msg := message.NewMessage(watermill.NewUUID(), b)
-	msg.Metadata.Set("sequence_number", fmt.Sprintf("%d", s.sequenceNumber))
+	msg.Metadata.Set(MetadataSequenceNumber, fmt.Sprintf("%d", s.sequenceNumber))
+	msg.Metadata.Set(MetadataTimestamp, time.Now().Format(time.RFC3339Nano))
 	s.sequenceNumber++
-
+	publishers := make(map[string][]message.Publisher, len(s.Publishers))
 	for topic, subs := range s.Publishers {
+		publishers[topic] = append([]message.Publisher{}, subs...)
+	}
+	middlewares := append([]Middleware{}, s.middlewares...)
+	s.mutex.Unlock()
+
+	for topic, subs := range publishers {
+		msg_ := msg
+		if len(middlewares) > 0 {
+			payload, err := ApplyMiddlewares(topic, b, middlewares...)
+			if err != nil {
+				return err
+			}
+			if payload == nil {
+				continue
+			}
+			msg_ = msg.Copy()
+			msg_.Payload = payload
+		}
+
 		for _, sub := range subs {
-			err = sub.Publish(topic, msg)
+			err = sub.Publish(topic, msg_)
 			if err != nil {
 				log.Warn().Err(err).Msg("failed to publish")
 			}
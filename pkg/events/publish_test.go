@@ -0,0 +1,55 @@
+package events
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// blockingPublisher blocks on the first message until unblocked.
+type blockingPublisher struct {
+	started chan struct{}
+	unblock chan struct{}
+	count   int
+}
+
+func (b *blockingPublisher) Publish(topic string, messages ...*message.Message) error {
+	b.count++
+	if b.count == 1 {
+		close(b.started)
+		<-b.unblock
+	}
+	return nil
+}
+
+func (b *blockingPublisher) Close() error {
+	return nil
+}
+
+func TestPublisherManagerPublishesOutsideTheLock(t *testing.T) {
+	p := &blockingPublisher{started: make(chan struct{}), unblock: make(chan struct{})}
+	m := NewPublisherManager()
+	m.SubscribePublisher("chat", p)
+
+	first := make(chan error)
+	go func() {
+		first <- m.Publish(map[string]interface{}{"type": "start"})
+	}()
+	<-p.started
+
+	// the second message is published while the first one is still blocked
+	second := make(chan error)
+	go func() {
+		second <- m.Publish(map[string]interface{}{"type": "final"})
+	}()
+	select {
+	case err := <-second:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("publishing waited for the blocked publisher")
+	}
+
+	close(p.unblock)
+	require.NoError(t, <-first)
+}
@@ -0,0 +1,20 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// GetDataDir returns the directory where pinocchio stores its data, such as conversations and runs,
+// $XDG_DATA_HOME/pinocchio, by default ~/.local/share/pinocchio.
+func GetDataDir() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataDir = filepath.Join(homeDir, ".local", "share")
+	}
+	return filepath.Join(dataDir, "pinocchio"), nil
+}
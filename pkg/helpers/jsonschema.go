@@ -5,33 +5,77 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/invopop/jsonschema"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	gopath "path"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 )
 
 // Callable is a type representing any callable function
 type Callable interface{}
 
-//nolint:unused
-func checkFirstArgContext(callable interface{}) bool {
-	funcVal := reflect.ValueOf(callable)
-	funcType := funcVal.Type()
+// CallFunctionFromJson calls a function with arguments provided as JSON.
+// Multiple arguments are passed either as a list, or as an object with the properties arg0, arg1, ...
+func CallFunctionFromJson(f Callable, jsonArgs interface{}) ([]reflect.Value, error) {
+	return CallFunctionWithNamedArguments(context.Background(), f, nil, jsonArgs)
+}
 
-	if funcVal.Kind() != reflect.Func {
-		return false
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// getFunctionParameters returns the parameter types of f, skipping a leading context.Context.
+func getFunctionParameters(funcType reflect.Type) ([]reflect.Type, bool) {
+	ret := []reflect.Type{}
+	takesContext := false
+	for i := 0; i < funcType.NumIn(); i++ {
+		if i == 0 && funcType.In(i) == contextType {
+			takesContext = true
+			continue
+		}
+		ret = append(ret, funcType.In(i))
 	}
+	return ret, takesContext
+}
 
-	if funcType.NumIn() > 0 {
-		firstArgType := funcType.In(0)
-		contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
-		return firstArgType == contextType
+// isObjectType returns true for the types whose JSON representation is an object,
+// which are passed the whole arguments object when they are the single parameter of a function.
+func isObjectType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Map || t.Kind() == reflect.Interface
+}
 
-	return false
+// GetParameterNames returns the given names, completed with arg0, arg1, ... for the missing ones.
+func GetParameterNames(names []string, count int) []string {
+	ret := make([]string, count)
+	for i := 0; i < count; i++ {
+		if i < len(names) && names[i] != "" {
+			ret[i] = names[i]
+		} else {
+			ret[i] = fmt.Sprintf("arg%d", i)
+		}
+	}
+	return ret
 }
 
-// CallFunctionFromJson calls a function with arguments provided as JSON
-// TODO(manuel, 2024-01-12) make this take a ctx
-func CallFunctionFromJson(f Callable, jsonArgs interface{}) ([]reflect.Value, error) {
+// CallFunctionWithNamedArguments calls a function with arguments provided as JSON.
+//
+// A function taking a single struct or map is passed the whole arguments object.
+// Otherwise, each parameter is taken from the property with the corresponding name in names
+// (completed with arg0, arg1, ...), or from the corresponding position if the arguments are a list.
+// A leading context.Context parameter is passed ctx.
+func CallFunctionWithNamedArguments(
+	ctx context.Context,
+	f Callable,
+	names []string,
+	jsonArgs interface{},
+) ([]reflect.Value, error) {
 	funcVal := reflect.ValueOf(f)
 	funcType := funcVal.Type()
 
@@ -40,56 +84,81 @@ func CallFunctionFromJson(f Callable, jsonArgs interface{}) ([]reflect.Value, er
 		return nil, fmt.Errorf("provided callable is not a function")
 	}
 
+	paramTypes, takesContext := getFunctionParameters(funcType)
+	var args []reflect.Value
+	if takesContext {
+		args = append(args, reflect.ValueOf(ctx))
+	}
+
 	// Marshal the provided arguments back to JSON to work with individual arguments
 	argsJson, err := json.Marshal(jsonArgs)
 	if err != nil {
 		return nil, err
 	}
 
-	// Prepare to unmarshal arguments into a slice of reflect.Value
-	var args []reflect.Value
-
-	// If there's only one argument, handle it separately
-	if funcType.NumIn() == 1 {
-		argType := funcType.In(0)
-		argPtr := reflect.New(argType)
+	// If there's only one object argument, handle it separately
+	if len(paramTypes) == 1 && isObjectType(paramTypes[0]) {
+		argPtr := reflect.New(paramTypes[0])
 
 		if err := json.Unmarshal(argsJson, argPtr.Interface()); err != nil {
 			return nil, err
 		}
 
-		args = append(args, argPtr.Elem())
-	} else {
-		// Unmarshal JSON into a slice of interfaces
-		var rawArgs []interface{}
-		if err := json.Unmarshal(argsJson, &rawArgs); err != nil {
+		return funcVal.Call(append(args, argPtr.Elem())), nil
+	}
+
+	rawArgs := make([]json.RawMessage, len(paramTypes))
+	switch jsonArgs.(type) {
+	case []interface{}:
+		var list []json.RawMessage
+		if err := json.Unmarshal(argsJson, &list); err != nil {
 			return nil, err
 		}
+		if len(list) > len(paramTypes) {
+			return nil, fmt.Errorf("too many arguments: expected %d, got %d", len(paramTypes), len(list))
+		}
+		copy(rawArgs, list)
+	default:
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(argsJson, &object); err != nil {
+			return nil, err
+		}
+		for i, name := range GetParameterNames(names, len(paramTypes)) {
+			rawArgs[i] = object[name]
+		}
+	}
 
-		// Convert each argument to reflect.Value
-		for i, rawArg := range rawArgs {
-			argType := funcType.In(i)
-			argValue := reflect.New(argType).Elem()
-
-			argJson, err := json.Marshal(rawArg)
-			if err != nil {
-				return nil, err
-			}
-
-			if err := json.Unmarshal(argJson, argValue.Addr().Interface()); err != nil {
+	// Convert each argument to reflect.Value, missing arguments are passed as zero values
+	for i, paramType := range paramTypes {
+		argValue := reflect.New(paramType).Elem()
+		if len(rawArgs[i]) > 0 {
+			if err := json.Unmarshal(rawArgs[i], argValue.Addr().Interface()); err != nil {
 				return nil, err
 			}
-
-			args = append(args, argValue)
 		}
+		args = append(args, argValue)
 	}
 
 	// Call the function with the prepared arguments
 	return funcVal.Call(args), nil
 }
 
-// GetFunctionParametersJsonSchema generates a JSON Schema for the arguments of the given function
+// GetFunctionParametersJsonSchema generates a JSON Schema for the arguments of the given function.
+// Multiple parameters are described as an object with the properties arg0, arg1, ...
 func GetFunctionParametersJsonSchema(reflector *jsonschema.Reflector, f Callable) (*jsonschema.Schema, error) {
+	return GetFunctionParametersJsonSchemaWithNames(reflector, f, nil)
+}
+
+// GetFunctionParametersJsonSchemaWithNames generates a JSON Schema for the arguments of the given function.
+//
+// A function taking a single struct or map is described by the schema of that parameter.
+// Otherwise, the arguments are described as an object with a required property per parameter,
+// named after names (completed with arg0, arg1, ...). A leading context.Context parameter is skipped.
+func GetFunctionParametersJsonSchemaWithNames(
+	reflector *jsonschema.Reflector,
+	f Callable,
+	names []string,
+) (*jsonschema.Schema, error) {
 	// Get the type of the function
 	funcVal := reflect.ValueOf(f)
 	funcType := funcVal.Type()
@@ -99,32 +168,124 @@ func GetFunctionParametersJsonSchema(reflector *jsonschema.Reflector, f Callable
 		return nil, fmt.Errorf("provided callable is not a function")
 	}
 
-	// Handle the case of a single parameter separately
-	if funcType.NumIn() == 1 {
-		singleParamType := funcType.In(0)
-		singleParamInstance := reflect.New(singleParamType).Elem().Interface()
+	paramTypes, _ := getFunctionParameters(funcType)
+
+	// Handle the case of a single object parameter separately
+	if len(paramTypes) == 1 && isObjectType(paramTypes[0]) {
+		singleParamInstance := reflect.New(paramTypes[0]).Elem().Interface()
 		return reflector.Reflect(singleParamInstance), nil
 	}
 
 	// Prepare a schema for multiple function parameters
 	schema := &jsonschema.Schema{
-		Type:  "array",
-		Items: &jsonschema.Schema{},
+		Type:       "object",
+		Properties: orderedmap.New[string, *jsonschema.Schema](),
+		Required:   []string{},
 	}
 
-	// Create a slice to hold schemas for each parameter
-	paramSchemas := make([]*jsonschema.Schema, 0, funcType.NumIn())
-
 	// Loop over the function's input parameters
-	for i := 0; i < funcType.NumIn(); i++ {
-		paramType := funcType.In(i)
-		paramInstance := reflect.New(paramType).Elem().Interface()
+	for i, name := range GetParameterNames(names, len(paramTypes)) {
+		paramInstance := reflect.New(paramTypes[i]).Elem().Interface()
 		paramSchema := reflector.Reflect(paramInstance)
-		paramSchemas = append(paramSchemas, paramSchema)
+		paramSchema.Version = ""
+		schema.Properties.Set(name, paramSchema)
+		schema.Required = append(schema.Required, name)
 	}
 
-	// Use PrefixItems to define schemas for each parameter in the array
-	schema.PrefixItems = paramSchemas
-
 	return schema, nil
 }
+
+// GetFunctionName returns the fully qualified name of a function, for example
+// github.com/go-go-golems/geppetto/pkg/helpers.GetFunctionName, which is the key used
+// by ExtractGoFunctionDocs.
+func GetFunctionName(f Callable) string {
+	funcVal := reflect.ValueOf(f)
+	if funcVal.Kind() != reflect.Func {
+		return ""
+	}
+	fn := runtime.FuncForPC(funcVal.Pointer())
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
+}
+
+// FunctionDoc is the documentation of a go function, as extracted from its source.
+type FunctionDoc struct {
+	// PackagePath is the import path of the package declaring the function.
+	PackagePath    string
+	Description    string
+	ParameterNames []string
+}
+
+// ExtractGoFunctionDocs reads all the go files contained in the provided path, including sub-directories,
+// and records the doc comment and the parameter names of every top-level function in docs,
+// keyed by the fully qualified function name (see GetFunctionName). The functions of main
+// packages are also recorded as main.<name>. Since the functions of different main packages
+// can't be told apart under that name, an alias declared by several main packages is set to nil.
+//
+// Just like jsonschema.ExtractGoComments, base is the import path corresponding to path.
+func ExtractGoFunctionDocs(base, path string, docs map[string]*FunctionDoc) error {
+	fset := token.NewFileSet()
+	return filepath.Walk(path, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		pkgs, err := parser.ParseDir(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		pkgPath := gopath.Join(base, path)
+		for _, pkg := range pkgs {
+			for _, file := range pkg.Files {
+				for _, decl := range file.Decls {
+					funcDecl, ok := decl.(*ast.FuncDecl)
+					if !ok || funcDecl.Recv != nil {
+						continue
+					}
+					doc_ := &FunctionDoc{
+						PackagePath:    pkgPath,
+						Description:    strings.TrimSpace(funcDecl.Doc.Text()),
+						ParameterNames: []string{},
+					}
+					for i, field := range funcDecl.Type.Params.List {
+						// skip a leading context, just like when reflecting the parameters
+						if i == 0 && isContextExpr(field.Type) {
+							continue
+						}
+						if len(field.Names) == 0 {
+							doc_.ParameterNames = append(doc_.ParameterNames, "")
+						}
+						for _, name := range field.Names {
+							doc_.ParameterNames = append(doc_.ParameterNames, name.Name)
+						}
+					}
+					docs[fmt.Sprintf("%s.%s", pkgPath, funcDecl.Name.Name)] = doc_
+					// the functions of the main package of a binary are named main.<name> at runtime,
+					// while tests see them under their import path
+					if pkg.Name == "main" {
+						alias := "main." + funcDecl.Name.Name
+						if previous, ok := docs[alias]; ok && (previous == nil || previous.PackagePath != pkgPath) {
+							docs[alias] = nil
+						} else {
+							docs[alias] = doc_
+						}
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func isContextExpr(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "context" && sel.Sel.Name == "Context"
+}
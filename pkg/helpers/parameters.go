@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/invopop/jsonschema"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// ParameterDefinitionsToJsonSchema converts a list of glazed parameter definitions
+// (the flags and arguments of a command) into the JSON schema of an object
+// with one property per parameter.
+func ParameterDefinitionsToJsonSchema(pds []*parameters.ParameterDefinition) *jsonschema.Schema {
+	ret := &jsonschema.Schema{
+		Type:       "object",
+		Properties: orderedmap.New[string, *jsonschema.Schema](),
+		Required:   []string{},
+	}
+
+	for _, pd := range pds {
+		s := ParameterTypeToJsonSchema(pd.Type)
+		s.Description = pd.Help
+		if len(pd.Choices) > 0 {
+			choices := []interface{}{}
+			for _, c := range pd.Choices {
+				choices = append(choices, c)
+			}
+			if s.Items != nil {
+				s.Items.Enum = choices
+			} else {
+				s.Enum = choices
+			}
+		}
+		if pd.Default != nil {
+			s.Default = *pd.Default
+		}
+		ret.Properties.Set(pd.Name, s)
+
+		if pd.Required {
+			ret.Required = append(ret.Required, pd.Name)
+		}
+	}
+
+	return ret
+}
+
+// ParameterTypeToJsonSchema returns the JSON schema for values of the given glazed parameter type.
+// Parameter types that load files are described by their file names.
+func ParameterTypeToJsonSchema(t parameters.ParameterType) *jsonschema.Schema {
+	switch t {
+	case parameters.ParameterTypeString,
+		parameters.ParameterTypeStringFromFile,
+		parameters.ParameterTypeStringFromFiles,
+		parameters.ParameterTypeFile,
+		parameters.ParameterTypeChoice:
+		return &jsonschema.Schema{Type: "string"}
+
+	case parameters.ParameterTypeDate:
+		return &jsonschema.Schema{Type: "string", Format: "date-time"}
+
+	case parameters.ParameterTypeInteger:
+		return &jsonschema.Schema{Type: "integer"}
+
+	case parameters.ParameterTypeFloat:
+		return &jsonschema.Schema{Type: "number"}
+
+	case parameters.ParameterTypeBool:
+		return &jsonschema.Schema{Type: "boolean"}
+
+	case parameters.ParameterTypeStringList,
+		parameters.ParameterTypeStringListFromFile,
+		parameters.ParameterTypeStringListFromFiles,
+		parameters.ParameterTypeFileList,
+		parameters.ParameterTypeChoiceList:
+		return &jsonschema.Schema{Type: "array", Items: &jsonschema.Schema{Type: "string"}}
+
+	case parameters.ParameterTypeIntegerList:
+		return &jsonschema.Schema{Type: "array", Items: &jsonschema.Schema{Type: "integer"}}
+
+	case parameters.ParameterTypeFloatList:
+		return &jsonschema.Schema{Type: "array", Items: &jsonschema.Schema{Type: "number"}}
+
+	case parameters.ParameterTypeKeyValue,
+		parameters.ParameterTypeObjectFromFile:
+		return &jsonschema.Schema{Type: "object"}
+
+	case parameters.ParameterTypeObjectListFromFile,
+		parameters.ParameterTypeObjectListFromFiles:
+		return &jsonschema.Schema{Type: "array", Items: &jsonschema.Schema{Type: "object"}}
+	}
+
+	return &jsonschema.Schema{}
+}
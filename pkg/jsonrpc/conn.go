@@ -0,0 +1,265 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Conn is a JSON-RPC 2.0 connection over a pair of streams, with one JSON message per line
+// (the stdio transport used by MCP).
+//
+// A Conn is symmetrical: it can both send requests to the other side with Call and Notify,
+// and answer incoming requests and notifications with its Handler.
+type Conn struct {
+	r       *bufio.Reader
+	w       io.Writer
+	handler Handler
+
+	writeMutex sync.Mutex
+
+	mutex  sync.Mutex
+	nextID int64
+	// pending are the channels of the calls waiting for their response, by normalized id
+	pending map[string]chan *message
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// Handler is called for every incoming request or notification.
+// The returned result is sent back as the response result (for requests only).
+// Return an *Error to control the error code sent back.
+type Handler func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	return &Conn{
+		r:       bufio.NewReaderSize(r, 1024*1024),
+		w:       w,
+		handler: handler,
+		pending: map[string]chan *message{},
+	}
+}
+
+// Run reads incoming messages until the reader is closed or ctx is cancelled.
+// Incoming requests are handled concurrently, each in its own goroutine.
+func (c *Conn) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer func() {
+		c.mutex.Lock()
+		c.closed = true
+		for id, ch := range c.pending {
+			close(ch)
+			delete(c.pending, id)
+		}
+		c.mutex.Unlock()
+		c.wg.Wait()
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := c.r.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				err := <-readErr
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			c.handleLine(ctx, line)
+		}
+	}
+}
+
+func (c *Conn) handleLine(ctx context.Context, line []byte) {
+	var msg message
+	err := json.Unmarshal(line, &msg)
+	if err != nil {
+		log.Warn().Err(err).Str("line", string(line)).Msg("could not parse JSON-RPC message")
+		_ = c.send(&message{
+			JSONRPC: Version,
+			ID:      json.RawMessage("null"),
+			Error:   &Error{Code: CodeParseError, Message: err.Error()},
+		})
+		return
+	}
+
+	if msg.Method == "" {
+		// this is a response to one of our calls
+		c.mutex.Lock()
+		ch, ok := c.pending[idKey(msg.ID)]
+		delete(c.pending, idKey(msg.ID))
+		c.mutex.Unlock()
+		if !ok {
+			log.Warn().Str("id", string(msg.ID)).Msg("received response for unknown request")
+			return
+		}
+		ch <- &msg
+		close(ch)
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.handleRequest(ctx, &msg)
+	}()
+}
+
+func (c *Conn) handleRequest(ctx context.Context, msg *message) {
+	var result interface{}
+	var err error
+	if c.handler == nil {
+		err = ErrMethodNotFound(msg.Method)
+	} else {
+		result, err = c.handler(ctx, msg.Method, msg.Params)
+	}
+
+	if msg.IsNotification() {
+		if err != nil {
+			log.Debug().Err(err).Str("method", msg.Method).Msg("error handling notification")
+		}
+		return
+	}
+
+	response := &message{
+		JSONRPC: Version,
+		ID:      msg.ID,
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		response.Error = rpcErr
+	} else {
+		if result == nil {
+			result = struct{}{}
+		}
+		response.Result, err = json.Marshal(result)
+		if err != nil {
+			response.Result = nil
+			response.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+	}
+
+	err = c.send(response)
+	if err != nil {
+		log.Warn().Err(err).Str("method", msg.Method).Msg("could not send JSON-RPC response")
+	}
+}
+
+// Call sends a request and waits for its response, which gets unmarshalled into result (if not nil).
+// Run needs to be running for the response to be received.
+func (c *Conn) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := json.RawMessage(strconv.FormatInt(c.nextID, 10))
+	ch := make(chan *message, 1)
+	c.pending[idKey(id)] = ch
+	c.mutex.Unlock()
+
+	msg := &message{
+		JSONRPC: Version,
+		ID:      id,
+		Method:  method,
+	}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = b
+	}
+
+	err := c.send(msg)
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.pending, idKey(id))
+		c.mutex.Unlock()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mutex.Lock()
+		delete(c.pending, idKey(id))
+		c.mutex.Unlock()
+		return ctx.Err()
+	case resp, ok := <-ch:
+		if !ok {
+			return ErrClosed
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	}
+}
+
+// Notify sends a notification, which doesn't get a response.
+func (c *Conn) Notify(method string, params interface{}) error {
+	msg := &message{
+		JSONRPC: Version,
+		Method:  method,
+	}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = b
+	}
+	return c.send(msg)
+}
+
+func (c *Conn) send(msg *message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err = c.w.Write(append(b, '\n'))
+	if err != nil {
+		return fmt.Errorf("could not write JSON-RPC message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"sync"
+	"testing"
+)
+
+// newConnPair connects two connections, and runs them until the test ends.
+func newConnPair(t *testing.T, handlerA Handler, handlerB Handler) (*Conn, *Conn) {
+	ar, bw := io.Pipe()
+	br, aw := io.Pipe()
+	a := NewConn(ar, aw, handlerA)
+	b := NewConn(br, bw, handlerB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = a.Run(ctx)
+	}()
+	go func() {
+		_ = b.Run(ctx)
+	}()
+	return a, b
+}
+
+// peer is the raw side of a connection, reading and writing JSON-RPC messages by hand.
+type peer struct {
+	r *bufio.Reader
+	w *io.PipeWriter
+}
+
+func newConnWithPeer(t *testing.T, handler Handler) (*Conn, *peer, chan error) {
+	cr, pw := io.Pipe()
+	pr, cw := io.Pipe()
+	c := NewConn(cr, cw, handler)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = pw.Close()
+		_ = pr.Close()
+	})
+	return c, &peer{r: bufio.NewReader(pr), w: pw}, done
+}
+
+func (p *peer) read(t *testing.T) *message {
+	line, err := p.r.ReadBytes('\n')
+	require.NoError(t, err)
+	msg := &message{}
+	require.NoError(t, json.Unmarshal(line, msg))
+	return msg
+}
+
+func (p *peer) write(t *testing.T, line string) {
+	_, err := p.w.Write([]byte(line + "\n"))
+	require.NoError(t, err)
+}
+
+func TestConnCallsAreMatchedToTheirResponses(t *testing.T) {
+	a, _ := newConnPair(t, nil, func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		var n int
+		err := UnmarshalParams(params, &n)
+		if err != nil {
+			return nil, err
+		}
+		switch method {
+		case "double":
+			return n * 2, nil
+		case "fail":
+			return nil, &Error{Code: 42, Message: "failed"}
+		default:
+			return nil, ErrMethodNotFound(method)
+		}
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var result int
+			err := a.Call(context.Background(), "double", i, &result)
+			assert.NoError(t, err)
+			assert.Equal(t, i*2, result)
+		}(i)
+	}
+	wg.Wait()
+
+	err := a.Call(context.Background(), "fail", 1, nil)
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, 42, rpcErr.Code)
+
+	err = a.Call(context.Background(), "unknown", 1, nil)
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, CodeMethodNotFound, rpcErr.Code)
+
+	err = a.Call(context.Background(), "double", "not a number", nil)
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, CodeInvalidParams, rpcErr.Code)
+}
+
+func TestConnNormalizesResponseIDs(t *testing.T) {
+	for _, format := range []string{`%d`, `"%d"`, `%d.0`, ` %d`} {
+		t.Run(format, func(t *testing.T) {
+			c, p, _ := newConnWithPeer(t, nil)
+
+			results := make(chan string, 1)
+			go func() {
+				var result string
+				err := c.Call(context.Background(), "ping", nil, &result)
+				assert.NoError(t, err)
+				results <- result
+			}()
+
+			request := p.read(t)
+			assert.Equal(t, "ping", request.Method)
+			var id int
+			require.NoError(t, json.Unmarshal(request.ID, &id))
+			p.write(t, fmt.Sprintf(`{"jsonrpc":"2.0","id":`+format+`,"result":"pong"}`, id))
+			assert.Equal(t, "pong", <-results)
+		})
+	}
+
+	assert.NotEqual(t, idKey(json.RawMessage(`1`)), idKey(json.RawMessage(`"a"`)))
+	assert.Equal(t, idKey(json.RawMessage(`"a"`)), idKey(json.RawMessage(`"a"`)))
+}
+
+func TestConnNotifications(t *testing.T) {
+	notifications := make(chan string, 2)
+	c, p, _ := newConnWithPeer(t, func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		if method == "notify" {
+			var s string
+			_ = json.Unmarshal(params, &s)
+			notifications <- s
+			return nil, fmt.Errorf("not sent back")
+		}
+		return "result", nil
+	})
+
+	// incoming notifications are handled, but don't get a response, even when they fail
+	p.write(t, `{"jsonrpc":"2.0","method":"notify","params":"hello"}`)
+	assert.Equal(t, "hello", <-notifications)
+	p.write(t, `{"jsonrpc":"2.0","id":"req","method":"request"}`)
+	response := p.read(t)
+	assert.Equal(t, `"req"`, string(response.ID))
+	assert.Equal(t, `"result"`, string(response.Result))
+
+	// outgoing notifications don't have an id. Pipes are synchronous, so the notification
+	// is sent while it's being read.
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Notify("event", map[string]string{"key": "value"})
+	}()
+	notification := p.read(t)
+	require.NoError(t, <-errs)
+	assert.Equal(t, "event", notification.Method)
+	assert.True(t, notification.IsNotification())
+	assert.JSONEq(t, `{"key":"value"}`, string(notification.Params))
+}
+
+func TestConnParseError(t *testing.T) {
+	_, p, _ := newConnWithPeer(t, nil)
+
+	p.write(t, `not json`)
+	response := p.read(t)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, CodeParseError, response.Error.Code)
+	assert.Equal(t, "null", string(response.ID))
+}
+
+func TestConnShutdown(t *testing.T) {
+	c, p, done := newConnWithPeer(t, nil)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Call(context.Background(), "never-answered", nil, nil)
+	}()
+	p.read(t)
+
+	// closing the stream ends Run, and fails the pending and later calls
+	require.NoError(t, p.w.Close())
+	assert.NoError(t, <-done)
+	assert.ErrorIs(t, <-errs, ErrClosed)
+	assert.ErrorIs(t, c.Call(context.Background(), "after-close", nil, nil), ErrClosed)
+}
+
+func TestConnCallIsCancelled(t *testing.T) {
+	c, p, _ := newConnWithPeer(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Call(ctx, "slow", nil, nil)
+	}()
+	request := p.read(t)
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	// the late response is dropped
+	p.write(t, `{"jsonrpc":"2.0","id":`+string(request.ID)+`,"result":{}}`)
+	c.mutex.Lock()
+	assert.Empty(t, c.pending)
+	c.mutex.Unlock()
+}
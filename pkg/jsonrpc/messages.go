@@ -0,0 +1,96 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+const Version = "2.0"
+
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var ErrClosed = errors.New("JSON-RPC connection closed")
+
+// Error is a JSON-RPC error object. It implements error, so that handlers can return it directly.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+func ErrMethodNotFound(method string) *Error {
+	return &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", method)}
+}
+
+func ErrInvalidParams(err error) *Error {
+	return &Error{Code: CodeInvalidParams, Message: err.Error()}
+}
+
+// message covers requests, notifications and responses, which are told apart by the presence
+// of the method and id fields.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func (m *message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// idKey normalizes a request id, so that the response of a peer sending back the id 1 as "1"
+// (or as 1.0) still matches its request.
+func idKey(id json.RawMessage) string {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(id))
+	d.UseNumber()
+	err := d.Decode(&v)
+	if err != nil {
+		return string(id)
+	}
+	switch v := v.(type) {
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		return strconv.Quote(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		if f, err := v.Float64(); err == nil && f == float64(int64(f)) {
+			return strconv.FormatInt(int64(f), 10)
+		}
+		return v.String()
+	default:
+		return string(id)
+	}
+}
+
+// UnmarshalParams decodes the params of a request into v, returning an invalid params error on failure.
+func UnmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(params, v)
+	if err != nil {
+		return ErrInvalidParams(err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/geppetto/pkg/jsonrpc"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const closeTimeout = 5 * time.Second
+
+// ServerDescription describes how to launch a local MCP server subprocess.
+type ServerDescription struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+// Client is a client for an MCP server running as a subprocess, talking JSON-RPC over its stdin and stdout.
+type Client struct {
+	Name       string
+	ServerInfo Implementation
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	conn   *jsonrpc.Conn
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// StartClient launches the server subprocess and runs the MCP initialization handshake.
+// The server gets killed when ctx is cancelled or Close is called.
+func StartClient(ctx context.Context, description *ServerDescription) (*Client, error) {
+	if description.Command == "" {
+		return nil, errors.Errorf("MCP server %s has no command", description.Name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	cmd := exec.CommandContext(ctx, description.Command, description.Args...)
+	cmd.Stderr = os.Stderr
+	if len(description.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range description.Env {
+			cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+		}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "could not start MCP server %s", description.Name)
+	}
+
+	ret := &Client{
+		Name:   description.Name,
+		cmd:    cmd,
+		stdin:  stdin,
+		cancel: cancel,
+	}
+	ret.conn = jsonrpc.NewConn(stdout, stdin, ret.handle)
+
+	ret.wg.Add(1)
+	go func() {
+		defer ret.wg.Done()
+		err := ret.conn.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Warn().Err(err).Str("server", description.Name).Msg("MCP connection closed")
+		}
+	}()
+
+	err = ret.initialize(ctx)
+	if err != nil {
+		_ = ret.Close()
+		return nil, errors.Wrapf(err, "could not initialize MCP server %s", description.Name)
+	}
+
+	return ret, nil
+}
+
+// handle answers the requests sent by the server. We don't offer any client capabilities,
+// so only pings are answered.
+func (c *Client) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "ping":
+		return struct{}{}, nil
+	default:
+		if strings.HasPrefix(method, "notifications/") {
+			log.Debug().Str("server", c.Name).Str("method", method).Msg("MCP notification")
+			return nil, nil
+		}
+		return nil, jsonrpc.ErrMethodNotFound(method)
+	}
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	result := &InitializeResult{}
+	err := c.conn.Call(ctx, "initialize", &InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo: Implementation{
+			Name:    "geppetto",
+			Version: "0.1.0",
+		},
+	}, result)
+	if err != nil {
+		return err
+	}
+	c.ServerInfo = result.ServerInfo
+
+	return c.conn.Notify("notifications/initialized", nil)
+}
+
+// ListTools returns all the tools offered by the server, following the pagination cursors.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	ret := []Tool{}
+	cursor := ""
+	for {
+		result := &ListToolsResult{}
+		err := c.conn.Call(ctx, "tools/list", &ListToolsParams{Cursor: cursor}, result)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, result.Tools...)
+		if result.NextCursor == "" {
+			return ret, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool calls a tool on the server. A result flagged as error is returned as is,
+// errors are only returned for protocol failures.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*CallToolResult, error) {
+	result := &CallToolResult{}
+	err := c.conn.Call(ctx, "tools/call", &CallToolParams{
+		Name:      name,
+		Arguments: arguments,
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Close shuts down the server by closing its stdin, and kills it if it doesn't exit in time.
+func (c *Client) Close() error {
+	_ = c.stdin.Close()
+
+	// the connection ends when the server closes its stdout. Reads from stdout have to be
+	// done before calling Wait, which closes the pipe.
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		log.Warn().Str("server", c.Name).Msg("MCP server did not exit, killing it")
+		c.cancel()
+		<-done
+	}
+
+	err := c.cmd.Wait()
+	c.cancel()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
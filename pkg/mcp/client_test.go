@@ -0,0 +1,140 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/jsonrpc"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+// When GEPPETTO_MCP_STUB_SERVER is set, the test binary acts as a stub MCP server,
+// so that the client can be tested against a real subprocess.
+func TestMain(m *testing.M) {
+	if os.Getenv("GEPPETTO_MCP_STUB_SERVER") != "" {
+		runStubServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func runStubServer() {
+	pages := map[string]ListToolsResult{
+		"": {
+			Tools: []Tool{{
+				Name:        "echo",
+				Description: "Echo the message",
+				InputSchema: json.RawMessage(`{"type":"object","properties":{"message":{"type":"string"}},"required":["message"]}`),
+			}},
+			NextCursor: "page-2",
+		},
+		"page-2": {
+			Tools: []Tool{{Name: "fail", Description: "Always fails"}},
+		},
+	}
+
+	conn := jsonrpc.NewConn(os.Stdin, os.Stdout,
+		func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+			switch method {
+			case "initialize":
+				return &InitializeResult{
+					ProtocolVersion: ProtocolVersion,
+					Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+					ServerInfo:      Implementation{Name: "stub", Version: "0.0.1"},
+				}, nil
+			case "notifications/initialized":
+				return nil, nil
+			case "tools/list":
+				p := &ListToolsParams{}
+				if err := jsonrpc.UnmarshalParams(params, p); err != nil {
+					return nil, err
+				}
+				return pages[p.Cursor], nil
+			case "tools/call":
+				p := &CallToolParams{}
+				if err := jsonrpc.UnmarshalParams(params, p); err != nil {
+					return nil, err
+				}
+				switch p.Name {
+				case "echo":
+					return &CallToolResult{
+						Content: []Content{NewTextContent(fmt.Sprintf("echo: %v", p.Arguments["message"]))},
+					}, nil
+				default:
+					return &CallToolResult{
+						Content: []Content{NewTextContent("it broke")},
+						IsError: true,
+					}, nil
+				}
+			default:
+				return nil, jsonrpc.ErrMethodNotFound(method)
+			}
+		})
+	_ = conn.Run(context.Background())
+}
+
+func startStubClient(t *testing.T) *Client {
+	executable, err := os.Executable()
+	require.NoError(t, err)
+
+	client, err := StartClient(context.Background(), &ServerDescription{
+		Name:    "stub",
+		Command: executable,
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{"GEPPETTO_MCP_STUB_SERVER": "1"},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, client.Close())
+	})
+	return client
+}
+
+func TestClientListAndCallTools(t *testing.T) {
+	client := startStubClient(t)
+	assert.Equal(t, "stub", client.ServerInfo.Name)
+
+	ctx := context.Background()
+	tools_, err := client.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools_, 2)
+	assert.Equal(t, "echo", tools_[0].Name)
+	assert.Equal(t, "fail", tools_[1].Name)
+
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"message": "hello"})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	require.Len(t, result.Content, 1)
+	assert.Equal(t, "echo: hello", result.Content[0].Text)
+}
+
+func TestClientSetTools(t *testing.T) {
+	set := &ClientSet{Clients: []*Client{startStubClient(t)}}
+
+	ctx := context.Background()
+	tools_, err := set.Tools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools_, 2)
+
+	echo := tools_[0]
+	openaiTool := tools.ToOpenAITool(echo)
+	assert.Equal(t, "echo", openaiTool.Function.Name)
+	assert.JSONEq(t,
+		`{"type":"object","properties":{"message":{"type":"string"}},"required":["message"]}`,
+		string(openaiTool.Function.Parameters.(json.RawMessage)))
+	claudeTool := tools.ToClaudeTool(echo)
+	assert.Equal(t, "Echo the message", claudeTool.Description)
+
+	res, err := echo.Call(ctx, map[string]interface{}{"message": "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hi", res)
+
+	_, err = tools_[1].Call(ctx, map[string]interface{}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "it broke")
+	assert.JSONEq(t, `{"type":"object","properties":{}}`, string(tools_[1].GetParameters()))
+}
@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/jsonrpc"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"strings"
+)
+
+// ServerPrompt is a prompt offered by the Server. Render is called with the prompt arguments
+// sent by the client to produce the prompt messages.
+type ServerPrompt struct {
+	Prompt Prompt
+	Render func(ctx context.Context, arguments map[string]string) (*GetPromptResult, error)
+}
+
+// Server is an MCP server offering tools and prompts over a JSON-RPC connection,
+// usually stdin and stdout.
+type Server struct {
+	info         Implementation
+	instructions string
+	tools        []tools.Tool
+	prompts      []*ServerPrompt
+}
+
+type ServerOption func(*Server)
+
+func WithServerInfo(name string, version string) ServerOption {
+	return func(s *Server) {
+		s.info = Implementation{Name: name, Version: version}
+	}
+}
+
+func WithInstructions(instructions string) ServerOption {
+	return func(s *Server) {
+		s.instructions = instructions
+	}
+}
+
+func WithTools(tools_ ...tools.Tool) ServerOption {
+	return func(s *Server) {
+		s.tools = append(s.tools, tools_...)
+	}
+}
+
+func WithPrompts(prompts ...*ServerPrompt) ServerOption {
+	return func(s *Server) {
+		s.prompts = append(s.prompts, prompts...)
+	}
+}
+
+func NewServer(options ...ServerOption) *Server {
+	ret := &Server{
+		info: Implementation{Name: "geppetto", Version: "0.1.0"},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+// Serve answers the requests read from r until r is closed or ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	conn := jsonrpc.NewConn(r, w, s.handle)
+	return conn.Run(ctx)
+}
+
+func (s *Server) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		p := &InitializeParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().
+			Str("client", p.ClientInfo.Name).
+			Str("protocolVersion", p.ProtocolVersion).
+			Msg("MCP client connected")
+
+		capabilities := map[string]interface{}{}
+		if len(s.tools) > 0 {
+			capabilities["tools"] = map[string]interface{}{}
+		}
+		if len(s.prompts) > 0 {
+			capabilities["prompts"] = map[string]interface{}{}
+		}
+		return &InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    capabilities,
+			ServerInfo:      s.info,
+			Instructions:    s.instructions,
+		}, nil
+
+	case "ping":
+		return struct{}{}, nil
+
+	case "tools/list":
+		ret := &ListToolsResult{Tools: []Tool{}}
+		for _, tool := range s.tools {
+			ret.Tools = append(ret.Tools, Tool{
+				Name:        tool.GetName(),
+				Description: tool.GetDescription(),
+				InputSchema: tool.GetParameters(),
+			})
+		}
+		return ret, nil
+
+	case "tools/call":
+		p := &CallToolParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		return s.callTool(ctx, p)
+
+	case "prompts/list":
+		ret := &ListPromptsResult{Prompts: []Prompt{}}
+		for _, prompt := range s.prompts {
+			ret.Prompts = append(ret.Prompts, prompt.Prompt)
+		}
+		return ret, nil
+
+	case "prompts/get":
+		p := &GetPromptParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, prompt := range s.prompts {
+			if prompt.Prompt.Name == p.Name {
+				if p.Arguments == nil {
+					p.Arguments = map[string]string{}
+				}
+				return prompt.Render(ctx, p.Arguments)
+			}
+		}
+		return nil, jsonrpc.ErrInvalidParams(errors.Errorf("unknown prompt %s", p.Name))
+
+	default:
+		if strings.HasPrefix(method, "notifications/") {
+			return nil, nil
+		}
+		return nil, jsonrpc.ErrMethodNotFound(method)
+	}
+}
+
+// callTool runs a tool. Errors of the tool itself are reported in the result, so that
+// the model calling the tool can see them.
+func (s *Server) callTool(ctx context.Context, p *CallToolParams) (*CallToolResult, error) {
+	var tool tools.Tool
+	for _, t := range s.tools {
+		if t.GetName() == p.Name {
+			tool = t
+			break
+		}
+	}
+	if tool == nil {
+		return nil, jsonrpc.ErrInvalidParams(errors.Errorf("unknown tool %s", p.Name))
+	}
+
+	arguments := p.Arguments
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+
+	log.Debug().Str("tool", p.Name).Interface("arguments", arguments).Msg("calling tool")
+	result, err := tool.Call(ctx, arguments)
+	if err != nil {
+		return &CallToolResult{
+			Content: []Content{NewTextContent(err.Error())},
+			IsError: true,
+		}, nil
+	}
+
+	var text string
+	switch v := result.(type) {
+	case string:
+		text = v
+	case fmt.Stringer:
+		text = v.String()
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	return &CallToolResult{
+		Content: []Content{NewTextContent(text)},
+	}, nil
+}
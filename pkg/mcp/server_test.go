@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/jsonrpc"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestServerToolsAndPrompts(t *testing.T) {
+	server := NewServer(
+		WithTools(
+			&tools.ToolFunc{
+				Name: "add",
+				Function: func(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+					return map[string]interface{}{"sum": arguments["a"].(float64) + arguments["b"].(float64)}, nil
+				},
+			},
+			&tools.ToolFunc{
+				Name: "fail",
+				Function: func(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+					return nil, errors.New("it broke")
+				},
+			},
+		),
+		WithPrompts(&ServerPrompt{
+			Prompt: Prompt{Name: "greet", Arguments: []PromptArgument{{Name: "name", Required: true}}},
+			Render: func(ctx context.Context, arguments map[string]string) (*GetPromptResult, error) {
+				return &GetPromptResult{
+					Messages: []PromptMessage{{Role: "user", Content: NewTextContent("Hello " + arguments["name"])}},
+				}, nil
+			},
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go func() {
+		_ = server.Serve(ctx, serverR, serverW)
+	}()
+	conn := jsonrpc.NewConn(clientR, clientW, nil)
+	go func() {
+		_ = conn.Run(ctx)
+	}()
+
+	initResult := &InitializeResult{}
+	err := conn.Call(ctx, "initialize", &InitializeParams{ProtocolVersion: ProtocolVersion}, initResult)
+	require.NoError(t, err)
+	assert.Contains(t, initResult.Capabilities, "tools")
+	assert.Contains(t, initResult.Capabilities, "prompts")
+
+	listResult := &ListToolsResult{}
+	err = conn.Call(ctx, "tools/list", nil, listResult)
+	require.NoError(t, err)
+	require.Len(t, listResult.Tools, 2)
+	assert.JSONEq(t, `{"type":"object","properties":{}}`, string(listResult.Tools[0].InputSchema))
+
+	callResult := &CallToolResult{}
+	err = conn.Call(ctx, "tools/call", &CallToolParams{
+		Name:      "add",
+		Arguments: map[string]interface{}{"a": 1, "b": 2},
+	}, callResult)
+	require.NoError(t, err)
+	assert.False(t, callResult.IsError)
+	assert.JSONEq(t, `{"sum":3}`, callResult.Content[0].Text)
+
+	err = conn.Call(ctx, "tools/call", &CallToolParams{Name: "fail"}, callResult)
+	require.NoError(t, err)
+	assert.True(t, callResult.IsError)
+	assert.Equal(t, "it broke", callResult.Content[0].Text)
+
+	err = conn.Call(ctx, "tools/call", &CallToolParams{Name: "unknown"}, callResult)
+	var rpcErr *jsonrpc.Error
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, jsonrpc.CodeInvalidParams, rpcErr.Code)
+
+	promptResult := &GetPromptResult{}
+	err = conn.Call(ctx, "prompts/get", &GetPromptParams{
+		Name:      "greet",
+		Arguments: map[string]string{"name": "world"},
+	}, promptResult)
+	require.NoError(t, err)
+	require.Len(t, promptResult.Messages, 1)
+	assert.Equal(t, "Hello world", promptResult.Messages[0].Content.Text)
+}
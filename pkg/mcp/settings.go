@@ -0,0 +1,48 @@
+package mcp
+
+import (
+	"fmt"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"strings"
+)
+
+const McpSlug = "mcp"
+
+type Settings struct {
+	Servers []string `glazed.parameter:"mcp-servers"`
+}
+
+func NewParameterLayer(options ...layers.ParameterLayerOptions) (layers.ParameterLayer, error) {
+	options_ := append([]layers.ParameterLayerOptions{
+		layers.WithParameterDefinitions(
+			parameters.NewParameterDefinition(
+				"mcp-servers",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("Command lines of MCP servers whose tools are offered to the model"),
+			),
+		),
+	}, options...)
+	return layers.NewParameterLayer(McpSlug, "MCP servers", options_...)
+}
+
+// GetServerDescriptions turns the configured command lines into server descriptions.
+// Command lines are split on whitespace, use the mcp-servers section of a command file
+// for arguments containing spaces.
+func (s *Settings) GetServerDescriptions() ([]*ServerDescription, error) {
+	ret := []*ServerDescription{}
+	for i, line := range s.Servers {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil, errors.Errorf("empty MCP server command line at index %d", i)
+		}
+		ret = append(ret, &ServerDescription{
+			Name:    fmt.Sprintf("%s-%d", filepath.Base(fields[0]), i),
+			Command: fields[0],
+			Args:    fields[1:],
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ServerTool exposes a tool of an MCP server as a tools.Tool, so that it can be passed
+// to the tool steps along with go functions and YAML tools.
+type ServerTool struct {
+	client *Client
+	tool   Tool
+}
+
+var _ tools.Tool = (*ServerTool)(nil)
+
+func NewServerTool(client *Client, tool Tool) *ServerTool {
+	return &ServerTool{client: client, tool: tool}
+}
+
+func (t *ServerTool) GetName() string {
+	return t.tool.Name
+}
+
+func (t *ServerTool) GetDescription() string {
+	return t.tool.Description
+}
+
+func (t *ServerTool) GetParameters() json.RawMessage {
+	if len(t.tool.InputSchema) == 0 || string(t.tool.InputSchema) == "null" {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return t.tool.InputSchema
+}
+
+// Call calls the tool on the server and returns its text content.
+// A result flagged as error by the server is returned as an error.
+func (t *ServerTool) Call(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+	result, err := t.client.CallTool(ctx, t.tool.Name, arguments)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not call tool %s on MCP server %s", t.tool.Name, t.client.Name)
+	}
+
+	text, err := ContentToText(result.Content)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		return nil, errors.Errorf("tool %s failed: %s", t.tool.Name, text)
+	}
+	return text, nil
+}
+
+// ContentToText concatenates the text content blocks. Other blocks are serialized as JSON,
+// since the models we talk to only accept text tool results.
+func ContentToText(content []Content) (string, error) {
+	texts := []string{}
+	for _, c := range content {
+		if c.Type == "text" {
+			texts = append(texts, c.Text)
+			continue
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			return "", err
+		}
+		texts = append(texts, string(b))
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// ClientSet is a group of running MCP servers whose tools are offered together.
+type ClientSet struct {
+	Clients []*Client
+}
+
+// StartClientSet starts all the given servers. If one fails to start, the already started ones are closed.
+func StartClientSet(ctx context.Context, descriptions []*ServerDescription) (*ClientSet, error) {
+	ret := &ClientSet{}
+	for _, description := range descriptions {
+		client, err := StartClient(ctx, description)
+		if err != nil {
+			_ = ret.Close()
+			return nil, err
+		}
+		ret.Clients = append(ret.Clients, client)
+	}
+	return ret, nil
+}
+
+// Tools lists the tools of all servers. Tool names have to be unique across servers.
+func (s *ClientSet) Tools(ctx context.Context) ([]tools.Tool, error) {
+	ret := []tools.Tool{}
+	servers := map[string]string{}
+	for _, client := range s.Clients {
+		tools_, err := client.ListTools(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list tools of MCP server %s", client.Name)
+		}
+		for _, tool := range tools_ {
+			if other, ok := servers[tool.Name]; ok {
+				return nil, errors.Errorf("tool %s is provided by both MCP servers %s and %s", tool.Name, other, client.Name)
+			}
+			servers[tool.Name] = client.Name
+			ret = append(ret, NewServerTool(client, tool))
+		}
+	}
+	return ret, nil
+}
+
+func (s *ClientSet) Close() error {
+	var ret error
+	for _, client := range s.Clients {
+		err := client.Close()
+		if err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
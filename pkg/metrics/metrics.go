@@ -0,0 +1,262 @@
+// Package metrics exposes Prometheus metrics about LLM calls, computed from the events
+// published by the chat steps. Since all providers publish the same start, partial, final
+// and error events, the metrics are consistent across providers.
+package metrics
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const namespace = "geppetto"
+
+// request tracks a chat step between its start event and its final, interrupt or error event.
+type request struct {
+	apiType       string
+	engine        string
+	startedAt     time.Time
+	hasFirstToken bool
+}
+
+// Collector computes the metrics of the chat steps from their events.
+// Only steps that report their settings in their step metadata are tracked.
+//
+// Collector is also a DeliveryObserver, reporting events that are delayed or dropped
+// by the queued handlers of an event router it is passed to.
+type Collector struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	timeToFirstToken *prometheus.HistogramVec
+	tokens           *prometheus.CounterVec
+	errors           *prometheus.CounterVec
+	inFlight         *prometheus.GaugeVec
+
+	eventsDropped *prometheus.CounterVec
+	eventDelay    *prometheus.HistogramVec
+
+	mutex   sync.Mutex
+	running map[uuid.UUID]*request
+}
+
+func NewCollector() (*Collector, error) {
+	labels := []string{"api_type", "engine"}
+	ret := &Collector{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_requests_total",
+			Help:      "Number of LLM requests, by status (success, error or interrupted).",
+		}, append(labels, "status")),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "llm_request_duration_seconds",
+			Help:      "Duration of LLM requests, until the last token.",
+			Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 80, 160},
+		}, labels),
+		timeToFirstToken: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "llm_time_to_first_token_seconds",
+			Help:      "Time until the first partial completion or tool call of streaming LLM requests.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16},
+		}, labels),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_tokens_total",
+			Help:      "Number of tokens reported by the providers, by direction (input or output).",
+		}, append(labels, "direction")),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_errors_total",
+			Help:      "Number of failed LLM requests, by classified error type.",
+		}, append(labels, "error_type")),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "llm_in_flight_requests",
+			Help:      "Number of LLM requests in progress.",
+		}, labels),
+		eventsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_dropped_total",
+			Help:      "Number of events dropped or coalesced before reaching a queued event handler, by reason.",
+		}, []string{"handler", "topic", "reason"}),
+		eventDelay: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "event_delivery_delay_seconds",
+			Help:      "Time events spend queued before reaching a queued event handler.",
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+		}, []string{"handler", "topic"}),
+		running: map[uuid.UUID]*request{},
+	}
+
+	for _, c := range []prometheus.Collector{
+		ret.requests, ret.requestDuration, ret.timeToFirstToken, ret.tokens, ret.errors, ret.inFlight,
+		ret.eventsDropped, ret.eventDelay,
+	} {
+		err := ret.registry.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+var _ events.DeliveryObserver = (*Collector)(nil)
+
+// ObserveDelivery records the time an event spent queued for a handler of the event router.
+func (c *Collector) ObserveDelivery(handler string, topic string, delay time.Duration) {
+	c.eventDelay.WithLabelValues(handler, topic).Observe(delay.Seconds())
+}
+
+// ObserveDrop records an event dropped or coalesced before reaching a handler of the event router.
+func (c *Collector) ObserveDrop(handler string, topic string, reason string) {
+	c.eventsDropped.WithLabelValues(handler, topic, reason).Inc()
+}
+
+// Registry returns the registry of the metrics, to gather them or to register additional collectors.
+func (c *Collector) Registry() *prometheus.Registry {
+	return c.registry
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (c *Collector) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{})
+}
+
+// AddToRouter computes the metrics from the messages of the given topics of the router.
+func (c *Collector) AddToRouter(router *events.EventRouter, topics ...string) {
+	for _, topic := range topics {
+		router.AddHandler("metrics-"+topic, topic, c.Handle)
+	}
+}
+
+// Handle updates the metrics with the event of msg.
+func (c *Collector) Handle(msg *message.Message) error {
+	defer msg.Ack()
+
+	typedEvent, err := chat.DecodeEvent(msg.Payload)
+	if err != nil {
+		return err
+	}
+	e := typedEvent.GetEvent()
+	if e.Step == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if v := msg.Metadata.Get(events.MetadataTimestamp); v != "" {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			now = t
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stepID := e.Step.StepID
+
+	switch e.Type {
+	case chat.EventTypeStart:
+		apiType, engine, ok := getSettings(e.Step)
+		if !ok {
+			return nil
+		}
+		c.running[stepID] = &request{
+			apiType:   apiType,
+			engine:    engine,
+			startedAt: now,
+		}
+		c.inFlight.WithLabelValues(apiType, engine).Inc()
+
+	case chat.EventTypePartial, chat.EventTypeToolCallDelta:
+		r, ok := c.running[stepID]
+		if !ok || r.hasFirstToken {
+			return nil
+		}
+		r.hasFirstToken = true
+		c.timeToFirstToken.WithLabelValues(r.apiType, r.engine).Observe(now.Sub(r.startedAt).Seconds())
+
+	case chat.EventTypeFinal:
+		r, ok := c.finish(stepID, now)
+		if !ok {
+			return nil
+		}
+		c.requests.WithLabelValues(r.apiType, r.engine, "success").Inc()
+		if usage, ok := getUsage(e.Step); ok {
+			c.tokens.WithLabelValues(r.apiType, r.engine, "input").Add(float64(usage.InputTokens))
+			c.tokens.WithLabelValues(r.apiType, r.engine, "output").Add(float64(usage.OutputTokens))
+		}
+
+	case chat.EventTypeInterrupt:
+		r, ok := c.finish(stepID, now)
+		if !ok {
+			return nil
+		}
+		c.requests.WithLabelValues(r.apiType, r.engine, "interrupted").Inc()
+
+	case chat.EventTypeError:
+		r, ok := c.finish(stepID, now)
+		if !ok {
+			return nil
+		}
+		errorType := "unknown"
+		if e.Error != nil && e.Error.Type != "" {
+			errorType = e.Error.Type
+		}
+		c.requests.WithLabelValues(r.apiType, r.engine, "error").Inc()
+		c.errors.WithLabelValues(r.apiType, r.engine, errorType).Inc()
+
+	case chat.EventTypeStatus,
+		chat.EventTypeToolCall,
+		chat.EventTypeToolResult:
+	}
+
+	return nil
+}
+
+// finish stops tracking the request of the step and records its duration. Needs to be called with the mutex held.
+func (c *Collector) finish(stepID uuid.UUID, now time.Time) (*request, bool) {
+	r, ok := c.running[stepID]
+	if !ok {
+		return nil, false
+	}
+	delete(c.running, stepID)
+
+	c.inFlight.WithLabelValues(r.apiType, r.engine).Dec()
+	c.requestDuration.WithLabelValues(r.apiType, r.engine).Observe(now.Sub(r.startedAt).Seconds())
+	return r, true
+}
+
+func getSettings(step *steps.StepMetadata) (string, string, bool) {
+	settings, ok := step.Metadata[steps.MetadataSettingsSlug].(map[string]interface{})
+	if !ok {
+		return "", "", false
+	}
+	apiType, _ := settings["ai-api-type"].(string)
+	engine, _ := settings["ai-engine"].(string)
+	return apiType, engine, true
+}
+
+// getUsage reads the usage reported by the step, which was decoded from JSON.
+func getUsage(step *steps.StepMetadata) (steps.Usage, bool) {
+	usage, ok := step.Metadata[steps.MetadataUsageSlug].(map[string]interface{})
+	if !ok {
+		return steps.Usage{}, false
+	}
+	inputTokens, _ := usage["input_tokens"].(float64)
+	outputTokens, _ := usage["output_tokens"].(float64)
+	return steps.Usage{
+		InputTokens:  int(inputTokens),
+		OutputTokens: int(outputTokens),
+	}, true
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/openai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func handle(t *testing.T, c *Collector, payload interface{}, at time.Time) {
+	b, err := json.Marshal(payload)
+	require.NoError(t, err)
+	msg := message.NewMessage("id", b)
+	msg.Metadata.Set(events.MetadataTimestamp, at.Format(time.RFC3339Nano))
+	require.NoError(t, c.Handle(msg))
+}
+
+func TestCollector(t *testing.T) {
+	c, err := NewCollector()
+	require.NoError(t, err)
+
+	newStep := func() *steps.StepMetadata {
+		return &steps.StepMetadata{
+			StepID: uuid.New(),
+			Type:   "openai-chat",
+			Metadata: map[string]interface{}{
+				steps.MetadataSettingsSlug: map[string]interface{}{
+					"ai-api-type": "openai",
+					"ai-engine":   "gpt-4",
+				},
+			},
+		}
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	success := newStep()
+	handle(t, c, &chat.Event{Type: chat.EventTypeStart, Step: success}, start)
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.inFlight.WithLabelValues("openai", "gpt-4")))
+	handle(t, c, &chat.EventPartialCompletion{
+		Event: chat.Event{Type: chat.EventTypePartial, Step: success},
+		Delta: "a",
+	}, start.Add(300*time.Millisecond))
+	success.Metadata[steps.MetadataUsageSlug] = steps.Usage{InputTokens: 10, OutputTokens: 20}
+	handle(t, c, &chat.EventText{Event: chat.Event{Type: chat.EventTypeFinal, Step: success}}, start.Add(time.Second))
+
+	failure := newStep()
+	handle(t, c, &chat.Event{Type: chat.EventTypeStart, Step: failure}, start)
+	handle(t, c, &chat.Event{
+		Type:  chat.EventTypeError,
+		Step:  failure,
+		Error: &chat.EventError{Message: "slow down", Type: "rate-limited"},
+	}, start.Add(time.Second))
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(c.inFlight.WithLabelValues("openai", "gpt-4")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.requests.WithLabelValues("openai", "gpt-4", "success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.requests.WithLabelValues("openai", "gpt-4", "error")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.errors.WithLabelValues("openai", "gpt-4", "rate-limited")))
+	assert.Equal(t, 20.0, testutil.ToFloat64(c.tokens.WithLabelValues("openai", "gpt-4", "output")))
+	assert.Equal(t, 1, testutil.CollectAndCount(c.timeToFirstToken))
+	assert.Equal(t, 1, testutil.CollectAndCount(c.requestDuration))
+}
+
+// collectorPublisher delivers the published events to the collector.
+type collectorPublisher struct {
+	c *Collector
+}
+
+func (p *collectorPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		if err := p.c.Handle(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *collectorPublisher) Close() error {
+	return nil
+}
+
+func TestCollectorStreamConnectError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error": {"message": "Rate limit reached", "type": "requests", "code": "rate_limit_exceeded"}}`))
+	}))
+	defer server.Close()
+
+	apiType := settings.ApiTypeOpenAI
+	engine := "gpt-4"
+	stepSettings := settings.NewStepSettings()
+	stepSettings.Chat.ApiType = &apiType
+	stepSettings.Chat.Engine = &engine
+	stepSettings.Chat.Stream = true
+	stepSettings.API.APIKeys[apiType+"-api-key"] = "key"
+	stepSettings.API.BaseUrls[apiType+"-base-url"] = server.URL
+
+	c, err := NewCollector()
+	require.NoError(t, err)
+	step, err := openai.NewStep(stepSettings)
+	require.NoError(t, err)
+	require.NoError(t, step.AddPublishedTopic(&collectorPublisher{c: c}, "chat"))
+
+	res, err := step.Start(context.Background(), conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleUser, "hello"),
+	})
+	require.NoError(t, err)
+	for r := range res.GetChannel() {
+		_, err = r.Value()
+		require.Error(t, err)
+	}
+
+	// the failed connection ends the request like any other error
+	assert.Equal(t, 0.0, testutil.ToFloat64(c.inFlight.WithLabelValues("openai", "gpt-4")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.requests.WithLabelValues("openai", "gpt-4", "error")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.errors.WithLabelValues("openai", "gpt-4", "rate-limited")))
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// Model is a model name offered to the clients of the proxy, answered with the settings of a profile.
+type Model struct {
+	Name string `yaml:"name"`
+	// Profile is the pinocchio profile providing the API type, engine and keys of the model.
+	// An empty profile selects the default profile.
+	Profile string `yaml:"profile,omitempty"`
+	// Engine overrides the engine of the profile.
+	Engine string `yaml:"engine,omitempty"`
+	// InputPrice and OutputPrice are the prices of the model in dollars per million tokens,
+	// used to account for the cost of the requests.
+	InputPrice  float64 `yaml:"input-price,omitempty"`
+	OutputPrice float64 `yaml:"output-price,omitempty"`
+}
+
+// Cost returns the cost in dollars of a request of the model.
+func (m *Model) Cost(usage Usage) float64 {
+	return (float64(usage.PromptTokens)*m.InputPrice + float64(usage.CompletionTokens)*m.OutputPrice) / 1_000_000
+}
+
+type modelsFile struct {
+	Models []*Model `yaml:"models"`
+}
+
+// LoadModels loads the models from a YAML file:
+//
+//	models:
+//	  - name: claude-3-5-sonnet
+//	    profile: claude
+//	    input-price: 3
+//	    output-price: 15
+//	  - name: gpt-4o-mini
+//	    profile: openai
+//	    engine: gpt-4o-mini
+func LoadModels(path string) ([]*Model, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read models file %s", path)
+	}
+	f := &modelsFile{}
+	err = yaml.Unmarshal(b, f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse models file %s", path)
+	}
+
+	names := map[string]bool{}
+	for _, model := range f.Models {
+		if model.Name == "" {
+			return nil, errors.Errorf("model without name in %s", path)
+		}
+		if names[model.Name] {
+			return nil, errors.Errorf("duplicate model %s in %s", model.Name, path)
+		}
+		names[model.Name] = true
+	}
+	return f.Models, nil
+}
+
+// ModelsFromProfiles offers one model per profile of the profile file, named after the profile.
+func ModelsFromProfiles(profileFile string) ([]*Model, error) {
+	profiles, err := cmds.ListProfiles(profileFile)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*Model{}
+	for _, profile := range profiles {
+		ret = append(ret, &Model{Name: profile, Profile: profile})
+	}
+	return ret, nil
+}
+
+// getStepSettings loads the step settings of the model from its profile.
+func (m *Model) getStepSettings(profileFile string) (*settings.StepSettings, error) {
+	stepSettings := settings.NewStepSettings()
+	geppettoLayers, err := cmds.CreateGeppettoLayers(stepSettings)
+	if err != nil {
+		return nil, err
+	}
+	description := glazed_cmds.NewCommandDescription("proxy", glazed_cmds.WithLayersList(geppettoLayers...))
+
+	values := map[string]map[string]interface{}{}
+	if m.Engine != "" {
+		values[settings.AiChatSlug] = map[string]interface{}{"ai-engine": m.Engine}
+	}
+	parsedLayers, err := cmds.ParseGeppettoParametersFromMap(description, values, profileFile, m.Profile)
+	if err != nil {
+		return nil, err
+	}
+	err = stepSettings.UpdateFromParsedLayers(parsedLayers)
+	if err != nil {
+		return nil, err
+	}
+	return stepSettings, nil
+}
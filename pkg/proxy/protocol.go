@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+)
+
+// The types of the OpenAI chat completions API, limited to the fields understood by the proxy.
+// Pointers distinguish unset parameters, which are left to the profile of the model.
+
+type ChatCompletionRequest struct {
+	Model               string        `json:"model"`
+	Messages            []Message     `json:"messages"`
+	MaxTokens           *int          `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int          `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64      `json:"temperature,omitempty"`
+	TopP                *float64      `json:"top_p,omitempty"`
+	N                   *int          `json:"n,omitempty"`
+	Stop                Stop          `json:"stop,omitempty"`
+	Stream              bool          `json:"stream,omitempty"`
+	StreamOptions       *StreamOption `json:"stream_options,omitempty"`
+	Tools               []interface{} `json:"tools,omitempty"`
+	Functions           []interface{} `json:"functions,omitempty"`
+}
+
+type StreamOption struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+// Stop is either a single stop sequence or a list of them.
+type Stop []string
+
+func (s *Stop) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*s = Stop{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("stop must be a string or a list of strings")
+	}
+	*s = list
+	return nil
+}
+
+type Message struct {
+	Role    string         `json:"role"`
+	Content MessageContent `json:"content"`
+}
+
+// MessageContent is either a string or a list of content parts, of which only text parts are supported.
+type MessageContent string
+
+func (c *MessageContent) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*c = MessageContent(text)
+		return nil
+	}
+	if string(b) == "null" {
+		*c = ""
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return errors.New("content must be a string or a list of content parts")
+	}
+	text = ""
+	for _, part := range parts {
+		if part.Type != "text" {
+			return errors.Errorf("unsupported content part type %s", part.Type)
+		}
+		text += part.Text
+	}
+	*c = MessageContent(text)
+	return nil
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ResponseMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type Choice struct {
+	Index        int             `json:"index"`
+	Message      ResponseMessage `json:"message"`
+	FinishReason string          `json:"finish_reason"`
+}
+
+type ChatCompletionResponse struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
+}
+
+type Delta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type ChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Delta   `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type ChatCompletionChunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []ChunkChoice `json:"choices"`
+	// Usage is only sent in the last chunk, when requested with stream_options.include_usage.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+type ModelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelInfo `json:"data"`
+}
+
+type Error struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
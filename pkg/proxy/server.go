@@ -0,0 +1,599 @@
+// Package proxy serves an OpenAI-compatible chat completions API, answering each model through
+// the settings of a pinocchio profile. Tools built on the OpenAI SDKs can then use Claude or any
+// other provider supported by geppetto, with the requests logged, cached and accounted for in one place.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/metrics"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/checkpoint"
+	"github.com/go-go-golems/geppetto/pkg/tokens"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StepFactory creates the chat step answering a request, from the settings of the requested model.
+type StepFactory func(stepSettings *settings.StepSettings) (chat.Step, error)
+
+// Server answers the OpenAI chat completions requests with the geppetto chat steps.
+type Server struct {
+	models      []*Model
+	profileFile string
+	newStep     StepFactory
+	cache       checkpoint.Store
+	collector   *metrics.Collector
+
+	requests *prometheus.CounterVec
+	tokens   *prometheus.CounterVec
+	cost     *prometheus.CounterVec
+}
+
+type ServerOption func(*Server)
+
+// WithProfileFile selects the profile file from which the settings of the models are loaded.
+func WithProfileFile(profileFile string) ServerOption {
+	return func(s *Server) {
+		s.profileFile = profileFile
+	}
+}
+
+// WithStepFactory replaces the standard step factory, for example to answer with a fake provider in tests.
+func WithStepFactory(newStep StepFactory) ServerOption {
+	return func(s *Server) {
+		s.newStep = newStep
+	}
+}
+
+// WithCache returns the recorded completion of requests that were already answered with the same
+// messages and settings, instead of calling the provider again.
+func WithCache(store checkpoint.Store) ServerOption {
+	return func(s *Server) {
+		s.cache = store
+	}
+}
+
+// WithMetrics records the LLM metrics of the requests, and the requests, tokens and cost by model,
+// in the registry of the collector.
+func WithMetrics(collector *metrics.Collector) ServerOption {
+	return func(s *Server) {
+		s.collector = collector
+	}
+}
+
+func NewServer(models []*Model, options ...ServerOption) (*Server, error) {
+	ret := &Server{
+		models: models,
+		newStep: func(stepSettings *settings.StepSettings) (chat.Step, error) {
+			factory := &ai.StandardStepFactory{Settings: stepSettings}
+			return factory.NewStep()
+		},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+
+	if ret.collector != nil {
+		ret.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "geppetto",
+			Name:      "proxy_requests_total",
+			Help:      "Number of chat completion requests answered by the proxy, by model, status and whether they were cached.",
+		}, []string{"model", "status", "cached"})
+		ret.tokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "geppetto",
+			Name:      "proxy_tokens_total",
+			Help:      "Number of tokens of the requests answered by the proxy, by model and direction (input or output).",
+		}, []string{"model", "direction"})
+		ret.cost = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "geppetto",
+			Name:      "proxy_cost_dollars_total",
+			Help:      "Cost of the requests answered by the proxy, by model, from the prices of the models.",
+		}, []string{"model"})
+		for _, c := range []prometheus.Collector{ret.requests, ret.tokens, ret.cost} {
+			err := ret.collector.Registry().Register(c)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// Handler serves POST /v1/chat/completions and GET /v1/models, and GET /metrics when metrics are enabled.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.serveChatCompletions)
+	mux.HandleFunc("/v1/models", s.serveModels)
+	if s.collector != nil {
+		mux.Handle("/metrics", s.collector.Handler())
+	}
+	return mux
+}
+
+func (s *Server) getModel(name string) *Model {
+	for _, model := range s.models {
+		if model.Name == name {
+			return model
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Debug().Err(err).Msg("could not write response")
+	}
+}
+
+func newError(type_ string, code string, err error) *ErrorResponse {
+	ret := &ErrorResponse{Error: Error{Message: err.Error(), Type: type_}}
+	if code != "" {
+		ret.Error.Code = &code
+	}
+	return ret
+}
+
+func writeError(w http.ResponseWriter, status int, type_ string, code string, err error) {
+	writeJSON(w, status, newError(type_, code, err))
+}
+
+// writeUpstreamError writes the error of the provider with the status and error code an OpenAI
+// client expects, so that it backs off on rate limits and doesn't retry invalid requests.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	status, type_, code := getUpstreamError(err)
+	var rateLimited *ai_errors.ErrRateLimited
+	if errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(rateLimited.RetryAfter.Round(time.Second).Seconds())))
+	}
+	writeError(w, status, type_, code, err)
+}
+
+// getUpstreamError returns the HTTP status, the error type and the error code of an error of the provider.
+func getUpstreamError(err error) (int, string, string) {
+	var rateLimited *ai_errors.ErrRateLimited
+	var auth *ai_errors.ErrAuth
+	var contextLength *ai_errors.ErrContextLengthExceeded
+	var modelNotFound *ai_errors.ErrModelNotFound
+	var contentFiltered *ai_errors.ErrContentFiltered
+	switch {
+	case errors.As(err, &rateLimited):
+		return http.StatusTooManyRequests, "requests", "rate_limit_exceeded"
+	case errors.As(err, &auth):
+		return http.StatusUnauthorized, "authentication_error", "invalid_api_key"
+	case errors.As(err, &contextLength):
+		return http.StatusBadRequest, "invalid_request_error", "context_length_exceeded"
+	case errors.As(err, &modelNotFound):
+		return http.StatusNotFound, "invalid_request_error", "model_not_found"
+	case errors.As(err, &contentFiltered):
+		return http.StatusBadRequest, "invalid_request_error", "content_filter"
+	default:
+		return http.StatusBadGateway, "upstream_error", ""
+	}
+}
+
+func (s *Server) serveModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "", errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	ret := &ModelList{Object: "list", Data: []ModelInfo{}}
+	for _, model := range s.models {
+		ret.Data = append(ret.Data, ModelInfo{ID: model.Name, Object: "model", OwnedBy: "pinocchio"})
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+// getConversation converts the messages of the request, which only supports text messages.
+func getConversation(messages []Message) (conversation.Conversation, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("messages can't be empty")
+	}
+
+	ret := conversation.Conversation{}
+	for _, msg := range messages {
+		var role conversation.Role
+		switch msg.Role {
+		case "system", "developer":
+			role = conversation.RoleSystem
+		case "user":
+			role = conversation.RoleUser
+		case "assistant":
+			role = conversation.RoleAssistant
+		default:
+			return nil, errors.Errorf("unsupported message role %s", msg.Role)
+		}
+		ret = append(ret, conversation.NewChatMessage(role, string(msg.Content)))
+	}
+	return ret, nil
+}
+
+// updateStepSettings applies the sampling parameters of the request over the settings of the profile.
+func updateStepSettings(stepSettings *settings.StepSettings, request *ChatCompletionRequest) error {
+	if len(request.Tools) > 0 || len(request.Functions) > 0 {
+		return errors.New("tools are not supported")
+	}
+	if request.N != nil && *request.N != 1 {
+		return errors.New("only n=1 is supported")
+	}
+
+	if request.MaxCompletionTokens != nil {
+		stepSettings.Chat.MaxResponseTokens = request.MaxCompletionTokens
+	} else if request.MaxTokens != nil {
+		stepSettings.Chat.MaxResponseTokens = request.MaxTokens
+	}
+	if request.Temperature != nil {
+		stepSettings.Chat.Temperature = request.Temperature
+	}
+	if request.TopP != nil {
+		stepSettings.Chat.TopP = request.TopP
+	}
+	if len(request.Stop) > 0 {
+		stepSettings.Chat.Stop = request.Stop
+	}
+	stepSettings.Chat.Stream = request.Stream
+	return nil
+}
+
+func (s *Server) serveChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "", errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	request := &ChatCompletionRequest{}
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", errors.Wrap(err, "invalid request"))
+		return
+	}
+
+	model := s.getModel(request.Model)
+	if model == nil {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			errors.Errorf("the model %s does not exist", request.Model))
+		return
+	}
+	conversation_, err := getConversation(request.Messages)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", err)
+		return
+	}
+	stepSettings, err := model.getStepSettings(s.profileFile)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	err = updateStepSettings(stepSettings, request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", err)
+		return
+	}
+
+	c := &completion{
+		id:      "chatcmpl-" + uuid.NewString(),
+		created: time.Now().Unix(),
+		model:   model.Name,
+	}
+	if request.Stream {
+		c.stream = &chunkWriter{w: w, completion: c}
+	}
+
+	startedAt := time.Now()
+	err = s.complete(r.Context(), model, stepSettings, conversation_, c)
+	s.account(model, stepSettings, c, err, time.Since(startedAt))
+
+	if request.Stream {
+		c.stream.finish(request.StreamOptions != nil && request.StreamOptions.IncludeUsage, err)
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &ChatCompletionResponse{
+		ID:      c.id,
+		Object:  "chat.completion",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []Choice{{
+			Message:      ResponseMessage{Role: "assistant", Content: c.answer},
+			FinishReason: "stop",
+		}},
+		Usage: c.usage,
+	})
+}
+
+// completion is the answer to a request, with its usage as reported by the provider, or estimated.
+type completion struct {
+	id      string
+	created int64
+	model   string
+	answer  string
+	usage   Usage
+	cached  bool
+	// stream is only set for streaming requests
+	stream *chunkWriter
+}
+
+func (s *Server) complete(
+	ctx context.Context,
+	model *Model,
+	stepSettings *settings.StepSettings,
+	conversation_ conversation.Conversation,
+	c *completion,
+) error {
+	publisher, closeRouter, err := s.startRouter(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer closeRouter()
+
+	var step chat.Step
+	step, err = s.newStep(stepSettings)
+	if err != nil {
+		return err
+	}
+	if s.cache != nil {
+		step = checkpoint.NewStep[conversation.Conversation, string](step, s.cache, "proxy", model.Name,
+			checkpoint.WithHashFunc(func(input interface{}) (string, error) {
+				return cmds.HashConversation(input.(conversation.Conversation), stepSettings)
+			}),
+			checkpoint.WithOnResume(func(*checkpoint.Checkpoint) {
+				c.cached = true
+			}),
+		)
+	}
+	if publisher != nil {
+		err = step.AddPublishedTopic(publisher, "chat")
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := steps.Start[conversation.Conversation, string](ctx, step, conversation_)
+	if err != nil {
+		return err
+	}
+	for v := range result.GetChannel() {
+		s_, err := v.Value()
+		if err != nil {
+			return err
+		}
+		c.answer += s_
+	}
+
+	if metadata := result.GetMetadata(); metadata != nil {
+		if usage, ok := metadata.Metadata[steps.MetadataUsageSlug].(steps.Usage); ok {
+			c.usage = Usage{PromptTokens: usage.InputTokens, CompletionTokens: usage.OutputTokens}
+		}
+	}
+	if c.usage.PromptTokens == 0 && c.usage.CompletionTokens == 0 {
+		engine := ""
+		if stepSettings.Chat.Engine != nil {
+			engine = *stepSettings.Chat.Engine
+		}
+		c.usage = estimateUsage(engine, conversation_, c.answer)
+	}
+	c.usage.TotalTokens = c.usage.PromptTokens + c.usage.CompletionTokens
+	return nil
+}
+
+// startRouter runs an event router for the streamed chunks and the metrics of the completion.
+// Requests that neither stream nor record metrics don't need the events, and get a nil publisher.
+func (s *Server) startRouter(ctx context.Context, c *completion) (message.Publisher, func(), error) {
+	if c.stream == nil && s.collector == nil {
+		return nil, func() {}, nil
+	}
+
+	router, err := events.NewEventRouter()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.stream != nil {
+		// the handler is synchronous, so all the chunks have been sent once the step is done
+		router.AddHandler("proxy", "chat", c.stream.writeChatEvent)
+	}
+	if s.collector != nil {
+		s.collector.AddToRouter(router, "chat")
+	}
+
+	routerCtx, cancelRouter := context.WithCancel(ctx)
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		return router.Run(routerCtx)
+	})
+	closeRouter := func() {
+		cancelRouter()
+		_ = eg.Wait()
+		err := router.Close()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to close event router")
+		}
+	}
+	select {
+	case <-router.Running():
+	case <-ctx.Done():
+		closeRouter()
+		return nil, nil, ctx.Err()
+	}
+	return router.Publisher, closeRouter, nil
+}
+
+// estimateUsage counts the tokens with the tokenizer of engine, for the providers and the cached
+// completions that don't report their usage.
+func estimateUsage(engine string, conversation_ conversation.Conversation, answer string) Usage {
+	counter, err := tokens.NewCounter(engine)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not create tokenizer")
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     counter.CountConversation(conversation_),
+		CompletionTokens: counter.Tokenizer.Count(answer),
+	}
+}
+
+// account logs the request and records its metrics.
+func (s *Server) account(model *Model, stepSettings *settings.StepSettings, c *completion, err error, duration time.Duration) {
+	engine := ""
+	if stepSettings.Chat.Engine != nil {
+		engine = *stepSettings.Chat.Engine
+	}
+	cost := model.Cost(c.usage)
+
+	if err != nil {
+		log.Warn().Err(err).
+			Str("model", model.Name).Str("profile", model.Profile).Str("engine", engine).
+			Dur("duration", duration).
+			Msg("chat completion failed")
+	} else {
+		log.Info().
+			Str("model", model.Name).Str("profile", model.Profile).Str("engine", engine).
+			Int("input_tokens", c.usage.PromptTokens).Int("output_tokens", c.usage.CompletionTokens).
+			Float64("cost", cost).Bool("cached", c.cached).Dur("duration", duration).
+			Msg("chat completion")
+	}
+
+	if s.collector == nil {
+		return
+	}
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	s.requests.WithLabelValues(model.Name, status, strconv.FormatBool(c.cached)).Inc()
+	if err != nil || c.cached {
+		return
+	}
+	s.tokens.WithLabelValues(model.Name, "input").Add(float64(c.usage.PromptTokens))
+	s.tokens.WithLabelValues(model.Name, "output").Add(float64(c.usage.CompletionTokens))
+	s.cost.WithLabelValues(model.Name).Add(cost)
+}
+
+// chunkWriter streams a completion as chat.completion.chunk Server-Sent Events.
+// The headers are only sent with the first chunk, so that failures before the completion
+// started are returned with an error status.
+type chunkWriter struct {
+	mutex      sync.Mutex
+	w          http.ResponseWriter
+	completion *completion
+	started    bool
+	streamed   bool
+}
+
+func (s *chunkWriter) writeData(data []byte) {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		s.w.Header().Set("Connection", "keep-alive")
+		s.w.WriteHeader(http.StatusOK)
+	}
+	_, err := fmt.Fprintf(s.w, "data: %s\n\n", data)
+	if err != nil {
+		log.Debug().Err(err).Msg("SSE client disconnected")
+		return
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *chunkWriter) writeChunk(delta Delta, finishReason *string, usage *Usage) {
+	choices := []ChunkChoice{}
+	if usage == nil {
+		choices = append(choices, ChunkChoice{Delta: delta, FinishReason: finishReason})
+	}
+	b, err := json.Marshal(&ChatCompletionChunk{
+		ID:      s.completion.id,
+		Object:  "chat.completion.chunk",
+		Created: s.completion.created,
+		Model:   s.completion.model,
+		Choices: choices,
+		Usage:   usage,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("could not marshal chunk")
+		return
+	}
+	s.writeData(b)
+}
+
+func (s *chunkWriter) writeDelta(content string) {
+	delta := Delta{Content: content}
+	if !s.streamed {
+		delta.Role = "assistant"
+		s.streamed = true
+	}
+	s.writeChunk(delta, nil, nil)
+}
+
+// writeChatEvent sends the partial completions published by the step.
+func (s *chunkWriter) writeChatEvent(msg *message.Message) error {
+	e, err := chat.NewEventFromJson(msg.Payload)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not parse chat event")
+		return nil
+	}
+	partial, ok := e.ToPartialCompletion()
+	if !ok || e.Type != chat.EventTypePartial || partial.Delta == "" {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.writeDelta(partial.Delta)
+	return nil
+}
+
+// finish ends the stream, sending the answer at once if the step didn't stream it, as do cached
+// completions. Errors are returned with an error status if nothing was sent yet.
+func (s *chunkWriter) finish(includeUsage bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		if !s.started {
+			writeUpstreamError(s.w, err)
+			return
+		}
+		_, type_, code := getUpstreamError(err)
+		b, err := json.Marshal(newError(type_, code, err))
+		if err == nil {
+			s.writeData(b)
+		}
+		return
+	}
+
+	if !s.streamed {
+		s.writeDelta(s.completion.answer)
+	}
+	stop := "stop"
+	s.writeChunk(Delta{}, &stop, nil)
+	if includeUsage {
+		s.writeChunk(Delta{}, nil, &s.completion.usage)
+	}
+	s.writeData([]byte("[DONE]"))
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/checkpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStep counts the completions requested from the echo step.
+type countingStep struct {
+	*chat.EchoStep
+	started *int32
+}
+
+func (c *countingStep) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
+	atomic.AddInt32(c.started, 1)
+	return c.EchoStep.Start(ctx, input)
+}
+
+func TestServerChatCompletions(t *testing.T) {
+	// no pinocchio profiles
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	// the echo step stands in for the provider, answering with the last message
+	started := int32(0)
+	server, err := NewServer([]*Model{{Name: "echo", Engine: "gpt-4o-mini", InputPrice: 1, OutputPrice: 2}},
+		WithStepFactory(func(stepSettings *settings.StepSettings) (chat.Step, error) {
+			step := chat.NewEchoStep()
+			step.TimePerCharacter = 0
+			return &countingStep{EchoStep: step, started: &started}, nil
+		}),
+		WithCache(store),
+	)
+	require.NoError(t, err)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	post := func(body string) *http.Response {
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/models")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	models := &ModelList{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(models))
+	require.Len(t, models.Data, 1)
+	assert.Equal(t, "echo", models.Data[0].ID)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "system", "content": "Be nice"}, {"role": "user", "content": [{"type": "text", "text": "Hello"}]}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	completion := &ChatCompletionResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(completion))
+	require.Len(t, completion.Choices, 1)
+	assert.Equal(t, "Hello", completion.Choices[0].Message.Content)
+	assert.Equal(t, "assistant", completion.Choices[0].Message.Role)
+	assert.Positive(t, completion.Usage.PromptTokens)
+	assert.Positive(t, completion.Usage.CompletionTokens)
+
+	resp = post(`{"model": "echo", "stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "Hi there"}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	content, lines := "", []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		lines = append(lines, data)
+		if data == "[DONE]" {
+			continue
+		}
+		chunk := &ChatCompletionChunk{}
+		require.NoError(t, json.Unmarshal([]byte(data), chunk))
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+		}
+	}
+	assert.Equal(t, "Hi there", content)
+	require.GreaterOrEqual(t, len(lines), 4)
+	assert.Equal(t, "[DONE]", lines[len(lines)-1])
+	assert.Contains(t, lines[len(lines)-2], `"usage"`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&started))
+
+	// the same messages are answered from the cache
+	resp = post(`{"model": "echo", "messages": [{"role": "system", "content": "Be nice"}, {"role": "user", "content": "Hello"}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(completion))
+	assert.Equal(t, "Hello", completion.Choices[0].Message.Content)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&started))
+
+	resp = post(`{"model": "unknown", "messages": [{"role": "user", "content": "Hello"}]}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	errorResponse := &ErrorResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(errorResponse))
+	require.NotNil(t, errorResponse.Error.Code)
+	assert.Equal(t, "model_not_found", *errorResponse.Error.Code)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "Hello"}], "tools": [{"type": "function"}]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// failingStep stands in for a provider failing with the error named by the last message.
+type failingStep struct {
+	*chat.EchoStep
+}
+
+var providerErrors = map[string]error{
+	"rate-limited": &ai_errors.ErrRateLimited{
+		ProviderError: ai_errors.ProviderError{Provider: "openai", HTTPStatusCode: 429, Message: "slow down"},
+		RetryAfter:    2 * time.Second,
+	},
+	"auth":           &ai_errors.ErrAuth{ProviderError: ai_errors.ProviderError{Provider: "openai", HTTPStatusCode: 401, Message: "invalid key"}},
+	"context-length": &ai_errors.ErrContextLengthExceeded{ProviderError: ai_errors.ProviderError{Provider: "openai", HTTPStatusCode: 400, Message: "too long"}},
+	"model":          &ai_errors.ErrModelNotFound{ProviderError: ai_errors.ProviderError{Provider: "openai", HTTPStatusCode: 404, Message: "no such model"}},
+	"filtered":       &ai_errors.ErrContentFiltered{ProviderError: ai_errors.ProviderError{Provider: "openai", HTTPStatusCode: 400, Message: "filtered"}},
+	"server":         &ai_errors.ErrServerError{ProviderError: ai_errors.ProviderError{Provider: "openai", HTTPStatusCode: 500, Message: "oops"}},
+}
+
+func (f *failingStep) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
+	return steps.Reject[string](providerErrors[input[len(input)-1].Content.String()]), nil
+}
+
+func TestServerUpstreamErrors(t *testing.T) {
+	// no pinocchio profiles
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	server, err := NewServer([]*Model{{Name: "failing", Engine: "gpt-4o-mini"}},
+		WithStepFactory(func(stepSettings *settings.StepSettings) (chat.Step, error) {
+			return &failingStep{EchoStep: chat.NewEchoStep()}, nil
+		}),
+	)
+	require.NoError(t, err)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		error  string
+		status int
+		code   string
+	}{
+		{"rate-limited", http.StatusTooManyRequests, "rate_limit_exceeded"},
+		{"auth", http.StatusUnauthorized, "invalid_api_key"},
+		{"context-length", http.StatusBadRequest, "context_length_exceeded"},
+		{"model", http.StatusNotFound, "model_not_found"},
+		{"filtered", http.StatusBadRequest, "content_filter"},
+		{"server", http.StatusBadGateway, ""},
+	}
+	for _, stream := range []bool{false, true} {
+		for _, test := range tests {
+			body, err := json.Marshal(map[string]interface{}{
+				"model":    "failing",
+				"stream":   stream,
+				"messages": []map[string]string{{"role": "user", "content": test.error}},
+			})
+			require.NoError(t, err)
+			resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(string(body)))
+			require.NoError(t, err)
+			errorResponse := &ErrorResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(errorResponse))
+			_ = resp.Body.Close()
+
+			assert.Equal(t, test.status, resp.StatusCode, test.error)
+			if test.code == "" {
+				assert.Nil(t, errorResponse.Error.Code, test.error)
+			} else {
+				require.NotNil(t, errorResponse.Error.Code, test.error)
+				assert.Equal(t, test.code, *errorResponse.Error.Code, test.error)
+			}
+			if test.error == "rate-limited" {
+				assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+			}
+		}
+	}
+}
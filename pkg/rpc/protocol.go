@@ -0,0 +1,103 @@
+package rpc
+
+import "encoding/json"
+
+// ProtocolVersion is the version of the pinocchio JSON-RPC protocol, increased on incompatible changes.
+const ProtocolVersion = 1
+
+type InitializeResult struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+}
+
+type ParameterInfo struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Help       string      `json:"help,omitempty"`
+	Default    interface{} `json:"default,omitempty"`
+	Choices    []string    `json:"choices,omitempty"`
+	Required   bool        `json:"required,omitempty"`
+	IsArgument bool        `json:"is_argument,omitempty"`
+}
+
+// LayerInfo describes a parameter layer of a command. The parameters of a command are
+// passed per layer, the flags and arguments of the command itself being in the "default" layer.
+type LayerInfo struct {
+	Slug        string          `json:"slug"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Prefix      string          `json:"prefix,omitempty"`
+	Parameters  []ParameterInfo `json:"parameters"`
+}
+
+type CommandInfo struct {
+	// Name is the path of the command, as typed on the command line, for example "code review".
+	Name string `json:"name"`
+	// ToolName is the name of the command when served as an MCP tool, which is also accepted to run it.
+	ToolName string      `json:"tool_name"`
+	Short    string      `json:"short,omitempty"`
+	Long     string      `json:"long,omitempty"`
+	Layers   []LayerInfo `json:"layers"`
+}
+
+type ListCommandsResult struct {
+	Commands []CommandInfo `json:"commands"`
+}
+
+// Parameters are the values of the parameters of a command, by layer slug and parameter name.
+type Parameters map[string]map[string]interface{}
+
+type RunCommandParams struct {
+	Command    string     `json:"command"`
+	Parameters Parameters `json:"parameters,omitempty"`
+	// Profile and ProfileFile select the pinocchio profile, instead of the one the server was started with.
+	Profile     string `json:"profile,omitempty"`
+	ProfileFile string `json:"profile_file,omitempty"`
+	// ID identifies the run in the event notifications and to cancel it. The server generates one if empty.
+	ID string `json:"id,omitempty"`
+	// Stream sends the events of the run as commands/event notifications.
+	Stream bool `json:"stream,omitempty"`
+}
+
+type RunCommandResult struct {
+	ID     string `json:"id"`
+	Output string `json:"output"`
+}
+
+type CancelParams struct {
+	ID string `json:"id"`
+}
+
+type StartChatParams struct {
+	// Command is the command whose messages and prompt start the conversation. Without a command,
+	// the conversation starts with SystemPrompt and Message.
+	Command     string     `json:"command,omitempty"`
+	Parameters  Parameters `json:"parameters,omitempty"`
+	Profile     string     `json:"profile,omitempty"`
+	ProfileFile string     `json:"profile_file,omitempty"`
+	// Conversation is the ID, or unique ID prefix, of a stored conversation to continue.
+	Conversation string `json:"conversation,omitempty"`
+	// SystemPrompt replaces the system prompt of the command.
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Message is a user message added after the messages of the command.
+	Message string `json:"message,omitempty"`
+}
+
+type ContinueChatParams struct {
+	ChatID  string `json:"chat_id"`
+	Message string `json:"message"`
+}
+
+type ChatResult struct {
+	ChatID string `json:"chat_id"`
+	// Answer is empty if the chat was started without a user message to answer.
+	Answer string `json:"answer"`
+}
+
+// EventParams are the params of the commands/event and chat/event notifications.
+// Event is a chat event, serialized as it was published by the step.
+type EventParams struct {
+	ID    string          `json:"id"`
+	Event json.RawMessage `json:"event"`
+}
@@ -0,0 +1,521 @@
+// Package rpc serves the geppetto commands and chats over JSON-RPC 2.0, so that editors and other
+// programs can run them and stream their completions without scraping the terminal output.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/jsonrpc"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"strings"
+	"sync"
+)
+
+// StepFactory creates the chat step answering the messages of a chat.
+type StepFactory func(stepSettings *settings.StepSettings) (chat.Step, error)
+
+// Server runs geppetto commands and chats for a JSON-RPC client.
+//
+// Commands are run like on the command line, writing their output into the result.
+// Chats are kept in memory for the lifetime of the server, and saved to the conversation
+// store after each answer if there is one. The events of the steps are sent to the client
+// as notifications while they run.
+type Server struct {
+	commands    []*cmds.GeppettoCommand
+	profileFile string
+	profile     string
+	store       *conversations.Store
+	newStep     StepFactory
+
+	mutex sync.Mutex
+	chats map[string]*chatSession
+	// cancels are the cancel functions of the running commands and chat answers, by ID
+	cancels map[string]context.CancelFunc
+}
+
+type chatSession struct {
+	name string
+	// manager continues the conversation from its last message, also for stored conversations with branches
+	manager      *conversations.BranchingManager
+	stepSettings *settings.StepSettings
+	// busy is held while the chat is answering
+	busy sync.Mutex
+}
+
+type ServerOption func(*Server)
+
+// WithProfile selects the pinocchio profile used when a request doesn't select one.
+func WithProfile(profileFile string, profile string) ServerOption {
+	return func(s *Server) {
+		s.profileFile = profileFile
+		s.profile = profile
+	}
+}
+
+// WithConversationStore saves the chats to store, and allows continuing stored conversations.
+func WithConversationStore(store *conversations.Store) ServerOption {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithStepFactory replaces the standard step factory used to answer chats.
+func WithStepFactory(newStep StepFactory) ServerOption {
+	return func(s *Server) {
+		s.newStep = newStep
+	}
+}
+
+func NewServer(commands []*cmds.GeppettoCommand, options ...ServerOption) *Server {
+	ret := &Server{
+		commands: commands,
+		newStep: func(stepSettings *settings.StepSettings) (chat.Step, error) {
+			factory := &ai.StandardStepFactory{Settings: stepSettings}
+			return factory.NewStep()
+		},
+		chats:   map[string]*chatSession{},
+		cancels: map[string]context.CancelFunc{},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+// Serve answers the requests read from r until r is closed or ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	var conn *jsonrpc.Conn
+	conn = jsonrpc.NewConn(r, w, func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		return s.handle(ctx, conn, method, params)
+	})
+	return conn.Run(ctx)
+}
+
+func (s *Server) handle(ctx context.Context, conn *jsonrpc.Conn, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return &InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Name:            "pinocchio",
+			Version:         "0.1.0",
+		}, nil
+
+	case "commands/list":
+		ret := &ListCommandsResult{Commands: []CommandInfo{}}
+		for _, command := range s.commands {
+			ret.Commands = append(ret.Commands, getCommandInfo(command))
+		}
+		return ret, nil
+
+	case "commands/run":
+		p := &RunCommandParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		return s.runCommand(ctx, conn, p)
+
+	case "commands/cancel", "chat/cancel":
+		p := &CancelParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		cancel, ok := s.cancels[p.ID]
+		s.mutex.Unlock()
+		if !ok {
+			return nil, jsonrpc.ErrInvalidParams(errors.Errorf("nothing running with id %s", p.ID))
+		}
+		cancel()
+		return struct{}{}, nil
+
+	case "chat/start":
+		p := &StartChatParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		return s.startChat(ctx, conn, p)
+
+	case "chat/continue":
+		p := &ContinueChatParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		if p.Message == "" {
+			return nil, jsonrpc.ErrInvalidParams(errors.New("missing message"))
+		}
+		s.mutex.Lock()
+		session, ok := s.chats[p.ChatID]
+		s.mutex.Unlock()
+		if !ok {
+			return nil, jsonrpc.ErrInvalidParams(errors.Errorf("unknown chat %s", p.ChatID))
+		}
+		return s.answer(ctx, conn, p.ChatID, session, p.Message)
+
+	case "chat/close":
+		p := &CancelParams{}
+		err := jsonrpc.UnmarshalParams(params, p)
+		if err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if cancel, ok := s.cancels[p.ID]; ok {
+			cancel()
+		}
+		delete(s.chats, p.ID)
+		return struct{}{}, nil
+
+	default:
+		return nil, jsonrpc.ErrMethodNotFound(method)
+	}
+}
+
+// getCommand finds a command by its path, for example "code review", or by its tool name.
+func (s *Server) getCommand(name string) (*cmds.GeppettoCommand, error) {
+	for _, command := range s.commands {
+		if getCommandPath(command) == name || cmds.GetCommandToolName(command) == name {
+			return command, nil
+		}
+	}
+	return nil, jsonrpc.ErrInvalidParams(errors.Errorf("unknown command %s", name))
+}
+
+func getCommandPath(command *cmds.GeppettoCommand) string {
+	return strings.Join(append(append([]string{}, command.Parents...), command.Name), " ")
+}
+
+func getCommandInfo(command *cmds.GeppettoCommand) CommandInfo {
+	ret := CommandInfo{
+		Name:     getCommandPath(command),
+		ToolName: cmds.GetCommandToolName(command),
+		Short:    command.Short,
+		Long:     command.Long,
+		Layers:   []LayerInfo{},
+	}
+	command.Layers.ForEach(func(slug string, layer layers.ParameterLayer) {
+		layerInfo := LayerInfo{
+			Slug:        slug,
+			Name:        layer.GetName(),
+			Description: layer.GetDescription(),
+			Prefix:      layer.GetPrefix(),
+			Parameters:  []ParameterInfo{},
+		}
+		for _, pd := range layer.GetParameterDefinitions().ToList() {
+			if cmds.IsBlockedRequestParameter(slug, pd.Name) {
+				continue
+			}
+			parameterInfo := ParameterInfo{
+				Name:       pd.Name,
+				Type:       string(pd.Type),
+				Help:       pd.Help,
+				Choices:    pd.Choices,
+				Required:   pd.Required,
+				IsArgument: pd.IsArgument,
+			}
+			if pd.Default != nil {
+				parameterInfo.Default = *pd.Default
+			}
+			layerInfo.Parameters = append(layerInfo.Parameters, parameterInfo)
+		}
+		ret.Layers = append(ret.Layers, layerInfo)
+	})
+	return ret
+}
+
+// parseParameters parses the parameters of a request through the layers of the command,
+// with the profile of the request or of the server.
+func (s *Server) parseParameters(
+	description *glazed_cmds.CommandDescription,
+	parameters Parameters,
+	profileFile string,
+	profile string,
+) (*layers.ParsedLayers, error) {
+	if profileFile == "" {
+		profileFile = s.profileFile
+	}
+	if profile == "" {
+		profile = s.profile
+	}
+
+	err := cmds.CheckRequestParameters(parameters)
+	if err != nil {
+		return nil, jsonrpc.ErrInvalidParams(err)
+	}
+	parsedLayers, err := cmds.ParseGeppettoRequestParameters(description, parameters, profileFile, profile)
+	if err != nil {
+		return nil, jsonrpc.ErrInvalidParams(err)
+	}
+	return parsedLayers, nil
+}
+
+// register makes a run cancellable under id, and returns the context of the run.
+func (s *Server) register(ctx context.Context, id string) (context.Context, func(), error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.cancels[id]; ok {
+		return nil, nil, jsonrpc.ErrInvalidParams(errors.Errorf("%s is already running", id))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancels[id] = cancel
+	return ctx, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		cancel()
+		delete(s.cancels, id)
+	}, nil
+}
+
+// notifyEvents returns a handler sending the events it receives as notifications for id.
+func notifyEvents(conn *jsonrpc.Conn, method string, id string) func(msg *message.Message) error {
+	return func(msg *message.Message) error {
+		err := conn.Notify(method, &EventParams{ID: id, Event: json.RawMessage(msg.Payload)})
+		if err != nil {
+			log.Warn().Err(err).Str("id", id).Msg("could not send event notification")
+		}
+		return nil
+	}
+}
+
+func (s *Server) runCommand(ctx context.Context, conn *jsonrpc.Conn, p *RunCommandParams) (*RunCommandResult, error) {
+	command, err := s.getCommand(p.Command)
+	if err != nil {
+		return nil, err
+	}
+	parsedLayers, err := s.parseParameters(command.Description(), p.Parameters, p.ProfileFile, p.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	id := p.ID
+	if id == "" {
+		id = uuid.NewString()
+	}
+	ctx, done, err := s.register(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if p.Stream {
+		ctx = cmds.WithEventHandler(ctx, "rpc", notifyEvents(conn, "commands/event", id))
+	}
+
+	log.Debug().Str("command", p.Command).Str("id", id).Msg("running command")
+	var b bytes.Buffer
+	err = command.RunIntoWriter(ctx, parsedLayers, &b)
+	if err != nil {
+		return nil, err
+	}
+	return &RunCommandResult{ID: id, Output: b.String()}, nil
+}
+
+func (s *Server) startChat(ctx context.Context, conn *jsonrpc.Conn, p *StartChatParams) (*ChatResult, error) {
+	session := &chatSession{
+		manager: conversations.NewBranchingManager(conversation.NewManager()),
+	}
+
+	if p.Command != "" {
+		command, err := s.getCommand(p.Command)
+		if err != nil {
+			return nil, err
+		}
+		parsedLayers, err := s.parseParameters(command.Description(), p.Parameters, p.ProfileFile, p.Profile)
+		if err != nil {
+			return nil, err
+		}
+		session.stepSettings = command.StepSettings.Clone()
+		err = session.stepSettings.UpdateFromParsedLayers(parsedLayers)
+		if err != nil {
+			return nil, err
+		}
+		session.name = command.Name
+
+		// the command is shared by all the requests, its system prompt is replaced on a copy
+		command_ := *command
+		if p.SystemPrompt != "" {
+			command_.SystemPrompt = p.SystemPrompt
+		}
+		if p.Conversation == "" {
+			err = command_.InitializeContextManager(session.manager, parsedLayers.GetDataMap())
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		stepSettings := settings.NewStepSettings()
+		geppettoLayers, err := cmds.CreateGeppettoLayers(stepSettings)
+		if err != nil {
+			return nil, err
+		}
+		description := glazed_cmds.NewCommandDescription("chat", glazed_cmds.WithLayersList(geppettoLayers...))
+		parsedLayers, err := s.parseParameters(description, p.Parameters, p.ProfileFile, p.Profile)
+		if err != nil {
+			return nil, err
+		}
+		err = stepSettings.UpdateFromParsedLayers(parsedLayers)
+		if err != nil {
+			return nil, err
+		}
+		session.stepSettings = stepSettings
+		session.name = "chat"
+
+		if p.SystemPrompt != "" && p.Conversation == "" {
+			session.manager.AppendMessages(conversation.NewChatMessage(conversation.RoleSystem, p.SystemPrompt))
+		}
+	}
+
+	if p.Conversation != "" {
+		if s.store == nil {
+			return nil, jsonrpc.ErrInvalidParams(errors.New("no conversation store to continue conversations from"))
+		}
+		stored, err := s.store.Load(p.Conversation)
+		if err != nil {
+			return nil, jsonrpc.ErrInvalidParams(err)
+		}
+		manager, err := stored.ToManager()
+		if err != nil {
+			return nil, err
+		}
+		session.manager = conversations.NewBranchingManager(manager)
+		session.name = stored.Name
+	}
+
+	chatID := session.manager.ConversationID.String()
+	s.mutex.Lock()
+	s.chats[chatID] = session
+	s.mutex.Unlock()
+
+	return s.answer(ctx, conn, chatID, session, p.Message)
+}
+
+// answer appends the user message to the chat and answers it. If message is empty, the chat
+// is answered only if it ends with a user message, for example the prompt of a command.
+func (s *Server) answer(
+	ctx context.Context,
+	conn *jsonrpc.Conn,
+	chatID string,
+	session *chatSession,
+	message_ string,
+) (*ChatResult, error) {
+	if !session.busy.TryLock() {
+		return nil, errors.Errorf("chat %s is already answering", chatID)
+	}
+	defer session.busy.Unlock()
+
+	ret := &ChatResult{ChatID: chatID}
+	var userMessage *conversation.Message
+	if message_ != "" {
+		userMessage = conversation.NewChatMessage(conversation.RoleUser, message_)
+		session.manager.AppendMessages(userMessage)
+	}
+	thread := session.manager.GetConversation()
+	if len(thread) == 0 {
+		return ret, nil
+	}
+	if content, ok := thread[len(thread)-1].Content.(*conversation.ChatMessageContent); !ok || content.Role != conversation.RoleUser {
+		return ret, nil
+	}
+
+	answer, err := s.complete(ctx, conn, chatID, session, thread)
+	if err != nil {
+		if userMessage != nil {
+			// the message can be sent again, without the failed attempt in the chat
+			_ = session.manager.Remove(userMessage.ID)
+		}
+		return nil, err
+	}
+	session.manager.AppendMessages(conversation.NewChatMessage(conversation.RoleAssistant, answer))
+	ret.Answer = answer
+
+	if s.store != nil {
+		err = s.store.Save(conversations.NewConversation(session.manager.ManagerImpl, session.name))
+		if err != nil {
+			log.Error().Err(err).Str("chat", chatID).Msg("Failed to save conversation")
+		}
+	}
+	return ret, nil
+}
+
+// complete runs the chat step on thread, sending its events as chat/event notifications.
+func (s *Server) complete(
+	ctx context.Context,
+	conn *jsonrpc.Conn,
+	chatID string,
+	session *chatSession,
+	thread conversation.Conversation,
+) (string, error) {
+	ctx, done, err := s.register(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	router, err := events.NewEventRouter()
+	if err != nil {
+		return "", err
+	}
+	// the handler is synchronous, so all the events have been sent once the step is done
+	router.AddHandler("rpc", "chat", notifyEvents(conn, "chat/event", chatID))
+
+	routerCtx, cancelRouter := context.WithCancel(ctx)
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		return router.Run(routerCtx)
+	})
+	defer func() {
+		cancelRouter()
+		_ = eg.Wait()
+		err := router.Close()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to close event router")
+		}
+	}()
+	select {
+	case <-router.Running():
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	step, err := s.newStep(session.stepSettings)
+	if err != nil {
+		return "", err
+	}
+	err = step.AddPublishedTopic(router.Publisher, "chat")
+	if err != nil {
+		return "", err
+	}
+
+	result, err := steps.Start[conversation.Conversation, string](ctx, step, thread)
+	if err != nil {
+		return "", err
+	}
+	answer := ""
+	for v := range result.GetChannel() {
+		s_, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		answer += s_
+	}
+	return answer, nil
+}
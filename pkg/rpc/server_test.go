@@ -0,0 +1,135 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/jsonrpc"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestServerChat(t *testing.T) {
+	// no pinocchio profiles
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	stepSettings := settings.NewStepSettings()
+	geppettoLayers, err := cmds.CreateGeppettoLayers(stepSettings)
+	require.NoError(t, err)
+	command, err := cmds.NewGeppettoCommand(
+		glazed_cmds.NewCommandDescription("greet",
+			glazed_cmds.WithShort("Greet someone"),
+			glazed_cmds.WithFlags(
+				parameters.NewParameterDefinition("name", parameters.ParameterTypeString, parameters.WithDefault("you")),
+			),
+			glazed_cmds.WithLayersList(geppettoLayers...),
+		),
+		stepSettings,
+		cmds.WithSystemPrompt("Be nice"),
+		cmds.WithPrompt("Hello {{ .name }}"),
+	)
+	require.NoError(t, err)
+
+	server := NewServer([]*cmds.GeppettoCommand{command},
+		WithStepFactory(func(stepSettings *settings.StepSettings) (chat.Step, error) {
+			step := chat.NewEchoStep()
+			step.TimePerCharacter = 0
+			return step, nil
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mutex := sync.Mutex{}
+	deltas := ""
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go func() {
+		_ = server.Serve(ctx, serverR, serverW)
+	}()
+	conn := jsonrpc.NewConn(clientR, clientW, func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		p := &EventParams{}
+		err := json.Unmarshal(params, p)
+		if err != nil {
+			return nil, err
+		}
+		e, err := chat.NewEventFromJson(p.Event)
+		if err != nil {
+			return nil, err
+		}
+		if partial, ok := e.ToPartialCompletion(); ok && e.Type == chat.EventTypePartial {
+			mutex.Lock()
+			deltas += partial.Delta
+			mutex.Unlock()
+		}
+		return nil, nil
+	})
+	go func() {
+		_ = conn.Run(ctx)
+	}()
+
+	listResult := &ListCommandsResult{}
+	err = conn.Call(ctx, "commands/list", nil, listResult)
+	require.NoError(t, err)
+	require.Len(t, listResult.Commands, 1)
+	assert.Equal(t, "greet", listResult.Commands[0].Name)
+	slugs := []string{}
+	for _, layer := range listResult.Commands[0].Layers {
+		slugs = append(slugs, layer.Slug)
+	}
+	assert.Contains(t, slugs, "default")
+	assert.Contains(t, slugs, cmds.GeppettoHelpersSlug)
+	for _, layer := range listResult.Commands[0].Layers {
+		if layer.Slug == cmds.GeppettoHelpersSlug {
+			// only the system prompt can be set by clients
+			require.Len(t, layer.Parameters, 1)
+			assert.Equal(t, "system", layer.Parameters[0].Name)
+		}
+	}
+
+	// the parameters accessing the files, processes and API keys of the server are rejected
+	for _, parameters_ := range []Parameters{
+		{cmds.GeppettoHelpersSlug: {"message-file": "/etc/passwd"}},
+		{cmds.GeppettoHelpersSlug: {"runs-dir": "/tmp"}},
+		{"mcp": {"mcp-servers": []string{"sh"}}},
+		{"openai-chat": {"openai-base-url": "http://example.com"}},
+	} {
+		var rpcErr *jsonrpc.Error
+		err = conn.Call(ctx, "chat/start", &StartChatParams{Command: "greet", Parameters: parameters_}, &ChatResult{})
+		require.ErrorAs(t, err, &rpcErr)
+		assert.Equal(t, jsonrpc.CodeInvalidParams, rpcErr.Code)
+		assert.Contains(t, rpcErr.Message, "can't be set by clients")
+	}
+
+	chatResult := &ChatResult{}
+	err = conn.Call(ctx, "chat/start", &StartChatParams{
+		Command:    "greet",
+		Parameters: Parameters{"default": {"name": "world"}},
+	}, chatResult)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", chatResult.Answer)
+	assert.NotEmpty(t, chatResult.ChatID)
+
+	err = conn.Call(ctx, "chat/continue", &ContinueChatParams{ChatID: chatResult.ChatID, Message: "again"}, chatResult)
+	require.NoError(t, err)
+	assert.Equal(t, "again", chatResult.Answer)
+
+	// the notifications are sent before the responses
+	mutex.Lock()
+	assert.Contains(t, deltas, "Hello world")
+	assert.Contains(t, deltas, "again")
+	mutex.Unlock()
+
+	err = conn.Call(ctx, "chat/continue", &ContinueChatParams{ChatID: "unknown", Message: "hi"}, chatResult)
+	var rpcErr *jsonrpc.Error
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, jsonrpc.CodeInvalidParams, rpcErr.Code)
+}
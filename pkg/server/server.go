@@ -0,0 +1,270 @@
+// Package server serves the geppetto commands over HTTP, returning their output as JSON or
+// streaming their chat events as Server-Sent Events.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// LayerInfo describes a parameter layer of a command, with the JSON schema of its parameters.
+type LayerInfo struct {
+	Slug        string             `json:"slug"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Schema      *jsonschema.Schema `json:"schema"`
+}
+
+type CommandInfo struct {
+	// Name is the path of the command, for example "code/go".
+	Name   string      `json:"name"`
+	Short  string      `json:"short,omitempty"`
+	Long   string      `json:"long,omitempty"`
+	Layers []LayerInfo `json:"layers"`
+}
+
+type ListCommandsResponse struct {
+	Commands []CommandInfo `json:"commands"`
+}
+
+// RunRequest is the body of POST /commands/<path>.
+type RunRequest struct {
+	// Parameters are the values of the parameters of the command, by layer slug and parameter name.
+	// The flags and arguments of the command are in the "default" layer.
+	Parameters map[string]map[string]interface{} `json:"parameters,omitempty"`
+	// Profile selects a profile of the profile file of the server.
+	Profile string `json:"profile,omitempty"`
+	// Stream returns the chat events as Server-Sent Events, as does an Accept: text/event-stream header.
+	Stream bool `json:"stream,omitempty"`
+}
+
+type RunResponse struct {
+	Output string `json:"output"`
+	// Error is only set in the done event of a stream, whose status was sent before the command failed.
+	Error string `json:"error,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server runs the geppetto commands for HTTP clients.
+type Server struct {
+	commands    []*cmds.GeppettoCommand
+	profileFile string
+	profile     string
+}
+
+type ServerOption func(*Server)
+
+// WithProfile selects the profile file, and the profile used when a request doesn't select one.
+func WithProfile(profileFile string, profile string) ServerOption {
+	return func(s *Server) {
+		s.profileFile = profileFile
+		s.profile = profile
+	}
+}
+
+func NewServer(commands []*cmds.GeppettoCommand, options ...ServerOption) *Server {
+	ret := &Server{
+		commands: commands,
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+// Handler serves GET /commands and POST /commands/<path>.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/commands", s.serveList)
+	mux.HandleFunc("/commands/", s.serveRun)
+	return mux
+}
+
+func getCommandPath(command *cmds.GeppettoCommand) string {
+	return strings.Join(append(append([]string{}, command.Parents...), command.Name), "/")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Debug().Err(err).Msg("could not write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &ErrorResponse{Error: err.Error()})
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	ret := &ListCommandsResponse{Commands: []CommandInfo{}}
+	for _, command := range s.commands {
+		commandInfo := CommandInfo{
+			Name:   getCommandPath(command),
+			Short:  command.Short,
+			Long:   command.Long,
+			Layers: []LayerInfo{},
+		}
+		command.Layers.ForEach(func(slug string, layer layers.ParameterLayer) {
+			pds := []*parameters.ParameterDefinition{}
+			for _, pd := range layer.GetParameterDefinitions().ToList() {
+				if !cmds.IsBlockedRequestParameter(slug, pd.Name) {
+					pds = append(pds, pd)
+				}
+			}
+			if len(pds) == 0 {
+				return
+			}
+			commandInfo.Layers = append(commandInfo.Layers, LayerInfo{
+				Slug:        slug,
+				Name:        layer.GetName(),
+				Description: layer.GetDescription(),
+				Schema:      helpers.ParameterDefinitionsToJsonSchema(pds),
+			})
+		})
+		ret.Commands = append(ret.Commands, commandInfo)
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func (s *Server) serveRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/commands/"), "/")
+	var command *cmds.GeppettoCommand
+	for _, c := range s.commands {
+		if getCommandPath(c) == path {
+			command = c
+			break
+		}
+	}
+	if command == nil {
+		writeError(w, http.StatusNotFound, errors.Errorf("unknown command %s", path))
+		return
+	}
+
+	request := &RunRequest{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid request"))
+			return
+		}
+	}
+	err := cmds.CheckRequestParameters(request.Parameters)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	profile := request.Profile
+	if profile == "" {
+		profile = s.profile
+	}
+	parsedLayers, err := cmds.ParseGeppettoRequestParameters(command.Description(), request.Parameters, s.profileFile, profile)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Debug().Str("command", path).Str("profile", profile).Msg("running command")
+
+	ctx := r.Context()
+	if !request.Stream && !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		var b bytes.Buffer
+		err = command.RunIntoWriter(ctx, parsedLayers, &b)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, &RunResponse{Output: b.String()})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sse := &sseWriter{w: w, flusher: flusher}
+	ctx = cmds.WithEventHandler(ctx, "http", sse.writeChatEvent)
+
+	var b bytes.Buffer
+	err = command.RunIntoWriter(ctx, parsedLayers, &b)
+	if err != nil {
+		sse.write("done", &RunResponse{Output: b.String(), Error: err.Error()})
+		return
+	}
+	sse.write("done", &RunResponse{Output: b.String()})
+}
+
+// sseWriter sends the chat events of a run, followed by a done event.
+type sseWriter struct {
+	mutex   sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseWriter) writeEvent(event string, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	if err != nil {
+		log.Debug().Err(err).Msg("SSE client disconnected")
+		return
+	}
+	s.flusher.Flush()
+}
+
+func (s *sseWriter) write(event string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not marshal SSE event")
+		return
+	}
+	s.writeEvent(event, b)
+}
+
+// writeChatEvent sends a chat event as published by the step, named after its type.
+func (s *sseWriter) writeChatEvent(msg *message.Message) error {
+	e := struct {
+		Type string `json:"type"`
+	}{}
+	err := json.Unmarshal(msg.Payload, &e)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not parse chat event")
+		return nil
+	}
+	s.writeEvent(e.Type, msg.Payload)
+	return nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/geppetto/pkg/cmds"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	glazed_cmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerValidation(t *testing.T) {
+	// no pinocchio profiles
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	stepSettings := settings.NewStepSettings()
+	geppettoLayers, err := cmds.CreateGeppettoLayers(stepSettings)
+	require.NoError(t, err)
+	command, err := cmds.NewGeppettoCommand(
+		glazed_cmds.NewCommandDescription("go",
+			glazed_cmds.WithParents("code"),
+			glazed_cmds.WithArguments(
+				parameters.NewParameterDefinition("query", parameters.ParameterTypeString, parameters.WithRequired(true)),
+			),
+			glazed_cmds.WithLayersList(geppettoLayers...),
+		),
+		stepSettings,
+		cmds.WithPrompt("{{ .query }}"),
+	)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(NewServer([]*cmds.GeppettoCommand{command}).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/commands")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	list := &ListCommandsResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(list))
+	require.Len(t, list.Commands, 1)
+	assert.Equal(t, "code/go", list.Commands[0].Name)
+	for _, layer := range list.Commands[0].Layers {
+		if layer.Slug == cmds.GeppettoHelpersSlug {
+			// only the system prompt can be set by clients
+			assert.Equal(t, 1, layer.Schema.Properties.Len())
+		}
+	}
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		err    string
+	}{
+		{"/commands/code/rust", `{}`, http.StatusNotFound, "unknown command"},
+		{"/commands/code/go", `{}`, http.StatusBadRequest, "missing required parameter query"},
+		{"/commands/code/go", `{"parameters": {"default": {"query": "hi", "foo": 1}}}`, http.StatusBadRequest, "unknown parameter foo"},
+		{"/commands/code/go", `{"parameters": {"geppetto-helpers": {"message-file": "/etc/passwd"}}}`, http.StatusBadRequest, "can't be set by clients"},
+		{"/commands/code/go", `{"parameters": {"openai-chat": {"openai-base-url": "http://example.com"}}}`, http.StatusBadRequest, "can't be set by clients"},
+		{"/commands/code/go", `{"parameters": {"default": {"query": 3}}}`, http.StatusBadRequest, "query"},
+	}
+	for _, test := range tests {
+		resp, err := http.Post(server.URL+test.path, "application/json", strings.NewReader(test.body))
+		require.NoError(t, err)
+		errResp := &ErrorResponse{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(errResp))
+		_ = resp.Body.Close()
+		assert.Equal(t, test.status, resp.StatusCode, test.body)
+		assert.Contains(t, errResp.Error, test.err, test.body)
+	}
+}
@@ -1,6 +1,7 @@
 package chat
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"io"
@@ -9,49 +10,131 @@ import (
 
 func StepPrinterFunc(name string, w io.Writer) func(msg *message.Message) error {
 	isFirst := true
+	atLineStart := true
+
+	write := func(s string) error {
+		if s == "" {
+			return nil
+		}
+		_, err := w.Write([]byte(s))
+		atLineStart = strings.HasSuffix(s, "\n")
+		return err
+	}
 
 	return func(msg *message.Message) error {
 		defer msg.Ack()
 
-		e, err := NewEventFromJson(msg.Payload)
+		e, err := DecodeEvent(msg.Payload)
+		if err != nil {
+			return err
+		}
 
-		switch e.Type {
+		switch e.GetEvent().Type {
 		case EventTypeError:
-			return err
+			if e.GetEvent().Error != nil {
+				return e.GetEvent().Error
+			}
+			return fmt.Errorf("unknown error")
 		case EventTypePartial:
-			p_, ok := e.ToPartialCompletion()
+			p_, ok := e.(*EventPartialCompletion)
 			if !ok {
 				return fmt.Errorf("Invalid payload type")
 			}
 			if isFirst && name != "" {
 				isFirst = false
-				_, err = w.Write([]byte(fmt.Sprintf("\n%s: \n", name)))
+				err = write(fmt.Sprintf("\n%s: \n", name))
 				if err != nil {
 					return err
 				}
 			}
-			_, err = w.Write([]byte(p_.Delta))
+			err = write(p_.Delta)
 			if err != nil {
 				return err
 			}
 		case EventTypeFinal:
-			p_, ok := e.ToText()
+			p_, ok := e.(*EventText)
+			if !ok {
+				return fmt.Errorf("Invalid payload type")
+			}
+			if p_.Text != "" && !strings.HasSuffix(p_.Text, "\n") {
+				err = write("\n")
+				if err != nil {
+					return err
+				}
+			}
+
+		case EventTypeToolCall:
+			p_, ok := e.(*EventToolCall)
 			if !ok {
 				return fmt.Errorf("Invalid payload type")
 			}
-			if !strings.HasSuffix(p_.Text, "\n") {
-				_, err = w.Write([]byte("\n"))
+			if !atLineStart {
+				err = write("\n")
 				if err != nil {
 					return err
 				}
 			}
+			err = write(FormatToolCall(p_.Name, p_.Arguments, p_.RawArguments) + "\n")
+			if err != nil {
+				return err
+			}
+
+		case EventTypeToolResult:
+			p_, ok := e.(*EventToolResult)
+			if !ok {
+				return fmt.Errorf("Invalid payload type")
+			}
+			if !atLineStart {
+				err = write("\n")
+				if err != nil {
+					return err
+				}
+			}
+			err = write(FormatToolResult(p_.Name, p_.Result, p_.ToolError) + "\n")
+			if err != nil {
+				return err
+			}
 
 		case EventTypeStart,
 			EventTypeStatus,
-			EventTypeInterrupt:
+			EventTypeInterrupt,
+			EventTypeToolCallDelta:
 
 		}
 
 		return nil
 	}
 }
+
+// FormatToolCall renders a tool call as name(arguments), for display to the user.
+func FormatToolCall(name string, arguments interface{}, rawArguments string) string {
+	args := rawArguments
+	if arguments != nil {
+		b, err := json.Marshal(arguments)
+		if err == nil {
+			args = string(b)
+		}
+	}
+	return fmt.Sprintf("→ %s(%s)", name, args)
+}
+
+// FormatToolResult renders the result or error of a tool call, for display to the user.
+func FormatToolResult(name string, result interface{}, toolError string) string {
+	if toolError != "" {
+		return fmt.Sprintf("← %s failed: %s", name, toolError)
+	}
+
+	var s string
+	switch v := result.(type) {
+	case string:
+		s = v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			s = fmt.Sprintf("%v", v)
+		} else {
+			s = string(b)
+		}
+	}
+	return fmt.Sprintf("← %s: %s", name, strings.TrimRight(s, "\n"))
+}
@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStepPrinterIgnoresExportMiddlewares(t *testing.T) {
+	router, err := events.NewEventRouter(events.WithExportMiddlewares(
+		append([]events.Middleware{events.DropEventTypes("partial")}, events.DefaultRedactionMiddlewares()...)...,
+	))
+	require.NoError(t, err)
+
+	printed := &bytes.Buffer{}
+	router.AddHandler("printer", "chat", StepPrinterFunc("", printed))
+	exported := []string{}
+	router.AddHandler("export", "chat", func(msg *message.Message) error {
+		defer msg.Ack()
+		exported = append(exported, string(msg.Payload))
+		return nil
+	}, events.AsExport())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- router.Run(ctx)
+	}()
+	<-router.Running()
+
+	publisherManager := events.NewPublisherManager()
+	publisherManager.SubscribePublisher("chat", router.Publisher)
+	require.NoError(t, publisherManager.Publish(&EventPartialCompletion{
+		Event:      Event{Type: EventTypePartial},
+		Delta:      "mail jane@example.com",
+		Completion: "mail jane@example.com",
+	}))
+	require.NoError(t, publisherManager.Publish(&EventText{
+		Event: Event{Type: EventTypeFinal},
+		Text:  "mail jane@example.com",
+	}))
+
+	cancel()
+	require.NoError(t, <-done)
+	require.NoError(t, router.Close())
+
+	// the printer gets the raw partials, while the exported events are dropped and redacted
+	assert.Contains(t, printed.String(), "mail jane@example.com")
+	require.Len(t, exported, 1)
+	assert.Contains(t, exported[0], `"type":"final"`)
+	assert.Contains(t, exported[0], events.Redacted)
+	assert.NotContains(t, exported[0], "jane@example.com")
+}
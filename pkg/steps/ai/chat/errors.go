@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	go_openai "github.com/sashabaranov/go-openai"
+	"net/http"
+)
+
+// EventError is the serializable form of the error of an error event.
+type EventError struct {
+	Message string `json:"message"`
+	// Type is the class of the error, either reported by the provider or the go type of the error.
+	Type string `json:"type,omitempty"`
+	// StatusCode is the HTTP status code returned by the provider, if any.
+	StatusCode int `json:"status_code,omitempty"`
+	// Retryable is true if the request can be retried as is, for example after a rate limit.
+	Retryable bool `json:"retryable,omitempty"`
+}
+
+var _ error = (*EventError)(nil)
+
+func (e *EventError) Error() string {
+	return e.Message
+}
+
+// Errors can provide the fields of their EventError by implementing these interfaces.
+type errorTyper interface {
+	ErrorType() string
+}
+
+type statusCoder interface {
+	StatusCode() int
+}
+
+type retryabler interface {
+	Retryable() bool
+}
+
+// NewEventError converts err to an EventError. Returns nil if err is nil.
+func NewEventError(err error) *EventError {
+	if err == nil {
+		return nil
+	}
+
+	var eventError *EventError
+	if errors.As(err, &eventError) {
+		ret := *eventError
+		ret.Message = err.Error()
+		return &ret
+	}
+
+	ret := &EventError{
+		Message: err.Error(),
+		Type:    fmt.Sprintf("%T", innermostError(err)),
+	}
+
+	var apiError *go_openai.APIError
+	var requestError *go_openai.RequestError
+	var typer errorTyper
+	var coder statusCoder
+	switch {
+	case errors.As(err, &typer):
+		ret.Type = typer.ErrorType()
+	case errors.As(err, &apiError):
+		if apiError.Type != "" {
+			ret.Type = apiError.Type
+		}
+		ret.StatusCode = apiError.HTTPStatusCode
+	case errors.As(err, &requestError):
+		ret.StatusCode = requestError.HTTPStatusCode
+	case errors.Is(err, context.Canceled):
+		ret.Type = "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		ret.Type = "deadline-exceeded"
+		ret.Retryable = true
+	}
+	if errors.As(err, &coder) {
+		ret.StatusCode = coder.StatusCode()
+	}
+
+	var r retryabler
+	if errors.As(err, &r) {
+		ret.Retryable = r.Retryable()
+	} else if ret.StatusCode == http.StatusTooManyRequests || ret.StatusCode >= http.StatusInternalServerError {
+		ret.Retryable = true
+	}
+
+	return ret
+}
+
+func innermostError(err error) error {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return err
+		}
+		err = next
+	}
+}
@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// TypedEvent is implemented by all the event payloads, which embed Event.
+type TypedEvent interface {
+	GetEvent() *Event
+}
+
+var (
+	eventTypesMutex sync.RWMutex
+	eventTypes      = map[EventType]func() TypedEvent{}
+)
+
+// RegisterEventType registers the payload type used to decode the events of type t.
+// Registering a type again replaces the previous payload type.
+func RegisterEventType[T any, PT interface {
+	*T
+	TypedEvent
+}](t EventType) {
+	eventTypesMutex.Lock()
+	defer eventTypesMutex.Unlock()
+	eventTypes[t] = func() TypedEvent {
+		return PT(new(T))
+	}
+}
+
+func init() {
+	RegisterEventType[Event](EventTypeStart)
+	RegisterEventType[EventText](EventTypeStatus)
+	RegisterEventType[EventPartialCompletion](EventTypePartial)
+	RegisterEventType[EventText](EventTypeFinal)
+	RegisterEventType[Event](EventTypeError)
+	RegisterEventType[EventText](EventTypeInterrupt)
+	RegisterEventType[EventToolCall](EventTypeToolCall)
+	RegisterEventType[EventToolCallDelta](EventTypeToolCallDelta)
+	RegisterEventType[EventToolResult](EventTypeToolResult)
+}
+
+// DecodeEvent decodes a serialized event into the payload type registered for its event type,
+// for example *EventText for final events. Events of unknown types are decoded as *Event.
+func DecodeEvent(b []byte) (TypedEvent, error) {
+	e, err := NewEventFromJson(b)
+	if err != nil {
+		return nil, err
+	}
+	if e.SchemaVersion > EventSchemaVersion {
+		return nil, errors.Errorf("unsupported event schema version %d", e.SchemaVersion)
+	}
+
+	eventTypesMutex.RLock()
+	newEvent, ok := eventTypes[e.Type]
+	eventTypesMutex.RUnlock()
+	if !ok {
+		return &e, nil
+	}
+
+	ret := newEvent()
+	err = json.Unmarshal(b, ret)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decode %s event", e.Type)
+	}
+	ret.GetEvent().payload = b
+
+	return ret, nil
+}
@@ -20,14 +20,37 @@ const (
 	EventTypeFinal     EventType = "final"
 	EventTypeError     EventType = "error"
 	EventTypeInterrupt EventType = "interrupt"
+
+	// EventTypeToolCall is published once the arguments of a tool call are complete.
+	EventTypeToolCall EventType = "tool-call"
+	// EventTypeToolCallDelta is published while the name and arguments of a tool call are streamed.
+	EventTypeToolCallDelta EventType = "tool-call-delta"
+	// EventTypeToolResult is published after a tool has been executed.
+	EventTypeToolResult EventType = "tool-result"
 )
 
+// EventSchemaVersion is the version of the JSON serialization of events, which is increased
+// on incompatible changes. Events published before the schema was versioned have no version.
+const EventSchemaVersion = 1
+
 type Event struct {
-	Type     EventType           `json:"type"`
-	Error    error               `json:"error,omitempty"`
-	Metadata EventMetadata       `json:"meta,omitempty"`
-	Step     *steps.StepMetadata `json:"step,omitempty"`
-	payload  []byte
+	Type EventType `json:"type"`
+	// SchemaVersion is set to EventSchemaVersion when the event is published.
+	SchemaVersion int                 `json:"schema_version,omitempty"`
+	Error         *EventError         `json:"error,omitempty"`
+	Metadata      EventMetadata       `json:"meta,omitempty"`
+	Step          *steps.StepMetadata `json:"step,omitempty"`
+	payload       []byte
+}
+
+// GetEvent returns the common fields of the event, and makes all the event payloads implement TypedEvent.
+func (e *Event) GetEvent() *Event {
+	return e
+}
+
+// SetSchemaVersion is called by events.PublisherManager before serializing the event.
+func (e *Event) SetSchemaVersion() {
+	e.SchemaVersion = EventSchemaVersion
 }
 
 type EventText struct {
@@ -46,11 +69,71 @@ type ToolCall struct {
 	Arguments string `json:"arguments"`
 }
 
+type EventToolCall struct {
+	Event
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments are the parsed JSON arguments of the call. RawArguments is only set when
+	// the arguments are not valid JSON.
+	Arguments    interface{} `json:"arguments"`
+	RawArguments string      `json:"raw_arguments,omitempty"`
+}
+
+// NewEventToolCall creates a tool call event, parsing the JSON arguments returned by the model.
+func NewEventToolCall(event Event, id string, name string, arguments string) *EventToolCall {
+	ret := &EventToolCall{
+		Event: event,
+		ID:    id,
+		Name:  name,
+	}
+	if arguments == "" {
+		return ret
+	}
+	err := json.Unmarshal([]byte(arguments), &ret.Arguments)
+	if err != nil {
+		ret.Arguments = nil
+		ret.RawArguments = arguments
+	}
+	return ret
+}
+
+type EventToolCallDelta struct {
+	Event
+	// Index is the position of the tool call in the response, IDs and names are only
+	// sent with the first delta of a call.
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	// Delta is the new fragment of the arguments, Arguments the arguments received so far.
+	Delta     string `json:"delta"`
+	Arguments string `json:"arguments"`
+}
+
+type EventToolResult struct {
+	Event
+	ID     string      `json:"id"`
+	Name   string      `json:"name"`
+	Result interface{} `json:"result,omitempty"`
+	// ToolError is the error returned by the tool, if any.
+	ToolError string `json:"tool_error,omitempty"`
+}
+
 // EventMetadata contains all the information that is passed along with watermill message,
 // specific to chat steps.
 type EventMetadata struct {
 	ID       conversation.NodeID `json:"message_id"`
 	ParentID conversation.NodeID `json:"parent_id"`
+	// ConversationID is the ID of the first message of the conversation the step was started with.
+	// Steps that don't know the conversation leave it empty.
+	ConversationID conversation.NodeID `json:"conversation_id,omitempty"`
+}
+
+// GetConversationID returns the ID of the first message of the conversation, used as EventMetadata.ConversationID.
+func GetConversationID(messages conversation.Conversation) conversation.NodeID {
+	if len(messages) == 0 {
+		return conversation.NullNode
+	}
+	return messages[0].ID
 }
 
 func NewEventFromJson(b []byte) (Event, error) {
@@ -91,6 +174,30 @@ func (e Event) ToPartialCompletion() (EventPartialCompletion, bool) {
 	return *ret, true
 }
 
+func (e Event) ToToolCall() (EventToolCall, bool) {
+	ret, ok := ToTypedEvent[EventToolCall](e)
+	if !ok || ret == nil {
+		return EventToolCall{}, false
+	}
+	return *ret, true
+}
+
+func (e Event) ToToolCallDelta() (EventToolCallDelta, bool) {
+	ret, ok := ToTypedEvent[EventToolCallDelta](e)
+	if !ok || ret == nil {
+		return EventToolCallDelta{}, false
+	}
+	return *ret, true
+}
+
+func (e Event) ToToolResult() (EventToolResult, bool) {
+	ret, ok := ToTypedEvent[EventToolResult](e)
+	if !ok || ret == nil {
+		return EventToolResult{}, false
+	}
+	return *ret, true
+}
+
 type StepOption func(Step) error
 
 func WithPublishedTopic(publisher message.Publisher, topic string) StepOption {
@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	go_openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestToolEventsRoundTrip(t *testing.T) {
+	e := NewEventToolCall(Event{Type: EventTypeToolCall}, "call-1", "get_weather", `{"city":"Paris"}`)
+	b, err := json.Marshal(e)
+	require.NoError(t, err)
+
+	decoded, err := NewEventFromJson(b)
+	require.NoError(t, err)
+	assert.Equal(t, EventTypeToolCall, decoded.Type)
+	toolCall, ok := decoded.ToToolCall()
+	require.True(t, ok)
+	assert.Equal(t, "call-1", toolCall.ID)
+	assert.Equal(t, map[string]interface{}{"city": "Paris"}, toolCall.Arguments)
+	assert.Empty(t, toolCall.RawArguments)
+
+	invalid := NewEventToolCall(Event{Type: EventTypeToolCall}, "call-2", "get_weather", `{"city":`)
+	assert.Nil(t, invalid.Arguments)
+	assert.Equal(t, `{"city":`, invalid.RawArguments)
+
+	b, err = json.Marshal(&EventToolResult{
+		Event:     Event{Type: EventTypeToolResult},
+		ID:        "call-1",
+		Name:      "get_weather",
+		ToolError: "no such city",
+	})
+	require.NoError(t, err)
+	decoded, err = NewEventFromJson(b)
+	require.NoError(t, err)
+	result, ok := decoded.ToToolResult()
+	require.True(t, ok)
+	assert.Equal(t, "no such city", result.ToolError)
+}
+
+func TestStepPrinterFuncRendersToolCalls(t *testing.T) {
+	var buf bytes.Buffer
+	printer := StepPrinterFunc("", &buf)
+
+	publish := func(v interface{}) {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		require.NoError(t, printer(message.NewMessage("id", b)))
+	}
+
+	publish(&EventPartialCompletion{Event: Event{Type: EventTypePartial}, Delta: "Let me check"})
+	publish(&EventToolCallDelta{Event: Event{Type: EventTypeToolCallDelta}, Name: "get_weather", Delta: `{"ci`})
+	publish(NewEventToolCall(Event{Type: EventTypeToolCall}, "call-1", "get_weather", `{"city":"Paris"}`))
+	publish(&EventToolResult{Event: Event{Type: EventTypeToolResult}, Name: "get_weather", Result: "sunny"})
+
+	assert.Equal(t, "Let me check\n→ get_weather({\"city\":\"Paris\"})\n← get_weather: sunny\n", buf.String())
+}
+
+func TestDecodeEventWithError(t *testing.T) {
+	apiError := &go_openai.APIError{
+		Type:           "rate_limit_exceeded",
+		Message:        "slow down",
+		HTTPStatusCode: 429,
+	}
+	e := &Event{
+		Type:  EventTypeError,
+		Error: NewEventError(errors.Wrap(apiError, "completion failed")),
+	}
+	e.SetSchemaVersion()
+	b, err := json.Marshal(e)
+	require.NoError(t, err)
+
+	decoded, err := DecodeEvent(b)
+	require.NoError(t, err)
+	require.IsType(t, &Event{}, decoded)
+	assert.Equal(t, EventSchemaVersion, decoded.GetEvent().SchemaVersion)
+	require.NotNil(t, decoded.GetEvent().Error)
+	assert.Equal(t, "completion failed: "+apiError.Error(), decoded.GetEvent().Error.Message)
+	assert.Equal(t, "rate_limit_exceeded", decoded.GetEvent().Error.Type)
+	assert.Equal(t, 429, decoded.GetEvent().Error.StatusCode)
+	assert.True(t, decoded.GetEvent().Error.Retryable)
+
+	b, err = json.Marshal(&EventText{Event: Event{Type: EventTypeFinal}, Text: "done"})
+	require.NoError(t, err)
+	decoded, err = DecodeEvent(b)
+	require.NoError(t, err)
+	text, ok := decoded.(*EventText)
+	require.True(t, ok)
+	assert.Equal(t, "done", text.Text)
+
+	_, err = DecodeEvent([]byte(`{"type":"final","schema_version":1000}`))
+	assert.Error(t, err)
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
-	"errors"
 	"io"
 	"net/http"
 )
@@ -107,12 +106,7 @@ func (c *Client) Complete(req *Request) (*SuccessfulResponse, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errorResp ErrorResponse
-		err = json.Unmarshal(respBody, &errorResp)
-		if err != nil {
-			return nil, err
-		}
-		return nil, errors.New(errorResp.Error.Message)
+		return nil, newResponseError(resp, respBody, req.Model)
 	}
 
 	var successResp SuccessfulResponse
@@ -152,16 +146,11 @@ func (c *Client) StreamComplete(req *Request) (<-chan Event, error) {
 		defer func(Body io.ReadCloser) {
 			_ = Body.Close()
 		}(resp.Body)
-		var errorResp ErrorResponse
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return nil, err
 		}
-		err = json.Unmarshal(body, &errorResp)
-		if err != nil {
-			return nil, err
-		}
-		return nil, errors.New(errorResp.Error.Message)
+		return nil, newResponseError(resp, body, req.Model)
 	}
 
 	events := make(chan Event)
@@ -0,0 +1,74 @@
+package claude
+
+import (
+	"encoding/json"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const providerName = "claude"
+
+var promptTooLongRegexp = regexp.MustCompile(`(\d+) tokens > (\d+) maximum`)
+
+// newResponseError classifies the error response of a request to the claude API for the given model.
+func newResponseError(resp *http.Response, body []byte, model string) error {
+	var ret error
+	var errorResp ErrorResponse
+	err := json.Unmarshal(body, &errorResp)
+	if err != nil || errorResp.Error.Message == "" {
+		message := strings.TrimSpace(string(body))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		ret = newDetailError(ErrorDetail{Message: message}, resp.StatusCode, model)
+	} else {
+		ret = newDetailError(errorResp.Error, resp.StatusCode, model)
+	}
+
+	if rateLimited, ok := ret.(*ai_errors.ErrRateLimited); ok {
+		rateLimited.RetryAfter = ai_errors.ParseRetryAfter(resp.Header.Get("retry-after"))
+	}
+	return ret
+}
+
+// newDetailError classifies an error reported by the claude API, either in an error response
+// or as an error event of a stream, in which case statusCode is 0.
+func newDetailError(detail ErrorDetail, statusCode int, model string) error {
+	providerError := ai_errors.ProviderError{
+		Provider:       providerName,
+		HTTPStatusCode: statusCode,
+		Type:           detail.Type,
+		Message:        detail.Message,
+	}
+
+	switch detail.Type {
+	case "invalid_request_error":
+		if m := promptTooLongRegexp.FindStringSubmatch(detail.Message); m != nil {
+			ret := &ai_errors.ErrContextLengthExceeded{ProviderError: providerError}
+			ret.RequestedTokens, _ = strconv.Atoi(m[1])
+			ret.MaxTokens, _ = strconv.Atoi(m[2])
+			return ret
+		}
+		if strings.Contains(detail.Message, "prompt is too long") {
+			return &ai_errors.ErrContextLengthExceeded{ProviderError: providerError}
+		}
+		return &providerError
+	case "authentication_error", "permission_error":
+		return &ai_errors.ErrAuth{ProviderError: providerError}
+	case "not_found_error":
+		return &ai_errors.ErrModelNotFound{ProviderError: providerError, Model: model}
+	case "rate_limit_error":
+		return &ai_errors.ErrRateLimited{ProviderError: providerError}
+	case "api_error", "overloaded_error":
+		return &ai_errors.ErrServerError{ProviderError: providerError}
+	default:
+		ret := ai_errors.FromStatusCode(providerError)
+		if modelNotFound, ok := ret.(*ai_errors.ErrModelNotFound); ok {
+			modelNotFound.Model = model
+		}
+		return ret
+	}
+}
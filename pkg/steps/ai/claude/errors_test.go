@@ -0,0 +1,80 @@
+package claude
+
+import (
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewDetailError(t *testing.T) {
+	tests := []struct {
+		detail     ErrorDetail
+		statusCode int
+		errorType  string
+		retryable  bool
+	}{
+		{ErrorDetail{Type: "invalid_request_error", Message: "max_tokens: must be positive"}, 400, "invalid_request_error", false},
+		{ErrorDetail{Type: "invalid_request_error", Message: "prompt is too long"}, 400, "context-length-exceeded", false},
+		{ErrorDetail{Type: "authentication_error", Message: "invalid x-api-key"}, 401, "auth", false},
+		{ErrorDetail{Type: "permission_error", Message: "not allowed"}, 403, "auth", false},
+		{ErrorDetail{Type: "not_found_error", Message: "model: claude-9"}, 404, "model-not-found", false},
+		{ErrorDetail{Type: "rate_limit_error", Message: "Number of requests has exceeded your rate limit"}, 429, "rate-limited", true},
+		{ErrorDetail{Type: "api_error", Message: "Internal server error"}, 500, "server-error", true},
+		// errors of a stream have no status code
+		{ErrorDetail{Type: "overloaded_error", Message: "Overloaded"}, 0, "server-error", true},
+		{ErrorDetail{Type: "unknown_error", Message: "Bad gateway"}, 502, "server-error", true},
+		{ErrorDetail{Type: "unknown_error", Message: "Not found"}, 404, "model-not-found", false},
+	}
+
+	for _, tt := range tests {
+		err := newDetailError(tt.detail, tt.statusCode, "claude-9")
+		eventError := chat.NewEventError(err)
+		assert.Equal(t, tt.errorType, eventError.Type, tt.detail.Message)
+		assert.Equal(t, tt.statusCode, eventError.StatusCode, tt.detail.Message)
+		assert.Equal(t, tt.retryable, ai_errors.IsRetryable(err), tt.detail.Message)
+
+		var modelNotFound *ai_errors.ErrModelNotFound
+		if errors.As(err, &modelNotFound) {
+			assert.Equal(t, "claude-9", modelNotFound.Model)
+		}
+	}
+
+	err := newDetailError(ErrorDetail{
+		Type:    "invalid_request_error",
+		Message: "prompt is too long: 250000 tokens > 200000 maximum",
+	}, 400, "claude-9")
+	var contextLength *ai_errors.ErrContextLengthExceeded
+	require.True(t, errors.As(err, &contextLength))
+	assert.Equal(t, 200000, contextLength.MaxTokens)
+	assert.Equal(t, 250000, contextLength.RequestedTokens)
+}
+
+func TestNewResponseError(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 429,
+		Header:     http.Header{"Retry-After": []string{"20"}},
+	}
+	err := newResponseError(resp, []byte(`{"type":"error","error":{"type":"rate_limit_error","message":"rate limited"}}`), "claude-9")
+	var rateLimited *ai_errors.ErrRateLimited
+	require.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, 20*time.Second, rateLimited.RetryAfter)
+	assert.Equal(t, "rate limited", rateLimited.Message)
+
+	// bodies that aren't error responses, for example from a proxy, are classified by status
+	resp = &http.Response{StatusCode: 502, Header: http.Header{}}
+	err = newResponseError(resp, []byte("<html>Bad Gateway</html>"), "claude-9")
+	var serverError *ai_errors.ErrServerError
+	require.True(t, errors.As(err, &serverError))
+	assert.Equal(t, "<html>Bad Gateway</html>", serverError.Message)
+
+	resp = &http.Response{StatusCode: 401, Header: http.Header{}}
+	err = newResponseError(resp, nil, "claude-9")
+	var auth *ai_errors.ErrAuth
+	require.True(t, errors.As(err, &auth))
+	assert.Equal(t, http.StatusText(401), auth.Message)
+}
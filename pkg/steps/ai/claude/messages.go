@@ -11,8 +11,6 @@ import (
 	"strconv"
 )
 
-// TODO(manuel, 2024-04-07) This is WIP code, most of it generated by an LLM. Do not use.
-
 // MessageRequest represents the Messages API request payload.
 type MessageRequest struct {
 	Model         string    `json:"model"`
@@ -122,6 +120,25 @@ type Usage struct {
 	OutputTokens int `json:"output_tokens"`
 }
 
+// StreamEvent is the data of an event of a streamed message.
+//
+// The usage is reported twice: message_start has the input tokens in its Message,
+// and message_delta has the total output tokens in its Usage.
+type StreamEvent struct {
+	Type    string           `json:"type"`
+	Message *MessageResponse `json:"message,omitempty"`
+	Delta   *StreamDelta     `json:"delta,omitempty"`
+	Usage   *Usage           `json:"usage,omitempty"`
+	Error   *ErrorDetail     `json:"error,omitempty"`
+}
+
+// StreamDelta is the delta of a content_block_delta or message_delta event.
+type StreamDelta struct {
+	Type       string `json:"type,omitempty"`
+	Text       string `json:"text,omitempty"`
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
 // SendMessage sends a message request and returns the response.
 func (c *Client) SendMessage(ctx context.Context, req *MessageRequest) (*MessageResponse, error) {
 	body, err := json.Marshal(req)
@@ -144,12 +161,8 @@ func (c *Client) SendMessage(ctx context.Context, req *MessageRequest) (*Message
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		var errorResp ErrorResponse
 		respBody, _ := io.ReadAll(resp.Body)
-		if unmarshalErr := json.Unmarshal(respBody, &errorResp); unmarshalErr != nil {
-			return nil, unmarshalErr
-		}
-		return nil, errors.New(errorResp.Error.Message)
+		return nil, newResponseError(resp, respBody, req.Model)
 	}
 
 	var messageResp MessageResponse
@@ -162,6 +175,7 @@ func (c *Client) SendMessage(ctx context.Context, req *MessageRequest) (*Message
 }
 
 // StreamMessage sends a message request and returns a channel of Events for streaming responses.
+// The channel is closed once the stream is done, or when ctx is cancelled.
 func (c *Client) StreamMessage(ctx context.Context, req *MessageRequest) (<-chan Event, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -183,12 +197,8 @@ func (c *Client) StreamMessage(ctx context.Context, req *MessageRequest) (<-chan
 		defer func(Body io.ReadCloser) {
 			_ = Body.Close()
 		}(resp.Body)
-		var errorResp ErrorResponse
 		respBody, _ := io.ReadAll(resp.Body)
-		if unmarshalErr := json.Unmarshal(respBody, &errorResp); unmarshalErr != nil {
-			return nil, unmarshalErr
-		}
-		return nil, errors.New(errorResp.Error.Message)
+		return nil, newResponseError(resp, respBody, req.Model)
 	}
 
 	events := make(chan Event)
@@ -196,23 +206,29 @@ func (c *Client) StreamMessage(ctx context.Context, req *MessageRequest) (<-chan
 		defer func(Body io.ReadCloser) {
 			_ = Body.Close()
 		}(resp.Body)
+		defer close(events)
+
 		reader := bufio.NewReader(resp.Body)
+		// the event name is sent on its own line, before the data of the event
+		name := ""
 		for {
 			line, err := reader.ReadBytes('\n')
 			if err != nil {
-				if err != io.EOF {
-					// Handle the error if needed
-					panic("Not implemented")
-				}
-				break
+				return
 			}
 
-			// Parse the line into an Event struct
 			var event Event
 			if parseErr := parseSSELine(line, &event); parseErr != nil {
-				// Handle the parse error if needed
 				continue
 			}
+			if event.Data == "" {
+				if event.Event != "" {
+					name = event.Event
+				}
+				continue
+			}
+			event.Event = name
+			name = ""
 
 			select {
 			case events <- event:
@@ -229,8 +245,8 @@ func (c *Client) StreamMessage(ctx context.Context, req *MessageRequest) (<-chan
 
 // parseSSELine parses a line from an SSE stream into an Event struct.
 func parseSSELine(line []byte, event *Event) error {
-	// Trim the potential trailing newline character
-	line = bytes.TrimSuffix(line, []byte("\n"))
+	// Trim the potential trailing newline characters
+	line = bytes.TrimRight(line, "\r\n")
 
 	// Split the line into "field: value" pairs
 	parts := bytes.SplitN(line, []byte(": "), 2)
@@ -10,7 +10,6 @@ import (
 	"github.com/go-go-golems/geppetto/pkg/steps"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"strings"
@@ -63,8 +62,9 @@ func (csf *Step) Start(
 	}
 
 	metadata := chat.EventMetadata{
-		ID:       conversation.NewNodeID(),
-		ParentID: parentID,
+		ID:             conversation.NewNodeID(),
+		ParentID:       parentID,
+		ConversationID: chat.GetConversationID(messages),
 	}
 
 	var cancel context.CancelFunc
@@ -96,6 +96,8 @@ func (csf *Step) Start(
 		return nil, errors.Errorf("no base URL for %s", apiType)
 	}
 
+	// the base URL used to include the path of the legacy completion API
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1/complete")
 	client := NewClient(apiKey, baseURL)
 
 	engine := ""
@@ -107,24 +109,10 @@ func (csf *Step) Start(
 		return nil, errors.New("no engine specified")
 	}
 
-	// Combine all the messages into a single prompt
-	prompt := ""
-	for _, msg := range messages {
-		switch content := msg.Content.(type) {
-		case *conversation.ChatMessageContent:
-			rolePrefix := "Human"
-			switch content.Role {
-			case conversation.RoleSystem:
-				rolePrefix = "System"
-			case conversation.RoleAssistant:
-				rolePrefix = "Assistant"
-			case conversation.RoleUser:
-				rolePrefix = "Human"
-			}
-			prompt += "\n\n" + rolePrefix + ": " + content.Text
-		}
+	system, messages_, err := makeMessages(messages)
+	if err != nil {
+		return nil, err
 	}
-	prompt += "\n\nAssistant: "
 
 	maxTokens := 32
 	if chatSettings.MaxResponseTokens != nil {
@@ -135,34 +123,25 @@ func (csf *Step) Start(
 	if chatSettings.Temperature != nil {
 		temperature = *chatSettings.Temperature
 	}
-	topP := 0.0
-	if chatSettings.TopP != nil {
-		topP = *chatSettings.TopP
-	}
 	stopSequences := []string{}
 	stopSequences = append(stopSequences, chatSettings.Stop...)
 
-	req := Request{
-		Model:             engine,
-		Prompt:            prompt,
-		MaxTokensToSample: maxTokens,
-		StopSequences:     stopSequences,
-		Temperature:       &temperature,
-		TopP:              &topP,
-		TopK:              nil,
-		Metadata:          nil,
-		Stream:            chatSettings.Stream,
+	req := MessageRequest{
+		Model:         engine,
+		Messages:      messages_,
+		MaxTokens:     maxTokens,
+		StopSequences: stopSequences,
+		Stream:        chatSettings.Stream,
+		System:        system,
+		Temperature:   &temperature,
+		TopP:          chatSettings.TopP,
+		TopK:          nil,
+		Metadata:      nil,
 	}
 
-	stepMetadata := &steps.StepMetadata{
-		StepID:     uuid.New(),
-		Type:       "claude-chat",
-		InputType:  "conversation.Conversation",
-		OutputType: "string",
-		Metadata: map[string]interface{}{
-			steps.MetadataSettingsSlug: csf.Settings.GetMetadata(),
-		},
-	}
+	stepMetadata := steps.NewStepMetadata(ctx, "claude-chat", "conversation.Conversation", "string", map[string]interface{}{
+		steps.MetadataSettingsSlug: csf.Settings.GetMetadata(),
+	})
 
 	csf.subscriptionManager.PublishBlind(&chat.Event{
 		Type:     chat.EventTypeStart,
@@ -171,9 +150,15 @@ func (csf *Step) Start(
 	})
 
 	if chatSettings.Stream {
-		events, err := client.StreamComplete(&req)
+		events, err := client.StreamMessage(ctx, &req)
 		if err != nil {
-			return steps.Reject[string](err), nil
+			csf.subscriptionManager.PublishBlind(&chat.Event{
+				Type:     chat.EventTypeError,
+				Error:    chat.NewEventError(err),
+				Metadata: metadata,
+				Step:     stepMetadata,
+			})
+			return steps.Reject[string](err, steps.WithMetadata[string](stepMetadata)), nil
 		}
 		c := make(chan helpers.Result[string])
 		ret := steps.NewStepResult[string](c,
@@ -184,8 +169,8 @@ func (csf *Step) Start(
 		go func() {
 			defer close(c)
 
-			isFirstEvent := true
 			message := ""
+			usage := steps.Usage{}
 			for {
 				select {
 				case <-ctx.Done():
@@ -200,6 +185,19 @@ func (csf *Step) Start(
 					c <- helpers.NewErrorResult[string](ctx.Err())
 					return
 				case event, ok := <-events:
+					// the events are also closed when ctx is cancelled
+					if !ok && ctx.Err() != nil {
+						csf.subscriptionManager.PublishBlind(&chat.EventText{
+							Event: chat.Event{
+								Type:     chat.EventTypeInterrupt,
+								Metadata: metadata,
+								Step:     ret.GetMetadata(),
+							},
+							Text: message,
+						})
+						c <- helpers.NewErrorResult[string](ctx.Err())
+						return
+					}
 					if !ok {
 						csf.subscriptionManager.PublishBlind(&chat.EventText{
 							Event: chat.Event{
@@ -212,24 +210,49 @@ func (csf *Step) Start(
 						c <- helpers.NewValueResult[string](message)
 						return
 					}
-					decoded := map[string]interface{}{}
+					decoded := StreamEvent{}
 					err = json.Unmarshal([]byte(event.Data), &decoded)
 					if err != nil {
 						csf.subscriptionManager.PublishBlind(&chat.Event{
 							Type:     chat.EventTypeError,
 							Metadata: metadata,
-							Error:    err,
+							Error:    chat.NewEventError(err),
 							Step:     ret.GetMetadata(),
 						})
 						c <- helpers.NewErrorResult[string](err)
 						return
 					}
-					if completion, exists := decoded["completion"].(string); exists {
-						if isFirstEvent {
-							completion = strings.TrimLeft(completion, " ")
-							isFirstEvent = false
+					if decoded.Error != nil {
+						err = newDetailError(*decoded.Error, 0, engine)
+						csf.subscriptionManager.PublishBlind(&chat.Event{
+							Type:     chat.EventTypeError,
+							Metadata: metadata,
+							Error:    chat.NewEventError(err),
+							Step:     ret.GetMetadata(),
+						})
+						c <- helpers.NewErrorResult[string](err)
+						return
+					}
+
+					switch decoded.Type {
+					case "message_start":
+						if decoded.Message != nil {
+							usage = getUsage(decoded.Message.Usage)
+							stepMetadata.Metadata[steps.MetadataUsageSlug] = usage
 						}
+					case "message_delta":
+						// the output tokens of message_delta are the total of the message
+						if decoded.Usage != nil {
+							usage.OutputTokens = decoded.Usage.OutputTokens
+							stepMetadata.Metadata[steps.MetadataUsageSlug] = usage
+						}
+					case "content_block_delta":
+						if decoded.Delta == nil || decoded.Delta.Text == "" {
+							continue
+						}
+						completion := decoded.Delta.Text
 						message += completion
+						steps.RecordPartial(ctx, completion)
 						csf.subscriptionManager.PublishBlind(&chat.EventPartialCompletion{
 							Event: chat.Event{
 								Type:     chat.EventTypePartial,
@@ -246,29 +269,84 @@ func (csf *Step) Start(
 
 		return ret, nil
 	} else {
-		resp, err := client.Complete(&req)
+		resp, err := client.SendMessage(ctx, &req)
 
 		if err != nil {
-			err = csf.subscriptionManager.Publish(&chat.Event{
-				Type:  chat.EventTypeError,
-				Error: err,
-				Step:  stepMetadata,
+			publishErr := csf.subscriptionManager.Publish(&chat.Event{
+				Type:     chat.EventTypeError,
+				Error:    chat.NewEventError(err),
+				Metadata: metadata,
+				Step:     stepMetadata,
 			})
-			if err != nil {
-				log.Warn().Err(err).Msg("error publishing error event")
+			if publishErr != nil {
+				log.Warn().Err(publishErr).Msg("error publishing error event")
 			}
 			return steps.Reject[string](err, steps.WithMetadata[string](stepMetadata)), nil
 		}
 
+		text := ""
+		for _, content := range resp.Content {
+			if content.Type == "text" && content.Text != nil {
+				text += *content.Text
+			}
+		}
+		stepMetadata.Metadata[steps.MetadataUsageSlug] = getUsage(resp.Usage)
+
 		csf.subscriptionManager.PublishBlind(&chat.EventText{
 			Event: chat.Event{
 				Type:     chat.EventTypeFinal,
 				Metadata: metadata,
 				Step:     stepMetadata,
 			},
-			Text: resp.Completion,
+			Text: text,
 		})
 
-		return steps.Resolve(resp.Completion, steps.WithMetadata[string](stepMetadata)), nil
+		return steps.Resolve(text, steps.WithMetadata[string](stepMetadata)), nil
+	}
+}
+
+// makeMessages converts the conversation to the system prompt and messages of the messages API.
+// The API expects alternating user and assistant messages, so consecutive messages of the same
+// role are merged.
+func makeMessages(messages conversation.Conversation) (string, []Message, error) {
+	systemPrompts := []string{}
+	roles := []string{}
+	texts := []string{}
+	for _, msg := range messages {
+		content, ok := msg.Content.(*conversation.ChatMessageContent)
+		if !ok {
+			continue
+		}
+		role := "user"
+		switch content.Role {
+		case conversation.RoleSystem:
+			systemPrompts = append(systemPrompts, content.Text)
+			continue
+		case conversation.RoleAssistant:
+			role = "assistant"
+		}
+		if len(roles) > 0 && roles[len(roles)-1] == role {
+			texts[len(texts)-1] += "\n\n" + content.Text
+			continue
+		}
+		roles = append(roles, role)
+		texts = append(texts, content.Text)
+	}
+
+	ret := []Message{}
+	for i, role := range roles {
+		b, err := json.Marshal(texts[i])
+		if err != nil {
+			return "", nil, err
+		}
+		ret = append(ret, Message{Role: role, Content: b})
+	}
+	return strings.Join(systemPrompts, "\n\n"), ret, nil
+}
+
+func getUsage(usage Usage) steps.Usage {
+	return steps.Usage{
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
 	}
 }
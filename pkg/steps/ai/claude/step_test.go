@@ -0,0 +1,88 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestStepSettings(server *httptest.Server, stream bool) *settings.StepSettings {
+	apiType := settings.ApiTypeClaude
+	engine := "claude-3-haiku-20240307"
+	stepSettings := settings.NewStepSettings()
+	stepSettings.Chat.ApiType = &apiType
+	stepSettings.Chat.Engine = &engine
+	stepSettings.Chat.Stream = stream
+	stepSettings.API.APIKeys[apiType+"-api-key"] = "key"
+	// configurations still have the URL of the legacy completion API
+	stepSettings.API.BaseUrls[apiType+"-base-url"] = server.URL + "/v1/complete"
+	return stepSettings
+}
+
+func TestStepUsage(t *testing.T) {
+	var req MessageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		req = MessageRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(MessageResponse{
+				Content: []Content{NewTextContent("Hello world")},
+				Usage:   Usage{InputTokens: 12, OutputTokens: 2},
+			})
+			return
+		}
+
+		// the input tokens are sent by message_start, the output tokens by message_delta
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`event: message_start`,
+			`data: {"type": "message_start", "message": {"role": "assistant", "content": [], "usage": {"input_tokens": 12, "output_tokens": 1}}}`,
+			`event: content_block_delta`,
+			`data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hello"}}`,
+			`event: content_block_delta`,
+			`data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": " world"}}`,
+			`event: message_delta`,
+			`data: {"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 2}}`,
+			`event: message_stop`,
+			`data: {"type": "message_stop"}`,
+		} {
+			_, _ = fmt.Fprintf(w, "%s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	input := conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleSystem, "Be brief"),
+		conversation.NewChatMessage(conversation.RoleUser, "Say hello"),
+		conversation.NewChatMessage(conversation.RoleUser, "to the world"),
+	}
+
+	for _, stream := range []bool{false, true} {
+		step := NewStep(newTestStepSettings(server, stream))
+		res, err := step.Start(context.Background(), input)
+		require.NoError(t, err)
+		results := res.Return()
+		require.Len(t, results, 1)
+		v, err := results[0].Value()
+		require.NoError(t, err)
+		assert.Equal(t, "Hello world", v)
+		assert.Equal(t, steps.Usage{InputTokens: 12, OutputTokens: 2}, res.GetMetadata().Metadata[steps.MetadataUsageSlug])
+
+		// the system prompt is sent apart, and the consecutive user messages are merged
+		assert.Equal(t, "Be brief", req.System)
+		require.Len(t, req.Messages, 1)
+		assert.Equal(t, "user", req.Messages[0].Role)
+		assert.JSONEq(t, `"Say hello\n\nto the world"`, string(req.Messages[0].Content))
+	}
+}
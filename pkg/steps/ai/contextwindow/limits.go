@@ -0,0 +1,45 @@
+package contextwindow
+
+import "strings"
+
+// contextLimits are the context windows of the known engines in tokens, by engine name prefix.
+// The longest matching prefix wins, so that for example gpt-4o isn't matched by gpt-4.
+var contextLimits = map[string]int{
+	"gpt-3.5-turbo":          16385,
+	"gpt-3.5-turbo-instruct": 4096,
+	"gpt-4":                  8192,
+	"gpt-4-32k":              32768,
+	"gpt-4-turbo":            128000,
+	"gpt-4-1106":             128000,
+	"gpt-4-0125":             128000,
+	"gpt-4o":                 128000,
+	"gpt-4.1":                1047576,
+	"o1":                     200000,
+	"o1-mini":                128000,
+	"o3":                     200000,
+	"o4-mini":                200000,
+	"claude-instant":         100000,
+	"claude-2":               100000,
+	"claude-2.1":             200000,
+	"claude-3":               200000,
+	"claude-sonnet":          200000,
+	"claude-opus":            200000,
+	"claude-haiku":           200000,
+	"mistral":                32768,
+	"mixtral":                32768,
+	"llama2":                 4096,
+	"llama3":                 8192,
+	"llama3.1":               131072,
+	"llama3.2":               131072,
+}
+
+// GetContextLimit returns the context window of engine in tokens, and false if the engine is unknown.
+func GetContextLimit(engine string) (int, bool) {
+	ret, longest := 0, -1
+	for prefix, limit := range contextLimits {
+		if strings.HasPrefix(engine, prefix) && len(prefix) > longest {
+			ret, longest = limit, len(prefix)
+		}
+	}
+	return ret, longest >= 0
+}
@@ -0,0 +1,69 @@
+package contextwindow
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+)
+
+const ContextWindowSlug = "context-window"
+
+// Strategy is the way a conversation that doesn't fit in the context window of the model is shortened.
+type Strategy string
+
+const (
+	// StrategyNone sends the conversation as is, leaving it to the provider to reject it.
+	StrategyNone Strategy = "none"
+	// StrategyDropOldest drops the oldest turns, keeping the system prompt and the last turn.
+	StrategyDropOldest Strategy = "drop-oldest"
+	// StrategySummarize replaces the oldest turns with a summary written by a (cheaper) model.
+	StrategySummarize Strategy = "summarize"
+	// StrategyTruncate truncates the messages larger than the maximum message size.
+	StrategyTruncate Strategy = "truncate"
+)
+
+type Settings struct {
+	Strategy Strategy `glazed.parameter:"context-strategy"`
+	// Limit overrides the context window of the engine, 0 uses the known limit of the engine.
+	Limit int `glazed.parameter:"context-limit"`
+	// SummaryEngine is the engine writing the summaries, empty to use the engine of the conversation.
+	SummaryEngine string `glazed.parameter:"context-summary-engine"`
+	// MaxMessageTokens is the size to which large messages are truncated, 0 for a quarter of the context window.
+	MaxMessageTokens int `glazed.parameter:"context-max-message-tokens"`
+}
+
+func NewParameterLayer(options ...layers.ParameterLayerOptions) (layers.ParameterLayer, error) {
+	options_ := append([]layers.ParameterLayerOptions{
+		layers.WithParameterDefinitions(
+			parameters.NewParameterDefinition(
+				"context-strategy",
+				parameters.ParameterTypeChoice,
+				parameters.WithHelp("How to shorten conversations that don't fit in the context window of the model"),
+				parameters.WithChoices(
+					string(StrategyNone),
+					string(StrategyDropOldest),
+					string(StrategySummarize),
+					string(StrategyTruncate),
+				),
+				parameters.WithDefault(string(StrategyNone)),
+			),
+			parameters.NewParameterDefinition(
+				"context-limit",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Context window of the model in tokens, 0 to use the known limit of the engine"),
+				parameters.WithDefault(0),
+			),
+			parameters.NewParameterDefinition(
+				"context-summary-engine",
+				parameters.ParameterTypeString,
+				parameters.WithHelp("Engine summarizing the oldest turns with the summarize strategy, defaults to the chat engine"),
+			),
+			parameters.NewParameterDefinition(
+				"context-max-message-tokens",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Size in tokens to which the truncate strategy truncates large messages, 0 for a quarter of the context window"),
+				parameters.WithDefault(0),
+			),
+		),
+	}, options...)
+	return layers.NewParameterLayer(ContextWindowSlug, "Context window management", options_...)
+}
@@ -0,0 +1,412 @@
+// Package contextwindow keeps conversations within the context window of the model, so that long
+// chats are shortened before they are sent instead of failing with a context length error.
+//
+// The Step wraps a chat step and counts the tokens of each message before every request. When the
+// conversation, plus the tokens reserved for the response, doesn't fit in the context window of the
+// engine, the configured strategy drops, summarizes or truncates messages, and the trimming is
+// recorded in the step metadata under MetadataTrimmingSlug.
+package contextwindow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/go-go-golems/geppetto/pkg/tokens"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"sync"
+)
+
+// MetadataTrimmingSlug is the StepMetadata.Metadata key under which the applied Trimming is recorded.
+const MetadataTrimmingSlug = "context-trimming"
+
+const summaryPrompt = `Summarize the following conversation concisely. Keep the facts, decisions, code and open questions needed to continue it.`
+
+const truncationMarker = "\n\n[... truncated]"
+
+// Trimming describes how a conversation was shortened to fit in the context window.
+type Trimming struct {
+	Strategy Strategy `json:"strategy"`
+	// Limit is the context window of the model, and Reserved the tokens reserved for the response.
+	Limit    int `json:"limit"`
+	Reserved int `json:"reserved"`
+	// ToolTokens are the tokens taken by the definitions of the offered tools.
+	ToolTokens int `json:"tool_tokens,omitempty"`
+	// InputTokens and OutputTokens are the sizes of the conversation before and after trimming.
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	DroppedMessages    int `json:"dropped_messages,omitempty"`
+	SummarizedMessages int `json:"summarized_messages,omitempty"`
+	TruncatedMessages  int `json:"truncated_messages,omitempty"`
+}
+
+type Option func(*Step)
+
+// WithSummarizer sets the step writing the summaries of the summarize strategy. It is started with a
+// system prompt and the transcript of the turns to summarize, and its events aren't published.
+// Without summarizer, the summarize strategy drops the oldest turns instead.
+func WithSummarizer(summarizer steps.Step[conversation.Conversation, string]) Option {
+	return func(s *Step) {
+		s.summarizer = summarizer
+	}
+}
+
+// WithTools sets the tools offered by the wrapped step. Their definitions are sent with every request,
+// and the tokens they take are subtracted from the context window.
+func WithTools(tools_ []tools.Tool) Option {
+	return func(s *Step) {
+		s.tools = tools_
+	}
+}
+
+// Step shortens the conversation before passing it to the wrapped chat step.
+type Step struct {
+	step         chat.Step
+	stepSettings *settings.StepSettings
+	settings     *Settings
+	summarizer   steps.Step[conversation.Conversation, string]
+	tools        []tools.Tool
+	summaries    *summaryCache
+}
+
+var _ chat.Step = (*Step)(nil)
+
+// NewStep wraps step, which answers with stepSettings. Its engine selects the context window and
+// tokenizer, and its max response tokens are reserved for the answer.
+func NewStep(step chat.Step, stepSettings *settings.StepSettings, settings_ *Settings, options ...Option) *Step {
+	ret := &Step{
+		step:         step,
+		stepSettings: stepSettings,
+		settings:     settings_,
+		summaries:    &summaryCache{},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (s *Step) AddPublishedTopic(publisher message.Publisher, topic string) error {
+	return s.step.AddPublishedTopic(publisher, topic)
+}
+
+func (s *Step) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
+	fitted, trimming, err := s.Fit(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.step.Start(ctx, fitted)
+	if err != nil || trimming == nil {
+		return res, err
+	}
+
+	// the metadata of the wrapped step is copied, as streaming steps keep publishing it
+	return steps.NewStepResult[string](res.GetChannel(),
+		steps.WithCancel[string](res.Cancel),
+		steps.WithMetadataFunc[string](func() *steps.StepMetadata {
+			ret := steps.StepMetadata{Type: "context-window"}
+			metadata := res.GetMetadata()
+			if metadata != nil {
+				ret = *metadata
+			}
+			ret.Metadata = map[string]interface{}{MetadataTrimmingSlug: trimming}
+			if metadata != nil {
+				for k, v := range metadata.Metadata {
+					ret.Metadata[k] = v
+				}
+			}
+			return &ret
+		}),
+	), nil
+}
+
+func (s *Step) getEngine() string {
+	if s.stepSettings.Chat != nil && s.stepSettings.Chat.Engine != nil {
+		return *s.stepSettings.Chat.Engine
+	}
+	return ""
+}
+
+// Fit returns the conversation shortened with the configured strategy, and the applied trimming,
+// which is nil if the conversation was returned as is. If the conversation doesn't fit even after
+// trimming, an ErrContextLengthExceeded is returned.
+func (s *Step) Fit(ctx context.Context, input conversation.Conversation) (conversation.Conversation, *Trimming, error) {
+	if s.settings.Strategy == StrategyNone || s.settings.Strategy == "" {
+		return input, nil, nil
+	}
+
+	engine := s.getEngine()
+	limit := s.settings.Limit
+	if limit == 0 {
+		var ok bool
+		limit, ok = GetContextLimit(engine)
+		if !ok {
+			log.Debug().Str("engine", engine).Msg("unknown context window, not trimming the conversation")
+			return input, nil, nil
+		}
+	}
+	reserved := 0
+	if s.stepSettings.Chat != nil && s.stepSettings.Chat.MaxResponseTokens != nil {
+		reserved = *s.stepSettings.Chat.MaxResponseTokens
+	}
+
+	counter, err := tokens.NewCounter(engine)
+	if err != nil {
+		return nil, nil, err
+	}
+	toolTokens := counter.CountTools(s.tools)
+	f := &fitter{
+		Counter: counter,
+		budget:  limit - reserved - toolTokens - counter.TokensPerReply,
+	}
+	inputTokens := f.count(input)
+	if inputTokens <= f.budget {
+		return input, nil, nil
+	}
+
+	trimming := &Trimming{
+		Strategy:    s.settings.Strategy,
+		Limit:       limit,
+		Reserved:    reserved,
+		ToolTokens:  toolTokens,
+		InputTokens: inputTokens,
+	}
+	output := input
+	switch s.settings.Strategy {
+	case StrategyDropOldest:
+	case StrategySummarize:
+		if s.summarizer == nil {
+			log.Warn().Msg("no summarizer, dropping the oldest turns instead")
+			break
+		}
+		output, trimming.SummarizedMessages, err = f.summarize(ctx, output, s.summarizer, s.summaries)
+		if err != nil {
+			return nil, nil, err
+		}
+	case StrategyTruncate:
+		maxMessageTokens := s.settings.MaxMessageTokens
+		if maxMessageTokens == 0 {
+			maxMessageTokens = f.budget / 4
+		}
+		output, trimming.TruncatedMessages = f.truncate(output, maxMessageTokens)
+	default:
+		return nil, nil, errors.Errorf("unknown context strategy %s", s.settings.Strategy)
+	}
+	// all strategies finally drop the oldest turns if the conversation still doesn't fit
+	output, trimming.DroppedMessages = f.dropOldest(output)
+
+	trimming.OutputTokens = f.count(output)
+	if trimming.OutputTokens > f.budget {
+		provider := ""
+		if s.stepSettings.Chat != nil && s.stepSettings.Chat.ApiType != nil {
+			provider = string(*s.stepSettings.Chat.ApiType)
+		}
+		return nil, nil, &ai_errors.ErrContextLengthExceeded{
+			ProviderError: ai_errors.ProviderError{
+				Provider: provider,
+				Message: fmt.Sprintf("the conversation needs %d tokens after trimming, %d for the tools, %d reserved for the response, "+
+					"and doesn't fit in the context window of %d tokens of %s", trimming.OutputTokens, toolTokens, reserved, limit, engine),
+			},
+			MaxTokens:       limit,
+			RequestedTokens: trimming.OutputTokens + toolTokens + reserved,
+		}
+	}
+
+	log.Debug().
+		Str("strategy", string(trimming.Strategy)).
+		Int("input_tokens", trimming.InputTokens).
+		Int("output_tokens", trimming.OutputTokens).
+		Int("dropped", trimming.DroppedMessages).
+		Int("summarized", trimming.SummarizedMessages).
+		Int("truncated", trimming.TruncatedMessages).
+		Msg("trimmed conversation to fit the context window")
+	return output, trimming, nil
+}
+
+type fitter struct {
+	*tokens.Counter
+	budget int
+}
+
+func (f *fitter) count(messages conversation.Conversation) int {
+	return f.CountMessages(messages)
+}
+
+func getRole(msg *conversation.Message) conversation.Role {
+	if content, ok := msg.Content.(*conversation.ChatMessageContent); ok {
+		return content.Role
+	}
+	return ""
+}
+
+// splitTurns splits the conversation into its leading system messages and its turns, each
+// starting with a user message.
+func splitTurns(messages conversation.Conversation) (conversation.Conversation, []conversation.Conversation) {
+	i := 0
+	for i < len(messages) && getRole(messages[i]) == conversation.RoleSystem {
+		i++
+	}
+	head := messages[:i]
+
+	turns := []conversation.Conversation{}
+	for _, msg := range messages[i:] {
+		if len(turns) == 0 || getRole(msg) == conversation.RoleUser {
+			turns = append(turns, conversation.Conversation{})
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], msg)
+	}
+	return head, turns
+}
+
+func join(head conversation.Conversation, turns []conversation.Conversation) conversation.Conversation {
+	ret := append(conversation.Conversation{}, head...)
+	for _, turn := range turns {
+		ret = append(ret, turn...)
+	}
+	return ret
+}
+
+// dropOldest drops the oldest turns until the conversation fits, keeping the system prompt and the last turn.
+func (f *fitter) dropOldest(messages conversation.Conversation) (conversation.Conversation, int) {
+	head, turns := splitTurns(messages)
+	total := f.count(messages)
+	dropped := 0
+	for total > f.budget && len(turns) > 1 {
+		total -= f.count(turns[0])
+		dropped += len(turns[0])
+		turns = turns[1:]
+	}
+	return join(head, turns), dropped
+}
+
+// summaryCache keeps the last summary, so that it is reused by the next turns of the conversation
+// instead of summarizing the same turns again before every request.
+type summaryCache struct {
+	mutex sync.Mutex
+	// hash is the hash of the first turns of the conversation, which summary summarizes.
+	hash    string
+	turns   int
+	summary string
+}
+
+// get returns the summary of the first turns of turns, and the number of summarized turns.
+func (c *summaryCache) get(turns []conversation.Conversation) (string, int, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.turns == 0 || c.turns >= len(turns) || hashTurns(turns[:c.turns]) != c.hash {
+		return "", 0, false
+	}
+	return c.summary, c.turns, true
+}
+
+func (c *summaryCache) set(turns []conversation.Conversation, summary string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.hash = hashTurns(turns)
+	c.turns = len(turns)
+	c.summary = summary
+}
+
+func hashTurns(turns []conversation.Conversation) string {
+	h := sha256.New()
+	for _, msg := range join(nil, turns) {
+		_, _ = fmt.Fprintf(h, "%s\x00%s\x00", getRole(msg), msg.Content.String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// summarize replaces the oldest turns with a summary appended to the system prompt. The most recent
+// turns that fit in three quarters of the budget are kept, leaving room for the summary.
+//
+// The summary in cache is reused as long as the turns following it fit, and is otherwise replaced.
+func (f *fitter) summarize(
+	ctx context.Context,
+	messages conversation.Conversation,
+	summarizer steps.Step[conversation.Conversation, string],
+	cache *summaryCache,
+) (conversation.Conversation, int, error) {
+	head, turns := splitTurns(messages)
+	if len(turns) < 2 {
+		return messages, 0, nil
+	}
+
+	if summary, n, ok := cache.get(turns); ok {
+		ret := withSummary(head, summary, turns[n:])
+		if f.count(ret) <= f.budget {
+			return ret, len(join(nil, turns[:n])), nil
+		}
+	}
+
+	kept := len(turns) - 1
+	total := f.count(head) + f.count(turns[kept])
+	for kept > 1 && total+f.count(turns[kept-1]) <= f.budget*3/4 {
+		kept--
+		total += f.count(turns[kept])
+	}
+	summarized := join(nil, turns[:kept])
+
+	transcript := strings.Builder{}
+	for _, msg := range summarized {
+		_, _ = fmt.Fprintf(&transcript, "%s: %s\n\n", getRole(msg), msg.Content.String())
+	}
+	res, err := steps.Start[conversation.Conversation, string](ctx, summarizer, conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleSystem, summaryPrompt),
+		conversation.NewChatMessage(conversation.RoleUser, transcript.String()),
+	})
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "could not summarize the conversation")
+	}
+	summary := ""
+	for r := range res.GetChannel() {
+		s, err := r.Value()
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "could not summarize the conversation")
+		}
+		summary += s
+	}
+	cache.set(turns[:kept], summary)
+
+	return withSummary(head, summary, turns[kept:]), len(summarized), nil
+}
+
+// withSummary appends the summary to the system prompt of head, followed by turns.
+func withSummary(head conversation.Conversation, summary string, turns []conversation.Conversation) conversation.Conversation {
+	// a single system prompt works with all providers
+	systemPrompt := "Summary of the earlier conversation:\n\n" + summary
+	if len(head) > 0 {
+		systemPrompt = head[len(head)-1].Content.String() + "\n\n" + systemPrompt
+		head = head[:len(head)-1]
+	}
+	head = append(append(conversation.Conversation{}, head...),
+		conversation.NewChatMessage(conversation.RoleSystem, systemPrompt))
+	return join(head, turns)
+}
+
+// truncate truncates the messages larger than maxMessageTokens.
+func (f *fitter) truncate(messages conversation.Conversation, maxMessageTokens int) (conversation.Conversation, int) {
+	ret := conversation.Conversation{}
+	truncated := 0
+	for _, msg := range messages {
+		text := f.Tokenizer.Truncate(msg.Content.String(), maxMessageTokens)
+		if text == msg.Content.String() {
+			ret = append(ret, msg)
+			continue
+		}
+
+		msg_ := *msg
+		msg_.Content = &conversation.ChatMessageContent{Role: getRole(msg), Text: text + truncationMarker}
+		ret = append(ret, &msg_)
+		truncated++
+	}
+	return ret, truncated
+}
@@ -0,0 +1,184 @@
+package contextwindow
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// recordingStep answers with a fixed text, recording the conversation it was started with.
+type recordingStep struct {
+	answer string
+	input  conversation.Conversation
+	calls  int
+}
+
+func (r *recordingStep) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
+	r.input = input
+	r.calls++
+	return steps.Resolve(r.answer), nil
+}
+
+func (r *recordingStep) AddPublishedTopic(publisher message.Publisher, topic string) error {
+	return nil
+}
+
+func getTexts(messages conversation.Conversation) []string {
+	ret := []string{}
+	for _, msg := range messages {
+		ret = append(ret, msg.Content.String())
+	}
+	return ret
+}
+
+func TestStepStrategies(t *testing.T) {
+	engine := "gpt-4"
+	maxResponseTokens := 100
+	stepSettings := settings.NewStepSettings()
+	stepSettings.Chat.Engine = &engine
+	stepSettings.Chat.MaxResponseTokens = &maxResponseTokens
+
+	// each old message has about 200 tokens, and the conversation about 830
+	long := strings.Repeat("word ", 200)
+	input := conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleSystem, "Be brief"),
+		conversation.NewChatMessage(conversation.RoleUser, "first "+long),
+		conversation.NewChatMessage(conversation.RoleAssistant, "first answer "+long),
+		conversation.NewChatMessage(conversation.RoleUser, "second "+long),
+		conversation.NewChatMessage(conversation.RoleAssistant, "second answer "+long),
+		conversation.NewChatMessage(conversation.RoleUser, "last question"),
+	}
+
+	getTrimming := func(t *testing.T, res steps.StepResult[string]) *Trimming {
+		metadata := res.GetMetadata()
+		require.NotNil(t, metadata)
+		trimming, ok := metadata.Metadata[MetadataTrimmingSlug].(*Trimming)
+		require.True(t, ok)
+		return trimming
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		step := &recordingStep{answer: "ok"}
+		res, err := NewStep(step, stepSettings, &Settings{Strategy: StrategyDropOldest}).Start(context.Background(), input)
+		require.NoError(t, err)
+		assert.Equal(t, input, step.input)
+		assert.Nil(t, res.GetMetadata())
+	})
+
+	t.Run("drop-oldest", func(t *testing.T) {
+		step := &recordingStep{answer: "ok"}
+		res, err := NewStep(step, stepSettings, &Settings{Strategy: StrategyDropOldest, Limit: 700}).
+			Start(context.Background(), input)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Be brief", "second " + long, "second answer " + long, "last question"}, getTexts(step.input))
+
+		trimming := getTrimming(t, res)
+		assert.Equal(t, 2, trimming.DroppedMessages)
+		assert.Equal(t, 100, trimming.Reserved)
+		assert.LessOrEqual(t, trimming.OutputTokens, 700-100)
+		assert.Greater(t, trimming.InputTokens, 700-100)
+	})
+
+	t.Run("summarize", func(t *testing.T) {
+		step := &recordingStep{answer: "ok"}
+		summarizer := &recordingStep{answer: "they talked"}
+		res, err := NewStep(step, stepSettings, &Settings{Strategy: StrategySummarize, Limit: 700}, WithSummarizer(summarizer)).
+			Start(context.Background(), input)
+		require.NoError(t, err)
+
+		assert.Contains(t, summarizer.input[1].Content.String(), "first answer")
+		texts := getTexts(step.input)
+		require.Len(t, texts, 4)
+		assert.Equal(t, "Be brief\n\nSummary of the earlier conversation:\n\nthey talked", texts[0])
+		assert.Equal(t, "last question", texts[3])
+		assert.Equal(t, 2, getTrimming(t, res).SummarizedMessages)
+	})
+
+	t.Run("summarize once", func(t *testing.T) {
+		step := &recordingStep{answer: "ok"}
+		summarizer := &recordingStep{answer: "they talked"}
+		contextStep := NewStep(step, stepSettings, &Settings{Strategy: StrategySummarize, Limit: 700}, WithSummarizer(summarizer))
+		_, err := contextStep.Start(context.Background(), input)
+		require.NoError(t, err)
+
+		// the next turn reuses the summary of the same first turns
+		next := append(append(conversation.Conversation{}, input...),
+			conversation.NewChatMessage(conversation.RoleAssistant, "ok"),
+			conversation.NewChatMessage(conversation.RoleUser, "next question"),
+		)
+		res, err := contextStep.Start(context.Background(), next)
+		require.NoError(t, err)
+		assert.Equal(t, 1, summarizer.calls)
+		texts := getTexts(step.input)
+		require.Len(t, texts, 6)
+		assert.Equal(t, "Be brief\n\nSummary of the earlier conversation:\n\nthey talked", texts[0])
+		assert.Equal(t, "next question", texts[5])
+		assert.Equal(t, 2, getTrimming(t, res).SummarizedMessages)
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		step := &recordingStep{answer: "ok"}
+		res, err := NewStep(step, stepSettings, &Settings{Strategy: StrategyTruncate, Limit: 800, MaxMessageTokens: 50}).
+			Start(context.Background(), input)
+		require.NoError(t, err)
+
+		require.Len(t, step.input, len(input))
+		assert.True(t, strings.HasSuffix(step.input[1].Content.String(), truncationMarker))
+		assert.Equal(t, "last question", step.input[5].Content.String())
+		trimming := getTrimming(t, res)
+		assert.Equal(t, 4, trimming.TruncatedMessages)
+		assert.Equal(t, 0, trimming.DroppedMessages)
+	})
+
+	t.Run("tools", func(t *testing.T) {
+		// the definition of the tool takes about 300 tokens of the context window
+		tool := &tools.ToolFunc{
+			Name:        "search",
+			Description: strings.Repeat("word ", 300),
+			Parameters:  json.RawMessage(`{"type": "object", "properties": {"query": {"type": "string"}}}`),
+		}
+		step := &recordingStep{answer: "ok"}
+		res, err := NewStep(step, stepSettings, &Settings{Strategy: StrategyDropOldest, Limit: 700},
+			WithTools([]tools.Tool{tool})).
+			Start(context.Background(), input)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Be brief", "last question"}, getTexts(step.input))
+		trimming := getTrimming(t, res)
+		assert.Equal(t, 4, trimming.DroppedMessages)
+		assert.Greater(t, trimming.ToolTokens, 300)
+		assert.LessOrEqual(t, trimming.OutputTokens+trimming.ToolTokens, 700-100)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		step := &recordingStep{answer: "ok"}
+		_, err := NewStep(step, stepSettings, &Settings{Strategy: StrategyDropOldest, Limit: 110}).
+			Start(context.Background(), input)
+		var contextErr *ai_errors.ErrContextLengthExceeded
+		require.True(t, errors.As(err, &contextErr))
+		assert.Equal(t, 110, contextErr.MaxTokens)
+		assert.Nil(t, step.input)
+	})
+}
+
+func TestGetContextLimit(t *testing.T) {
+	limit, ok := GetContextLimit("gpt-4o-mini")
+	assert.True(t, ok)
+	assert.Equal(t, 128000, limit)
+
+	limit, ok = GetContextLimit("gpt-4-0613")
+	assert.True(t, ok)
+	assert.Equal(t, 8192, limit)
+
+	_, ok = GetContextLimit("my-local-model")
+	assert.False(t, ok)
+}
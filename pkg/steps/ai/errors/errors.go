@@ -0,0 +1,143 @@
+// Package errors contains the classified errors returned by the provider steps, so that retry,
+// fallback and context trimming logic can act on the kind of failure instead of matching
+// error messages.
+//
+// All the errors embed ProviderError, and can be tested with errors.As:
+//
+//	var rateLimited *ai_errors.ErrRateLimited
+//	if errors.As(err, &rateLimited) {
+//		time.Sleep(rateLimited.RetryAfter)
+//	}
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ProviderError is an error returned by the API of a provider.
+type ProviderError struct {
+	// Provider is the api type of the provider, for example openai or claude.
+	Provider string
+	// HTTPStatusCode is the status code of the response, if any.
+	HTTPStatusCode int
+	// Type is the error type or code reported by the provider.
+	Type    string
+	Message string
+	// Err is the original error returned by the client library, if any.
+	Err error
+}
+
+func (e *ProviderError) Error() string {
+	if e.HTTPStatusCode != 0 {
+		return fmt.Sprintf("%s error (status %d): %s", e.Provider, e.HTTPStatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s error: %s", e.Provider, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorType returns the type reported by the provider. The classified errors return their own class.
+func (e *ProviderError) ErrorType() string {
+	return e.Type
+}
+
+func (e *ProviderError) StatusCode() int {
+	return e.HTTPStatusCode
+}
+
+// Retryable returns true if the request can be retried as is.
+func (e *ProviderError) Retryable() bool {
+	return false
+}
+
+// ErrRateLimited is returned when the request was rejected because of rate limits.
+type ErrRateLimited struct {
+	ProviderError
+	// RetryAfter is the delay after which the request can be retried, 0 if unknown.
+	RetryAfter time.Duration
+}
+
+func (e *ErrRateLimited) ErrorType() string { return "rate-limited" }
+func (e *ErrRateLimited) Retryable() bool   { return true }
+
+// ErrAuth is returned when the API key is missing, invalid or lacks permissions.
+type ErrAuth struct {
+	ProviderError
+}
+
+func (e *ErrAuth) ErrorType() string { return "auth" }
+
+// ErrContextLengthExceeded is returned when the prompt and the requested completion don't fit
+// in the context window of the model. The token counts are 0 if the provider didn't report them.
+type ErrContextLengthExceeded struct {
+	ProviderError
+	MaxTokens       int
+	RequestedTokens int
+}
+
+func (e *ErrContextLengthExceeded) ErrorType() string { return "context-length-exceeded" }
+
+// ErrContentFiltered is returned when the prompt or the completion was blocked by the content filter
+// of the provider.
+type ErrContentFiltered struct {
+	ProviderError
+}
+
+func (e *ErrContentFiltered) ErrorType() string { return "content-filtered" }
+
+// ErrModelNotFound is returned when the model doesn't exist or isn't accessible.
+type ErrModelNotFound struct {
+	ProviderError
+	Model string
+}
+
+func (e *ErrModelNotFound) ErrorType() string { return "model-not-found" }
+
+// ErrServerError is returned when the provider failed to handle the request, or is overloaded.
+type ErrServerError struct {
+	ProviderError
+}
+
+func (e *ErrServerError) ErrorType() string { return "server-error" }
+func (e *ErrServerError) Retryable() bool   { return true }
+
+// FromStatusCode classifies an error response by its HTTP status code alone,
+// for providers that don't report a more specific error type.
+// Returns a plain ProviderError for the status codes it doesn't know.
+func FromStatusCode(providerError ProviderError) error {
+	switch {
+	case providerError.HTTPStatusCode == http.StatusTooManyRequests:
+		return &ErrRateLimited{ProviderError: providerError}
+	case providerError.HTTPStatusCode == http.StatusUnauthorized,
+		providerError.HTTPStatusCode == http.StatusForbidden:
+		return &ErrAuth{ProviderError: providerError}
+	case providerError.HTTPStatusCode == http.StatusNotFound:
+		return &ErrModelNotFound{ProviderError: providerError}
+	case providerError.HTTPStatusCode >= http.StatusInternalServerError:
+		return &ErrServerError{ProviderError: providerError}
+	default:
+		return &providerError
+	}
+}
+
+// IsRetryable returns true if err is a classified error that can be retried as is.
+func IsRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	return errors.As(err, &r) && r.Retryable()
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, given in seconds.
+// Returns 0 if the header is empty or is an HTTP date.
+func ParseRetryAfter(value string) time.Duration {
+	var seconds float64
+	_, err := fmt.Sscanf(value, "%g", &seconds)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
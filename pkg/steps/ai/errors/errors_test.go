@@ -0,0 +1,106 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFromStatusCode(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		errorType  string
+		retryable  bool
+	}{
+		{statusCode: 429, errorType: "rate-limited", retryable: true},
+		{statusCode: 401, errorType: "auth"},
+		{statusCode: 403, errorType: "auth"},
+		{statusCode: 404, errorType: "model-not-found"},
+		{statusCode: 500, errorType: "server-error", retryable: true},
+		{statusCode: 503, errorType: "server-error", retryable: true},
+		{statusCode: 400, errorType: "invalid_request"},
+		{statusCode: 0, errorType: "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d", tt.statusCode), func(t *testing.T) {
+			err := FromStatusCode(ProviderError{
+				Provider:       "openai",
+				HTTPStatusCode: tt.statusCode,
+				Type:           "invalid_request",
+				Message:        "failed",
+			})
+			var typed interface{ ErrorType() string }
+			require.True(t, errors.As(err, &typed))
+			assert.Equal(t, tt.errorType, typed.ErrorType())
+			assert.Equal(t, tt.retryable, IsRetryable(err))
+		})
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	assert.Equal(t, "openai error (status 429): slow down", (&ErrRateLimited{
+		ProviderError: ProviderError{Provider: "openai", HTTPStatusCode: 429, Message: "slow down"},
+	}).Error())
+	assert.Equal(t, "claude error: overloaded", (&ErrServerError{
+		ProviderError: ProviderError{Provider: "claude", Message: "overloaded"},
+	}).Error())
+}
+
+func TestErrorsAs(t *testing.T) {
+	cause := io.ErrUnexpectedEOF
+	rateLimited := &ErrRateLimited{
+		ProviderError: ProviderError{Provider: "openai", HTTPStatusCode: 429, Err: cause},
+		RetryAfter:    2 * time.Second,
+	}
+	contextLength := &ErrContextLengthExceeded{
+		ProviderError:   ProviderError{Provider: "openai", HTTPStatusCode: 400, Type: "context_length_exceeded"},
+		MaxTokens:       8192,
+		RequestedTokens: 9000,
+	}
+
+	// the steps wrap the classified errors
+	err := fmt.Errorf("step failed: %w", rateLimited)
+	var rateLimited_ *ErrRateLimited
+	require.True(t, errors.As(err, &rateLimited_))
+	assert.Equal(t, 2*time.Second, rateLimited_.RetryAfter)
+	assert.True(t, IsRetryable(err))
+	assert.True(t, errors.Is(err, cause))
+	var contextLength_ *ErrContextLengthExceeded
+	assert.False(t, errors.As(err, &contextLength_))
+
+	err = fmt.Errorf("step failed: %w", contextLength)
+	require.True(t, errors.As(err, &contextLength_))
+	assert.Equal(t, 8192, contextLength_.MaxTokens)
+	assert.Equal(t, 9000, contextLength_.RequestedTokens)
+	assert.Equal(t, "context-length-exceeded", contextLength_.ErrorType())
+	assert.Equal(t, 400, contextLength_.StatusCode())
+	assert.False(t, IsRetryable(err))
+	assert.False(t, errors.As(err, &rateLimited_))
+
+	assert.False(t, IsRetryable(nil))
+	assert.False(t, IsRetryable(cause))
+	assert.False(t, IsRetryable(&ProviderError{Provider: "openai"}))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "0", expected: 0},
+		{value: "20", expected: 20 * time.Second},
+		{value: "1.5", expected: 1500 * time.Millisecond},
+		{value: "-1", expected: 0},
+		{value: "Wed, 21 Oct 2015 07:28:00 GMT", expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseRetryAfter(tt.value))
+		})
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
 	"github.com/go-go-golems/glazed/pkg/helpers/maps"
-	"github.com/google/uuid"
 	"github.com/jmorganca/ollama/api"
 )
 
@@ -50,18 +49,13 @@ func (ccs *ChatCompletionStep) Start(
 	}
 
 	metadata := chat.EventMetadata{
-		ID:       conversation.NewNodeID(),
-		ParentID: parentID,
-	}
-	stepMetadata := &steps.StepMetadata{
-		StepID:     uuid.New(),
-		Type:       "openai-chat",
-		InputType:  "conversation.Conversation",
-		OutputType: "string",
-		Metadata: map[string]interface{}{
-			steps.MetadataSettingsSlug: ccs.Settings.GetMetadata(),
-		},
+		ID:             conversation.NewNodeID(),
+		ParentID:       parentID,
+		ConversationID: chat.GetConversationID(messages),
 	}
+	stepMetadata := steps.NewStepMetadata(ctx, "openai-chat", "conversation.Conversation", "string", map[string]interface{}{
+		steps.MetadataSettingsSlug: ccs.Settings.GetMetadata(),
+	})
 
 	stream := ccs.Settings.Chat.Stream
 
@@ -93,9 +87,18 @@ func (ccs *ChatCompletionStep) Start(
 		message := ""
 
 		err := ccs.Client.Chat(cancellableCtx, req, func(resp api.ChatResponse) error {
-			// TODO(manuel, 2024-01-13) Handle metrics
+			delta := ""
+			if resp.Message != nil {
+				delta = resp.Message.Content
+			}
 
+			// the last response has the whole message when not streaming, and the token counts
 			if resp.Done {
+				message += delta
+				stepMetadata.Metadata[steps.MetadataUsageSlug] = steps.Usage{
+					InputTokens:  resp.PromptEvalCount,
+					OutputTokens: resp.EvalCount,
+				}
 				ccs.subscriptionManager.PublishBlind(&chat.EventText{
 					Event: chat.Event{
 						Type:     chat.EventTypeFinal,
@@ -104,11 +107,12 @@ func (ccs *ChatCompletionStep) Start(
 					},
 					Text: message,
 				})
-				c <- helpers.NewValueResult[string](resp.Message.Content)
+				c <- helpers.NewValueResult[string](message)
 				return nil
 			}
 
-			message += resp.Message.Content
+			message += delta
+			steps.RecordPartial(ctx, delta)
 
 			ccs.subscriptionManager.PublishBlind(&chat.EventPartialCompletion{
 				Event: chat.Event{
@@ -116,7 +120,7 @@ func (ccs *ChatCompletionStep) Start(
 					Metadata: metadata,
 					Step:     ret.GetMetadata(),
 				},
-				Delta:      resp.Message.Content,
+				Delta:      delta,
 				Completion: message,
 			})
 
@@ -124,10 +128,11 @@ func (ccs *ChatCompletionStep) Start(
 		})
 
 		if err != nil {
+			err = classifyError(err, *ccs.Settings.Chat.Engine)
 			ccs.subscriptionManager.PublishBlind(&chat.EventText{
 				Event: chat.Event{
 					Type:     chat.EventTypeError,
-					Error:    err,
+					Error:    chat.NewEventError(err),
 					Metadata: metadata,
 					Step:     ret.GetMetadata(),
 				},
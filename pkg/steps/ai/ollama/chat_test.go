@@ -0,0 +1,55 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/jmorganca/ollama/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChatCompletionStepUsage(t *testing.T) {
+	// the token counts are sent with the last response of the stream
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		encoder := json.NewEncoder(w)
+		for _, resp := range []api.ChatResponse{
+			{Message: &api.Message{Role: "assistant", Content: "Hello"}},
+			{Message: &api.Message{Role: "assistant", Content: " world"}},
+			{
+				Message: &api.Message{Role: "assistant"},
+				Done:    true,
+				Metrics: api.Metrics{PromptEvalCount: 12, EvalCount: 2},
+			},
+		} {
+			require.NoError(t, encoder.Encode(resp))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+	client, err := api.ClientFromEnvironment()
+	require.NoError(t, err)
+
+	engine := "llama3"
+	stepSettings := settings.NewStepSettings()
+	stepSettings.Chat.Engine = &engine
+	stepSettings.Chat.Stream = true
+	step := NewChatCompletionStep(client, stepSettings)
+
+	res, err := step.Start(context.Background(), conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleUser, "Say hello"),
+	})
+	require.NoError(t, err)
+	results := res.Return()
+	require.Len(t, results, 1)
+	v, err := results[0].Value()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", v)
+	assert.Equal(t, steps.Usage{InputTokens: 12, OutputTokens: 2}, res.GetMetadata().Metadata[steps.MetadataUsageSlug])
+}
@@ -0,0 +1,44 @@
+package ollama
+
+import (
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/jmorganca/ollama/api"
+	"github.com/pkg/errors"
+	"net/http"
+	"regexp"
+)
+
+var (
+	modelNotFoundRegexp = regexp.MustCompile(`(?i)model .* not found`)
+	contextLengthRegexp = regexp.MustCompile(`(?i)(exceeds|exceeded) .*context (length|window)`)
+)
+
+// classifyError maps the errors returned by the ollama client for the given model to the classified
+// errors of the ai errors package. Other errors, for example network errors, are returned as is.
+func classifyError(err error, model string) error {
+	var statusError api.StatusError
+	if !errors.As(err, &statusError) {
+		return err
+	}
+
+	message := statusError.ErrorMessage
+	if message == "" {
+		message = http.StatusText(statusError.StatusCode)
+	}
+	providerError := ai_errors.ProviderError{
+		Provider:       string(settings.ApiTypeOllama),
+		HTTPStatusCode: statusError.StatusCode,
+		Message:        message,
+		Err:            err,
+	}
+
+	switch {
+	case contextLengthRegexp.MatchString(message):
+		return &ai_errors.ErrContextLengthExceeded{ProviderError: providerError}
+	case statusError.StatusCode == http.StatusNotFound || modelNotFoundRegexp.MatchString(message):
+		return &ai_errors.ErrModelNotFound{ProviderError: providerError, Model: model}
+	default:
+		return ai_errors.FromStatusCode(providerError)
+	}
+}
@@ -0,0 +1,44 @@
+package ollama
+
+import (
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/jmorganca/ollama/api"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	err := classifyError(api.StatusError{
+		StatusCode:   404,
+		Status:       "404 Not Found",
+		ErrorMessage: "model 'llama3' not found, try pulling it first",
+	}, "llama3")
+	var modelNotFound *ai_errors.ErrModelNotFound
+	require.True(t, errors.As(err, &modelNotFound))
+	assert.Equal(t, "llama3", modelNotFound.Model)
+	assert.Equal(t, "ollama", modelNotFound.Provider)
+
+	err = classifyError(api.StatusError{
+		StatusCode:   400,
+		ErrorMessage: "the input length exceeds the context length",
+	}, "llama3")
+	var contextLength *ai_errors.ErrContextLengthExceeded
+	require.True(t, errors.As(err, &contextLength))
+	assert.False(t, ai_errors.IsRetryable(err))
+
+	err = classifyError(api.StatusError{StatusCode: 503}, "llama3")
+	var serverError *ai_errors.ErrServerError
+	require.True(t, errors.As(err, &serverError))
+
+	eventError := chat.NewEventError(err)
+	assert.Equal(t, "server-error", eventError.Type)
+	assert.Equal(t, 503, eventError.StatusCode)
+	assert.True(t, eventError.Retryable)
+
+	// network errors are returned as is
+	connectionError := errors.New("connection refused")
+	assert.Equal(t, connectionError, classifyError(connectionError, "llama3"))
+}
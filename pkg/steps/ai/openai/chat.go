@@ -9,8 +9,8 @@ import (
 	"github.com/go-go-golems/geppetto/pkg/steps"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	go_openai "github.com/sashabaranov/go-openai"
 	"io"
 )
 
@@ -85,18 +85,13 @@ func (csf *Step) Start(
 	}
 
 	metadata := chat.EventMetadata{
-		ID:       conversation.NewNodeID(),
-		ParentID: parentID,
-	}
-	stepMetadata := &steps.StepMetadata{
-		StepID:     uuid.New(),
-		Type:       "openai-chat",
-		InputType:  "conversation.Conversation",
-		OutputType: "string",
-		Metadata: map[string]interface{}{
-			steps.MetadataSettingsSlug: csf.Settings.GetMetadata(),
-		},
+		ID:             conversation.NewNodeID(),
+		ParentID:       parentID,
+		ConversationID: chat.GetConversationID(messages),
 	}
+	stepMetadata := steps.NewStepMetadata(ctx, "openai-chat", "conversation.Conversation", "string", map[string]interface{}{
+		steps.MetadataSettingsSlug: csf.Settings.GetMetadata(),
+	})
 
 	stream := csf.Settings.Chat.Stream
 
@@ -109,7 +104,14 @@ func (csf *Step) Start(
 	if stream {
 		stream, err := client.CreateChatCompletionStream(cancellableCtx, *req)
 		if err != nil {
-			return steps.Reject[string](err), nil
+			err = classifyError(err, csf.Settings)
+			csf.publisherManager.PublishBlind(&chat.Event{
+				Type:     chat.EventTypeError,
+				Error:    chat.NewEventError(err),
+				Metadata: metadata,
+				Step:     stepMetadata,
+			})
+			return steps.Reject[string](err, steps.WithMetadata[string](stepMetadata)), nil
 		}
 		c := make(chan helpers.Result[string])
 		ret := steps.NewStepResult[string](
@@ -173,9 +175,28 @@ func (csf *Step) Start(
 							return
 						}
 
+						err = classifyError(err, csf.Settings)
+						csf.publisherManager.PublishBlind(&chat.Event{
+							Type:     chat.EventTypeError,
+							Error:    chat.NewEventError(err),
+							Metadata: metadata,
+							Step:     ret.GetMetadata(),
+						})
+						c <- helpers.NewErrorResult[string](err)
+						return
+					}
+
+					if response.Usage != nil {
+						stepMetadata.Metadata[steps.MetadataUsageSlug] = getUsage(*response.Usage)
+					}
+					if len(response.Choices) == 0 {
+						continue
+					}
+					if response.Choices[0].FinishReason == go_openai.FinishReasonContentFilter {
+						err = newContentFilteredError(csf.Settings)
 						csf.publisherManager.PublishBlind(&chat.Event{
 							Type:     chat.EventTypeError,
-							Error:    err,
+							Error:    chat.NewEventError(err),
 							Metadata: metadata,
 							Step:     ret.GetMetadata(),
 						})
@@ -184,6 +205,7 @@ func (csf *Step) Start(
 					}
 
 					message += response.Choices[0].Delta.Content
+					steps.RecordPartial(ctx, response.Choices[0].Delta.Content)
 
 					csf.publisherManager.PublishBlind(&chat.EventPartialCompletion{
 						Event: chat.Event{
@@ -213,16 +235,21 @@ func (csf *Step) Start(
 			return steps.Reject[string](err, steps.WithMetadata[string](stepMetadata)), nil
 		}
 
+		if err == nil && len(resp.Choices) > 0 && resp.Choices[0].FinishReason == go_openai.FinishReasonContentFilter {
+			err = newContentFilteredError(csf.Settings)
+		}
 		if err != nil {
+			err = classifyError(err, csf.Settings)
 			csf.publisherManager.PublishBlind(&chat.Event{
 				Type:     chat.EventTypeError,
-				Error:    err,
+				Error:    chat.NewEventError(err),
 				Metadata: metadata,
 				Step:     stepMetadata,
 			})
 			return steps.Reject[string](err, steps.WithMetadata[string](stepMetadata)), nil
 		}
 
+		stepMetadata.Metadata[steps.MetadataUsageSlug] = getUsage(resp.Usage)
 		csf.publisherManager.PublishBlind(&chat.EventText{
 			Event: chat.Event{
 				Type:     chat.EventTypeFinal,
@@ -0,0 +1,55 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	go_openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStepStreamingUsage(t *testing.T) {
+	// the usage is sent in a last chunk without choices
+	req := go_openai.ChatCompletionRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []go_openai.ChatCompletionStreamResponse{
+			{Choices: []go_openai.ChatCompletionStreamChoice{{Delta: go_openai.ChatCompletionStreamChoiceDelta{Content: "Hello"}}}},
+			{Choices: []go_openai.ChatCompletionStreamChoice{{Delta: go_openai.ChatCompletionStreamChoiceDelta{Content: " world"}}}},
+			{Choices: []go_openai.ChatCompletionStreamChoice{}, Usage: &go_openai.Usage{PromptTokens: 12, CompletionTokens: 2}},
+		}
+		for _, chunk := range chunks {
+			b, err := json.Marshal(chunk)
+			require.NoError(t, err)
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", b)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	stepSettings := newTestStepSettings(server)
+	stepSettings.Chat.Stream = true
+	step, err := NewStep(stepSettings)
+	require.NoError(t, err)
+
+	res, err := step.Start(context.Background(), conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleUser, "Say hello"),
+	})
+	require.NoError(t, err)
+	results := res.Return()
+	require.Len(t, results, 1)
+	v, err := results[0].Value()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", v)
+
+	require.NotNil(t, req.StreamOptions)
+	assert.True(t, req.StreamOptions.IncludeUsage)
+	assert.Equal(t, steps.Usage{InputTokens: 12, OutputTokens: 2}, res.GetMetadata().Metadata[steps.MetadataUsageSlug])
+}
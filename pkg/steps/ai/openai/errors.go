@@ -0,0 +1,137 @@
+package openai
+
+import (
+	"fmt"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/pkg/errors"
+	go_openai "github.com/sashabaranov/go-openai"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	contextLengthRegexp = regexp.MustCompile(`maximum context length is (\d+) tokens.*?(\d+) tokens`)
+	retryAfterRegexp    = regexp.MustCompile(`(?i)try again in (\d+(?:\.\d+)?)(ms|s)`)
+)
+
+// classifyError maps the errors returned by the go-openai client to the classified errors
+// of the ai errors package. Other errors, for example network errors, are returned as is.
+func classifyError(err error, stepSettings *settings.StepSettings) error {
+	provider, model := getProviderAndModel(stepSettings)
+
+	var apiError *go_openai.APIError
+	var requestError *go_openai.RequestError
+
+	switch {
+	case errors.As(err, &apiError):
+		code := ""
+		if apiError.Code != nil {
+			code = fmt.Sprint(apiError.Code)
+		}
+		providerError := ai_errors.ProviderError{
+			Provider:       provider,
+			HTTPStatusCode: apiError.HTTPStatusCode,
+			Type:           apiError.Type,
+			Message:        apiError.Message,
+			Err:            err,
+		}
+		if code != "" {
+			providerError.Type = code
+		}
+
+		if m := contextLengthRegexp.FindStringSubmatch(apiError.Message); code == "context_length_exceeded" || m != nil {
+			ret := &ai_errors.ErrContextLengthExceeded{ProviderError: providerError}
+			if m != nil {
+				ret.MaxTokens, _ = strconv.Atoi(m[1])
+				ret.RequestedTokens, _ = strconv.Atoi(m[2])
+			}
+			return ret
+		}
+
+		switch {
+		case code == "content_filter" ||
+			(apiError.InnerError != nil && apiError.InnerError.Code == "ResponsibleAIPolicyViolation"):
+			return &ai_errors.ErrContentFiltered{ProviderError: providerError}
+		case code == "model_not_found":
+			return &ai_errors.ErrModelNotFound{ProviderError: providerError, Model: model}
+		case code == "invalid_api_key":
+			return &ai_errors.ErrAuth{ProviderError: providerError}
+		case code == "insufficient_quota":
+			// running out of credits is reported as a rate limit, but can't be retried
+			return &providerError
+		case apiError.HTTPStatusCode == http.StatusTooManyRequests:
+			return &ai_errors.ErrRateLimited{
+				ProviderError: providerError,
+				RetryAfter:    parseRetryAfterMessage(apiError.Message),
+			}
+		case apiError.HTTPStatusCode == http.StatusNotFound:
+			return &ai_errors.ErrModelNotFound{ProviderError: providerError, Model: model}
+		default:
+			return ai_errors.FromStatusCode(providerError)
+		}
+
+	case errors.As(err, &requestError):
+		message := http.StatusText(requestError.HTTPStatusCode)
+		if requestError.Err != nil {
+			message = requestError.Err.Error()
+		}
+		ret := ai_errors.FromStatusCode(ai_errors.ProviderError{
+			Provider:       provider,
+			HTTPStatusCode: requestError.HTTPStatusCode,
+			Message:        message,
+			Err:            err,
+		})
+		if modelNotFound, ok := ret.(*ai_errors.ErrModelNotFound); ok {
+			modelNotFound.Model = model
+		}
+		return ret
+
+	default:
+		return err
+	}
+}
+
+func getProviderAndModel(stepSettings *settings.StepSettings) (string, string) {
+	provider := string(settings.ApiTypeOpenAI)
+	model := ""
+	if stepSettings.Chat != nil {
+		if stepSettings.Chat.ApiType != nil {
+			provider = string(*stepSettings.Chat.ApiType)
+		}
+		if stepSettings.Chat.Engine != nil {
+			model = *stepSettings.Chat.Engine
+		}
+	}
+	return provider, model
+}
+
+// parseRetryAfterMessage extracts the delay from rate limit messages like "Please try again in 20s".
+func parseRetryAfterMessage(message string) time.Duration {
+	m := retryAfterRegexp.FindStringSubmatch(message)
+	if m == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	if m[2] == "ms" {
+		return time.Duration(v * float64(time.Millisecond))
+	}
+	return time.Duration(v * float64(time.Second))
+}
+
+// newContentFilteredError is returned when a completion was stopped by the content filter.
+func newContentFilteredError(stepSettings *settings.StepSettings) error {
+	provider, _ := getProviderAndModel(stepSettings)
+	return &ai_errors.ErrContentFiltered{
+		ProviderError: ai_errors.ProviderError{
+			Provider: provider,
+			Type:     string(go_openai.FinishReasonContentFilter),
+			Message:  "the completion was stopped by the content filter",
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package openai
+
+import (
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	ai_errors "github.com/go-go-golems/geppetto/pkg/steps/ai/errors"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/pkg/errors"
+	go_openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	engine := "gpt-4"
+	stepSettings := &settings.StepSettings{
+		Chat: &settings.ChatSettings{Engine: &engine},
+	}
+
+	err := classifyError(&go_openai.APIError{
+		Code:           "rate_limit_exceeded",
+		Message:        "Rate limit reached for gpt-4. Please try again in 1.5s.",
+		HTTPStatusCode: 429,
+	}, stepSettings)
+	var rateLimited *ai_errors.ErrRateLimited
+	require.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, 1500*time.Millisecond, rateLimited.RetryAfter)
+	assert.True(t, ai_errors.IsRetryable(err))
+
+	err = classifyError(&go_openai.APIError{
+		Code: "context_length_exceeded",
+		Message: "This model's maximum context length is 8192 tokens. " +
+			"However, your messages resulted in 9000 tokens. Please reduce the length of the messages.",
+		HTTPStatusCode: 400,
+	}, stepSettings)
+	var contextLength *ai_errors.ErrContextLengthExceeded
+	require.True(t, errors.As(err, &contextLength))
+	assert.Equal(t, 8192, contextLength.MaxTokens)
+	assert.Equal(t, 9000, contextLength.RequestedTokens)
+	assert.False(t, ai_errors.IsRetryable(err))
+
+	err = classifyError(&go_openai.APIError{
+		Code:           "model_not_found",
+		Message:        "The model `gpt-4` does not exist",
+		HTTPStatusCode: 404,
+	}, stepSettings)
+	var modelNotFound *ai_errors.ErrModelNotFound
+	require.True(t, errors.As(err, &modelNotFound))
+	assert.Equal(t, "gpt-4", modelNotFound.Model)
+
+	err = classifyError(&go_openai.RequestError{HTTPStatusCode: 502, Err: errors.New("bad gateway")}, stepSettings)
+	var serverError *ai_errors.ErrServerError
+	require.True(t, errors.As(err, &serverError))
+
+	eventError := chat.NewEventError(err)
+	assert.Equal(t, "server-error", eventError.Type)
+	assert.Equal(t, 502, eventError.StatusCode)
+	assert.True(t, eventError.Retryable)
+}
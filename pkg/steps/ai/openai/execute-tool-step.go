@@ -7,17 +7,17 @@ import (
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/go-go-golems/bobatea/pkg/conversation"
 	"github.com/go-go-golems/geppetto/pkg/events"
-	"github.com/go-go-golems/geppetto/pkg/helpers"
 	"github.com/go-go-golems/geppetto/pkg/steps"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
-	"github.com/google/uuid"
-	"github.com/invopop/jsonschema"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
 	"github.com/rs/zerolog/log"
-	openai2 "github.com/sashabaranov/go-openai"
+	go_openai "github.com/sashabaranov/go-openai"
 )
 
 type ExecuteToolStep struct {
+	// Tools maps tool names to either go functions or tools.Tool implementations
 	Tools               map[string]interface{}
+	reflector           *tools.Reflector
 	subscriptionManager *events.PublisherManager
 	messageID           conversation.NodeID
 	parentID            conversation.NodeID
@@ -34,6 +34,13 @@ func WithExecuteToolStepSubscriptionManager(subscriptionManager *events.Publishe
 	}
 }
 
+func WithExecuteToolStepReflector(reflector *tools.Reflector) ExecuteToolStepOption {
+	return func(step *ExecuteToolStep) error {
+		step.reflector = reflector
+		return nil
+	}
+}
+
 func WithExecuteToolStepParentID(parentID conversation.NodeID) ExecuteToolStepOption {
 	return func(step *ExecuteToolStep) error {
 		step.parentID = parentID
@@ -76,6 +83,8 @@ func (e *ExecuteToolStep) AddPublishedTopic(publisher message.Publisher, topic s
 
 const MetadataToolsSlug = "tools"
 
+// Start executes the tool calls of the completion, and returns their results by tool call ID.
+
 func (e *ExecuteToolStep) Start(
 	ctx context.Context,
 	input ToolCompletionResponse,
@@ -84,19 +93,11 @@ func (e *ExecuteToolStep) Start(
 
 	toolMetadata := map[string]interface{}{}
 	for name, tool := range e.Tools {
-		jsonSchema, err := helpers.GetFunctionParametersJsonSchema(&jsonschema.Reflector{}, tool)
+		tool_, err := getToolDefinition(e.reflector, name, tool)
 		if err != nil {
 			return steps.Reject[map[string]interface{}](err), nil
 		}
-		s, _ := json.MarshalIndent(jsonSchema, "", "  ")
-		toolMetadata[name] = openai2.Tool{
-			Type: "function",
-			Function: openai2.FunctionDefinition{
-				Name:        name,
-				Description: jsonSchema.Description,
-				Parameters:  json.RawMessage(s),
-			},
-		}
+		toolMetadata[name] = tool_
 	}
 
 	metadata := chat.EventMetadata{
@@ -104,15 +105,9 @@ func (e *ExecuteToolStep) Start(
 		ParentID: e.parentID,
 	}
 
-	stepMetadata := &steps.StepMetadata{
-		StepID:     uuid.New(),
-		Type:       "execute-tool-step",
-		InputType:  "ToolCompletionResponse",
-		OutputType: "map[string]interface{}",
-		Metadata: map[string]interface{}{
-			MetadataToolsSlug: toolMetadata,
-		},
-	}
+	stepMetadata := steps.NewStepMetadata(ctx, "execute-tool-step", "ToolCompletionResponse", "map[string]interface{}", map[string]interface{}{
+		MetadataToolsSlug: toolMetadata,
+	})
 
 	e.subscriptionManager.PublishBlind(&chat.Event{
 		Type:     chat.EventTypeStart,
@@ -128,7 +123,7 @@ func (e *ExecuteToolStep) Start(
 		if tool == nil {
 			e.subscriptionManager.PublishBlind(&chat.Event{
 				Type:     chat.EventTypeError,
-				Error:    fmt.Errorf("could not find tool %s", toolCall.Function.Name),
+				Error:    chat.NewEventError(fmt.Errorf("could not find tool %s", toolCall.Function.Name)),
 				Metadata: metadata,
 				Step:     stepMetadata,
 			})
@@ -138,26 +133,26 @@ func (e *ExecuteToolStep) Start(
 			), nil
 		}
 
-		var v interface{}
-		err := json.Unmarshal([]byte(toolCall.Function.Arguments), &v)
-		if err != nil {
-			e.subscriptionManager.PublishBlind(&chat.Event{
-				Type:     chat.EventTypeError,
-				Error:    fmt.Errorf("could not find tool %s", toolCall.Function.Name),
+		result, err := e.callTool(ctx, tool, toolCall)
+		toolResult := &chat.EventToolResult{
+			Event: chat.Event{
+				Type:     chat.EventTypeToolResult,
 				Metadata: metadata,
 				Step:     stepMetadata,
-			})
-			return steps.Reject[map[string]interface{}](
-				err,
-				steps.WithMetadata[map[string]interface{}](stepMetadata),
-			), nil
+			},
+			ID:     toolCall.ID,
+			Name:   toolCall.Function.Name,
+			Result: result,
 		}
+		if err != nil {
+			toolResult.ToolError = err.Error()
+		}
+		e.subscriptionManager.PublishBlind(toolResult)
 
-		vs_, err := helpers.CallFunctionFromJson(tool, v)
 		if err != nil {
 			e.subscriptionManager.PublishBlind(&chat.Event{
 				Type:     chat.EventTypeError,
-				Error:    fmt.Errorf("could not find tool %s", toolCall.Function.Name),
+				Error:    chat.NewEventError(err),
 				Metadata: metadata,
 				Step:     stepMetadata,
 			})
@@ -167,29 +162,43 @@ func (e *ExecuteToolStep) Start(
 			), nil
 		}
 
-		if len(vs_) == 1 {
-			res[toolCall.Function.Name] = vs_[0].Interface()
-		} else {
-			vals := []interface{}{}
-			for _, v_ := range vs_ {
-				vals = append(vals, v_.Interface())
-			}
-			res[toolCall.Function.Name] = vals
-		}
+		res[toolCall.ID] = result
 	}
 
-	r, _ := json.MarshalIndent(res, "", "  ")
-
+	// the results were published as tool-result events, the final event only closes the message
 	e.subscriptionManager.PublishBlind(&chat.EventText{
 		Event: chat.Event{
 			Type:     chat.EventTypeFinal,
 			Metadata: metadata,
 			Step:     stepMetadata,
 		},
-		Text: string(r),
 	})
 
 	return steps.Resolve(res,
 		steps.WithMetadata[map[string]interface{}](stepMetadata),
 	), nil
 }
+
+// callTool decodes the JSON arguments of the tool call and calls the tool, which is either
+// a tools.Tool or a go function.
+func (e *ExecuteToolStep) callTool(
+	ctx context.Context,
+	tool interface{},
+	toolCall go_openai.ToolCall,
+) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(toolCall.Function.Arguments), &v)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse arguments for tool %s: %w", toolCall.Function.Name, err)
+	}
+
+	tool_, err := tools.GetTool(e.reflector, toolCall.Function.Name, tool)
+	if err != nil {
+		return nil, err
+	}
+	args, ok := v.(map[string]interface{})
+	if !ok && v != nil {
+		return nil, fmt.Errorf("arguments for tool %s are not an object", toolCall.Function.Name)
+	}
+	return tool_.Call(ctx, args)
+}
@@ -0,0 +1,69 @@
+package openai
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	go_openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// recordingPublisher decodes the published events.
+type recordingPublisher struct {
+	events []chat.TypedEvent
+}
+
+func (r *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		e, err := chat.DecodeEvent(msg.Payload)
+		if err != nil {
+			return err
+		}
+		r.events = append(r.events, e)
+	}
+	return nil
+}
+
+func (r *recordingPublisher) Close() error {
+	return nil
+}
+
+func TestExecuteToolStep(t *testing.T) {
+	getWeather, err := tools.NewFunctionTool(nil, "getWeather", func(city string) string {
+		return "sunny in " + city
+	}, tools.WithParameterNames("city"))
+	require.NoError(t, err)
+	step, err := NewExecuteToolStep(map[string]interface{}{"getWeather": getWeather})
+	require.NoError(t, err)
+	publisher := &recordingPublisher{}
+	require.NoError(t, step.AddPublishedTopic(publisher, "chat"))
+
+	// the same tool called twice in one response
+	res, err := steps.Start[ToolCompletionResponse, map[string]interface{}](context.Background(), step, ToolCompletionResponse{
+		ToolCalls: []go_openai.ToolCall{
+			{ID: "call-1", Type: go_openai.ToolTypeFunction, Function: go_openai.FunctionCall{Name: "getWeather", Arguments: `{"city":"Paris"}`}},
+			{ID: "call-2", Type: go_openai.ToolTypeFunction, Function: go_openai.FunctionCall{Name: "getWeather", Arguments: `{"city":"Boston"}`}},
+		},
+	})
+	require.NoError(t, err)
+	results := res.Return()
+	require.Len(t, results, 1)
+	v, err := results[0].Value()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"call-1": "sunny in Paris", "call-2": "sunny in Boston"}, v)
+
+	types := []chat.EventType{}
+	for _, e := range publisher.events {
+		types = append(types, e.GetEvent().Type)
+	}
+	assert.Equal(t, []chat.EventType{
+		chat.EventTypeStart, chat.EventTypeToolResult, chat.EventTypeToolResult, chat.EventTypeFinal,
+	}, types)
+	final, ok := publisher.events[3].(*chat.EventText)
+	require.True(t, ok)
+	assert.Empty(t, final.Text)
+}
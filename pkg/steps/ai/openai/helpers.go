@@ -4,19 +4,23 @@ import (
 	"github.com/go-go-golems/bobatea/pkg/conversation"
 	"github.com/go-go-golems/geppetto/pkg/steps"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
 	"github.com/pkg/errors"
 	go_openai "github.com/sashabaranov/go-openai"
+	"sort"
 	"strings"
 )
 
-func GetToolCallDelta(toolCalls []go_openai.ToolCall) string {
-	msg := ""
-	for _, call := range toolCalls {
-		msg += call.Function.Name
-		msg += call.Function.Arguments
+// getToolDefinition returns the openai tool definition for a tool, which can be either a go function
+// (whose parameters schema gets reflected) or a tools.Tool.
+func getToolDefinition(reflector *tools.Reflector, name string, tool interface{}) (go_openai.Tool, error) {
+	tool_, err := tools.GetTool(reflector, name, tool)
+	if err != nil {
+		return go_openai.Tool{}, err
 	}
-
-	return msg
+	ret := tools.ToOpenAITool(tool_)
+	ret.Function.Name = name
+	return ret, nil
 }
 
 type ToolCallMerger struct {
@@ -45,10 +49,23 @@ func (tcm *ToolCallMerger) AddToolCalls(toolCalls []go_openai.ToolCall) {
 	}
 }
 
+// GetToolCall returns the tool call merged so far at the given index.
+func (tcm *ToolCallMerger) GetToolCall(index int) (go_openai.ToolCall, bool) {
+	ret, ok := tcm.toolCalls[index]
+	return ret, ok
+}
+
+// GetToolCalls returns the merged tool calls, ordered by index.
 func (tcm *ToolCallMerger) GetToolCalls() []go_openai.ToolCall {
+	indices := make([]int, 0, len(tcm.toolCalls))
+	for index := range tcm.toolCalls {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
 	var result []go_openai.ToolCall
-	for _, call := range tcm.toolCalls {
-		result = append(result, call)
+	for _, index := range indices {
+		result = append(result, tcm.toolCalls[index])
 	}
 
 	return result
@@ -135,9 +152,21 @@ func makeCompletionRequest(
 		// See https://github.com/go-go-golems/geppetto/issues/48
 		LogitBias: nil,
 	}
+	if stream {
+		// the usage is sent in a last chunk without choices
+		req.StreamOptions = &go_openai.StreamOptions{IncludeUsage: true}
+	}
 	return &req, nil
 }
 
+// getUsage converts the usage reported by the API to the usage reported in the step metadata.
+func getUsage(usage go_openai.Usage) steps.Usage {
+	return steps.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+}
+
 func makeClient(apiSettings *settings.APISettings, apiType settings.ApiType) (*go_openai.Client, error) {
 	apiKey, ok := apiSettings.APIKeys[apiType+"-api-key"]
 	if !ok {
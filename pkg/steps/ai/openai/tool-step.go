@@ -10,16 +10,21 @@ import (
 	"github.com/go-go-golems/geppetto/pkg/steps"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
-	"github.com/go-go-golems/geppetto/pkg/steps/utils"
-	"github.com/google/uuid"
-	"github.com/invopop/jsonschema"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/pkg/errors"
 	go_openai "github.com/sashabaranov/go-openai"
 )
 
+const DefaultMaxIterations = 10
+
+// ChatToolStep offers tools to the model through native function calling. It executes the tool calls
+// of each completion and sends their results back to the model, until it answers without calling tools.
+// The answer is the text of that last completion.
 type ChatToolStep struct {
-	reflector           *jsonschema.Reflector
+	reflector           *tools.Reflector
 	toolFunctions       map[string]interface{}
 	tools               []go_openai.Tool
+	maxIterations       int
 	stepSettings        *settings.StepSettings
 	subscriptionManager *events.PublisherManager
 }
@@ -28,7 +33,7 @@ var _ chat.Step = &ChatToolStep{}
 
 type ChatToolStepOption func(step *ChatToolStep)
 
-func WithReflector(reflector *jsonschema.Reflector) ChatToolStepOption {
+func WithReflector(reflector *tools.Reflector) ChatToolStepOption {
 	return func(step *ChatToolStep) {
 		step.reflector = reflector
 	}
@@ -40,33 +45,37 @@ func WithToolFunctions(toolFunctions map[string]interface{}) ChatToolStepOption
 	}
 }
 
+// WithMaxIterations sets the maximum number of completions before the step gives up on
+// getting an answer without tool calls.
+func WithMaxIterations(maxIterations int) ChatToolStepOption {
+	return func(step *ChatToolStep) {
+		step.maxIterations = maxIterations
+	}
+}
+
 func NewChatToolStep(stepSettings *settings.StepSettings, options ...ChatToolStepOption) (*ChatToolStep, error) {
 	step := &ChatToolStep{
 		stepSettings:        stepSettings,
+		maxIterations:       DefaultMaxIterations,
 		subscriptionManager: events.NewPublisherManager(),
 	}
 	for _, option := range options {
 		option(step)
 	}
+	if step.maxIterations < 1 {
+		return nil, errors.Errorf("invalid max iterations %d", step.maxIterations)
+	}
 
 	if step.reflector == nil {
-		step.reflector = &jsonschema.Reflector{}
+		step.reflector = tools.NewReflector()
 	}
 
 	for name, tool := range step.toolFunctions {
-		jsonSchema, err := helpers.GetFunctionParametersJsonSchema(step.reflector, tool)
+		tool_, err := getToolDefinition(step.reflector, name, tool)
 		if err != nil {
 			return nil, err
 		}
-		s, _ := json.MarshalIndent(jsonSchema, "", "  ")
-		step.tools = append(step.tools, go_openai.Tool{
-			Type: "function",
-			Function: go_openai.FunctionDefinition{
-				Name:        name,
-				Description: jsonSchema.Description,
-				Parameters:  json.RawMessage(s),
-			},
-		})
+		step.tools = append(step.tools, tool_)
 	}
 
 	return step, nil
@@ -74,85 +83,150 @@ func NewChatToolStep(stepSettings *settings.StepSettings, options ...ChatToolSte
 
 func (t *ChatToolStep) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
 	cancellableCtx, cancel := context.WithCancel(ctx)
+
+	// the tool completions and executions are nested steps of this step
+	stepMetadata := steps.NewStepMetadata(ctx, "chat-tool-step", "conversation.Conversation", "string", map[string]interface{}{
+		steps.MetadataSettingsSlug: t.stepSettings.GetMetadata(),
+	})
+
+	c := make(chan helpers.Result[string])
+	ret := steps.NewStepResult[string](
+		c,
+		steps.WithCancel[string](cancel),
+		steps.WithMetadata[string](stepMetadata),
+	)
+
 	go func() {
-		<-ctx.Done()
-		cancel()
+		defer close(c)
+		defer cancel()
+
+		// the usage of all the completions is reported as the usage of this step
+		usage := &steps.Usage{}
+		answer, err := t.run(steps.WithParentStep(cancellableCtx, stepMetadata), input, usage)
+		stepMetadata.Metadata[steps.MetadataUsageSlug] = *usage
+		if err != nil {
+			c <- helpers.NewErrorResult[string](err)
+			return
+		}
+		c <- helpers.NewValueResult[string](answer)
 	}()
 
-	var parentMessage *conversation.Message
-	parentID := conversation.NullNode
-	toolCompletionMessageID := conversation.NewNodeID()
-	toolResultMessageID := conversation.NewNodeID()
+	return ret, nil
+}
 
-	if len(input) > 0 {
-		parentMessage = input[len(input)-1]
-		parentID = parentMessage.ID
-	}
+// run completes the conversation, and appends the tool calls of the model and their results
+// as assistant and tool messages, until the model answers without calling tools.
+// The usage reported by the completions is added to usage.
+func (t *ChatToolStep) run(ctx context.Context, messages conversation.Conversation, usage *steps.Usage) (string, error) {
+	for i := 0; i < t.maxIterations; i++ {
+		parentID := conversation.NullNode
+		if len(messages) > 0 {
+			parentID = messages[len(messages)-1].ID
+		}
+		completionMessageID := conversation.NewNodeID()
+
+		toolStep, err := NewToolStep(
+			t.stepSettings, t.tools,
+			WithToolStepParentID(parentID),
+			WithToolStepMessageID(completionMessageID),
+			WithToolStepSubscriptionManager(t.subscriptionManager),
+		)
+		if err != nil {
+			return "", err
+		}
+		response, completionMetadata, err := getLastValue[[]*conversation.Message, ToolCompletionResponse](ctx, toolStep, messages)
+		if completionMetadata != nil {
+			if usage_, ok := completionMetadata.Metadata[steps.MetadataUsageSlug].(steps.Usage); ok {
+				usage.InputTokens += usage_.InputTokens
+				usage.OutputTokens += usage_.OutputTokens
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(response.ToolCalls) == 0 {
+			return response.Content, nil
+		}
 
-	toolStep, err := NewToolStep(
-		t.stepSettings, t.tools,
-		WithToolStepParentID(parentID),
-		WithToolStepMessageID(toolCompletionMessageID),
-		WithToolStepSubscriptionManager(t.subscriptionManager),
-	)
-	if err != nil {
-		return nil, err
+		messages = append(messages, conversation.NewChatMessage(
+			conversation.RoleAssistant, response.Content,
+			conversation.WithID(completionMessageID),
+			conversation.WithParentID(parentID),
+			conversation.WithMetadata(map[string]interface{}{"tool_calls": response.ToolCalls}),
+		))
+
+		resultMessageID := conversation.NewNodeID()
+		executeToolStep, err := NewExecuteToolStep(t.toolFunctions,
+			WithExecuteToolStepReflector(t.reflector),
+			WithExecuteToolStepSubscriptionManager(t.subscriptionManager),
+			WithExecuteToolStepParentID(completionMessageID),
+			WithExecuteToolStepMessageID(resultMessageID),
+		)
+		if err != nil {
+			return "", err
+		}
+		results, _, err := getLastValue[ToolCompletionResponse, map[string]interface{}](ctx, executeToolStep, response)
+		if err != nil {
+			return "", err
+		}
+
+		parentID = completionMessageID
+		for j, toolCall := range response.ToolCalls {
+			content, err := formatToolResult(results[toolCall.ID])
+			if err != nil {
+				return "", err
+			}
+			// the last result takes the ID of the published results, which the next completion answers
+			id := conversation.NewNodeID()
+			if j == len(response.ToolCalls)-1 {
+				id = resultMessageID
+			}
+			msg := conversation.NewChatMessage(
+				conversation.Role("tool"), content,
+				conversation.WithID(id),
+				conversation.WithParentID(parentID),
+				conversation.WithMetadata(map[string]interface{}{"tool_call_id": toolCall.ID}),
+			)
+			messages = append(messages, msg)
+			parentID = msg.ID
+		}
 	}
 
-	toolResult, err := toolStep.Start(cancellableCtx, input)
+	return "", errors.Errorf("no answer without tool calls after %d iterations", t.maxIterations)
+}
+
+// getLastValue starts step and returns its last value, and the metadata of the step.
+func getLastValue[T any, U any](ctx context.Context, step steps.Step[T, U], input T) (U, *steps.StepMetadata, error) {
+	var ret U
+	res, err := steps.Start[T, U](ctx, step, input)
 	if err != nil {
-		return nil, err
+		return ret, nil, err
 	}
-	step, err := NewExecuteToolStep(t.toolFunctions,
-		WithExecuteToolStepSubscriptionManager(t.subscriptionManager),
-		WithExecuteToolStepParentID(toolCompletionMessageID),
-		WithExecuteToolStepMessageID(toolResultMessageID),
-	)
-	if err != nil {
-		return nil, err
+	for r := range res.GetChannel() {
+		ret, err = r.Value()
+		if err != nil {
+			return ret, res.GetMetadata(), err
+		}
 	}
-	execResult := steps.Bind[ToolCompletionResponse, map[string]interface{}](cancellableCtx, toolResult, step)
-
-	responseToStringID := conversation.NewNodeID()
-
-	responseToStringStep := &utils.LambdaStep[map[string]interface{}, string]{
-		Function: func(s map[string]interface{}) helpers.Result[string] {
-			stepMetadata := &steps.StepMetadata{
-				StepID:     uuid.New(),
-				Type:       "response-to-string",
-				InputType:  "map[string]interface{}",
-				OutputType: "string",
-				Metadata:   map[string]interface{}{},
-			}
-			t.subscriptionManager.PublishBlind(&chat.Event{
-				Type: chat.EventTypeStart,
-				Step: stepMetadata,
-				Metadata: chat.EventMetadata{
-					ID:       responseToStringID,
-					ParentID: toolResultMessageID,
-				}})
-			s_, _ := json.MarshalIndent(s, "", " ")
-			t.subscriptionManager.PublishBlind(&chat.EventText{
-				Event: chat.Event{
-					Type: chat.EventTypeFinal,
-					Step: stepMetadata,
-					Metadata: chat.EventMetadata{
-						ID:       responseToStringID,
-						ParentID: toolResultMessageID,
-					}},
-				Text: string(s_),
-			})
-			return helpers.NewValueResult[string](string(s_))
-		},
+	if ctx.Err() != nil {
+		return ret, res.GetMetadata(), ctx.Err()
 	}
-	stringResult := steps.Bind[map[string]interface{}, string](cancellableCtx, execResult, responseToStringStep)
+	return ret, res.GetMetadata(), nil
+}
 
-	return stringResult, nil
+// formatToolResult renders the result of a tool for the model, strings as is and other values as JSON.
+func formatToolResult(result interface{}) (string, error) {
+	if s, ok := result.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
 }
 
 func (t *ChatToolStep) AddPublishedTopic(publisher message.Publisher, topic string) error {
 	t.subscriptionManager.SubscribePublisher(topic, publisher)
 	return nil
 }
-
-var _ chat.Step = &ChatToolStep{}
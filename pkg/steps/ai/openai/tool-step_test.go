@@ -0,0 +1,86 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	go_openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestStepSettings returns the settings of an openai step answered by server.
+func newTestStepSettings(server *httptest.Server) *settings.StepSettings {
+	apiType := settings.ApiTypeOpenAI
+	engine := "gpt-4"
+	stepSettings := settings.NewStepSettings()
+	stepSettings.Chat.ApiType = &apiType
+	stepSettings.Chat.Engine = &engine
+	stepSettings.API.APIKeys[apiType+"-api-key"] = "key"
+	stepSettings.API.BaseUrls[apiType+"-base-url"] = server.URL
+	return stepSettings
+}
+
+func TestChatToolStep(t *testing.T) {
+	// the model calls the tool twice, then answers with the results
+	requests := []go_openai.ChatCompletionRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := go_openai.ChatCompletionRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		message := go_openai.ChatCompletionMessage{Role: "assistant", Content: "It is sunny in Paris and rainy in Boston."}
+		if len(requests) == 1 {
+			message = go_openai.ChatCompletionMessage{
+				Role: "assistant",
+				ToolCalls: []go_openai.ToolCall{
+					{ID: "call-1", Type: go_openai.ToolTypeFunction, Function: go_openai.FunctionCall{Name: "getWeather", Arguments: `{"city":"Paris"}`}},
+					{ID: "call-2", Type: go_openai.ToolTypeFunction, Function: go_openai.FunctionCall{Name: "getWeather", Arguments: `{"city":"Boston"}`}},
+				},
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(go_openai.ChatCompletionResponse{
+			Choices: []go_openai.ChatCompletionChoice{{Message: message}},
+			Usage:   go_openai.Usage{PromptTokens: 10 * len(requests), CompletionTokens: 5},
+		})
+	}))
+	defer server.Close()
+
+	weather := map[string]string{"Paris": "sunny", "Boston": "rainy"}
+	getWeather, err := tools.NewFunctionTool(nil, "getWeather", func(city string) string {
+		return weather[city]
+	}, tools.WithParameterNames("city"))
+	require.NoError(t, err)
+	step, err := NewChatToolStep(newTestStepSettings(server), WithToolFunctions(map[string]interface{}{
+		"getWeather": getWeather,
+	}))
+	require.NoError(t, err)
+
+	res, err := step.Start(context.Background(), conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleUser, "What is the weather in Paris and Boston?"),
+	})
+	require.NoError(t, err)
+	results := res.Return()
+	require.Len(t, results, 1)
+	v, err := results[0].Value()
+	require.NoError(t, err)
+	assert.Equal(t, "It is sunny in Paris and rainy in Boston.", v)
+	// the usage of both completions is reported
+	assert.Equal(t, steps.Usage{InputTokens: 30, OutputTokens: 10}, res.GetMetadata().Metadata[steps.MetadataUsageSlug])
+
+	// the tool calls and their results were sent back to the model
+	require.Len(t, requests, 2)
+	messages := requests[1].Messages
+	require.Len(t, messages, 4)
+	assert.Equal(t, "assistant", messages[1].Role)
+	require.Len(t, messages[1].ToolCalls, 2)
+	assert.Equal(t, go_openai.ChatCompletionMessage{Role: "tool", Content: "sunny", ToolCallID: "call-1"}, messages[2])
+	assert.Equal(t, go_openai.ChatCompletionMessage{Role: "tool", Content: "rainy", ToolCallID: "call-2"}, messages[3])
+}
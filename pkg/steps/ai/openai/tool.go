@@ -2,7 +2,6 @@ package openai
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/go-go-golems/bobatea/pkg/conversation"
 	"github.com/go-go-golems/geppetto/pkg/events"
@@ -10,7 +9,6 @@ import (
 	"github.com/go-go-golems/geppetto/pkg/steps"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/settings"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	go_openai "github.com/sashabaranov/go-openai"
 	"io"
@@ -115,18 +113,13 @@ func (csf *ToolStep) Start(
 	}
 
 	metadata := chat.EventMetadata{
-		ID:       csf.messageID,
-		ParentID: csf.parentID,
-	}
-	stepMetadata := &steps.StepMetadata{
-		StepID:     uuid.New(),
-		Type:       "openai-tool-completion",
-		InputType:  "conversation.Conversation",
-		OutputType: "ToolCompletionResponse",
-		Metadata: map[string]interface{}{
-			steps.MetadataSettingsSlug: csf.Settings.GetMetadata(),
-		},
+		ID:             csf.messageID,
+		ParentID:       csf.parentID,
+		ConversationID: chat.GetConversationID(messages),
 	}
+	stepMetadata := steps.NewStepMetadata(ctx, "openai-tool-completion", "conversation.Conversation", "ToolCompletionResponse", map[string]interface{}{
+		steps.MetadataSettingsSlug: csf.Settings.GetMetadata(),
+	})
 
 	csf.subscriptionManager.PublishBlind(&chat.Event{
 		Type:     chat.EventTypeStart,
@@ -143,7 +136,14 @@ func (csf *ToolStep) Start(
 	if stream {
 		stream_, err := client.CreateChatCompletionStream(context.Background(), *req)
 		if err != nil {
-			return steps.Reject[ToolCompletionResponse](err), nil
+			err = classifyError(err, csf.Settings)
+			csf.subscriptionManager.PublishBlind(&chat.Event{
+				Type:     chat.EventTypeError,
+				Error:    chat.NewEventError(err),
+				Metadata: metadata,
+				Step:     stepMetadata,
+			})
+			return steps.Reject[ToolCompletionResponse](err, steps.WithMetadata[ToolCompletionResponse](stepMetadata)), nil
 		}
 		c := make(chan helpers.Result[ToolCompletionResponse])
 		ret := steps.NewStepResult[ToolCompletionResponse](
@@ -188,8 +188,7 @@ func (csf *ToolStep) Start(
 						}
 						stepMetadata.Metadata[MetadataToolCallsSlug] = toolCalls_
 
-						// TODO(manuel, 2023-11-28) Handle multiple choices
-						//s, _ := json.MarshalIndent(toolCalls_, "", " ")
+						csf.publishToolCalls(toolCalls, metadata, stepMetadata)
 
 						msg := &chat.EventText{
 							Event: chat.Event{
@@ -197,7 +196,7 @@ func (csf *ToolStep) Start(
 								Metadata: metadata,
 								Step:     stepMetadata,
 							},
-							Text: GetToolCallDelta(toolCalls),
+							Text: message,
 						}
 
 						csf.subscriptionManager.PublishBlind(msg)
@@ -209,9 +208,10 @@ func (csf *ToolStep) Start(
 						return
 					}
 					if err != nil {
+						err = classifyError(err, csf.Settings)
 						csf.subscriptionManager.PublishBlind(&chat.Event{
 							Type:     chat.EventTypeError,
-							Error:    err,
+							Error:    chat.NewEventError(err),
 							Metadata: metadata,
 							Step:     stepMetadata,
 						})
@@ -219,26 +219,51 @@ func (csf *ToolStep) Start(
 						return
 					}
 
+					if response.Usage != nil {
+						stepMetadata.Metadata[steps.MetadataUsageSlug] = getUsage(*response.Usage)
+					}
+					if len(response.Choices) == 0 {
+						continue
+					}
+
 					// TODO(manuel, 2023-11-28) Handle multiple choices
 					delta := response.Choices[0].Delta
-					deltaContent := delta.Content
-					if delta.Content == "" {
-						deltaContent = GetToolCallDelta(delta.ToolCalls)
-
-					}
 					toolCallMerger.AddToolCalls(delta.ToolCalls)
 
-					message += deltaContent
+					if delta.Content != "" {
+						message += delta.Content
+						steps.RecordPartial(ctx, delta.Content)
 
-					csf.subscriptionManager.PublishBlind(&chat.EventPartialCompletion{
-						Event: chat.Event{
-							Type:     chat.EventTypePartial,
-							Metadata: metadata,
-							Step:     stepMetadata,
-						},
-						Delta:      deltaContent,
-						Completion: message,
-					})
+						csf.subscriptionManager.PublishBlind(&chat.EventPartialCompletion{
+							Event: chat.Event{
+								Type:     chat.EventTypePartial,
+								Metadata: metadata,
+								Step:     stepMetadata,
+							},
+							Delta:      delta.Content,
+							Completion: message,
+						})
+					}
+
+					for _, toolCall := range delta.ToolCalls {
+						index := 0
+						if toolCall.Index != nil {
+							index = *toolCall.Index
+						}
+						merged, _ := toolCallMerger.GetToolCall(index)
+						csf.subscriptionManager.PublishBlind(&chat.EventToolCallDelta{
+							Event: chat.Event{
+								Type:     chat.EventTypeToolCallDelta,
+								Metadata: metadata,
+								Step:     stepMetadata,
+							},
+							Index:     index,
+							ID:        toolCall.ID,
+							Name:      toolCall.Function.Name,
+							Delta:     toolCall.Function.Arguments,
+							Arguments: merged.Function.Arguments,
+						})
+					}
 
 					if delta.Role != "" {
 						ret.Role = delta.Role
@@ -262,17 +287,20 @@ func (csf *ToolStep) Start(
 		}
 
 		if err != nil {
+			err = classifyError(err, csf.Settings)
 			csf.subscriptionManager.PublishBlind(&chat.Event{
 				Type:     chat.EventTypeError,
-				Error:    err,
+				Error:    chat.NewEventError(err),
 				Metadata: metadata,
 				Step:     stepMetadata,
 			})
 			return steps.Reject[ToolCompletionResponse](err), nil
 		}
 
+		stepMetadata.Metadata[steps.MetadataUsageSlug] = getUsage(resp.Usage)
+
 		// TODO(manuel, 2023-11-28) Handle multiple choices
-		s, _ := json.MarshalIndent(resp.Choices[0].Message.ToolCalls, "", " ")
+		csf.publishToolCalls(resp.Choices[0].Message.ToolCalls, metadata, stepMetadata)
 
 		csf.subscriptionManager.PublishBlind(&chat.EventText{
 			Event: chat.Event{
@@ -280,7 +308,7 @@ func (csf *ToolStep) Start(
 				Metadata: metadata,
 				Step:     stepMetadata,
 			},
-			Text: string(s),
+			Text: resp.Choices[0].Message.Content,
 		})
 
 		ret := ToolCompletionResponse{
@@ -288,7 +316,27 @@ func (csf *ToolStep) Start(
 			Content:   resp.Choices[0].Message.Content,
 			ToolCalls: resp.Choices[0].Message.ToolCalls,
 		}
-		return steps.Resolve(ret), nil
+		return steps.Resolve(ret, steps.WithMetadata[ToolCompletionResponse](stepMetadata)), nil
+	}
+}
+
+// publishToolCalls publishes a tool call event for each of the complete tool calls returned by the model.
+func (csf *ToolStep) publishToolCalls(
+	toolCalls []go_openai.ToolCall,
+	metadata chat.EventMetadata,
+	stepMetadata *steps.StepMetadata,
+) {
+	for _, toolCall := range toolCalls {
+		csf.subscriptionManager.PublishBlind(chat.NewEventToolCall(
+			chat.Event{
+				Type:     chat.EventTypeToolCall,
+				Metadata: metadata,
+				Step:     stepMetadata,
+			},
+			toolCall.ID,
+			toolCall.Function.Name,
+			toolCall.Function.Arguments,
+		))
 	}
 }
 
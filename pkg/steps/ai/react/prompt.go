@@ -0,0 +1,196 @@
+package react
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/go-go-golems/geppetto/pkg/steps/parse"
+	"regexp"
+	"strings"
+)
+
+const FinalAnswerAction = "Final Answer"
+
+// RenderToolPrompt renders the catalogue of tools, along with the instructions on how to call
+// them, so that it can be added to the system prompt.
+func RenderToolPrompt(tools_ []tools.Tool) string {
+	b := &strings.Builder{}
+	b.WriteString("You have access to the following tools:\n\n")
+
+	names := []string{}
+	for _, tool := range tools_ {
+		names = append(names, tool.GetName())
+		_, _ = fmt.Fprintf(b, "%s: %s\n", tool.GetName(), tool.GetDescription())
+		_, _ = fmt.Fprintf(b, "  Arguments (JSON schema): %s\n", compactJSON(tool.GetParameters()))
+	}
+
+	_, _ = fmt.Fprintf(b, `
+To use a tool, answer with the following format:
+
+Thought: think about what to do next
+Action: the tool to use, one of [%s]
+Action Input: the arguments of the tool, as a JSON object
+
+You will then get the result of the tool as:
+
+Observation: the result of the tool
+
+Thought/Action/Action Input/Observation can repeat several times, but only use a single action per answer.
+Once you know the answer, reply with:
+
+Thought: I now know the final answer
+Final Answer: the final answer to the original question
+
+Instead of the Action and Action Input lines, you can also answer with a JSON code block:
+
+`+"```json"+`
+{"action": "the tool to use", "action_input": {"argument": "value"}}
+`+"```"+`
+
+using "%s" as the action and the answer as the action_input when you know the final answer.
+`, strings.Join(names, ", "), FinalAnswerAction)
+
+	return b.String()
+}
+
+func compactJSON(s json.RawMessage) string {
+	b := &bytes.Buffer{}
+	if err := json.Compact(b, s); err != nil {
+		return string(s)
+	}
+	return b.String()
+}
+
+// Action is a tool call parsed from the answer of the model. Input is the raw JSON of
+// the arguments.
+type Action struct {
+	Name  string
+	Input string
+}
+
+// Response is the parsed answer of the model. Either Action is set, or FinalAnswer contains
+// the answer of the model.
+type Response struct {
+	// Text is the answer of the model, truncated before any observation the model
+	// made up itself.
+	Text        string
+	Thought     string
+	Action      *Action
+	FinalAnswer string
+}
+
+var (
+	observationRegexp = regexp.MustCompile(`(?mi)^\s*Observation\s*:`)
+	thoughtRegexp     = regexp.MustCompile(`(?mi)^\s*Thought\s*:\s*(.*)$`)
+	actionRegexp      = regexp.MustCompile(`(?mi)^\s*Action\s*:\s*(.*)$`)
+	actionInputRegexp = regexp.MustCompile(`(?mi)^\s*Action\s+Input\s*:`)
+	finalAnswerRegexp = regexp.MustCompile(`(?mi)^\s*Final\s+Answer\s*:`)
+)
+
+type jsonAction struct {
+	Action      string          `json:"action"`
+	ActionInput json.RawMessage `json:"action_input"`
+}
+
+// ParseResponse parses the answer of the model, either in the Thought/Action/Action Input format
+// or as a JSON block with action and action_input fields. An answer with neither an action
+// nor a final answer is considered to be the final answer.
+func ParseResponse(ctx context.Context, text string) (*Response, error) {
+	if loc := observationRegexp.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	text = strings.TrimSpace(text)
+
+	ret := &Response{
+		Text: text,
+	}
+	if m := thoughtRegexp.FindStringSubmatch(text); m != nil {
+		ret.Thought = strings.TrimSpace(m[1])
+	}
+
+	actionLoc := actionRegexp.FindStringSubmatchIndex(text)
+	finalAnswerLoc := finalAnswerRegexp.FindStringIndex(text)
+
+	if finalAnswerLoc != nil && (actionLoc == nil || finalAnswerLoc[0] < actionLoc[0]) {
+		ret.FinalAnswer = strings.TrimSpace(text[finalAnswerLoc[1]:])
+		return ret, nil
+	}
+
+	if actionLoc != nil {
+		name := strings.Trim(strings.TrimSpace(text[actionLoc[2]:actionLoc[3]]), "`\"'")
+		input := ""
+		if inputLoc := actionInputRegexp.FindStringIndex(text); inputLoc != nil && inputLoc[0] > actionLoc[0] {
+			input = strings.TrimSpace(text[inputLoc[1]:])
+			blocks, err := extractJSON(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+			if len(blocks) > 0 {
+				input = blocks[0]
+			}
+		}
+
+		if strings.EqualFold(name, FinalAnswerAction) {
+			ret.FinalAnswer = unquoteFinalAnswer(input)
+			return ret, nil
+		}
+		ret.Action = &Action{
+			Name:  name,
+			Input: input,
+		}
+		return ret, nil
+	}
+
+	blocks, err := extractJSON(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		var action jsonAction
+		err = json.Unmarshal([]byte(block), &action)
+		if err != nil || action.Action == "" {
+			continue
+		}
+		if strings.EqualFold(action.Action, FinalAnswerAction) {
+			ret.FinalAnswer = unquoteFinalAnswer(string(action.ActionInput))
+			return ret, nil
+		}
+		ret.Action = &Action{
+			Name:  action.Action,
+			Input: string(action.ActionInput),
+		}
+		return ret, nil
+	}
+
+	ret.FinalAnswer = text
+	return ret, nil
+}
+
+// extractJSON runs the JSON extractor step on s.
+func extractJSON(ctx context.Context, s string) ([]string, error) {
+	res, err := (&parse.ExtractJSONStep{}).Start(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, r := range res.Return() {
+		v, err := r.Value()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v...)
+	}
+	return ret, nil
+}
+
+// unquoteFinalAnswer returns the string value of a JSON string final answer, and the
+// final answer as is otherwise.
+func unquoteFinalAnswer(s string) string {
+	var ret string
+	if err := json.Unmarshal([]byte(s), &ret); err == nil {
+		return ret
+	}
+	return strings.TrimSpace(s)
+}
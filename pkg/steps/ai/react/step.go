@@ -0,0 +1,327 @@
+package react
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/events"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/openai"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	go_openai "github.com/sashabaranov/go-openai"
+	"sort"
+	"strings"
+)
+
+const DefaultMaxIterations = 10
+
+// Step offers tools to models without native function calling support. It adds the tool catalogue
+// to the system prompt, asks the model to answer with ReAct style actions, executes the parsed
+// actions with an openai.ExecuteToolStep and feeds the results back as observations,
+// until the model gives its final answer.
+//
+// Since it only relies on the text completion of the wrapped chat step, it works with every provider.
+type Step struct {
+	step                chat.Step
+	reflector           *tools.Reflector
+	toolFunctions       map[string]interface{}
+	tools               []tools.Tool
+	maxIterations       int
+	subscriptionManager *events.PublisherManager
+}
+
+var _ chat.Step = (*Step)(nil)
+
+type StepOption func(*Step) error
+
+func WithReflector(reflector *tools.Reflector) StepOption {
+	return func(step *Step) error {
+		step.reflector = reflector
+		return nil
+	}
+}
+
+// WithToolFunctions sets the tools, which are either go functions or tools.Tool implementations.
+func WithToolFunctions(toolFunctions map[string]interface{}) StepOption {
+	return func(step *Step) error {
+		step.toolFunctions = toolFunctions
+		return nil
+	}
+}
+
+// WithMaxIterations sets the maximum number of completions before the step gives up on
+// getting a final answer.
+func WithMaxIterations(maxIterations int) StepOption {
+	return func(step *Step) error {
+		if maxIterations < 1 {
+			return errors.Errorf("invalid max iterations %d", maxIterations)
+		}
+		step.maxIterations = maxIterations
+		return nil
+	}
+}
+
+// NewStep creates a ReAct step that uses step to get the completions of the model.
+func NewStep(step chat.Step, options ...StepOption) (*Step, error) {
+	ret := &Step{
+		step:                step,
+		maxIterations:       DefaultMaxIterations,
+		subscriptionManager: events.NewPublisherManager(),
+	}
+	for _, option := range options {
+		err := option(ret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ret.reflector == nil {
+		ret.reflector = tools.NewReflector()
+	}
+
+	for name, tool := range ret.toolFunctions {
+		tool_, err := tools.GetTool(ret.reflector, name, tool)
+		if err != nil {
+			return nil, err
+		}
+		ret.tools = append(ret.tools, &namedTool{Tool: tool_, name: name})
+	}
+	sort.Slice(ret.tools, func(i, j int) bool {
+		return ret.tools[i].GetName() < ret.tools[j].GetName()
+	})
+
+	return ret, nil
+}
+
+// namedTool renders a tool under the name it was registered with.
+type namedTool struct {
+	tools.Tool
+	name string
+}
+
+func (n *namedTool) GetName() string {
+	return n.name
+}
+
+func (s *Step) AddPublishedTopic(publisher message.Publisher, topic string) error {
+	s.subscriptionManager.SubscribePublisher(topic, publisher)
+	return s.step.AddPublishedTopic(publisher, topic)
+}
+
+func (s *Step) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
+	cancellableCtx, cancel := context.WithCancel(ctx)
+
+	toolMetadata := map[string]interface{}{}
+	for _, tool := range s.tools {
+		toolMetadata[tool.GetName()] = tools.ToOpenAITool(tool)
+	}
+	stepMetadata := steps.NewStepMetadata(ctx, "react", "conversation.Conversation", "string", map[string]interface{}{
+		openai.MetadataToolsSlug: toolMetadata,
+	})
+
+	c := make(chan helpers.Result[string])
+	ret := steps.NewStepResult[string](
+		c,
+		steps.WithCancel[string](cancel),
+		steps.WithMetadata[string](stepMetadata),
+	)
+
+	go func() {
+		defer close(c)
+		defer cancel()
+
+		answer, err := s.run(steps.WithParentStep(cancellableCtx, stepMetadata), withToolPrompt(input, RenderToolPrompt(s.tools)))
+		if err != nil {
+			c <- helpers.NewErrorResult[string](err)
+			return
+		}
+		c <- helpers.NewValueResult[string](answer)
+	}()
+
+	return ret, nil
+}
+
+// withToolPrompt appends the tool prompt to the system prompt of the conversation,
+// or prepends a new system message if there is none.
+func withToolPrompt(input conversation.Conversation, toolPrompt string) conversation.Conversation {
+	ret := conversation.Conversation{}
+	if len(input) > 0 {
+		if content, ok := input[0].Content.(*conversation.ChatMessageContent); ok && content.Role == conversation.RoleSystem {
+			system := *input[0]
+			system.Content = &conversation.ChatMessageContent{
+				Role: conversation.RoleSystem,
+				Text: strings.TrimRight(content.Text, "\n") + "\n\n" + toolPrompt,
+			}
+			ret = append(ret, &system)
+			return append(ret, input[1:]...)
+		}
+	}
+
+	ret = append(ret, conversation.NewChatMessage(conversation.RoleSystem, toolPrompt))
+	return append(ret, input...)
+}
+
+func (s *Step) run(ctx context.Context, messages conversation.Conversation) (string, error) {
+	for i := 0; i < s.maxIterations; i++ {
+		text, err := s.complete(ctx, messages)
+		if err != nil {
+			return "", err
+		}
+
+		response, err := ParseResponse(ctx, text)
+		if err != nil {
+			return "", err
+		}
+		if response.Action == nil {
+			return response.FinalAnswer, nil
+		}
+
+		parentID := conversation.NullNode
+		if len(messages) > 0 {
+			parentID = messages[len(messages)-1].ID
+		}
+		assistantMessage := conversation.NewChatMessage(
+			conversation.RoleAssistant, response.Text,
+			conversation.WithParentID(parentID),
+		)
+		messages = append(messages, assistantMessage)
+
+		observation, err := s.executeAction(ctx, response.Action, assistantMessage.ID)
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, conversation.NewChatMessage(
+			conversation.RoleUser, "Observation: "+observation,
+			conversation.WithParentID(assistantMessage.ID),
+		))
+	}
+
+	return "", errors.Errorf("no final answer after %d iterations", s.maxIterations)
+}
+
+// complete runs the wrapped step and returns its last completion.
+func (s *Step) complete(ctx context.Context, messages conversation.Conversation) (string, error) {
+	res, err := steps.Start(ctx, s.step, messages)
+	if err != nil {
+		return "", err
+	}
+
+	ret := ""
+	for r := range res.GetChannel() {
+		v, err := r.Value()
+		if err != nil {
+			return "", err
+		}
+		ret = v
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	return ret, nil
+}
+
+// executeAction runs the tool of the action and returns the observation to send back to the model.
+// Unknown tools and invalid arguments are reported to the model so that it can correct itself,
+// while tool errors stop the step, like for native tool calls.
+func (s *Step) executeAction(ctx context.Context, action *Action, parentID conversation.NodeID) (string, error) {
+	if _, ok := s.toolFunctions[action.Name]; !ok {
+		names := []string{}
+		for _, tool := range s.tools {
+			names = append(names, tool.GetName())
+		}
+		return fmt.Sprintf("%s is not a valid tool, use one of [%s].", action.Name, strings.Join(names, ", ")), nil
+	}
+
+	arguments := strings.TrimSpace(action.Input)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &v); err != nil {
+		return fmt.Sprintf("the Action Input of %s must be a JSON object: %s", action.Name, err.Error()), nil
+	}
+
+	actionMessageID := conversation.NewNodeID()
+	toolCall := go_openai.ToolCall{
+		ID:   uuid.New().String(),
+		Type: go_openai.ToolTypeFunction,
+		Function: go_openai.FunctionCall{
+			Name:      action.Name,
+			Arguments: arguments,
+		},
+	}
+	s.publishToolCall(ctx, toolCall, actionMessageID, parentID)
+
+	executeToolStep, err := openai.NewExecuteToolStep(s.toolFunctions,
+		openai.WithExecuteToolStepReflector(s.reflector),
+		openai.WithExecuteToolStepSubscriptionManager(s.subscriptionManager),
+		openai.WithExecuteToolStepParentID(actionMessageID),
+		openai.WithExecuteToolStepMessageID(conversation.NewNodeID()),
+	)
+	if err != nil {
+		return "", err
+	}
+	res, err := steps.Start[openai.ToolCompletionResponse, map[string]interface{}](ctx, executeToolStep, openai.ToolCompletionResponse{
+		Role:      string(conversation.RoleAssistant),
+		ToolCalls: []go_openai.ToolCall{toolCall},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var results map[string]interface{}
+	for r := range res.GetChannel() {
+		results, err = r.Value()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	result := results[toolCall.ID]
+	if s_, ok := result.(string); ok {
+		return s_, nil
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// publishToolCall publishes the parsed action as a tool call, in its own message.
+func (s *Step) publishToolCall(ctx context.Context, toolCall go_openai.ToolCall, messageID conversation.NodeID, parentID conversation.NodeID) {
+	metadata := chat.EventMetadata{
+		ID:       messageID,
+		ParentID: parentID,
+	}
+	stepMetadata := steps.NewStepMetadata(ctx, "react-action", "string", "ToolCompletionResponse", map[string]interface{}{})
+
+	s.subscriptionManager.PublishBlind(&chat.Event{
+		Type:     chat.EventTypeStart,
+		Metadata: metadata,
+		Step:     stepMetadata,
+	})
+	s.subscriptionManager.PublishBlind(chat.NewEventToolCall(
+		chat.Event{
+			Type:     chat.EventTypeToolCall,
+			Metadata: metadata,
+			Step:     stepMetadata,
+		},
+		toolCall.ID,
+		toolCall.Function.Name,
+		toolCall.Function.Arguments,
+	))
+	s.subscriptionManager.PublishBlind(&chat.EventText{
+		Event: chat.Event{
+			Type:     chat.EventTypeFinal,
+			Metadata: metadata,
+			Step:     stepMetadata,
+		},
+	})
+}
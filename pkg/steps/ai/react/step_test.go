@@ -0,0 +1,99 @@
+package react
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseResponse(t *testing.T) {
+	ctx := context.Background()
+
+	r, err := ParseResponse(ctx, "Thought: I need the weather\nAction: getWeather\nAction Input: {\"city\": \"Paris\"}\nObservation: sunny")
+	require.NoError(t, err)
+	assert.Equal(t, "I need the weather", r.Thought)
+	require.NotNil(t, r.Action)
+	assert.Equal(t, "getWeather", r.Action.Name)
+	assert.JSONEq(t, `{"city": "Paris"}`, r.Action.Input)
+	assert.NotContains(t, r.Text, "Observation")
+
+	r, err = ParseResponse(ctx, "Let me check.\n\n```json\n{\"action\": \"getWeather\", \"action_input\": {\"city\": \"Paris\"}}\n```")
+	require.NoError(t, err)
+	require.NotNil(t, r.Action)
+	assert.Equal(t, "getWeather", r.Action.Name)
+	assert.JSONEq(t, `{"city": "Paris"}`, r.Action.Input)
+
+	r, err = ParseResponse(ctx, "```json\n{\"action\": \"Final Answer\", \"action_input\": \"It is sunny.\"}\n```")
+	require.NoError(t, err)
+	assert.Nil(t, r.Action)
+	assert.Equal(t, "It is sunny.", r.FinalAnswer)
+
+	r, err = ParseResponse(ctx, "Thought: I now know the final answer\nFinal Answer: It is sunny.")
+	require.NoError(t, err)
+	assert.Nil(t, r.Action)
+	assert.Equal(t, "It is sunny.", r.FinalAnswer)
+
+	r, err = ParseResponse(ctx, "It is sunny.")
+	require.NoError(t, err)
+	assert.Nil(t, r.Action)
+	assert.Equal(t, "It is sunny.", r.FinalAnswer)
+}
+
+// scriptedStep answers with the given completions in order, and records the conversations it got.
+type scriptedStep struct {
+	completions []string
+	inputs      []conversation.Conversation
+}
+
+func (s *scriptedStep) Start(ctx context.Context, input conversation.Conversation) (steps.StepResult[string], error) {
+	s.inputs = append(s.inputs, input)
+	ret := s.completions[0]
+	s.completions = s.completions[1:]
+	return steps.Resolve(ret), nil
+}
+
+func (s *scriptedStep) AddPublishedTopic(publisher message.Publisher, topic string) error {
+	return nil
+}
+
+func TestStep(t *testing.T) {
+	chatStep := &scriptedStep{
+		completions: []string{
+			"Thought: I need the weather\nAction: getWeather\nAction Input: {\"city\": \"Paris\"}",
+			"Action: unknown\nAction Input: {}",
+			"Final Answer: It is sunny in Paris.",
+		},
+	}
+	getWeather, err := tools.NewFunctionTool(nil, "getWeather", func(city string) string {
+		return "sunny in " + city
+	}, tools.WithParameterNames("city"))
+	require.NoError(t, err)
+	step, err := NewStep(chatStep, WithToolFunctions(map[string]interface{}{
+		"getWeather": getWeather,
+	}))
+	require.NoError(t, err)
+
+	res, err := step.Start(context.Background(), conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleUser, "What is the weather in Paris?"),
+	})
+	require.NoError(t, err)
+	results := res.Return()
+	require.Len(t, results, 1)
+	v, err := results[0].Value()
+	require.NoError(t, err)
+	assert.Equal(t, "It is sunny in Paris.", v)
+
+	require.Len(t, chatStep.inputs, 3)
+	system := chatStep.inputs[0][0].Content.(*conversation.ChatMessageContent)
+	assert.Equal(t, conversation.RoleSystem, system.Role)
+	assert.Contains(t, system.Text, "getWeather")
+
+	last := chatStep.inputs[2]
+	assert.Equal(t, "Observation: sunny in Paris", last[len(last)-3].Content.String())
+	assert.Contains(t, last[len(last)-1].Content.String(), "unknown is not a valid tool")
+}
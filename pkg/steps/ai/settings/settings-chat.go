@@ -21,6 +21,17 @@ const (
 	ApiTypeCohere ApiType = "cohere"
 )
 
+// ToolFormat is the way tools are offered to the model.
+type ToolFormat string
+
+const (
+	// ToolFormatNative uses the function calling API of the provider.
+	ToolFormatNative ToolFormat = "native"
+	// ToolFormatReAct describes the tools in the system prompt and parses the tool calls
+	// from the text of the answer, for models without function calling support.
+	ToolFormatReAct ToolFormat = "react"
+)
+
 type ChatSettings struct {
 	Engine            *string           `yaml:"engine,omitempty" glazed.parameter:"ai-engine"`
 	ApiType           *ApiType          `yaml:"api_type,omitempty" glazed.parameter:"ai-api-type"`
@@ -29,6 +40,7 @@ type ChatSettings struct {
 	Temperature       *float64          `yaml:"temperature,omitempty" glazed.parameter:"ai-temperature"`
 	Stop              []string          `yaml:"stop,omitempty" glazed.parameter:"ai-stop"`
 	Stream            bool              `yaml:"stream,omitempty" glazed.parameter:"ai-stream"`
+	ToolFormat        *ToolFormat       `yaml:"tool_format,omitempty" glazed.parameter:"ai-tool-format"`
 	APIKeys           map[string]string `yaml:"api_keys,omitempty" glazed.parameter:"*-api-key"`
 }
 
@@ -41,6 +53,7 @@ func NewChatSettings() *ChatSettings {
 		Temperature:       nil,
 		Stop:              []string{},
 		Stream:            false,
+		ToolFormat:        nil,
 		APIKeys:           map[string]string{},
 	}
 }
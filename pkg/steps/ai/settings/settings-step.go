@@ -91,6 +91,9 @@ func (ss *StepSettings) GetMetadata() map[string]interface{} {
 		}
 
 		metadata["ai-stream"] = ss.Chat.Stream
+		if ss.Chat.ToolFormat != nil && *ss.Chat.ToolFormat != ToolFormatNative {
+			metadata["ai-tool-format"] = *ss.Chat.ToolFormat
+		}
 	}
 
 	if ss.OpenAI != nil {
@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/invopop/jsonschema"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Reflector creates the schemas of go function tools. Besides the JSON schema reflector used
+// for the parameter types, it keeps the doc comments and parameter names of the functions
+// extracted with AddGoComments.
+type Reflector struct {
+	Reflector *jsonschema.Reflector
+	Functions map[string]*helpers.FunctionDoc
+}
+
+func NewReflector() *Reflector {
+	return &Reflector{
+		Reflector: &jsonschema.Reflector{
+			DoNotReference: true,
+		},
+		Functions: map[string]*helpers.FunctionDoc{},
+	}
+}
+
+// AddGoComments extracts the comments of the types, fields and functions in the go files in path,
+// which is imported as base. Field comments end up as property descriptions, function comments
+// as tool descriptions, and function parameter names as property names.
+//
+// Since comments are read from the source, path is relative to the working directory, for example
+//
+//	r.AddGoComments("github.com/go-go-golems/geppetto", "./cmd/experiments/tool-ui")
+func (r *Reflector) AddGoComments(base, path string) error {
+	err := r.Reflector.AddGoComments(base, path)
+	if err != nil {
+		return err
+	}
+	return helpers.ExtractGoFunctionDocs(base, path, r.Functions)
+}
+
+// FunctionTool is a Tool backed by a go function. The arguments schema is reflected from the
+// parameter types, see helpers.GetFunctionParametersJsonSchemaWithNames.
+type FunctionTool struct {
+	Name           string
+	Description    string
+	Function       interface{}
+	ParameterNames []string
+	parameters     json.RawMessage
+}
+
+var _ Tool = (*FunctionTool)(nil)
+
+type FunctionToolOption func(*FunctionTool)
+
+// WithDescription overrides the description taken from the function doc comment.
+func WithDescription(description string) FunctionToolOption {
+	return func(t *FunctionTool) {
+		t.Description = description
+	}
+}
+
+// WithParameterNames sets the names of the properties describing the function parameters,
+// overriding the names extracted from the source. A leading context.Context parameter doesn't
+// get a name.
+func WithParameterNames(names ...string) FunctionToolOption {
+	return func(t *FunctionTool) {
+		t.ParameterNames = names
+	}
+}
+
+// NewFunctionTool creates a tool for the go function f. The description and parameter names default
+// to the ones extracted by reflector.AddGoComments, if any. reflector can be nil.
+func NewFunctionTool(reflector *Reflector, name string, f interface{}, options ...FunctionToolOption) (*FunctionTool, error) {
+	if reflector == nil {
+		reflector = NewReflector()
+	}
+
+	ret := &FunctionTool{
+		Name:     name,
+		Function: f,
+	}
+	if doc := reflector.Functions[helpers.GetFunctionName(f)]; doc != nil {
+		ret.Description = doc.Description
+		ret.ParameterNames = doc.ParameterNames
+	}
+	for _, option := range options {
+		option(ret)
+	}
+
+	schema, err := helpers.GetFunctionParametersJsonSchemaWithNames(reflector.Reflector, f, ret.ParameterNames)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not reflect schema of tool %s", name)
+	}
+	if ret.Description == "" {
+		ret.Description = schema.Description
+	}
+	ret.parameters, err = json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// GetTool returns the Tool for an entry of a tools map, which can be either a go function
+// (wrapped as a FunctionTool) or a Tool.
+func GetTool(reflector *Reflector, name string, tool interface{}) (Tool, error) {
+	if tool_, ok := tool.(Tool); ok {
+		return tool_, nil
+	}
+	return NewFunctionTool(reflector, name, tool)
+}
+
+func (t *FunctionTool) GetName() string {
+	return t.Name
+}
+
+func (t *FunctionTool) GetDescription() string {
+	return t.Description
+}
+
+func (t *FunctionTool) GetParameters() json.RawMessage {
+	return t.parameters
+}
+
+// Call calls the function with the decoded arguments. Functions returning a single value
+// return it as is, multiple return values are returned as a list.
+// A trailing error return value is returned as the error of the call.
+func (t *FunctionTool) Call(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+	var args interface{} = arguments
+	if arguments == nil {
+		args = map[string]interface{}{}
+	}
+	vs_, err := helpers.CallFunctionWithNamedArguments(ctx, t.Function, t.ParameterNames, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vs_) > 0 && vs_[len(vs_)-1].Type() == errorType {
+		last := vs_[len(vs_)-1]
+		if !last.IsNil() {
+			return nil, last.Interface().(error)
+		}
+		vs_ = vs_[:len(vs_)-1]
+		if len(vs_) == 0 {
+			return nil, nil
+		}
+	}
+
+	if len(vs_) == 1 {
+		return vs_[0].Interface(), nil
+	}
+	vals := []interface{}{}
+	for _, v_ := range vs_ {
+		vals = append(vals, v_.Interface())
+	}
+	return vals, nil
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type ForecastRequest struct {
+	// The city for which to request the forecast
+	City string `json:"city"`
+}
+
+// forecast returns the forecast for a city.
+func forecast(request ForecastRequest) string {
+	return "sunny in " + request.City
+}
+
+// weatherOnDay returns the temperature in a city on a given day.
+func weatherOnDay(ctx context.Context, city string, day int) (float64, error) {
+	if city == "" {
+		return 0, errors.New("missing city")
+	}
+	return float64(day), nil
+}
+
+func newTestReflector(t *testing.T) *Reflector {
+	reflector := NewReflector()
+	err := reflector.AddGoComments("github.com/go-go-golems/geppetto/pkg/steps/ai/tools", ".")
+	require.NoError(t, err)
+	return reflector
+}
+
+func TestFunctionToolSingleStruct(t *testing.T) {
+	tool, err := NewFunctionTool(newTestReflector(t), "forecast", forecast)
+	require.NoError(t, err)
+	assert.Equal(t, "forecast returns the forecast for a city.", tool.GetDescription())
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(tool.GetParameters(), &schema))
+	city := schema["properties"].(map[string]interface{})["city"].(map[string]interface{})
+	assert.Equal(t, "The city for which to request the forecast", city["description"])
+
+	res, err := tool.Call(context.Background(), map[string]interface{}{"city": "Paris"})
+	require.NoError(t, err)
+	assert.Equal(t, "sunny in Paris", res)
+}
+
+func TestFunctionToolNamedParameters(t *testing.T) {
+	tool, err := NewFunctionTool(newTestReflector(t), "weather", weatherOnDay)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {"city": {"type": "string"}, "day": {"type": "integer"}},
+		"required": ["city", "day"]
+	}`, string(tool.GetParameters()))
+
+	res, err := tool.Call(context.Background(), map[string]interface{}{"city": "Paris", "day": 12})
+	require.NoError(t, err)
+	assert.Equal(t, 12.0, res)
+
+	_, err = tool.Call(context.Background(), map[string]interface{}{"day": 12})
+	assert.EqualError(t, err, "missing city")
+
+	// without extracted comments, names are given at registration time
+	tool, err = NewFunctionTool(nil, "weather", weatherOnDay,
+		WithParameterNames("location", "date"),
+		WithDescription("Get the weather"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "Get the weather", tool.GetDescription())
+	res, err = tool.Call(context.Background(), map[string]interface{}{"location": "Paris", "date": 3})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, res)
+}
+
+func TestAddGoCommentsMainPackages(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"a/main.go": "package main\n\n// run runs a.\nfunc run(name string) {}\n\n// onlyA is only in a.\nfunc onlyA(x int) {}\n\nfunc main() {}\n",
+		"b/main.go": "package main\n\n// run runs b.\nfunc run(count int) {}\n\nfunc main() {}\n",
+	}
+	for name, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(source), 0644))
+	}
+
+	reflector := NewReflector()
+	require.NoError(t, reflector.AddGoComments("example.com/tools", dir))
+	// extracting the same package twice doesn't make its aliases ambiguous
+	require.NoError(t, reflector.AddGoComments("example.com/tools", filepath.Join(dir, "a")))
+
+	// both packages declare run, so main.run can't be attributed to either of them
+	doc, ok := reflector.Functions["main.run"]
+	assert.True(t, ok)
+	assert.Nil(t, doc)
+	assert.Equal(t, "run runs a.", reflector.Functions["example.com/tools"+filepath.ToSlash(filepath.Join(dir, "a"))+".run"].Description)
+	assert.Equal(t, []string{"count"}, reflector.Functions["example.com/tools"+filepath.ToSlash(filepath.Join(dir, "b"))+".run"].ParameterNames)
+
+	require.NotNil(t, reflector.Functions["main.onlyA"])
+	assert.Equal(t, "onlyA is only in a.", reflector.Functions["main.onlyA"].Description)
+	assert.Equal(t, []string{"x"}, reflector.Functions["main.onlyA"].ParameterNames)
+}
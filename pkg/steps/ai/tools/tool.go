@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/claude"
+	go_openai "github.com/sashabaranov/go-openai"
+)
+
+// Tool is a tool whose description, JSON schema and implementation are only known at runtime,
+// for example because they were declared in a command YAML file.
+//
+// Tools can be passed to the tool steps in the same map as plain go functions.
+// Go functions get wrapped as a FunctionTool, which reflects their schema,
+// while a Tool provides its own schema and is called with the decoded JSON arguments.
+type Tool interface {
+	GetName() string
+	GetDescription() string
+	// GetParameters returns the JSON schema of the arguments object.
+	GetParameters() json.RawMessage
+	Call(ctx context.Context, arguments map[string]interface{}) (interface{}, error)
+}
+
+// ToOpenAITool converts a Tool to the go-openai function tool definition.
+func ToOpenAITool(t Tool) go_openai.Tool {
+	return go_openai.Tool{
+		Type: "function",
+		Function: &go_openai.FunctionDefinition{
+			Name:        t.GetName(),
+			Description: t.GetDescription(),
+			Parameters:  t.GetParameters(),
+		},
+	}
+}
+
+// ToClaudeTool converts a Tool to the claude messages API tool definition.
+func ToClaudeTool(t Tool) claude.Tool {
+	return claude.Tool{
+		Name:        t.GetName(),
+		Description: t.GetDescription(),
+		InputSchema: t.GetParameters(),
+	}
+}
+
+// ToolFunc is a Tool backed by a go function taking the raw arguments map.
+type ToolFunc struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+	Function    func(ctx context.Context, arguments map[string]interface{}) (interface{}, error)
+}
+
+var _ Tool = (*ToolFunc)(nil)
+
+func (t *ToolFunc) GetName() string {
+	return t.Name
+}
+
+func (t *ToolFunc) GetDescription() string {
+	return t.Description
+}
+
+func (t *ToolFunc) GetParameters() json.RawMessage {
+	if len(t.Parameters) == 0 {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return t.Parameters
+}
+
+func (t *ToolFunc) Call(ctx context.Context, arguments map[string]interface{}) (interface{}, error) {
+	return t.Function(ctx, arguments)
+}
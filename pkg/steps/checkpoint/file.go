@@ -0,0 +1,70 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+// FileStore stores each checkpoint as a JSON file in <dir>/<run-id>/<step-id>-<input-hash>.json.
+type FileStore struct {
+	dir string
+}
+
+var _ Store = (*FileStore)(nil)
+
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) path(runID string, stepID string, inputHash string) string {
+	return filepath.Join(f.dir, filepath.Base(runID), filepath.Base(stepID)+"-"+inputHash+".json")
+}
+
+func (f *FileStore) Load(ctx context.Context, runID string, stepID string, inputHash string) (*Checkpoint, error) {
+	b, err := os.ReadFile(f.path(runID, stepID, inputHash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ret := &Checkpoint{}
+	err = json.Unmarshal(b, ret)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse checkpoint of step %s", stepID)
+	}
+	return ret, nil
+}
+
+func (f *FileStore) Save(ctx context.Context, checkpoint *Checkpoint) error {
+	path := f.path(checkpoint.RunID, checkpoint.StepID, checkpoint.InputHash)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that an interrupted run doesn't leave a truncated checkpoint
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (f *FileStore) Close() error {
+	return nil
+}
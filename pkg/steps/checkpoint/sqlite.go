@@ -0,0 +1,79 @@
+package checkpoint
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// SQLiteStore stores checkpoints in a table of a SQLite database.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+const createCheckpointsTable = `
+CREATE TABLE IF NOT EXISTS checkpoints (
+	run_id     TEXT NOT NULL,
+	step_id    TEXT NOT NULL,
+	input_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	outputs    BLOB NOT NULL,
+	PRIMARY KEY (run_id, step_id, input_hash)
+)`
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(createCheckpointsTable)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "could not create checkpoints table")
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Load(ctx context.Context, runID string, stepID string, inputHash string) (*Checkpoint, error) {
+	ret := &Checkpoint{
+		RunID:     runID,
+		StepID:    stepID,
+		InputHash: inputHash,
+	}
+	var outputs []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT created_at, outputs FROM checkpoints WHERE run_id = ? AND step_id = ? AND input_hash = ?`,
+		runID, stepID, inputHash,
+	).Scan(&ret.CreatedAt, &outputs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ret.Outputs = outputs
+
+	return ret, nil
+}
+
+func (s *SQLiteStore) Save(ctx context.Context, checkpoint *Checkpoint) error {
+	createdAt := checkpoint.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO checkpoints (run_id, step_id, input_hash, created_at, outputs) VALUES (?, ?, ?, ?, ?)`,
+		checkpoint.RunID, checkpoint.StepID, checkpoint.InputHash, createdAt, []byte(checkpoint.Outputs),
+	)
+	return err
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
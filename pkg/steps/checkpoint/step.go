@@ -0,0 +1,213 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// MetadataCachedSlug is set to true in the step metadata of results that were loaded from a checkpoint.
+const MetadataCachedSlug = "checkpoint-cached"
+
+type options struct {
+	resumeFrom []string
+	hashFunc   func(input interface{}) (string, error)
+	onResume   func(checkpoint *Checkpoint)
+}
+
+type Option func(*options)
+
+// WithResumeFrom looks up the checkpoints of previous runs when the current run has none.
+// Checkpoints found in previous runs are copied into the current run.
+func WithResumeFrom(runIDs ...string) Option {
+	return func(o *options) {
+		for _, runID := range runIDs {
+			if runID != "" {
+				o.resumeFrom = append(o.resumeFrom, runID)
+			}
+		}
+	}
+}
+
+// WithHashFunc overrides the hashing of the step input, which by default hashes its JSON serialization.
+// This is useful when the input contains values that change between runs, like IDs or timestamps.
+func WithHashFunc(hashFunc func(input interface{}) (string, error)) Option {
+	return func(o *options) {
+		o.hashFunc = hashFunc
+	}
+}
+
+// WithOnResume registers a callback called when the outputs of a checkpoint are returned
+// instead of running the step, for example to let the user know that the step was skipped.
+func WithOnResume(onResume func(checkpoint *Checkpoint)) Option {
+	return func(o *options) {
+		o.onResume = onResume
+	}
+}
+
+// Step records the outputs of the wrapped step into a Store, and returns the recorded outputs
+// instead of running the step when it is started again with the same input.
+//
+// Only runs that returned all their values without error are recorded, so that a failing step
+// runs again when resuming.
+type Step[T any, U any] struct {
+	step   steps.Step[T, U]
+	store  Store
+	runID  string
+	stepID string
+	options
+}
+
+var _ steps.Step[string, string] = (*Step[string, string])(nil)
+
+// NewStep wraps step. stepID identifies the step within the pipeline and needs to be stable across runs.
+func NewStep[T any, U any](
+	step steps.Step[T, U],
+	store Store,
+	runID string,
+	stepID string,
+	options_ ...Option,
+) *Step[T, U] {
+	ret := &Step[T, U]{
+		step:   step,
+		store:  store,
+		runID:  runID,
+		stepID: stepID,
+		options: options{
+			hashFunc: HashJSON,
+		},
+	}
+	for _, option := range options_ {
+		option(&ret.options)
+	}
+	return ret
+}
+
+func (s *Step[T, U]) AddPublishedTopic(publisher message.Publisher, topic string) error {
+	return s.step.AddPublishedTopic(publisher, topic)
+}
+
+func (s *Step[T, U]) Start(ctx context.Context, input T) (steps.StepResult[U], error) {
+	inputHash, err := s.hashFunc(input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not hash input of step %s", s.stepID)
+	}
+
+	checkpoint, err := s.load(ctx, inputHash)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint != nil {
+		return s.resolveCheckpoint(checkpoint)
+	}
+
+	res, err := s.step.Start(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan helpers.Result[U])
+	go func() {
+		defer close(c)
+
+		outputs := []U{}
+		failed := false
+		for r := range res.GetChannel() {
+			if r.Error() != nil {
+				failed = true
+			} else {
+				outputs = append(outputs, r.Unwrap())
+			}
+			c <- r
+		}
+		if failed || ctx.Err() != nil {
+			return
+		}
+
+		err := s.save(ctx, inputHash, outputs)
+		if err != nil {
+			log.Warn().Err(err).Str("step", s.stepID).Msg("could not save checkpoint")
+		}
+	}()
+
+	return steps.NewStepResult[U](c,
+		steps.WithCancel[U](res.Cancel),
+		steps.WithMetadataFunc[U](res.GetMetadata),
+	), nil
+}
+
+// load returns the checkpoint of the current run, or of the first previous run that has one.
+func (s *Step[T, U]) load(ctx context.Context, inputHash string) (*Checkpoint, error) {
+	for i, runID := range append([]string{s.runID}, s.resumeFrom...) {
+		checkpoint, err := s.store.Load(ctx, runID, s.stepID, inputHash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load checkpoint of step %s", s.stepID)
+		}
+		if checkpoint == nil {
+			continue
+		}
+
+		if i > 0 {
+			// copy the checkpoint into the current run, so that it can be resumed in turn
+			copied := *checkpoint
+			copied.RunID = s.runID
+			err = s.store.Save(ctx, &copied)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not save checkpoint of step %s", s.stepID)
+			}
+		}
+		return checkpoint, nil
+	}
+
+	return nil, nil
+}
+
+func (s *Step[T, U]) save(ctx context.Context, inputHash string, outputs []U) error {
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		return err
+	}
+	return s.store.Save(ctx, &Checkpoint{
+		RunID:     s.runID,
+		StepID:    s.stepID,
+		InputHash: inputHash,
+		CreatedAt: time.Now(),
+		Outputs:   b,
+	})
+}
+
+func (s *Step[T, U]) resolveCheckpoint(checkpoint *Checkpoint) (steps.StepResult[U], error) {
+	outputs := []U{}
+	err := json.Unmarshal(checkpoint.Outputs, &outputs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse checkpoint of step %s", s.stepID)
+	}
+
+	log.Debug().Str("step", s.stepID).Str("run", checkpoint.RunID).Msg("reusing checkpoint")
+	if s.onResume != nil {
+		s.onResume(checkpoint)
+	}
+
+	c := make(chan helpers.Result[U], len(outputs))
+	for _, output := range outputs {
+		c <- helpers.NewValueResult[U](output)
+	}
+	close(c)
+
+	return steps.NewStepResult[U](c,
+		steps.WithMetadata[U](&steps.StepMetadata{
+			Type: "checkpoint",
+			Metadata: map[string]interface{}{
+				MetadataCachedSlug: true,
+				"step":             s.stepID,
+				"run":              checkpoint.RunID,
+				"created_at":       checkpoint.CreatedAt,
+			},
+		}),
+	), nil
+}
@@ -0,0 +1,86 @@
+package checkpoint
+
+import (
+	"context"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/utils"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+// runPipeline runs a two step pipeline doubling its input, then failing if fail is true.
+func runPipeline(
+	t *testing.T,
+	store Store,
+	runID string,
+	resumeFrom string,
+	doubleCalls *int,
+	fail bool,
+) ([]helpers.Result[int], bool) {
+	ctx := context.Background()
+
+	double := NewStep[int, int](&utils.LambdaStep[int, int]{
+		Function: func(input int) helpers.Result[int] {
+			*doubleCalls++
+			return helpers.NewValueResult[int](input * 2)
+		},
+	}, store, runID, "double", WithResumeFrom(resumeFrom))
+
+	resumed := false
+	finish := NewStep[int, int](&utils.LambdaStep[int, int]{
+		Function: func(input int) helpers.Result[int] {
+			if fail {
+				return helpers.NewErrorResult[int](errors.New("failed"))
+			}
+			return helpers.NewValueResult[int](input + 1)
+		},
+	}, store, runID, "finish", WithResumeFrom(resumeFrom), WithOnResume(func(*Checkpoint) {
+		resumed = true
+	}))
+
+	m := steps.Bind[int, int](ctx, steps.Resolve(21), double)
+	res := steps.Bind[int, int](ctx, m, finish).Return()
+	require.Len(t, res, 1)
+	return res, resumed
+}
+
+func testStore(t *testing.T, store Store) {
+	doubleCalls := 0
+
+	res, _ := runPipeline(t, store, "run-1", "", &doubleCalls, true)
+	assert.Error(t, res[0].Error())
+	assert.Equal(t, 1, doubleCalls)
+
+	// the successful step is reused, the failing one runs again
+	res, resumed := runPipeline(t, store, "run-2", "run-1", &doubleCalls, false)
+	require.NoError(t, res[0].Error())
+	assert.Equal(t, 43, res[0].Unwrap())
+	assert.Equal(t, 1, doubleCalls)
+	assert.False(t, resumed)
+
+	// resuming the resumed run reuses both steps, including the one copied from run-1
+	res, resumed = runPipeline(t, store, "run-3", "run-2", &doubleCalls, true)
+	require.NoError(t, res[0].Error())
+	assert.Equal(t, 43, res[0].Unwrap())
+	assert.Equal(t, 1, doubleCalls)
+	assert.True(t, resumed)
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	testStore(t, store)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "checkpoints.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+	testStore(t, store)
+}
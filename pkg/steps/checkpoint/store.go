@@ -0,0 +1,47 @@
+// Package checkpoint persists the outputs of steps, so that a pipeline that failed halfway
+// can be resumed without running the steps that already succeeded again.
+//
+// A checkpoint is keyed by the ID of the run, a stable ID of the step within the pipeline
+// and a hash of the step input. Wrap each step of a pipeline with NewStep:
+//
+//	store, _ := checkpoint.NewFileStore(dir)
+//	extract := checkpoint.NewStep[string, string](extractStep, store, runID, "extract",
+//		checkpoint.WithResumeFrom(previousRunID))
+package checkpoint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Checkpoint holds the recorded outputs of a step for a given input.
+type Checkpoint struct {
+	RunID     string    `json:"run_id"`
+	StepID    string    `json:"step_id"`
+	InputHash string    `json:"input_hash"`
+	CreatedAt time.Time `json:"created_at"`
+	// Outputs is the JSON list of the values returned by the step.
+	Outputs json.RawMessage `json:"outputs"`
+}
+
+// Store persists checkpoints.
+type Store interface {
+	// Load returns the checkpoint recorded for the step and input in the given run,
+	// or nil if there is none.
+	Load(ctx context.Context, runID string, stepID string, inputHash string) (*Checkpoint, error)
+	Save(ctx context.Context, checkpoint *Checkpoint) error
+	Close() error
+}
+
+// HashJSON hashes the JSON serialization of v.
+func HashJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
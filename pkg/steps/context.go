@@ -0,0 +1,62 @@
+package steps
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const (
+	runIDContextKey        contextKey = "run-id"
+	parentStepIDContextKey contextKey = "parent-step-id"
+)
+
+// WithRunID returns a context in which the steps record runID as the RunID of their metadata.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDContextKey, runID)
+}
+
+// GetRunID returns the ID of the run set with WithRunID, or an empty string.
+func GetRunID(ctx context.Context) string {
+	runID, _ := ctx.Value(runIDContextKey).(string)
+	return runID
+}
+
+// WithParentStep returns the context in which a step starts its nested steps,
+// which record the step as their parent.
+func WithParentStep(ctx context.Context, metadata *StepMetadata) context.Context {
+	if metadata == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, parentStepIDContextKey, metadata.StepID)
+}
+
+// GetParentStepID returns the ID of the step set with WithParentStep, or uuid.Nil.
+func GetParentStepID(ctx context.Context) uuid.UUID {
+	parentStepID, _ := ctx.Value(parentStepIDContextKey).(uuid.UUID)
+	return parentStepID
+}
+
+// NewStepMetadata creates the metadata of a step started with ctx, with a new step ID
+// and the parent step and run ID found in ctx.
+func NewStepMetadata(
+	ctx context.Context,
+	type_ string,
+	inputType string,
+	outputType string,
+	metadata map[string]interface{},
+) *StepMetadata {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	return &StepMetadata{
+		StepID:       uuid.New(),
+		ParentStepID: GetParentStepID(ctx),
+		RunID:        GetRunID(ctx),
+		Type:         type_,
+		InputType:    inputType,
+		OutputType:   outputType,
+		Metadata:     metadata,
+	}
+}
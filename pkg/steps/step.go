@@ -16,20 +16,26 @@ type StepResult[T any] interface {
 }
 
 type StepMetadata struct {
-	StepID     uuid.UUID `json:"step_id"`
-	Type       string    `json:"type"`
-	InputType  string    `json:"input_type"`
-	OutputType string    `json:"output_type"`
+	StepID uuid.UUID `json:"step_id"`
+	// ParentStepID is the ID of the step that started this step, uuid.Nil for top-level steps.
+	ParentStepID uuid.UUID `json:"parent_step_id"`
+	// RunID identifies the run the step is part of, if any.
+	RunID      string `json:"run_id,omitempty"`
+	Type       string `json:"type"`
+	InputType  string `json:"input_type"`
+	OutputType string `json:"output_type"`
 
 	Metadata map[string]interface{} `json:"meta"`
 }
 
 func (sm *StepMetadata) ToMap() map[string]interface{} {
 	ret := map[string]interface{}{
-		"step_id":     sm.StepID,
-		"type":        sm.Type,
-		"input_type":  sm.InputType,
-		"output_type": sm.OutputType,
+		"step_id":        sm.StepID,
+		"parent_step_id": sm.ParentStepID,
+		"run_id":         sm.RunID,
+		"type":           sm.Type,
+		"input_type":     sm.InputType,
+		"output_type":    sm.OutputType,
 	}
 
 	for k, v := range sm.Metadata {
@@ -185,7 +191,7 @@ func Bind[T any, U any](
 							continue
 						}
 
-						c_, err := step.Start(ctx, r.Unwrap())
+						c_, err := Start(ctx, step, r.Unwrap())
 						if err != nil {
 							c <- helpers.NewErrorResult[U](err)
 							return
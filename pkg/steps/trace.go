@@ -0,0 +1,126 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/geppetto/pkg/helpers"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used to trace step execution.
+// Spans are only recorded once an application registers a global tracer provider.
+const TracerName = "github.com/go-go-golems/geppetto/pkg/steps"
+
+// MetadataUsageSlug is the StepMetadata.Metadata key under which steps report their token usage, as Usage.
+const MetadataUsageSlug = "usage"
+
+// Usage is the token usage of a step.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Start starts step with input inside a span that lasts until all the results of the step have been read.
+// The span is named after the type of the step, and is the parent of the spans of the steps started
+// with the returned context by the step itself.
+//
+// Steps that start other steps should use Start rather than calling Step.Start directly.
+func Start[T any, U any](ctx context.Context, step Step[T, U], input T) (StepResult[U], error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, fmt.Sprintf("%T", step))
+
+	res, err := step.Start(ctx, input)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	setSpanMetadata(span, res.GetMetadata())
+
+	c := make(chan helpers.Result[U])
+	go func() {
+		defer close(c)
+		defer span.End()
+
+		for r := range res.GetChannel() {
+			if r.Error() != nil {
+				span.RecordError(r.Error())
+				span.SetStatus(codes.Error, r.Error().Error())
+			}
+			c <- r
+		}
+
+		// steps report their usage once they are done
+		setSpanUsage(span, res.GetMetadata())
+	}()
+
+	return NewStepResult[U](c,
+		WithCancel[U](res.Cancel),
+		WithMetadataFunc[U](res.GetMetadata),
+	), nil
+}
+
+func setSpanMetadata(span trace.Span, metadata *StepMetadata) {
+	if metadata == nil || !span.IsRecording() {
+		return
+	}
+
+	if metadata.Type != "" {
+		span.SetName(metadata.Type)
+	}
+	span.SetAttributes(
+		attribute.String("step.id", metadata.StepID.String()),
+		attribute.String("step.type", metadata.Type),
+		attribute.String("step.input_type", metadata.InputType),
+		attribute.String("step.output_type", metadata.OutputType),
+	)
+
+	settings, ok := metadata.Metadata[MetadataSettingsSlug].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, v := range settings {
+		key := "settings." + k
+		switch v_ := v.(type) {
+		case string:
+			span.SetAttributes(attribute.String(key, v_))
+		case bool:
+			span.SetAttributes(attribute.Bool(key, v_))
+		case int:
+			span.SetAttributes(attribute.Int(key, v_))
+		case float64:
+			span.SetAttributes(attribute.Float64(key, v_))
+		case []string:
+			span.SetAttributes(attribute.StringSlice(key, v_))
+		default:
+			span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+}
+
+func setSpanUsage(span trace.Span, metadata *StepMetadata) {
+	if metadata == nil || !span.IsRecording() {
+		return
+	}
+	usage, ok := metadata.Metadata[MetadataUsageSlug].(Usage)
+	if !ok {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("usage.input_tokens", usage.InputTokens),
+		attribute.Int("usage.output_tokens", usage.OutputTokens),
+	)
+}
+
+// RecordPartial records a partial result of the step running in ctx as an event of its span.
+func RecordPartial(ctx context.Context, delta string) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.AddEvent("partial", trace.WithAttributes(attribute.Int("delta.length", len(delta))))
+}
@@ -0,0 +1,84 @@
+package steps
+
+import (
+	"context"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+// testStep records a partial and returns its input with a suffix, starting next on the result if set.
+type testStep struct {
+	type_ string
+	next  Step[string, string]
+	err   error
+}
+
+func (t *testStep) Start(ctx context.Context, input string) (StepResult[string], error) {
+	metadata := &StepMetadata{
+		Type: t.type_,
+		Metadata: map[string]interface{}{
+			MetadataSettingsSlug: map[string]interface{}{"ai-engine": "test-engine"},
+			MetadataUsageSlug:    Usage{InputTokens: 3, OutputTokens: 5},
+		},
+	}
+	RecordPartial(ctx, input)
+	if t.err != nil {
+		return Reject[string](t.err, WithMetadata[string](metadata)), nil
+	}
+	res := Resolve(input+"-"+t.type_, WithMetadata[string](metadata))
+	if t.next == nil {
+		return res, nil
+	}
+	return NewStepResult[string](Bind[string, string](ctx, res, t.next).GetChannel(), WithMetadata[string](metadata)), nil
+}
+
+func (t *testStep) AddPublishedTopic(publisher message.Publisher, topic string) error {
+	return nil
+}
+
+func TestStartNestsSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	step := &testStep{
+		type_: "outer",
+		next:  &testStep{type_: "inner", err: errors.New("inner failed")},
+	}
+	res, err := Start[string, string](context.Background(), step, "input")
+	require.NoError(t, err)
+	results := res.Return()
+	require.Len(t, results, 1)
+	assert.Error(t, results[0].Error())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	inner, outer := spans[0], spans[1]
+
+	assert.Equal(t, "outer", outer.Name())
+	assert.Equal(t, "inner", inner.Name())
+	assert.Equal(t, outer.SpanContext().SpanID(), inner.Parent().SpanID())
+
+	assert.Equal(t, codes.Error, inner.Status().Code)
+	// the error of the inner step is returned as a result of the outer step
+	assert.Equal(t, codes.Error, outer.Status().Code)
+
+	attributes := map[string]interface{}{}
+	for _, kv := range outer.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, "test-engine", attributes["settings.ai-engine"])
+	assert.Equal(t, int64(5), attributes["usage.output_tokens"])
+
+	require.NotEmpty(t, outer.Events())
+	assert.Equal(t, "partial", outer.Events()[0].Name)
+}
@@ -20,7 +20,7 @@ func (c *ChainStep[T, U, V]) Start(ctx context.Context, input T) (steps.StepResu
 	if err != nil {
 		return nil, err
 	}
-	v, err := stepA.Start(ctx, input)
+	v, err := steps.Start(ctx, stepA, input)
 	if err != nil {
 		return nil, err
 	}
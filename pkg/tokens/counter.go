@@ -0,0 +1,77 @@
+package tokens
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+)
+
+// tokensPerTool approximates the overhead of the formatting of each tool definition, whose name,
+// description and parameters are counted from their JSON serialization.
+const tokensPerTool = 8
+
+// Counter counts the tokens of conversations, including the overhead of each message and of
+// the reply, as sent to a model.
+type Counter struct {
+	Tokenizer Tokenizer
+	// TokensPerMessage is the overhead of the role and delimiters of each message.
+	TokensPerMessage int
+	// TokensPerReply is the overhead priming the answer of the model.
+	TokensPerReply int
+}
+
+// NewCounter returns the counter of engine, whose counts are estimates for the models
+// whose tokenizer isn't known.
+func NewCounter(engine string) (*Counter, error) {
+	tokenizer_, err := ForEngine(engine)
+	if err != nil {
+		return nil, err
+	}
+	f := getFamily(engine)
+	return &Counter{
+		Tokenizer:        tokenizer_,
+		TokensPerMessage: f.tokensPerMessage,
+		TokensPerReply:   f.tokensPerReply,
+	}, nil
+}
+
+// CountMessage counts the content of msg and its overhead.
+func (c *Counter) CountMessage(msg *conversation.Message) int {
+	return c.Tokenizer.Count(msg.Content.String()) + c.TokensPerMessage
+}
+
+// CountMessages counts the messages and their overhead, without the reply overhead.
+func (c *Counter) CountMessages(messages conversation.Conversation) int {
+	ret := 0
+	for _, msg := range messages {
+		ret += c.CountMessage(msg)
+	}
+	return ret
+}
+
+// CountConversation counts the prompt sent to the model for the conversation.
+func (c *Counter) CountConversation(messages conversation.Conversation) int {
+	return c.CountMessages(messages) + c.TokensPerReply
+}
+
+// CountTool counts the definition of a tool offered to the model.
+func (c *Counter) CountTool(tool tools.Tool) int {
+	b, err := json.Marshal(map[string]interface{}{
+		"name":        tool.GetName(),
+		"description": tool.GetDescription(),
+		"parameters":  tool.GetParameters(),
+	})
+	if err != nil {
+		return c.Tokenizer.Count(tool.GetName()+tool.GetDescription()+string(tool.GetParameters())) + tokensPerTool
+	}
+	return c.Tokenizer.Count(string(b)) + tokensPerTool
+}
+
+// CountTools counts the definitions of the tools offered to the model.
+func (c *Counter) CountTools(tools_ []tools.Tool) int {
+	ret := 0
+	for _, tool := range tools_ {
+		ret += c.CountTool(tool)
+	}
+	return ret
+}
@@ -0,0 +1,48 @@
+package tokens
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	messages := conversation.Conversation{
+		conversation.NewChatMessage(conversation.RoleSystem, "You are a helpful assistant."),
+		conversation.NewChatMessage(conversation.RoleUser, "hello world"),
+	}
+
+	counter, err := NewCounter("gpt-4")
+	require.NoError(t, err)
+	assert.True(t, counter.Tokenizer.Exact())
+	assert.Equal(t, "cl100k_base", counter.Tokenizer.Name())
+	assert.Equal(t, 2, counter.Tokenizer.Count("hello world"))
+	// 6 and 2 tokens, 3 per message and 3 for the reply
+	assert.Equal(t, 6+3+2+3+3, counter.CountConversation(messages))
+
+	claude, err := NewCounter("claude-3-5-sonnet-20240620")
+	require.NoError(t, err)
+	assert.False(t, claude.Tokenizer.Exact())
+	long := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20)
+	assert.Greater(t, claude.Tokenizer.Count(long), counter.Tokenizer.Count(long))
+
+	// unknown models are estimated
+	local, err := NewCounter("my-local-model")
+	require.NoError(t, err)
+	assert.False(t, local.Tokenizer.Exact())
+
+	truncated := counter.Tokenizer.Truncate(long, 10)
+	assert.True(t, strings.HasPrefix(long, truncated))
+	assert.Equal(t, 10, counter.Tokenizer.Count(truncated))
+
+	tool := &tools.ToolFunc{
+		Name:        "get_weather",
+		Description: "Get the weather of a city",
+		Parameters:  json.RawMessage(`{"type": "object", "properties": {"city": {"type": "string"}}}`),
+	}
+	assert.Greater(t, counter.CountTools([]tools.Tool{tool}), counter.Tokenizer.Count("get_weather Get the weather of a city"))
+}
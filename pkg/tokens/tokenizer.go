@@ -0,0 +1,141 @@
+// Package tokens counts the tokens of conversations as the providers do, to check them against
+// the context window of a model or estimate their cost before sending them.
+//
+// The OpenAI engines are counted with their tiktoken codec. The other providers don't publish
+// their tokenizers, and are estimated with cl100k_base, scaled by a factor calibrated for the
+// model family. Counter adds the overhead of the roles, delimiters and tool definitions.
+package tokens
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/tiktoken-go/tokenizer"
+	"math"
+	"strings"
+)
+
+// Tokenizer counts the tokens of texts.
+type Tokenizer interface {
+	// Name is the name of the codec, followed by the estimation factor for estimates.
+	Name() string
+	// Exact is false if the counts are estimates.
+	Exact() bool
+	Count(text string) int
+	// Truncate returns the beginning of text that has at most maxTokens tokens.
+	Truncate(text string, maxTokens int) string
+}
+
+// codecTokenizer counts with a tiktoken codec, scaled by factor for estimates.
+type codecTokenizer struct {
+	codec  tokenizer.Codec
+	factor float64
+	exact  bool
+}
+
+var _ Tokenizer = (*codecTokenizer)(nil)
+
+func (c *codecTokenizer) Name() string {
+	if c.exact {
+		return c.codec.GetName()
+	}
+	return c.codec.GetName() + " (estimate)"
+}
+
+func (c *codecTokenizer) Exact() bool {
+	return c.exact
+}
+
+func (c *codecTokenizer) encode(text string) []uint {
+	ids, _, err := c.codec.Encode(text)
+	if err != nil {
+		// the codecs only fail on invalid input, count about 4 characters per token
+		log.Warn().Err(err).Msg("could not encode text, estimating its tokens")
+		return make([]uint, len(text)/4)
+	}
+	return ids
+}
+
+func (c *codecTokenizer) Count(text string) int {
+	return int(math.Ceil(float64(len(c.encode(text))) * c.factor))
+}
+
+func (c *codecTokenizer) Truncate(text string, maxTokens int) string {
+	ids := c.encode(text)
+	n := int(float64(maxTokens) / c.factor)
+	if len(ids) <= n {
+		return text
+	}
+	ret, err := c.codec.Decode(ids[:n])
+	if err != nil {
+		log.Warn().Err(err).Msg("could not decode tokens, truncating by characters")
+		return text[:min(len(text), n*4)]
+	}
+	return ret
+}
+
+// family holds the tokenizer and the message overhead of a family of models.
+type family struct {
+	prefixes []string
+	encoding tokenizer.Encoding
+	// factor scales the counts of the encoding for the models with another tokenizer.
+	factor float64
+	exact  bool
+	// tokensPerMessage counts the role and delimiters around each message, and tokensPerReply
+	// the tokens priming the answer.
+	tokensPerMessage int
+	tokensPerReply   int
+}
+
+// families are matched in order by engine name prefix.
+var families = []family{
+	// gpt-4o, gpt-4.1 and the o-series use o200k_base, which tokenizes English like cl100k_base
+	{prefixes: []string{"gpt-4o", "gpt-4.1", "o1", "o3", "o4"}, encoding: tokenizer.Cl100kBase, factor: 1, tokensPerMessage: 3, tokensPerReply: 3},
+	{prefixes: []string{"gpt-4", "gpt-3.5-turbo", "text-embedding"}, encoding: tokenizer.Cl100kBase, factor: 1, exact: true, tokensPerMessage: 3, tokensPerReply: 3},
+	// the Claude tokenizer produces about 15% more tokens than cl100k_base on English and code
+	{prefixes: []string{"claude"}, encoding: tokenizer.Cl100kBase, factor: 1.15, tokensPerMessage: 4, tokensPerReply: 3},
+	// the Llama 3 tokenizer is derived from cl100k_base, with <|start_header_id|>role<|end_header_id|> and <|eot_id|> around messages
+	{prefixes: []string{"llama3", "llama-3", "meta-llama-3", "meta-llama/llama-3", "meta-llama/meta-llama-3"}, encoding: tokenizer.Cl100kBase, factor: 1, tokensPerMessage: 5, tokensPerReply: 4},
+	// the sentencepiece tokenizers of Llama 2 and Mistral produce about 20% more tokens, with [INST] and [/INST] around messages
+	{prefixes: []string{"llama", "meta-llama", "codellama", "mistral", "mixtral", "open-mistral", "open-mixtral"}, encoding: tokenizer.Cl100kBase, factor: 1.2, tokensPerMessage: 4, tokensPerReply: 0},
+}
+
+// defaultFamily estimates the unknown models with cl100k_base.
+var defaultFamily = family{encoding: tokenizer.Cl100kBase, factor: 1, tokensPerMessage: 3, tokensPerReply: 3}
+
+func getFamily(engine string) family {
+	engine = strings.ToLower(engine)
+	for _, f := range families {
+		for _, prefix := range f.prefixes {
+			if strings.HasPrefix(engine, prefix) {
+				return f
+			}
+		}
+	}
+	return defaultFamily
+}
+
+func (f family) newTokenizer() (Tokenizer, error) {
+	codec, err := tokenizer.Get(f.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &codecTokenizer{codec: codec, factor: f.factor, exact: f.exact}, nil
+}
+
+// ForEngine returns the tokenizer of engine, which is an estimate for the models whose tokenizer isn't known.
+func ForEngine(engine string) (Tokenizer, error) {
+	// the older OpenAI models have their own codecs
+	if codec, err := tokenizer.ForModel(tokenizer.Model(engine)); err == nil {
+		return &codecTokenizer{codec: codec, factor: 1, exact: true}, nil
+	}
+	return getFamily(engine).newTokenizer()
+}
+
+// ForEncoding returns the tokenizer of a tiktoken encoding, for example cl100k_base.
+func ForEncoding(encoding string) (Tokenizer, error) {
+	codec, err := tokenizer.Get(tokenizer.Encoding(encoding))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unknown encoding %s", encoding)
+	}
+	return &codecTokenizer{codec: codec, factor: 1, exact: true}, nil
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"context"
+	"fmt"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/charmbracelet/bubbletea"
 	boba_chat "github.com/go-go-golems/bobatea/pkg/chat"
@@ -11,6 +12,7 @@ import (
 	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"strings"
 )
 
 type StepBackend struct {
@@ -23,7 +25,7 @@ func (s *StepBackend) Start(ctx context.Context, msgs []*conversation.Message) (
 		return nil, errors.New("Step is already running")
 	}
 
-	stepResult, err := s.stepFactory.Start(ctx, msgs)
+	stepResult, err := steps.Start[conversation.Conversation, string](ctx, s.stepFactory, msgs)
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +52,15 @@ func NewStepBackend(step chat.Step) *StepBackend {
 	}
 }
 
+// SetStep replaces the step used for the next completions, for example to switch to another model.
+func (s *StepBackend) SetStep(step chat.Step) error {
+	if !s.IsFinished() {
+		return errors.New("Step is already running")
+	}
+	s.stepFactory = step
+	return nil
+}
+
 func (s *StepBackend) Interrupt() {
 	if s.stepResult != nil {
 		s.stepResult.Cancel()
@@ -73,14 +84,63 @@ func (s *StepBackend) IsFinished() bool {
 
 var _ boba_chat.Backend = &StepBackend{}
 
+// toolMessage collects the tool calls and results streamed into a message, so that
+// they can be rendered as part of the message text.
+type toolMessage struct {
+	content   string
+	callIDs   []string
+	calls     map[string]string
+	names     map[string]string
+	indexToID map[int]string
+	results   []string
+}
+
+func (t *toolMessage) setCall(id string, rendered string) {
+	if _, ok := t.calls[id]; !ok {
+		t.callIDs = append(t.callIDs, id)
+	}
+	t.calls[id] = rendered
+}
+
+func (t *toolMessage) render() string {
+	// the final text of a tool execution is the JSON of all the results, which we render individually
+	if len(t.results) > 0 {
+		return strings.Join(t.results, "\n")
+	}
+
+	lines := []string{}
+	if t.content != "" {
+		lines = append(lines, t.content)
+	}
+	for _, id := range t.callIDs {
+		lines = append(lines, t.calls[id])
+	}
+	return strings.Join(lines, "\n")
+}
+
 func StepChatForwardFunc(p *tea.Program) func(msg *message.Message) error {
+	toolMessages := map[conversation.NodeID]*toolMessage{}
+	getToolMessage := func(id conversation.NodeID) *toolMessage {
+		ret, ok := toolMessages[id]
+		if !ok {
+			ret = &toolMessage{
+				calls:     map[string]string{},
+				names:     map[string]string{},
+				indexToID: map[int]string{},
+			}
+			toolMessages[id] = ret
+		}
+		return ret
+	}
+
 	return func(msg *message.Message) error {
 		msg.Ack()
 
-		e, err := chat.NewEventFromJson(msg.Payload)
+		typedEvent, err := chat.DecodeEvent(msg.Payload)
 		if err != nil {
 			return err
 		}
+		e := typedEvent.GetEvent()
 
 		metadata := conversation2.StreamMetadata{
 			ID:       e.Metadata.ID,
@@ -93,39 +153,109 @@ func StepChatForwardFunc(p *tea.Program) func(msg *message.Message) error {
 				Metadata:   e.Step.Metadata,
 			},
 		}
+		toolMessage, hasToolMessage := toolMessages[e.Metadata.ID]
+
 		switch e.Type {
 		case chat.EventTypeError:
+			delete(toolMessages, e.Metadata.ID)
+			var err error = errors.New("unknown error")
+			if e.Error != nil {
+				err = e.Error
+			}
 			p.Send(conversation2.StreamCompletionError{
 				StreamMetadata: metadata,
-				Err:            e.Error,
+				Err:            err,
 			})
 		case chat.EventTypePartial:
-			p_, ok := e.ToPartialCompletion()
+			p_, ok := typedEvent.(*chat.EventPartialCompletion)
 			if !ok {
 				return errors.New("payload is not of type EventPartialCompletionPayload")
 			}
+			completion := p_.Completion
+			if hasToolMessage {
+				toolMessage.content = p_.Completion
+				completion = toolMessage.render()
+			}
 			p.Send(conversation2.StreamCompletionMsg{
 				StreamMetadata: metadata,
 				Delta:          p_.Delta,
-				Completion:     p_.Completion,
+				Completion:     completion,
+			})
+		case chat.EventTypeToolCallDelta:
+			p_, ok := typedEvent.(*chat.EventToolCallDelta)
+			if !ok {
+				return errors.New("payload is not of type EventToolCallDelta")
+			}
+			toolMessage := getToolMessage(e.Metadata.ID)
+			id, ok := toolMessage.indexToID[p_.Index]
+			if !ok {
+				id = p_.ID
+				if id == "" {
+					id = fmt.Sprintf("%d", p_.Index)
+				}
+				toolMessage.indexToID[p_.Index] = id
+			}
+			// only the first delta of a call contains its name
+			if p_.Name != "" {
+				toolMessage.names[id] = p_.Name
+			}
+			toolMessage.setCall(id, fmt.Sprintf("→ %s(%s", toolMessage.names[id], p_.Arguments))
+			p.Send(conversation2.StreamCompletionMsg{
+				StreamMetadata: metadata,
+				Delta:          p_.Delta,
+				Completion:     toolMessage.render(),
+			})
+		case chat.EventTypeToolCall:
+			p_, ok := typedEvent.(*chat.EventToolCall)
+			if !ok {
+				return errors.New("payload is not of type EventToolCall")
+			}
+			toolMessage := getToolMessage(e.Metadata.ID)
+			toolMessage.setCall(p_.ID, chat.FormatToolCall(p_.Name, p_.Arguments, p_.RawArguments))
+			p.Send(conversation2.StreamCompletionMsg{
+				StreamMetadata: metadata,
+				Completion:     toolMessage.render(),
+			})
+		case chat.EventTypeToolResult:
+			p_, ok := typedEvent.(*chat.EventToolResult)
+			if !ok {
+				return errors.New("payload is not of type EventToolResult")
+			}
+			toolMessage := getToolMessage(e.Metadata.ID)
+			toolMessage.results = append(toolMessage.results, chat.FormatToolResult(p_.Name, p_.Result, p_.ToolError))
+			p.Send(conversation2.StreamCompletionMsg{
+				StreamMetadata: metadata,
+				Completion:     toolMessage.render(),
 			})
 		case chat.EventTypeFinal:
-			p_, ok := e.ToText()
+			p_, ok := typedEvent.(*chat.EventText)
 			if !ok {
 				return errors.New("payload is not of type EventTextPayload")
 			}
+			completion := p_.Text
+			if hasToolMessage {
+				toolMessage.content = p_.Text
+				completion = toolMessage.render()
+				delete(toolMessages, e.Metadata.ID)
+			}
 			p.Send(conversation2.StreamDoneMsg{
 				StreamMetadata: metadata,
-				Completion:     p_.Text,
+				Completion:     completion,
 			})
 		case chat.EventTypeInterrupt:
-			p_, ok := e.ToText()
+			p_, ok := typedEvent.(*chat.EventText)
 			if !ok {
 				return errors.New("payload is not of type EventTextPayload")
 			}
+			completion := p_.Text
+			if hasToolMessage {
+				toolMessage.content = p_.Text
+				completion = toolMessage.render()
+				delete(toolMessages, e.Metadata.ID)
+			}
 			p.Send(conversation2.StreamDoneMsg{
 				StreamMetadata: metadata,
-				Completion:     p_.Text,
+				Completion:     completion,
 			})
 
 		case chat.EventTypeStart:
@@ -134,7 +264,7 @@ func StepChatForwardFunc(p *tea.Program) func(msg *message.Message) error {
 			})
 
 		case chat.EventTypeStatus:
-			p_, ok := e.ToText()
+			p_, ok := typedEvent.(*chat.EventText)
 			if !ok {
 				return errors.New("payload is not of type EventTextPayload")
 			}
@@ -0,0 +1,309 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	boba_chat "github.com/go-go-golems/bobatea/pkg/chat"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/bobatea/pkg/textarea"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type BranchingKeyMap struct {
+	Regenerate     key.Binding
+	EditMessage    key.Binding
+	PreviousBranch key.Binding
+	NextBranch     key.Binding
+	SubmitEdit     key.Binding
+	CancelEdit     key.Binding
+	Interrupt      key.Binding
+}
+
+var DefaultBranchingKeyMap = BranchingKeyMap{
+	Regenerate: key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("ctrl+r", "regenerate answer"),
+	),
+	EditMessage: key.NewBinding(
+		key.WithKeys("ctrl+o"),
+		key.WithHelp("ctrl+o", "edit message"),
+	),
+	PreviousBranch: key.NewBinding(
+		key.WithKeys("ctrl+left", "alt+,"),
+		key.WithHelp("ctrl+←", "previous branch"),
+	),
+	NextBranch: key.NewBinding(
+		key.WithKeys("ctrl+right", "alt+."),
+		key.WithHelp("ctrl+→", "next branch"),
+	),
+	SubmitEdit: key.NewBinding(
+		key.WithKeys("tab"),
+		key.WithHelp("tab", "submit edit"),
+	),
+	CancelEdit: key.NewBinding(
+		key.WithKeys("esc", "ctrl+g"),
+		key.WithHelp("esc", "cancel edit"),
+	),
+	Interrupt: key.NewBinding(
+		key.WithKeys("esc", "ctrl+g"),
+		key.WithHelp("esc", "cancel completion"),
+	),
+}
+
+// BranchingModel wraps the bobatea chat model to regenerate answers and edit previous user messages
+// as new branches of the conversation tree, and to switch between sibling branches.
+//
+// The wrapped model renders the current conversation of the manager, which is also the
+// conversation sent to the backend.
+type BranchingModel struct {
+	model   tea.Model
+	manager *conversations.BranchingManager
+	backend boba_chat.Backend
+	keyMap  BranchingKeyMap
+
+	// editing is the user message being edited, nil when not editing
+	editing *conversation.Message
+	editor  textarea.Model
+	// generating is true while a completion started by the branching model is running,
+	// as the wrapped model doesn't know about it
+	generating bool
+	err        error
+	// output is the output of the last slash command
+	output string
+
+	width  int
+	height int
+}
+
+func NewBranchingModel(
+	manager *conversations.BranchingManager,
+	backend boba_chat.Backend,
+	options ...boba_chat.ModelOption,
+) BranchingModel {
+	editor := textarea.New()
+	editor.CharLimit = 20000
+	editor.MaxHeight = 500
+
+	return BranchingModel{
+		model:   boba_chat.InitialModel(manager, backend, options...),
+		manager: manager,
+		backend: backend,
+		keyMap:  DefaultBranchingKeyMap,
+		editor:  editor,
+	}
+}
+
+func (m BranchingModel) Init() tea.Cmd {
+	return m.model.Init()
+}
+
+func (m BranchingModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+
+	switch msg_ := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg_.Width
+		m.height = msg_.Height
+		m.editor.SetWidth(m.width - 2)
+		return m, m.resize()
+
+	case boba_chat.BackendFinishedMsg:
+		m.generating = false
+
+	case SlashCommandOutputMsg:
+		m.err = msg_.Err
+		m.output = msg_.Text
+		return m, m.resize()
+
+	case InjectMessagesMsg:
+		m.manager.AppendMessages(msg_.Messages...)
+		return m, m.resize()
+
+	case tea.KeyMsg:
+		if m.editing != nil {
+			return m.updateEditor(msg_)
+		}
+		if m.err != nil || m.output != "" {
+			m.err = nil
+			m.output = ""
+			// the wrapped model gets the space of the output back
+			cmds = append(cmds, m.resize())
+		}
+
+		switch {
+		case m.generating && key.Matches(msg_, m.keyMap.Interrupt):
+			m.backend.Interrupt()
+			return m, nil
+		case key.Matches(msg_, m.keyMap.Regenerate):
+			return m, m.regenerate()
+		case key.Matches(msg_, m.keyMap.EditMessage):
+			m.startEditing(nil)
+			return m, tea.Batch(m.editor.Focus(), m.resize())
+		case key.Matches(msg_, m.keyMap.PreviousBranch):
+			m.manager.SwitchBranch(-1)
+			return m, m.resize()
+		case key.Matches(msg_, m.keyMap.NextBranch):
+			m.manager.SwitchBranch(1)
+			return m, m.resize()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.model, cmd = m.model.Update(msg)
+	return m, tea.Batch(append(cmds, cmd)...)
+}
+
+func (m BranchingModel) updateEditor(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keyMap.CancelEdit):
+		m.editing = nil
+		return m, m.resize()
+
+	case key.Matches(msg, m.keyMap.EditMessage):
+		// edit the user message before the one being edited
+		m.startEditing(m.editing)
+		return m, nil
+
+	case key.Matches(msg, m.keyMap.SubmitEdit):
+		return m, m.submitEdit()
+	}
+
+	var cmd tea.Cmd
+	m.editor, cmd = m.editor.Update(msg)
+	return m, tea.Batch(cmd, m.resize())
+}
+
+// startEditing edits the last user message of the current conversation before the message before,
+// or the last user message if before is nil.
+func (m *BranchingModel) startEditing(before *conversation.Message) {
+	thread := m.manager.GetConversation()
+	end := len(thread)
+	if before != nil {
+		for i, msg := range thread {
+			if msg.ID == before.ID {
+				end = i
+			}
+		}
+	}
+
+	for i := end - 1; i >= 0; i-- {
+		if content, ok := thread[i].Content.(*conversation.ChatMessageContent); ok && content.Role == conversation.RoleUser {
+			m.editing = thread[i]
+			m.editor.SetValue(content.Text)
+			return
+		}
+	}
+
+	if before == nil {
+		m.err = errors.New("no user message to edit")
+	}
+}
+
+// regenerate starts a new answer to the question of the last answer, as a sibling of the last answer.
+func (m *BranchingModel) regenerate() tea.Cmd {
+	if !m.backend.IsFinished() {
+		m.err = errors.New("already streaming")
+		return nil
+	}
+
+	thread := m.manager.GetConversation()
+	if len(thread) == 0 {
+		return nil
+	}
+	last := thread[len(thread)-1]
+	if content, ok := last.Content.(*conversation.ChatMessageContent); ok && content.Role == conversation.RoleAssistant {
+		m.manager.Fork(last.ParentID)
+	}
+
+	return m.start()
+}
+
+// submitEdit adds the edited message as a sibling of the original message, and starts a new answer.
+func (m *BranchingModel) submitEdit() tea.Cmd {
+	if !m.backend.IsFinished() {
+		m.err = errors.New("already streaming")
+		return nil
+	}
+
+	original := m.editing
+	m.editing = nil
+	content, _ := original.Content.(*conversation.ChatMessageContent)
+	m.manager.Fork(original.ParentID)
+	m.manager.AppendMessages(conversation.NewChatMessage(content.Role, m.editor.Value()))
+	m.editor.SetValue("")
+
+	return m.start()
+}
+
+func (m *BranchingModel) start() tea.Cmd {
+	cmd, err := m.backend.Start(context.Background(), m.manager.GetConversation())
+	if err != nil {
+		m.err = err
+		return m.resize()
+	}
+	m.generating = true
+	return tea.Batch(cmd, m.resize())
+}
+
+// resize gives the wrapped model the space left by the status line and the editor,
+// which also makes it render the current conversation again.
+func (m *BranchingModel) resize() tea.Cmd {
+	height := m.height - lipgloss.Height(m.statusView())
+	if m.output != "" {
+		height -= lipgloss.Height(m.output)
+	}
+	if m.editing != nil {
+		height -= lipgloss.Height(m.editorView())
+	}
+	if height < 0 {
+		height = 0
+	}
+
+	var cmd tea.Cmd
+	m.model, cmd = m.model.Update(tea.WindowSizeMsg{Width: m.width, Height: height})
+	return cmd
+}
+
+func (m BranchingModel) statusView() string {
+	parts := []string{}
+	if m.err != nil {
+		parts = append(parts, "error: "+m.err.Error())
+	}
+	if branch, ok := m.manager.CurrentBranch(); ok {
+		role := "message"
+		if content, ok := branch.Message.Content.(*conversation.ChatMessageContent); ok {
+			role = string(content.Role)
+		}
+		parts = append(parts, fmt.Sprintf("%s branch %d/%d", role, branch.Index+1, branch.Count))
+	}
+	for _, binding := range []key.Binding{m.keyMap.Regenerate, m.keyMap.EditMessage, m.keyMap.PreviousBranch, m.keyMap.NextBranch} {
+		parts = append(parts, binding.Help().Key+" "+binding.Help().Desc)
+	}
+	style := lipgloss.NewStyle().Faint(true)
+	if m.width > 0 {
+		// a single line, so that the height left to the wrapped model is right
+		style = style.MaxWidth(m.width)
+	}
+	return style.Render(strings.Join(parts, " • "))
+}
+
+func (m BranchingModel) editorView() string {
+	header := "editing message, tab to submit as a new branch, ctrl+o for the previous message, esc to cancel"
+	return header + "\n" + lipgloss.NewStyle().Border(lipgloss.NormalBorder()).Render(m.editor.View())
+}
+
+func (m BranchingModel) View() string {
+	ret := m.model.View()
+	if m.editing != nil {
+		ret += "\n" + m.editorView()
+	}
+	if m.output != "" {
+		ret += "\n" + m.output
+	}
+	return ret + "\n" + m.statusView()
+}
@@ -0,0 +1,235 @@
+package ui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/go-go-golems/geppetto/pkg/steps"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// REPL is a line-oriented chat, reading the user messages from an input and running the step
+// for each of them. It doesn't print the answers itself: the step is expected to publish its
+// events to a printer writing to the same output, for example chat.StepPrinterFunc.
+type REPL struct {
+	step     chat.Step
+	manager  *conversations.BranchingManager
+	commands *SlashCommands
+
+	in     io.Reader
+	out    io.Writer
+	errOut io.Writer
+	// prompt is written to errOut before each message, so that it doesn't mix with the answers
+	prompt string
+	// delimiter is the line ending a multi-line message. If empty, every line is a message.
+	delimiter string
+	// onTurn is called after each answer, and after each slash command
+	onTurn func()
+}
+
+type REPLOption func(*REPL)
+
+func WithREPLInput(in io.Reader) REPLOption {
+	return func(r *REPL) {
+		r.in = in
+	}
+}
+
+func WithREPLOutput(out io.Writer, errOut io.Writer) REPLOption {
+	return func(r *REPL) {
+		r.out = out
+		r.errOut = errOut
+	}
+}
+
+func WithREPLPrompt(prompt string) REPLOption {
+	return func(r *REPL) {
+		r.prompt = prompt
+	}
+}
+
+// WithREPLDelimiter makes messages span several lines, until a line equal to delimiter.
+func WithREPLDelimiter(delimiter string) REPLOption {
+	return func(r *REPL) {
+		r.delimiter = delimiter
+	}
+}
+
+// WithREPLSlashCommands runs the messages starting with a slash as slash commands.
+func WithREPLSlashCommands(commands *SlashCommands) REPLOption {
+	return func(r *REPL) {
+		r.commands = commands
+	}
+}
+
+// WithREPLOnTurn calls f after each answer and slash command, for example to save the conversation.
+func WithREPLOnTurn(f func()) REPLOption {
+	return func(r *REPL) {
+		r.onTurn = f
+	}
+}
+
+func NewREPL(step chat.Step, manager *conversations.BranchingManager, options ...REPLOption) *REPL {
+	ret := &REPL{
+		step:    step,
+		manager: manager,
+		in:      os.Stdin,
+		out:     os.Stdout,
+		errOut:  os.Stderr,
+		prompt:  "> ",
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+// SetStep replaces the step used for the next answers.
+func (r *REPL) SetStep(step chat.Step) error {
+	r.step = step
+	return nil
+}
+
+// Run reads messages until the end of the input, or until ctx is cancelled.
+func (r *REPL) Run(ctx context.Context) error {
+	scanner := bufio.NewScanner(r.in)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		r.writePrompt()
+		text, ok := r.readMessage(scanner)
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		if strings.TrimSpace(text) != "" {
+			err := r.handleMessage(ctx, text)
+			if err != nil {
+				_, _ = fmt.Fprintf(r.errOut, "error: %s\n", err)
+			}
+			if r.onTurn != nil {
+				r.onTurn()
+			}
+		}
+		if !ok {
+			return nil
+		}
+	}
+}
+
+func (r *REPL) writePrompt() {
+	if r.prompt != "" {
+		_, _ = fmt.Fprint(r.errOut, r.prompt)
+	}
+}
+
+// readMessage reads the next message, and returns false once the input is done.
+func (r *REPL) readMessage(scanner *bufio.Scanner) (string, bool) {
+	if r.delimiter == "" {
+		if !scanner.Scan() {
+			return "", false
+		}
+		return scanner.Text(), true
+	}
+
+	lines := []string{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == r.delimiter {
+			return strings.Join(lines, "\n"), true
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), false
+}
+
+func (r *REPL) handleMessage(ctx context.Context, text string) error {
+	if r.commands != nil && strings.HasPrefix(text, "/") {
+		if !IsSlashCommand(text) {
+			text = text[1:]
+		} else {
+			cmd, err := r.commands.Run(ctx, text)
+			if err != nil {
+				return err
+			}
+			return r.handleCmd(cmd)
+		}
+	}
+
+	msg := conversation.NewChatMessage(conversation.RoleUser, text)
+	r.manager.AppendMessages(msg)
+
+	answer, err := r.complete(ctx)
+	if err != nil {
+		// the message can be sent again, without the failed attempt in the conversation
+		_ = r.manager.Remove(msg.ID)
+		return err
+	}
+	r.manager.AppendMessages(conversation.NewChatMessage(conversation.RoleAssistant, answer))
+	return nil
+}
+
+func (r *REPL) complete(ctx context.Context) (string, error) {
+	result, err := steps.Start[conversation.Conversation, string](ctx, r.step, r.manager.GetConversation())
+	if err != nil {
+		return "", err
+	}
+
+	answer := ""
+	for v := range result.GetChannel() {
+		s, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		answer += s
+	}
+	return answer, nil
+}
+
+// handleCmd runs the command returned by a slash command, in the same way as the chat UI.
+func (r *REPL) handleCmd(cmd tea.Cmd) error {
+	if cmd == nil {
+		return nil
+	}
+
+	switch msg := cmd().(type) {
+	case SlashCommandOutputMsg:
+		if msg.Err != nil {
+			return msg.Err
+		}
+		_, err := fmt.Fprintln(r.out, msg.Text)
+		return err
+
+	case InjectMessagesMsg:
+		r.manager.AppendMessages(msg.Messages...)
+		for _, msg_ := range msg.Messages {
+			_, err := fmt.Fprintln(r.out, msg_.Content.String())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case tea.BatchMsg:
+		for _, cmd_ := range msg {
+			err := r.handleCmd(cmd_)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return errors.Errorf("unsupported slash command result %T", msg)
+	}
+}
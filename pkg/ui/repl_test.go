@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/go-go-golems/geppetto/pkg/steps/ai/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func texts(c conversation.Conversation) []string {
+	ret := []string{}
+	for _, msg := range c {
+		ret = append(ret, msg.Content.String())
+	}
+	return ret
+}
+
+func TestREPL(t *testing.T) {
+	step := chat.NewEchoStep()
+	step.TimePerCharacter = 0
+	manager := conversations.NewBranchingManager(conversation.NewManager())
+	out := &bytes.Buffer{}
+	turns := 0
+
+	repl := NewREPL(step, manager,
+		WithREPLInput(strings.NewReader("hello\n\n/help\n//literal\n")),
+		WithREPLOutput(out, &bytes.Buffer{}),
+		WithREPLSlashCommands(NewSlashCommands()),
+		WithREPLOnTurn(func() { turns++ }),
+	)
+	require.NoError(t, repl.Run(context.Background()))
+
+	assert.Equal(t, []string{"hello", "hello", "/literal", "/literal"}, texts(manager.GetConversation()))
+	assert.Contains(t, out.String(), "/help")
+	assert.Equal(t, 3, turns)
+}
+
+func TestREPLDelimiter(t *testing.T) {
+	step := chat.NewEchoStep()
+	step.TimePerCharacter = 0
+	manager := conversations.NewBranchingManager(conversation.NewManager())
+
+	repl := NewREPL(step, manager,
+		WithREPLInput(strings.NewReader("first line\nsecond line\n.\nlast\nmessage")),
+		WithREPLOutput(&bytes.Buffer{}, &bytes.Buffer{}),
+		WithREPLDelimiter("."),
+	)
+	require.NoError(t, repl.Run(context.Background()))
+
+	assert.Equal(t, []string{
+		"first line\nsecond line", "first line\nsecond line",
+		"last\nmessage", "last\nmessage",
+	}, texts(manager.GetConversation()))
+}
@@ -0,0 +1,222 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"github.com/charmbracelet/bubbletea"
+	boba_chat "github.com/go-go-golems/bobatea/pkg/chat"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// SlashCommandFunc runs a slash command with the text following its name.
+//
+// It is called from the UI loop, so it can change the conversation directly. Slow work
+// should be returned as a tea.Cmd, which runs in the background while the chat waits for it,
+// and can send SlashCommandOutputMsg and InjectMessagesMsg back to the UI.
+type SlashCommandFunc func(ctx context.Context, args string) (tea.Cmd, error)
+
+type SlashCommand struct {
+	Name string
+	// Args describes the arguments, for example "<engine>"
+	Args  string
+	Short string
+	Run   SlashCommandFunc
+}
+
+// SlashCommandOutputMsg is shown below the conversation until the next key press.
+type SlashCommandOutputMsg struct {
+	Text string
+	Err  error
+}
+
+// InjectMessagesMsg appends messages to the current conversation, without starting a completion.
+type InjectMessagesMsg struct {
+	Messages []*conversation.Message
+}
+
+// Output returns a command that shows text below the conversation.
+func Output(text string) tea.Cmd {
+	return func() tea.Msg {
+		return SlashCommandOutputMsg{Text: text}
+	}
+}
+
+// Outputf is like Output, with a format string.
+func Outputf(format string, args ...interface{}) tea.Cmd {
+	return Output(fmt.Sprintf(format, args...))
+}
+
+// SlashCommands is a set of slash commands, which always includes /help.
+type SlashCommands struct {
+	commands map[string]*SlashCommand
+}
+
+func NewSlashCommands(commands ...*SlashCommand) *SlashCommands {
+	ret := &SlashCommands{
+		commands: map[string]*SlashCommand{},
+	}
+	ret.Add(&SlashCommand{
+		Name:  "help",
+		Short: "list the slash commands",
+		Run: func(ctx context.Context, args string) (tea.Cmd, error) {
+			return Output(ret.Help()), nil
+		},
+	})
+	ret.Add(commands...)
+	return ret
+}
+
+// Add registers commands, replacing the commands with the same name.
+func (s *SlashCommands) Add(commands ...*SlashCommand) {
+	for _, command := range commands {
+		s.commands[command.Name] = command
+	}
+}
+
+// Help lists the commands.
+func (s *SlashCommands) Help() string {
+	names := make([]string, 0, len(s.commands))
+	for name := range s.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{}
+	for _, name := range names {
+		command := s.commands[name]
+		usage := "/" + command.Name
+		if command.Args != "" {
+			usage += " " + command.Args
+		}
+		lines = append(lines, fmt.Sprintf("%-28s %s", usage, command.Short))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// IsSlashCommand returns true if text is a slash command, rather than a message
+// starting with two slashes.
+func IsSlashCommand(text string) bool {
+	return strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//")
+}
+
+// Run runs the slash command text, for example "/model gpt-4".
+func (s *SlashCommands) Run(ctx context.Context, text string) (tea.Cmd, error) {
+	name, args := strings.TrimSpace(strings.TrimPrefix(text, "/")), ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, args = name[:i], name[i:]
+	}
+	command, ok := s.commands[name]
+	if !ok {
+		return nil, errors.Errorf("unknown command /%s, /help lists the commands", name)
+	}
+	cmd, err := command.Run(ctx, strings.TrimSpace(args))
+	if err != nil {
+		return nil, errors.Wrapf(err, "/%s", name)
+	}
+	return cmd, nil
+}
+
+// SlashCommandBackend runs the user messages that start with a slash as slash commands,
+// and forwards the other messages to the wrapped backend. A message starting with two
+// slashes is sent with the first slash removed.
+type SlashCommandBackend struct {
+	boba_chat.Backend
+	manager  *conversations.BranchingManager
+	commands *SlashCommands
+
+	// running is true while the tea.Cmd returned by a slash command is running
+	running atomic.Bool
+	mutex   sync.Mutex
+	cancel  context.CancelFunc
+}
+
+var _ boba_chat.Backend = (*SlashCommandBackend)(nil)
+
+func NewSlashCommandBackend(
+	backend boba_chat.Backend,
+	manager *conversations.BranchingManager,
+	commands *SlashCommands,
+) *SlashCommandBackend {
+	return &SlashCommandBackend{
+		Backend:  backend,
+		manager:  manager,
+		commands: commands,
+	}
+}
+
+func (s *SlashCommandBackend) Start(ctx context.Context, msgs []*conversation.Message) (tea.Cmd, error) {
+	if len(msgs) == 0 {
+		return s.Backend.Start(ctx, msgs)
+	}
+	last := msgs[len(msgs)-1]
+	content, ok := last.Content.(*conversation.ChatMessageContent)
+	if !ok || content.Role != conversation.RoleUser || !strings.HasPrefix(content.Text, "/") {
+		return s.Backend.Start(ctx, msgs)
+	}
+	if !IsSlashCommand(content.Text) {
+		content.Text = content.Text[1:]
+		return s.Backend.Start(ctx, msgs)
+	}
+	if !s.IsFinished() {
+		return nil, errors.New("already running")
+	}
+
+	// the command itself is not part of the conversation
+	err := s.manager.Remove(last.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.mutex.Lock()
+	s.cancel = cancel
+	s.mutex.Unlock()
+	s.running.Store(true)
+
+	finished := func() tea.Msg {
+		cancel()
+		s.running.Store(false)
+		return boba_chat.BackendFinishedMsg{}
+	}
+
+	// errors are shown as output, as the chat waits for the backend to finish in any case
+	cmd, err := s.commands.Run(ctx, content.Text)
+	if err != nil {
+		cmd = func() tea.Msg {
+			return SlashCommandOutputMsg{Err: err}
+		}
+	}
+	if cmd == nil {
+		return finished, nil
+	}
+	return tea.Sequence(cmd, finished), nil
+}
+
+func (s *SlashCommandBackend) Interrupt() {
+	if s.running.Load() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.cancel()
+		return
+	}
+	s.Backend.Interrupt()
+}
+
+func (s *SlashCommandBackend) Kill() {
+	if s.running.Load() {
+		s.Interrupt()
+		return
+	}
+	s.Backend.Kill()
+}
+
+func (s *SlashCommandBackend) IsFinished() bool {
+	return !s.running.Load() && s.Backend.IsFinished()
+}
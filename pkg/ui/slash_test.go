@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"context"
+	"github.com/charmbracelet/bubbletea"
+	boba_chat "github.com/go-go-golems/bobatea/pkg/chat"
+	"github.com/go-go-golems/bobatea/pkg/conversation"
+	"github.com/go-go-golems/geppetto/pkg/conversations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+type recordingBackend struct {
+	started []conversation.Conversation
+}
+
+func (r *recordingBackend) Start(ctx context.Context, msgs []*conversation.Message) (tea.Cmd, error) {
+	r.started = append(r.started, msgs)
+	return nil, nil
+}
+
+func (r *recordingBackend) Interrupt()       {}
+func (r *recordingBackend) Kill()            {}
+func (r *recordingBackend) IsFinished() bool { return true }
+
+// sequenceMsgs runs cmd, and the commands of the tea.Sequence it returns, and returns their messages.
+func sequenceMsgs(cmd tea.Cmd) []tea.Msg {
+	msg := cmd()
+	// tea.Sequence returns an unexported slice of commands
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Slice || v.Type().Elem() != reflect.TypeOf(cmd) {
+		return []tea.Msg{msg}
+	}
+	ret := []tea.Msg{}
+	for i := 0; i < v.Len(); i++ {
+		ret = append(ret, sequenceMsgs(v.Index(i).Interface().(tea.Cmd))...)
+	}
+	return ret
+}
+
+func TestSlashCommandBackend(t *testing.T) {
+	manager := conversations.NewBranchingManager(conversation.NewManager())
+	backend := &recordingBackend{}
+	echoed := ""
+	slash := NewSlashCommandBackend(backend, manager, NewSlashCommands(&SlashCommand{
+		Name: "echo",
+		Run: func(ctx context.Context, args string) (tea.Cmd, error) {
+			echoed = args
+			return Output(args), nil
+		},
+	}))
+
+	manager.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "hello"))
+	_, err := slash.Start(context.Background(), manager.GetConversation())
+	require.NoError(t, err)
+	require.Len(t, backend.started, 1)
+
+	manager.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "/echo  some text"))
+	cmd, err := slash.Start(context.Background(), manager.GetConversation())
+	require.NoError(t, err)
+	assert.False(t, slash.IsFinished())
+	assert.Equal(t, "some text", echoed)
+	// the command is not kept in the conversation
+	assert.Len(t, manager.GetConversation(), 1)
+	assert.Len(t, backend.started, 1)
+
+	msgs := sequenceMsgs(cmd)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, SlashCommandOutputMsg{Text: "some text"}, msgs[0])
+	assert.Equal(t, boba_chat.BackendFinishedMsg{}, msgs[1])
+	assert.True(t, slash.IsFinished())
+
+	manager.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "/unknown"))
+	cmd, err = slash.Start(context.Background(), manager.GetConversation())
+	require.NoError(t, err)
+	msgs = sequenceMsgs(cmd)
+	require.Len(t, msgs, 2)
+	assert.Error(t, msgs[0].(SlashCommandOutputMsg).Err)
+
+	manager.AppendMessages(conversation.NewChatMessage(conversation.RoleUser, "//echo is sent"))
+	_, err = slash.Start(context.Background(), manager.GetConversation())
+	require.NoError(t, err)
+	require.Len(t, backend.started, 2)
+	last := backend.started[1][len(backend.started[1])-1]
+	assert.Equal(t, "/echo is sent", last.Content.(*conversation.ChatMessageContent).Text)
+}